@@ -0,0 +1,220 @@
+// エディタなどのツール向けにASTを静的に解析するパッケージ
+package analysis
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// 型を推論できなかった式に付ける型
+const UNKNOWN = "UNKNOWN"
+
+// 戻り値の型が引数によらず決まる組み込み関数
+var builtinReturnTypes = map[string]string{
+	"len":       object.INTEGER_OBJ,
+	"rest":      object.ARRAY_OBJ,
+	"push":      object.ARRAY_OBJ,
+	"transpose": object.ARRAY_OBJ,
+}
+
+// プログラム中の各式が評価されるとどの型のオブジェクトになるかを推論する
+// 推論する型はINTEGER・STRING・ARRAY・FUNCTIONのいずれかで、推論できなければUNKNOWNとなる
+// リテラル、戻り値の型が決まっている組み込み関数、let文で束縛した変数、
+// 被演算子の型から決まる演算の結果を手がかりにする最善努力の推論で、健全性は保証しない
+// 戻り値のmapはプログラム中のすべての式をキーに持つ
+func TypeHints(program *ast.Program) map[ast.Node]string {
+	h := &hinter{types: map[ast.Node]string{}, scope: newScope(nil)}
+	ast.Walk(h, program)
+	return h.types
+}
+
+// 変数の型を保持するスコープ
+// ifやforのブロックはスコープを作らないので、関数ごとに一つ作る
+type scope struct {
+	vars  map[string]string
+	outer *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{vars: map[string]string{}, outer: outer}
+}
+
+// 変数の型を返す
+// 変数が見つからなければ組み込み関数かどうかで判断する
+func (s *scope) lookup(name string) string {
+	for ; s != nil; s = s.outer {
+		if t, ok := s.vars[name]; ok {
+			return t
+		}
+	}
+	if object.GetBuiltinByName(name) != nil {
+		return object.FUNCTION_OBJ
+	}
+	return UNKNOWN
+}
+
+// 代入された値の型で変数の型を更新する
+// 代入前後で型が変わる変数は型を決められないのでUNKNOWNにする
+func (s *scope) assign(name string, t string) {
+	for ; s != nil; s = s.outer {
+		if old, ok := s.vars[name]; ok {
+			if old != t {
+				s.vars[name] = UNKNOWN
+			}
+			return
+		}
+	}
+}
+
+type hinter struct {
+	types map[ast.Node]string
+	scope *scope
+}
+
+// 文を走査して、let文の束縛と式の型を記録する
+// 式はexpressionで子ノードまで処理するので、その先は走査しない
+func (h *hinter) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.LetStatement:
+		h.define(n.Name, h.expression(n.Value))
+		return nil
+	case *ast.ConstStatement:
+		h.define(n.Name, h.expression(n.Value))
+		return nil
+	case *ast.DestructuringLetStatement:
+		h.expression(n.Value)
+		for _, name := range n.Names {
+			h.define(name, UNKNOWN)
+		}
+		return nil
+	case ast.Expression:
+		h.expression(n)
+		return nil
+	case nil:
+		return nil
+	}
+	return h
+}
+
+// 変数を現在のスコープに束縛し、その識別子の型を記録する
+func (h *hinter) define(name *ast.Identifier, t string) {
+	h.scope.vars[name.Value] = t
+	h.types[name] = t
+}
+
+// 式の型を推論して記録する
+func (h *hinter) expression(e ast.Expression) string {
+	if e == nil {
+		return UNKNOWN
+	}
+	t := h.infer(e)
+	h.types[e] = t
+	return t
+}
+
+func (h *hinter) infer(e ast.Expression) string {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return object.INTEGER_OBJ
+	case *ast.StringLiteral:
+		return object.STRING_OBJ
+	case *ast.ArrayLiteral:
+		for _, el := range e.Elements {
+			h.expression(el)
+		}
+		return object.ARRAY_OBJ
+	case *ast.FunctionLiteral:
+		h.scope = newScope(h.scope)
+		for _, p := range e.Parameters {
+			h.define(p, UNKNOWN)
+		}
+		ast.Walk(h, e.Body)
+		h.scope = h.scope.outer
+		return object.FUNCTION_OBJ
+	case *ast.Identifier:
+		return h.scope.lookup(e.Value)
+	case *ast.PrefixExpression:
+		right := h.expression(e.Right)
+		if e.Operator == "-" && right == object.INTEGER_OBJ {
+			return object.INTEGER_OBJ
+		}
+		return UNKNOWN
+	case *ast.InfixExpression:
+		left := h.expression(e.Left)
+		right := h.expression(e.Right)
+		return infixType(e.Operator, left, right)
+	case *ast.AssignExpression:
+		t := h.expression(e.Value)
+		h.types[e.Name] = t
+		h.scope.assign(e.Name.Value, t)
+		return t
+	case *ast.SliceExpression:
+		left := h.expression(e.Left)
+		h.expression(e.Low)
+		h.expression(e.High)
+		if left == object.STRING_OBJ || left == object.ARRAY_OBJ {
+			return left
+		}
+		return UNKNOWN
+	case *ast.PropagateErrorExpression:
+		// エラーであれば関数から返るので、値は内側の式と同じ型になる
+		return h.expression(e.Inner)
+	case *ast.CallExpression:
+		h.expression(e.Function)
+		for _, arg := range e.Arguments {
+			h.expression(arg)
+		}
+		if ident, ok := e.Function.(*ast.Identifier); ok {
+			if !h.defined(ident.Value) {
+				if t, ok := builtinReturnTypes[ident.Value]; ok {
+					return t
+				}
+			}
+		}
+		return UNKNOWN
+	}
+
+	// その他の式は子ノードだけを走査する
+	ast.Walk(children{h: h, parent: e}, e)
+	return UNKNOWN
+}
+
+// 組み込み関数と同名の変数がスコープに定義されているかを返す
+func (h *hinter) defined(name string) bool {
+	for s := h.scope; s != nil; s = s.outer {
+		if _, ok := s.vars[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 中置演算の結果の型を被演算子の型から決める
+func infixType(operator, left, right string) string {
+	switch {
+	case left == object.INTEGER_OBJ && right == object.INTEGER_OBJ:
+		switch operator {
+		case "+", "-", "*", "/", "%":
+			return object.INTEGER_OBJ
+		}
+	case left == object.STRING_OBJ && right == object.STRING_OBJ:
+		if operator == "+" {
+			return object.STRING_OBJ
+		}
+	}
+	return UNKNOWN
+}
+
+// parentの子ノードをhinterで走査するVisitor
+// ast.Walkはまずparent自身を訪れるので、parentだけは読み飛ばす
+type children struct {
+	h      *hinter
+	parent ast.Node
+}
+
+func (c children) Visit(node ast.Node) ast.Visitor {
+	if node == c.parent {
+		return c
+	}
+	return c.h.Visit(node)
+}
@@ -0,0 +1,103 @@
+package analysis
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+// 最後の文の式に推論された型をテスト
+func TestTypeHints(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5", "INTEGER"},
+		{`"a" + "b"`, "STRING"},
+		{"1 + 2 * -3", "INTEGER"},
+		{`1 + "a"`, "UNKNOWN"},
+		{"1 < 2", "UNKNOWN"},
+		{"[1, 2]", "ARRAY"},
+		{"fn(x) { x }", "FUNCTION"},
+		{"let x = 5; x", "INTEGER"},
+		{"let x = 5; let y = x * 2; y", "INTEGER"},
+		{`let s = "a"; s + s`, "STRING"},
+		{"len", "FUNCTION"},
+		{"len([1, 2])", "INTEGER"},
+		{"push([], 1)", "ARRAY"},
+		{`let len = fn(x) { "s" }; len([1])`, "UNKNOWN"},
+		{"first([1])", "UNKNOWN"},
+		{`"abc"[1:]`, "STRING"},
+		{"let f = fn(x) { x }; f(1)", "UNKNOWN"},
+		{"unknown", "UNKNOWN"},
+		{"let x = 1; x = 2; x", "INTEGER"},
+		{`let x = 1; x = "a"; x`, "UNKNOWN"},
+		{"let [a, b] = [1, 2]; a", "UNKNOWN"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		types := TypeHints(program)
+		last := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement).Expression
+		if got := types[last]; got != tt.expected {
+			t.Errorf("wrong type for %q. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// let文で束縛した識別子や、関数やifの中の式にも型が付くことをテスト
+func TestTypeHintsNestedExpressions(t *testing.T) {
+	program := parse(t, `let x = 5; let f = fn(p) { if (p) { let s = "x" + "y"; [s] } }`)
+	types := TypeHints(program)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	if got := types[let.Name]; got != "INTEGER" {
+		t.Errorf("wrong type for x. want=INTEGER, got=%s", got)
+	}
+
+	expected := map[string]string{
+		"(x + y)": "STRING",
+		"[s]":     "ARRAY",
+		"s":       "STRING",
+		"p":       "UNKNOWN",
+	}
+	found := map[string]bool{}
+	ast.Inspect(program.Statements[1], func(n ast.Node) bool {
+		if _, ok := n.(ast.Expression); !ok {
+			return n != nil
+		}
+		if want, ok := expected[n.String()]; ok {
+			found[n.String()] = true
+			if got := types[n]; got != want {
+				t.Errorf("wrong type for %s. want=%s, got=%s", n.String(), want, got)
+			}
+		}
+		return true
+	})
+	for s := range expected {
+		if !found[s] {
+			t.Errorf("expression %s not found", s)
+		}
+	}
+
+	// すべての式に型が付いている
+	ast.Inspect(program, func(n ast.Node) bool {
+		if e, ok := n.(ast.Expression); ok {
+			if _, ok := types[e]; !ok {
+				t.Errorf("no type for %T (%s)", e, e.String())
+			}
+		}
+		return true
+	})
+}
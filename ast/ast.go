@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"monkey/token"
+	"sort"
 	"strings"
 )
 
@@ -10,8 +11,12 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Position() Pos // ソースコード上でノードが始まる位置
 }
 
+// ソースコード上の位置
+type Pos = token.Pos
+
 // 文ノード: 値を返さない
 type Statement interface {
 	Node
@@ -27,7 +32,9 @@ type Expression interface {
 // -----------------------------------------------------
 // プログラムを表すASTノード: 文の集合
 type Program struct {
-	Statements []Statement
+	NodePos          Pos // 最初のトークンの位置
+	Statements       []Statement
+	TrailingComments []token.Token // 最後の文より後にあるコメント
 }
 
 func (p *Program) String() string {
@@ -38,6 +45,8 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+func (p *Program) Position() Pos { return p.NodePos }
+
 func (p *Program) TokenLiteral() string {
 	if len(p.Statements) > 0 {
 		return p.Statements[0].TokenLiteral()
@@ -53,13 +62,16 @@ func (p *Program) TokenLiteral() string {
 // let <identifier> = <expression>;
 // let x = 5;
 type LetStatement struct {
-	Token token.Token // token.LET = "let"
-	Name  *Identifier // x
-	Value Expression  // 5
+	Token    token.Token   // token.LET = "let"
+	NodePos  Pos           // Tokenのソースコード上の位置
+	Name     *Identifier   // x
+	Value    Expression    // 5
+	Comments []token.Token // 文の直前にあるコメント
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Position() Pos        { return ls.NodePos }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
@@ -74,16 +86,81 @@ func (ls *LetStatement) String() string {
 
 // -----------------------------------------------------
 
+// -----------------------------------------------------
+// CONST文を表すASTノード
+// const <identifier> = <expression>;
+// const x = 5;
+// LET文と同じだが、束縛した名前には再宣言も代入もできない
+type ConstStatement struct {
+	Token    token.Token   // token.CONST = "const"
+	NodePos  Pos           // Tokenのソースコード上の位置
+	Name     *Identifier   // x
+	Value    Expression    // 5
+	Comments []token.Token // 文の直前にあるコメント
+}
+
+func (cs *ConstStatement) statementNode()       {}
+func (cs *ConstStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ConstStatement) Position() Pos        { return cs.NodePos }
+func (cs *ConstStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(cs.TokenLiteral() + " ")
+	out.WriteString(cs.Name.String())
+	out.WriteString(" = ")
+	if cs.Value != nil {
+		out.WriteString(cs.Value.String())
+	}
+	out.WriteString(";")
+	return out.String() // "const x = 5;"
+}
+
+// -----------------------------------------------------
+
+// -----------------------------------------------------
+// 配列を分割して束縛するLET文を表すASTノード
+// let [<identifier>, <identifier>, ...] = <expression>;
+// let [x, y] = [1, 2];
+type DestructuringLetStatement struct {
+	Token    token.Token   // token.LET = "let"
+	NodePos  Pos           // Tokenのソースコード上の位置
+	Names    []*Identifier // x, y
+	Value    Expression    // [1, 2]
+	Comments []token.Token // 文の直前にあるコメント
+}
+
+func (ds *DestructuringLetStatement) statementNode()       {}
+func (ds *DestructuringLetStatement) TokenLiteral() string { return ds.Token.Literal }
+func (ds *DestructuringLetStatement) Position() Pos        { return ds.NodePos }
+func (ds *DestructuringLetStatement) String() string {
+	var out bytes.Buffer
+	names := []string{}
+	for _, n := range ds.Names {
+		names = append(names, n.String())
+	}
+	out.WriteString(ds.TokenLiteral() + " [")
+	out.WriteString(strings.Join(names, ", "))
+	out.WriteString("] = ")
+	if ds.Value != nil {
+		out.WriteString(ds.Value.String())
+	}
+	out.WriteString(";")
+	return out.String() // "let [x, y] = [1, 2];"
+}
+
+// -----------------------------------------------------
+
 // -----------------------------------------------------
 // 識別子を表すASTノード
 // 「let x = 5;」における「x」
 type Identifier struct {
-	Token token.Token // token.IDENT
-	Value string      // x
+	Token   token.Token // token.IDENT
+	NodePos Pos         // Tokenのソースコード上の位置
+	Value   string      // x
 }
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Position() Pos        { return i.NodePos }
 func (i *Identifier) String() string       { return i.Value }
 
 // -----------------------------------------------------
@@ -93,12 +170,15 @@ func (i *Identifier) String() string       { return i.Value }
 // return <expression>;
 // return 5;
 type ReturnStatement struct {
-	Token       token.Token // token.RETURN = "return"
-	ReturnValue Expression  // 5
+	Token       token.Token   // token.RETURN = "return"
+	NodePos     Pos           // Tokenのソースコード上の位置
+	ReturnValue Expression    // 5
+	Comments    []token.Token // 文の直前にあるコメント
 }
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Position() Pos        { return rs.NodePos }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(rs.TokenLiteral() + " ")
@@ -118,11 +198,14 @@ func (rs *ReturnStatement) String() string {
 // x + 10; <- これ
 type ExpressionStatement struct {
 	Token      token.Token // 式の最初のトークン
+	NodePos    Pos         // Tokenのソースコード上の位置
 	Expression Expression
+	Comments   []token.Token // 文の直前にあるコメント
 }
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Position() Pos        { return es.NodePos }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -136,16 +219,34 @@ func (es *ExpressionStatement) String() string {
 // 整数リテラルを表すASTノード(整数値も式)
 // 5
 type IntegerLiteral struct {
-	Token token.Token // token.INT = int
-	Value int64       // 5
+	Token   token.Token // token.INT = int
+	NodePos Pos         // Tokenのソースコード上の位置
+	Value   int64       // 5
 }
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Position() Pos        { return il.NodePos }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
 // -----------------------------------------------------
 
+// -----------------------------------------------------
+// 浮動小数点数リテラルを表すASTノード
+// 1.5
+type FloatLiteral struct {
+	Token   token.Token // token.FLOAT
+	NodePos Pos         // Tokenのソースコード上の位置
+	Value   float64     // 1.5
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Position() Pos        { return fl.NodePos }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
+// -----------------------------------------------------
+
 // -----------------------------------------------------
 // 前置演算子を表すASTノード
 // <prefix operator> <expression>;
@@ -153,12 +254,14 @@ func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 // -5
 type PrefixExpression struct {
 	Token    token.Token // 前置トークン
+	NodePos  Pos         // Tokenのソースコード上の位置
 	Operator string      // 「!」「-」のどちらか
 	Right    Expression  // 前置演算子の右隣に来る式を表現するASTノード
 }
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Position() Pos        { return pe.NodePos }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -176,6 +279,7 @@ func (pe *PrefixExpression) String() string {
 // 5 + 5
 type InfixExpression struct {
 	Token    token.Token // 演算子トークン
+	NodePos  Pos         // Tokenのソースコード上の位置
 	Left     Expression  // 5
 	Operator string      // *
 	Right    Expression  // 5
@@ -183,38 +287,84 @@ type InfixExpression struct {
 
 func (oe *InfixExpression) expressionNode()      {}
 func (oe *InfixExpression) TokenLiteral() string { return oe.Token.Literal }
+func (oe *InfixExpression) Position() Pos        { return oe.NodePos }
 func (oe *InfixExpression) String() string {
 	var out bytes.Buffer
-	// out.WriteString("(")
+	out.WriteString("(")
 	out.WriteString(oe.Left.String())
 	out.WriteString(" " + oe.Operator + " ")
 	out.WriteString(oe.Right.String())
-	// out.WriteString(")")
+	out.WriteString(")")
 	return out.String() // "(5 * 5)"
 }
 
 // -----------------------------------------------------
 
+// -----------------------------------------------------
+// 代入式を表すASTノード
+// <identifier> = <expression>
+// x = 5
+// 代入した値が式の値になる
+type AssignExpression struct {
+	Token   token.Token // '=' トークン
+	NodePos Pos         // Tokenのソースコード上の位置
+	Name    *Identifier // x
+	Value   Expression  // 5
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Position() Pos        { return ae.NodePos }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ae.Name.String())
+	out.WriteString(" = ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+	return out.String() // "(x = 5)"
+}
+
+// -----------------------------------------------------
+
 // -----------------------------------------------------
 // BOOLEAN型のトークンを表すASTノード
 // false
 type Boolean struct {
-	Token token.Token
-	Value bool
+	Token   token.Token
+	NodePos Pos // Tokenのソースコード上の位置
+	Value   bool
 }
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Position() Pos        { return b.NodePos }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
 // -----------------------------------------------------
 
+// -----------------------------------------------------
+// NULLリテラルを表すASTノード
+// null
+type NullLiteral struct {
+	Token   token.Token // token.NULL = "null"
+	NodePos Pos         // Tokenのソースコード上の位置
+}
+
+func (n *NullLiteral) expressionNode()      {}
+func (n *NullLiteral) TokenLiteral() string { return n.Token.Literal }
+func (n *NullLiteral) Position() Pos        { return n.NodePos }
+func (n *NullLiteral) String() string       { return n.Token.Literal }
+
+// -----------------------------------------------------
+
 // -----------------------------------------------------
 // IF文を表すASTノード
 // if ( <condition> ) <consequence> else <alternative>
 // if(x < y) { return x; } else { return y; }
 type IfExpression struct {
 	Token       token.Token     // 'if' トークン
+	NodePos     Pos             // Tokenのソースコード上の位置
 	Condition   Expression      // x < y
 	Consequence *BlockStatement // return x;
 	Alternative *BlockStatement // return y;
@@ -222,6 +372,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Position() Pos        { return ie.NodePos }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("if")
@@ -237,16 +388,68 @@ func (ie *IfExpression) String() string {
 
 // -----------------------------------------------------
 
+// -----------------------------------------------------
+// SWITCH式を表すASTノード
+// switch <subject> { case <value>: <body> ... default: <body> }
+// switch x { case 1: "one"; case 2: "two"; default: "many" }
+type SwitchExpression struct {
+	Token   token.Token     // 'switch' トークン
+	NodePos Pos             // Tokenのソースコード上の位置
+	Subject Expression      // x
+	Cases   []*CaseClause   // case 1: "one"; case 2: "two";
+	Default *BlockStatement // "many"（default節がなければnil）
+}
+
+func (se *SwitchExpression) expressionNode()      {}
+func (se *SwitchExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SwitchExpression) Position() Pos        { return se.NodePos }
+func (se *SwitchExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("switch ")
+	out.WriteString(se.Subject.String())
+	out.WriteString(" {")
+	for _, c := range se.Cases {
+		out.WriteString(" ")
+		out.WriteString(c.String())
+	}
+	if se.Default != nil {
+		out.WriteString(" default: ")
+		out.WriteString(se.Default.String())
+	}
+	out.WriteString(" }")
+	return out.String()
+}
+
+// SWITCH式のcase節を表すASTノード
+// case <value>: <body>
+type CaseClause struct {
+	Token   token.Token     // 'case' トークン
+	NodePos Pos             // Tokenのソースコード上の位置
+	Value   Expression      // 1
+	Body    *BlockStatement // "one";
+}
+
+func (cc *CaseClause) TokenLiteral() string { return cc.Token.Literal }
+func (cc *CaseClause) Position() Pos        { return cc.NodePos }
+func (cc *CaseClause) String() string {
+	return "case " + cc.Value.String() + ": " + cc.Body.String()
+}
+
+// -----------------------------------------------------
+
 // -----------------------------------------------------
 // ブロック文を表すASTノード
 // ブロックは複数の文で成る
 type BlockStatement struct {
-	Token      token.Token // '{' トークン
-	Statements []Statement
+	Token            token.Token // '{' トークン
+	NodePos          Pos         // Tokenのソースコード上の位置
+	Statements       []Statement
+	TrailingComments []token.Token // 最後の文より後、「}」の前にあるコメント
 }
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Position() Pos        { return bs.NodePos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 	for _, s := range bs.Statements {
@@ -259,18 +462,159 @@ func (bs *BlockStatement) String() string {
 
 // -----------------------------------------------------
 
+// -----------------------------------------------------
+// FOR文を表すASTノード
+// for ( <init>; <condition>; <post> ) <body>
+// for (let i = 0; i < 10; i = i + 1) { puts(i); }
+// <init>、<condition>、<post>はいずれも省略できる
+type ForStatement struct {
+	Token     token.Token     // 'for' トークン
+	NodePos   Pos             // Tokenのソースコード上の位置
+	Init      Statement       // let i = 0;
+	Condition Expression      // i < 10
+	Post      Expression      // i = i + 1
+	Body      *BlockStatement // puts(i);
+	Comments  []token.Token   // 文の直前にあるコメント
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Position() Pos        { return fs.NodePos }
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("for (")
+	if fs.Init != nil {
+		out.WriteString(fs.Init.String()) // LET文の文字列表現は「;」で終わる
+	} else {
+		out.WriteString(";")
+	}
+	out.WriteString(" ")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+	if fs.Post != nil {
+		out.WriteString(fs.Post.String())
+	}
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+	return out.String() // "for (let i = 0; (i < 10); puts(i)) let i = (i + 1);"
+}
+
+// -----------------------------------------------------
+
+// -----------------------------------------------------
+// WHILE文を表すASTノード
+// while ( <condition> ) <body>
+// while (i < 10) { i = i + 1; }
+type WhileStatement struct {
+	Token     token.Token     // 'while' トークン
+	NodePos   Pos             // Tokenのソースコード上の位置
+	Condition Expression      // i < 10
+	Body      *BlockStatement // i = i + 1;
+	Comments  []token.Token   // 文の直前にあるコメント
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Position() Pos        { return ws.NodePos }
+func (ws *WhileStatement) String() string {
+	return "while " + ws.Condition.String() + " " + ws.Body.String()
+}
+
+// -----------------------------------------------------
+
+// -----------------------------------------------------
+// TRY文を表すASTノード
+// try <try> catch ( <errName> ) <catch>
+// try { 10 / x } catch (e) { puts(e.message); 0 }
+type TryCatchStatement struct {
+	Token    token.Token     // 'try' トークン
+	NodePos  Pos             // Tokenのソースコード上の位置
+	Try      *BlockStatement // 10 / x
+	ErrName  *Identifier     // e
+	Catch    *BlockStatement // puts(e.message); 0
+	Comments []token.Token   // 文の直前にあるコメント
+}
+
+func (ts *TryCatchStatement) statementNode()       {}
+func (ts *TryCatchStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *TryCatchStatement) Position() Pos        { return ts.NodePos }
+func (ts *TryCatchStatement) String() string {
+	return "try " + ts.Try.String() + " catch (" + ts.ErrName.String() + ") " + ts.Catch.String()
+}
+
+// -----------------------------------------------------
+
+// -----------------------------------------------------
+// DEFER文を表すASTノード
+// 関数呼び出しの評価を、それを囲む関数から返るときまで遅らせる
+// defer <call expression>;
+// defer puts("done");
+type DeferStatement struct {
+	Token    token.Token   // 'defer' トークン
+	NodePos  Pos           // Tokenのソースコード上の位置
+	Call     Expression    // puts("done")
+	Comments []token.Token // 文の直前にあるコメント
+}
+
+func (ds *DeferStatement) statementNode()       {}
+func (ds *DeferStatement) TokenLiteral() string { return ds.Token.Literal }
+func (ds *DeferStatement) Position() Pos        { return ds.NodePos }
+func (ds *DeferStatement) String() string {
+	return ds.TokenLiteral() + " " + ds.Call.String() + ";"
+}
+
+// -----------------------------------------------------
+
+// -----------------------------------------------------
+// BREAK文を表すASTノード
+// 最も内側のループを抜ける
+// break;
+type BreakStatement struct {
+	Token    token.Token   // 'break' トークン
+	NodePos  Pos           // Tokenのソースコード上の位置
+	Comments []token.Token // 文の直前にあるコメント
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Position() Pos        { return bs.NodePos }
+func (bs *BreakStatement) String() string       { return bs.TokenLiteral() + ";" }
+
+// -----------------------------------------------------
+
+// -----------------------------------------------------
+// CONTINUE文を表すASTノード
+// 最も内側のループの次の繰り返しに移る
+// continue;
+type ContinueStatement struct {
+	Token    token.Token   // 'continue' トークン
+	NodePos  Pos           // Tokenのソースコード上の位置
+	Comments []token.Token // 文の直前にあるコメント
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Position() Pos        { return cs.NodePos }
+func (cs *ContinueStatement) String() string       { return cs.TokenLiteral() + ";" }
+
+// -----------------------------------------------------
+
 // -----------------------------------------------------
 // 関数リテラルを表すASTノード
 // fn <parameters> <block statement>
 // fn(x, y) { x + y; }
 type FunctionLiteral struct {
 	Token      token.Token     // 'fn' トークン
+	NodePos    Pos             // Tokenのソースコード上の位置
 	Parameters []*Identifier   // x, y
 	Body       *BlockStatement // x + y;
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Position() Pos        { return fl.NodePos }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	params := []string{}
@@ -287,6 +631,36 @@ func (fl *FunctionLiteral) String() string {
 
 // -----------------------------------------------------
 
+// -----------------------------------------------------
+// マクロリテラルを表すASTノード
+// macro <parameters> <block statement>
+// macro(x, y) { quote(unquote(y) - unquote(x)); }
+type MacroLiteral struct {
+	Token      token.Token     // 'macro' トークン
+	NodePos    Pos             // Tokenのソースコード上の位置
+	Parameters []*Identifier   // x, y
+	Body       *BlockStatement // quote(unquote(y) - unquote(x));
+}
+
+func (ml *MacroLiteral) expressionNode()      {}
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) Position() Pos        { return ml.NodePos }
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+	return out.String()
+}
+
+// -----------------------------------------------------
+
 // -----------------------------------------------------
 // 関数呼び出し式を表すASTノード
 // <expression> ( <comma separated expressions> )
@@ -294,12 +668,14 @@ func (fl *FunctionLiteral) String() string {
 // fn(x, y) { x + y }(2, 3)
 type CallExpression struct {
 	Token     token.Token // '(' トークン
+	NodePos   Pos         // Tokenのソースコード上の位置
 	Function  Expression  // Identifier または FunctionLiteral
 	Arguments []Expression
 }
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Position() Pos        { return ce.NodePos }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 	args := []string{}
@@ -321,12 +697,14 @@ func (ce *CallExpression) String() string {
 // <sequence of characters>
 // "hello world"
 type StringLiteral struct {
-	Token token.Token
-	Value string
+	Token   token.Token
+	NodePos Pos // Tokenのソースコード上の位置
+	Value   string
 }
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Position() Pos        { return sl.NodePos }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
 // -----------------------------------------------------
@@ -337,11 +715,13 @@ func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 // ["hello", 123, fn(name) = { return "Hi there, " + name; }];
 type ArrayLiteral struct {
 	Token    token.Token // '[' トークン
+	NodePos  Pos         // Tokenのソースコード上の位置
 	Elements []Expression
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Position() Pos        { return al.NodePos }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 	elements := []string{}
@@ -356,19 +736,38 @@ func (al *ArrayLiteral) String() string {
 
 // -----------------------------------------------------
 
+// -----------------------------------------------------
+// 配列リテラルの要素として別の配列を展開するスプレッド要素を表すASTノード
+// ... <expression>
+// [1, ...rest, 4]
+type SpreadElement struct {
+	Token      token.Token // '...' トークン
+	NodePos    Pos         // Tokenのソースコード上の位置
+	Expression Expression  // rest
+}
+
+func (se *SpreadElement) expressionNode()      {}
+func (se *SpreadElement) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadElement) Position() Pos        { return se.NodePos }
+func (se *SpreadElement) String() string       { return "..." + se.Expression.String() }
+
+// -----------------------------------------------------
+
 // -----------------------------------------------------
 // 添字演算子式を表すASTノード
 // <expression> [ <expression> ]
 // myArray[3]
 // [1, 2, 3, 4][3] => 4
 type IndexExpression struct {
-	Token token.Token // '[' トークン
-	Left  Expression
-	Index Expression
+	Token   token.Token // '[' トークン
+	NodePos Pos         // Tokenのソースコード上の位置
+	Left    Expression
+	Index   Expression
 }
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Position() Pos        { return ie.NodePos }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -382,21 +781,157 @@ func (ie *IndexExpression) String() string {
 
 // -----------------------------------------------------
 
+// -----------------------------------------------------
+// エラーを伝える後置演算子?を表すASTノード
+// <expression> ?
+// 式の値がエラーであれば、それを囲む関数からただちに返す
+// parse(input)? + 1
+type PropagateErrorExpression struct {
+	Token   token.Token // '?' トークン
+	NodePos Pos         // Tokenのソースコード上の位置
+	Inner   Expression  // parse(input)
+}
+
+func (pe *PropagateErrorExpression) expressionNode()      {}
+func (pe *PropagateErrorExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PropagateErrorExpression) Position() Pos        { return pe.NodePos }
+func (pe *PropagateErrorExpression) String() string {
+	return "(" + pe.Inner.String() + "?)"
+}
+
+// -----------------------------------------------------
+
+// -----------------------------------------------------
+// IMPORT式を表すASTノード
+// import <string literal>
+// 読み込んだモジュールを値として返すので、式として扱う
+// let io = import "io";
+type ImportExpression struct {
+	Token   token.Token    // 'import' トークン
+	NodePos Pos            // Tokenのソースコード上の位置
+	Path    *StringLiteral // "io"
+}
+
+func (ie *ImportExpression) expressionNode()      {}
+func (ie *ImportExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *ImportExpression) Position() Pos        { return ie.NodePos }
+func (ie *ImportExpression) String() string {
+	return ie.TokenLiteral() + " \"" + ie.Path.Value + "\""
+}
+
+// -----------------------------------------------------
+
+// -----------------------------------------------------
+// スライス式を表すASTノード
+// <expression> [ <expression>? : <expression>? ]
+// myArray[1:3]
+// "hello"[:2] => "he"
+type SliceExpression struct {
+	Token   token.Token // '[' トークン
+	NodePos Pos         // Tokenのソースコード上の位置
+	Left    Expression
+	Low     Expression // 省略された場合はnil
+	High    Expression // 省略された場合はnil
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) Position() Pos        { return se.NodePos }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString("]")
+	out.WriteString(")")
+	return out.String()
+}
+
+// -----------------------------------------------------
+
+// -----------------------------------------------------
+// タプルリテラルを表すASTノード
+// ( <expression>, <sequence of Expressions> )
+// (1, "two", 3)
+// (1,) 要素が一つの場合はコンマが必要
+type TupleLiteral struct {
+	Token    token.Token // '(' トークン
+	NodePos  Pos         // Tokenのソースコード上の位置
+	Elements []Expression
+}
+
+func (tl *TupleLiteral) expressionNode()      {}
+func (tl *TupleLiteral) TokenLiteral() string { return tl.Token.Literal }
+func (tl *TupleLiteral) Position() Pos        { return tl.NodePos }
+func (tl *TupleLiteral) String() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, el := range tl.Elements {
+		elements = append(elements, el.String())
+	}
+	out.WriteString("(")
+	out.WriteString(strings.Join(elements, ", "))
+	if len(tl.Elements) == 1 {
+		out.WriteString(",")
+	}
+	out.WriteString(")")
+	return out.String()
+}
+
+// -----------------------------------------------------
+
+// -----------------------------------------------------
+// 集合リテラルを表すASTノード
+// #{ <sequence of Expressions> }
+// #{1, 2, 3}
+type SetLiteral struct {
+	Token    token.Token // '#{' トークン
+	NodePos  Pos         // Tokenのソースコード上の位置
+	Elements []Expression
+}
+
+func (sl *SetLiteral) expressionNode()      {}
+func (sl *SetLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *SetLiteral) Position() Pos        { return sl.NodePos }
+func (sl *SetLiteral) String() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, el := range sl.Elements {
+		elements = append(elements, el.String())
+	}
+	out.WriteString("#{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// -----------------------------------------------------
+
 // -----------------------------------------------------
 // ハッシュリテラルを表すASTノード
 // { <expression> : <expression>, <expression> : <expression>, ... }
 type HashLiteral struct {
-	Token token.Token // '{' トークン
-	Pairs map[Expression]Expression
+	Token   token.Token // '{' トークン
+	NodePos Pos         // Tokenのソースコード上の位置
+	Pairs   map[Expression]Expression
+	Keys    []Expression // Pairsのキーをソース上に現れた順に並べたもの
 }
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Position() Pos        { return hl.NodePos }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+": "+value.String())
+	for _, key := range hl.OrderedKeys() {
+		pairs = append(pairs, key.String()+": "+hl.Pairs[key].String())
 	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
@@ -404,4 +939,21 @@ func (hl *HashLiteral) String() string {
 	return out.String()
 }
 
+// Pairsのキーを決まった順序で返す
+// mapの走査順は不定なので、ソース上の出現順を記録したKeysを使う
+// Keysが記録されていない場合（パーサを経ずに組み立てたノードなど）はキーの文字列表現でソートした順序を返す
+func (hl *HashLiteral) OrderedKeys() []Expression {
+	if len(hl.Keys) == len(hl.Pairs) {
+		return hl.Keys
+	}
+	keys := make([]Expression, 0, len(hl.Pairs))
+	for k := range hl.Pairs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
 // -----------------------------------------------------
@@ -0,0 +1,260 @@
+package ast
+
+// nodeを深く複製したノードを返す
+// 子ノードのスライスやHashLiteralのmapも含めてすべて複製するので、
+// 複製したノードを書き換えても元のノードには影響しない
+// トークンは値としてコピーされる
+func Clone(node Node) Node {
+	switch n := node.(type) {
+	case *Program:
+		return &Program{NodePos: n.NodePos, Statements: cloneStatements(n.Statements), TrailingComments: cloneComments(n.TrailingComments)}
+	case *CaseClause:
+		return cloneCaseClause(n)
+	case Statement:
+		return cloneStatement(n)
+	case Expression:
+		return cloneExpression(n)
+	}
+	return nil
+}
+
+// 文を複製する
+func cloneStatement(s Statement) Statement {
+	switch s := s.(type) {
+	case *LetStatement:
+		return &LetStatement{
+			Token:    s.Token,
+			NodePos:  s.NodePos,
+			Name:     cloneIdentifier(s.Name),
+			Value:    cloneExpression(s.Value),
+			Comments: cloneComments(s.Comments),
+		}
+	case *ConstStatement:
+		return &ConstStatement{
+			Token:    s.Token,
+			NodePos:  s.NodePos,
+			Name:     cloneIdentifier(s.Name),
+			Value:    cloneExpression(s.Value),
+			Comments: cloneComments(s.Comments),
+		}
+	case *DestructuringLetStatement:
+		names := make([]*Identifier, len(s.Names))
+		for i, n := range s.Names {
+			names[i] = cloneIdentifier(n)
+		}
+		return &DestructuringLetStatement{
+			Token:    s.Token,
+			NodePos:  s.NodePos,
+			Names:    names,
+			Value:    cloneExpression(s.Value),
+			Comments: cloneComments(s.Comments),
+		}
+	case *ReturnStatement:
+		return &ReturnStatement{Token: s.Token, NodePos: s.NodePos, ReturnValue: cloneExpression(s.ReturnValue), Comments: cloneComments(s.Comments)}
+	case *DeferStatement:
+		return &DeferStatement{Token: s.Token, NodePos: s.NodePos, Call: cloneExpression(s.Call), Comments: cloneComments(s.Comments)}
+	case *ExpressionStatement:
+		return &ExpressionStatement{Token: s.Token, NodePos: s.NodePos, Expression: cloneExpression(s.Expression), Comments: cloneComments(s.Comments)}
+	case *BlockStatement:
+		if s == nil {
+			return nil
+		}
+		return cloneBlock(s)
+	case *ForStatement:
+		var init Statement
+		if s.Init != nil {
+			init = cloneStatement(s.Init)
+		}
+		return &ForStatement{
+			Token:     s.Token,
+			NodePos:   s.NodePos,
+			Init:      init,
+			Condition: cloneExpression(s.Condition),
+			Post:      cloneExpression(s.Post),
+			Body:      cloneBlock(s.Body),
+			Comments:  cloneComments(s.Comments),
+		}
+	case *WhileStatement:
+		return &WhileStatement{
+			Token:     s.Token,
+			NodePos:   s.NodePos,
+			Condition: cloneExpression(s.Condition),
+			Body:      cloneBlock(s.Body),
+			Comments:  cloneComments(s.Comments),
+		}
+	case *TryCatchStatement:
+		return &TryCatchStatement{
+			Token:    s.Token,
+			NodePos:  s.NodePos,
+			Try:      cloneBlock(s.Try),
+			ErrName:  cloneIdentifier(s.ErrName),
+			Catch:    cloneBlock(s.Catch),
+			Comments: cloneComments(s.Comments),
+		}
+	case *BreakStatement:
+		return &BreakStatement{Token: s.Token, NodePos: s.NodePos, Comments: cloneComments(s.Comments)}
+	case *ContinueStatement:
+		return &ContinueStatement{Token: s.Token, NodePos: s.NodePos, Comments: cloneComments(s.Comments)}
+	}
+	return s
+}
+
+// 式を複製する
+func cloneExpression(e Expression) Expression {
+	switch e := e.(type) {
+	case *Identifier:
+		if e == nil {
+			return nil
+		}
+		return cloneIdentifier(e)
+	case *IntegerLiteral:
+		return &IntegerLiteral{Token: e.Token, NodePos: e.NodePos, Value: e.Value}
+	case *FloatLiteral:
+		return &FloatLiteral{Token: e.Token, NodePos: e.NodePos, Value: e.Value}
+	case *Boolean:
+		return &Boolean{Token: e.Token, NodePos: e.NodePos, Value: e.Value}
+	case *NullLiteral:
+		return &NullLiteral{Token: e.Token, NodePos: e.NodePos}
+	case *StringLiteral:
+		return &StringLiteral{Token: e.Token, NodePos: e.NodePos, Value: e.Value}
+	case *PrefixExpression:
+		return &PrefixExpression{Token: e.Token, NodePos: e.NodePos, Operator: e.Operator, Right: cloneExpression(e.Right)}
+	case *InfixExpression:
+		return &InfixExpression{
+			Token:    e.Token,
+			NodePos:  e.NodePos,
+			Left:     cloneExpression(e.Left),
+			Operator: e.Operator,
+			Right:    cloneExpression(e.Right),
+		}
+	case *AssignExpression:
+		return &AssignExpression{Token: e.Token, NodePos: e.NodePos, Name: cloneIdentifier(e.Name), Value: cloneExpression(e.Value)}
+	case *IfExpression:
+		return &IfExpression{
+			Token:       e.Token,
+			NodePos:     e.NodePos,
+			Condition:   cloneExpression(e.Condition),
+			Consequence: cloneBlock(e.Consequence),
+			Alternative: cloneBlock(e.Alternative),
+		}
+	case *FunctionLiteral:
+		var params []*Identifier
+		if e.Parameters != nil {
+			params = make([]*Identifier, len(e.Parameters))
+			for i, p := range e.Parameters {
+				params[i] = cloneIdentifier(p)
+			}
+		}
+		return &FunctionLiteral{Token: e.Token, NodePos: e.NodePos, Parameters: params, Body: cloneBlock(e.Body)}
+	case *MacroLiteral:
+		params := make([]*Identifier, len(e.Parameters))
+		for i, p := range e.Parameters {
+			params[i] = cloneIdentifier(p)
+		}
+		return &MacroLiteral{Token: e.Token, NodePos: e.NodePos, Parameters: params, Body: cloneBlock(e.Body)}
+	case *CallExpression:
+		return &CallExpression{
+			Token:     e.Token,
+			NodePos:   e.NodePos,
+			Function:  cloneExpression(e.Function),
+			Arguments: cloneExpressions(e.Arguments),
+		}
+	case *SpreadElement:
+		return &SpreadElement{Token: e.Token, NodePos: e.NodePos, Expression: cloneExpression(e.Expression)}
+	case *ArrayLiteral:
+		return &ArrayLiteral{Token: e.Token, NodePos: e.NodePos, Elements: cloneExpressions(e.Elements)}
+	case *SetLiteral:
+		return &SetLiteral{Token: e.Token, NodePos: e.NodePos, Elements: cloneExpressions(e.Elements)}
+	case *TupleLiteral:
+		return &TupleLiteral{Token: e.Token, NodePos: e.NodePos, Elements: cloneExpressions(e.Elements)}
+	case *IndexExpression:
+		return &IndexExpression{Token: e.Token, NodePos: e.NodePos, Left: cloneExpression(e.Left), Index: cloneExpression(e.Index)}
+	case *PropagateErrorExpression:
+		return &PropagateErrorExpression{Token: e.Token, NodePos: e.NodePos, Inner: cloneExpression(e.Inner)}
+	case *ImportExpression:
+		path := *e.Path
+		return &ImportExpression{Token: e.Token, NodePos: e.NodePos, Path: &path}
+	case *SwitchExpression:
+		var cases []*CaseClause
+		if e.Cases != nil {
+			cases = make([]*CaseClause, len(e.Cases))
+			for i, c := range e.Cases {
+				cases[i] = cloneCaseClause(c)
+			}
+		}
+		return &SwitchExpression{
+			Token:   e.Token,
+			NodePos: e.NodePos,
+			Subject: cloneExpression(e.Subject),
+			Cases:   cases,
+			Default: cloneBlock(e.Default),
+		}
+	case *SliceExpression:
+		return &SliceExpression{
+			Token:   e.Token,
+			NodePos: e.NodePos,
+			Left:    cloneExpression(e.Left),
+			Low:     cloneExpression(e.Low),
+			High:    cloneExpression(e.High),
+		}
+	case *HashLiteral:
+		// Keysの要素とPairsのキーは同じノードを指すので、複製後も同じノードを指すようにする
+		pairs := make(map[Expression]Expression, len(e.Pairs))
+		var keys []Expression
+		if e.Keys != nil {
+			keys = make([]Expression, 0, len(e.Keys))
+		}
+		for _, k := range e.OrderedKeys() {
+			cloned := cloneExpression(k)
+			pairs[cloned] = cloneExpression(e.Pairs[k])
+			if keys != nil {
+				keys = append(keys, cloned)
+			}
+		}
+		return &HashLiteral{Token: e.Token, NodePos: e.NodePos, Pairs: pairs, Keys: keys}
+	}
+	return e
+}
+
+func cloneIdentifier(i *Identifier) *Identifier {
+	if i == nil {
+		return nil
+	}
+	return &Identifier{Token: i.Token, NodePos: i.NodePos, Value: i.Value}
+}
+
+func cloneCaseClause(c *CaseClause) *CaseClause {
+	if c == nil {
+		return nil
+	}
+	return &CaseClause{Token: c.Token, NodePos: c.NodePos, Value: cloneExpression(c.Value), Body: cloneBlock(c.Body)}
+}
+
+func cloneBlock(b *BlockStatement) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+	return &BlockStatement{Token: b.Token, NodePos: b.NodePos, Statements: cloneStatements(b.Statements), TrailingComments: cloneComments(b.TrailingComments)}
+}
+
+func cloneStatements(list []Statement) []Statement {
+	if list == nil {
+		return nil
+	}
+	cloned := make([]Statement, len(list))
+	for i, s := range list {
+		cloned[i] = cloneStatement(s)
+	}
+	return cloned
+}
+
+func cloneExpressions(list []Expression) []Expression {
+	if list == nil {
+		return nil
+	}
+	cloned := make([]Expression, len(list))
+	for i, e := range list {
+		cloned[i] = cloneExpression(e)
+	}
+	return cloned
+}
@@ -0,0 +1,110 @@
+package ast_test
+
+import (
+	"monkey/ast"
+	"monkey/token"
+	"reflect"
+	"testing"
+)
+
+// 複製したASTを書き換えても元のASTが変化しないことをテスト
+func TestCloneDoesNotAlias(t *testing.T) {
+	program := parseWalkInput(t)
+	before := program.String()
+
+	cloned := ast.Clone(program).(*ast.Program)
+	if got := cloned.String(); got != before {
+		t.Fatalf("clone differs from original.\nwant=%q\ngot=%q", before, got)
+	}
+
+	// 複製側のすべての整数リテラルを書き換え、文を追加する
+	ast.Inspect(cloned, func(n ast.Node) bool {
+		if il, ok := n.(*ast.IntegerLiteral); ok {
+			il.Value = 42
+			il.Token.Literal = "42"
+		}
+		if fl, ok := n.(*ast.FunctionLiteral); ok {
+			fl.Parameters[0].Value = "changed"
+			fl.Body.Statements = append(fl.Body.Statements, &ast.ExpressionStatement{})
+		}
+		return true
+	})
+	cloned.Statements = append(cloned.Statements, &ast.ExpressionStatement{
+		Token:      token.Token{Type: token.INT, Literal: "1"},
+		Expression: &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1},
+	})
+
+	if got := program.String(); got != before {
+		t.Errorf("original changed after mutating clone.\nwant=%q\ngot=%q", before, got)
+	}
+	if len(program.Statements) != 5 {
+		t.Errorf("original has wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	// 元のASTと複製のASTでノードを共有していない
+	originals := map[ast.Node]bool{}
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n != nil {
+			originals[n] = true
+		}
+		return true
+	})
+	ast.Inspect(ast.Clone(program), func(n ast.Node) bool {
+		if n != nil && originals[n] {
+			t.Errorf("node %T (%s) is shared between original and clone", n, n.String())
+		}
+		return true
+	})
+}
+
+// トークンとノードの位置が複製されていることをテスト
+func TestCloneCopiesTokens(t *testing.T) {
+	program := parseWalkInput(t)
+	cloned := ast.Clone(program)
+
+	var originalTokens, clonedTokens []token.Token
+	var originalPositions, clonedPositions []ast.Pos
+	collect := func(tokens *[]token.Token, positions *[]ast.Pos) func(ast.Node) bool {
+		return func(n ast.Node) bool {
+			if n == nil {
+				return false
+			}
+			*positions = append(*positions, n.Position())
+			v := reflect.ValueOf(n).Elem().FieldByName("Token")
+			if v.IsValid() {
+				*tokens = append(*tokens, v.Interface().(token.Token))
+			}
+			return true
+		}
+	}
+	ast.Inspect(program, collect(&originalTokens, &originalPositions))
+	ast.Inspect(cloned, collect(&clonedTokens, &clonedPositions))
+
+	if len(originalTokens) == 0 {
+		t.Fatalf("no tokens collected")
+	}
+	if !reflect.DeepEqual(originalTokens, clonedTokens) {
+		t.Errorf("tokens differ.\nwant=%v\ngot=%v", originalTokens, clonedTokens)
+	}
+	if !reflect.DeepEqual(originalPositions, clonedPositions) {
+		t.Errorf("positions differ.\nwant=%v\ngot=%v", originalPositions, clonedPositions)
+	}
+}
+
+// 式や文を単体で複製できることをテスト
+func TestCloneNode(t *testing.T) {
+	program := parseProgram(t, "let f = fn(x) { x[1:] };")
+	let := program.Statements[0].(*ast.LetStatement)
+
+	clonedLet := ast.Clone(let).(*ast.LetStatement)
+	if clonedLet == let || clonedLet.String() != let.String() {
+		t.Errorf("statement not cloned. got=%q", clonedLet.String())
+	}
+	clonedFn := ast.Clone(let.Value).(*ast.FunctionLiteral)
+	if clonedFn == let.Value || clonedFn.Body == let.Value.(*ast.FunctionLiteral).Body {
+		t.Errorf("function literal not deeply cloned")
+	}
+	if ast.Clone(nil) != nil {
+		t.Errorf("Clone(nil) should be nil")
+	}
+}
@@ -0,0 +1,92 @@
+package ast
+
+import "monkey/token"
+
+// 文の直前にあるコメントを返す
+// コメントを保持できない種類の文に対してはnilを返す
+func Comments(s Statement) []token.Token {
+	switch s := s.(type) {
+	case *LetStatement:
+		return s.Comments
+	case *ConstStatement:
+		return s.Comments
+	case *DestructuringLetStatement:
+		return s.Comments
+	case *ReturnStatement:
+		return s.Comments
+	case *ExpressionStatement:
+		return s.Comments
+	case *ForStatement:
+		return s.Comments
+	case *WhileStatement:
+		return s.Comments
+	case *TryCatchStatement:
+		return s.Comments
+	case *DeferStatement:
+		return s.Comments
+	case *BreakStatement:
+		return s.Comments
+	case *ContinueStatement:
+		return s.Comments
+	}
+	return nil
+}
+
+// 文の直前にあるコメントを設定する
+// コメントを保持できない種類の文やnilの文に対しては何もしない
+func SetComments(s Statement, comments []token.Token) {
+	switch s := s.(type) {
+	case *LetStatement:
+		if s != nil {
+			s.Comments = comments
+		}
+	case *ConstStatement:
+		if s != nil {
+			s.Comments = comments
+		}
+	case *DestructuringLetStatement:
+		if s != nil {
+			s.Comments = comments
+		}
+	case *ReturnStatement:
+		if s != nil {
+			s.Comments = comments
+		}
+	case *ExpressionStatement:
+		if s != nil {
+			s.Comments = comments
+		}
+	case *ForStatement:
+		if s != nil {
+			s.Comments = comments
+		}
+	case *WhileStatement:
+		if s != nil {
+			s.Comments = comments
+		}
+	case *TryCatchStatement:
+		if s != nil {
+			s.Comments = comments
+		}
+	case *DeferStatement:
+		if s != nil {
+			s.Comments = comments
+		}
+	case *BreakStatement:
+		if s != nil {
+			s.Comments = comments
+		}
+	case *ContinueStatement:
+		if s != nil {
+			s.Comments = comments
+		}
+	}
+}
+
+// コメントのスライスを複製する
+func cloneComments(comments []token.Token) []token.Token {
+	if comments == nil {
+		return nil
+	}
+	return append([]token.Token{}, comments...)
+}
@@ -0,0 +1,406 @@
+package ast
+
+import (
+	"bytes"
+	"strings"
+)
+
+// 整形時にインデント一段に使う文字列
+const formatIndent = "    "
+
+// 整形時に括弧が必要かどうかを判断するための演算子の優先順位
+// parserの優先順位テーブルと同じ順序関係を保つ
+const (
+	_ int = iota
+	precLowest
+	precAssign      // x = y
+	precOr          // ||
+	precAnd         // &&
+	precEquals      // ==
+	precLessGreater // > or <
+	precSum         // +
+	precProduct     // *
+	precPrefix      // -x or !x
+	precCall        // myFunction(x)
+	precIndex       // array[index]
+)
+
+var infixPrecedences = map[string]int{
+	"||": precOr,
+	"&&": precAnd,
+	"==": precEquals,
+	"!=": precEquals,
+	"<":  precLessGreater,
+	">":  precLessGreater,
+	"<=": precLessGreater,
+	">=": precLessGreater,
+	"+":  precSum,
+	"-":  precSum,
+	"*":  precProduct,
+	"/":  precProduct,
+	"%":  precProduct,
+}
+
+// ASTノードを正規化・インデントされたMonkeyのソースコードに整形する
+// 文は一行に一つずつ、ブロックは4スペースでインデントし、文末にはセミコロンを付ける
+// 整形結果をパースし直すと元と等価なASTが得られる
+// 文に付いたコメントは文の直前の行に、末尾のコメントはブロックやプログラムの最後に出力する
+func Format(node Node) string {
+	f := &formatter{}
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			f.statement(s)
+			f.out.WriteString("\n")
+		}
+		for _, c := range node.TrailingComments {
+			f.out.WriteString(c.Literal)
+			f.out.WriteString("\n")
+		}
+	case Statement:
+		f.statement(node)
+	case Expression:
+		f.expression(node, precLowest)
+	}
+	return f.out.String()
+}
+
+// 優先順位上必要な箇所にだけ括弧を付けて式を文字列にする
+// String()は中置式をすべて括弧で囲むが、こちらは(a + b) * cやa + b * cのように出力する
+// ブロックは改行せずに一行で出力する
+func StringMinimal(e Expression) string {
+	f := &formatter{inline: true}
+	f.expression(e, precLowest)
+	return f.out.String()
+}
+
+type formatter struct {
+	out    bytes.Buffer
+	depth  int
+	inline bool // trueならブロックを改行・インデントせずに一行で出力する
+}
+
+func (f *formatter) writeIndent() {
+	f.out.WriteString(strings.Repeat(formatIndent, f.depth))
+}
+
+// 文を整形する
+// 一行で出力する場合はコメントを出力しない
+func (f *formatter) statement(s Statement) {
+	if !f.inline {
+		for _, c := range Comments(s) {
+			f.out.WriteString(c.Literal)
+			f.out.WriteString("\n")
+			f.writeIndent()
+		}
+	}
+
+	switch s := s.(type) {
+	case *LetStatement:
+		f.out.WriteString("let ")
+		f.out.WriteString(s.Name.Value)
+		f.out.WriteString(" = ")
+		f.expression(s.Value, precLowest)
+		f.out.WriteString(";")
+	case *ConstStatement:
+		f.out.WriteString("const ")
+		f.out.WriteString(s.Name.Value)
+		f.out.WriteString(" = ")
+		f.expression(s.Value, precLowest)
+		f.out.WriteString(";")
+	case *DestructuringLetStatement:
+		names := []string{}
+		for _, n := range s.Names {
+			names = append(names, n.Value)
+		}
+		f.out.WriteString("let [")
+		f.out.WriteString(strings.Join(names, ", "))
+		f.out.WriteString("] = ")
+		f.expression(s.Value, precLowest)
+		f.out.WriteString(";")
+	case *ReturnStatement:
+		f.out.WriteString("return")
+		if s.ReturnValue != nil {
+			f.out.WriteString(" ")
+			f.expression(s.ReturnValue, precLowest)
+		}
+		f.out.WriteString(";")
+	case *DeferStatement:
+		f.out.WriteString("defer ")
+		f.expression(s.Call, precLowest)
+		f.out.WriteString(";")
+	case *ExpressionStatement:
+		f.expression(s.Expression, precLowest)
+		// ブロックで終わるif式やswitch式にはセミコロンを付けない
+		switch s.Expression.(type) {
+		case *IfExpression, *SwitchExpression:
+		default:
+			f.out.WriteString(";")
+		}
+	case *BlockStatement:
+		f.block(s)
+	case *ForStatement:
+		f.out.WriteString("for (")
+		if s.Init != nil {
+			f.statement(s.Init)
+		} else {
+			f.out.WriteString(";")
+		}
+		if s.Condition != nil {
+			f.out.WriteString(" ")
+			f.expression(s.Condition, precLowest)
+		}
+		f.out.WriteString(";")
+		if s.Post != nil {
+			f.out.WriteString(" ")
+			f.expression(s.Post, precLowest)
+		}
+		f.out.WriteString(") ")
+		f.block(s.Body)
+	case *WhileStatement:
+		f.out.WriteString("while (")
+		f.expression(s.Condition, precLowest)
+		f.out.WriteString(") ")
+		f.block(s.Body)
+	case *TryCatchStatement:
+		f.out.WriteString("try ")
+		f.block(s.Try)
+		f.out.WriteString(" catch (" + s.ErrName.Value + ") ")
+		f.block(s.Catch)
+	case *BreakStatement:
+		f.out.WriteString("break;")
+	case *ContinueStatement:
+		f.out.WriteString("continue;")
+	}
+}
+
+// ブロック文を { から } まで整形する
+func (f *formatter) block(b *BlockStatement) {
+	if b == nil || len(b.Statements) == 0 && (f.inline || len(b.TrailingComments) == 0) {
+		f.out.WriteString("{}")
+		return
+	}
+	if f.inline {
+		f.out.WriteString("{ ")
+		for i, s := range b.Statements {
+			if i > 0 {
+				f.out.WriteString(" ")
+			}
+			f.statement(s)
+		}
+		f.out.WriteString(" }")
+		return
+	}
+	f.out.WriteString("{\n")
+	f.depth++
+	for _, s := range b.Statements {
+		f.writeIndent()
+		f.statement(s)
+		f.out.WriteString("\n")
+	}
+	for _, c := range b.TrailingComments {
+		f.writeIndent()
+		f.out.WriteString(c.Literal)
+		f.out.WriteString("\n")
+	}
+	f.depth--
+	f.writeIndent()
+	f.out.WriteString("}")
+}
+
+// 式を整形する
+// parentは式を囲む文脈の優先順位で、式の優先順位がそれより低ければ括弧で囲む
+func (f *formatter) expression(e Expression, parent int) {
+	if e == nil {
+		return
+	}
+	prec := expressionPrecedence(e)
+	if prec < parent {
+		f.out.WriteString("(")
+		defer f.out.WriteString(")")
+	}
+
+	switch e := e.(type) {
+	case *Identifier:
+		f.out.WriteString(e.Value)
+	case *IntegerLiteral:
+		f.out.WriteString(e.Token.Literal)
+	case *FloatLiteral:
+		f.out.WriteString(e.Token.Literal)
+	case *Boolean:
+		f.out.WriteString(e.Token.Literal)
+	case *StringLiteral:
+		f.out.WriteString(`"` + e.Value + `"`)
+	case *PrefixExpression:
+		f.out.WriteString(e.Operator)
+		f.expression(e.Right, precPrefix)
+	case *InfixExpression:
+		// 左結合なので、右辺は同じ優先順位でも括弧が必要
+		f.expression(e.Left, prec)
+		f.out.WriteString(" " + e.Operator + " ")
+		f.expression(e.Right, prec+1)
+	case *AssignExpression:
+		// 右結合なので、右辺は同じ優先順位でも括弧は不要
+		f.out.WriteString(e.Name.Value + " = ")
+		f.expression(e.Value, prec)
+	case *IfExpression:
+		f.out.WriteString("if (")
+		f.expression(e.Condition, precLowest)
+		f.out.WriteString(") ")
+		f.block(e.Consequence)
+		if e.Alternative != nil {
+			f.out.WriteString(" else ")
+			f.block(e.Alternative)
+		}
+	case *SwitchExpression:
+		f.out.WriteString("switch ")
+		f.expression(e.Subject, precLowest)
+		f.out.WriteString(" {")
+		for _, c := range e.Cases {
+			f.caseHead()
+			f.out.WriteString("case ")
+			f.expression(c.Value, precLowest)
+			f.out.WriteString(":")
+			f.caseBody(c.Body)
+		}
+		if e.Default != nil {
+			f.caseHead()
+			f.out.WriteString("default:")
+			f.caseBody(e.Default)
+		}
+		if f.inline {
+			f.out.WriteString(" }")
+		} else {
+			f.out.WriteString("\n")
+			f.writeIndent()
+			f.out.WriteString("}")
+		}
+	case *FunctionLiteral:
+		f.parameters("fn", e.Parameters)
+		f.block(e.Body)
+	case *MacroLiteral:
+		f.parameters("macro", e.Parameters)
+		f.block(e.Body)
+	case *CallExpression:
+		f.expression(e.Function, precCall)
+		f.out.WriteString("(")
+		f.expressionList(e.Arguments)
+		f.out.WriteString(")")
+	case *SpreadElement:
+		f.out.WriteString("...")
+		f.expression(e.Expression, precPrefix)
+	case *ArrayLiteral:
+		f.out.WriteString("[")
+		f.expressionList(e.Elements)
+		f.out.WriteString("]")
+	case *SetLiteral:
+		f.out.WriteString("#{")
+		f.expressionList(e.Elements)
+		f.out.WriteString("}")
+	case *TupleLiteral:
+		f.out.WriteString("(")
+		f.expressionList(e.Elements)
+		if len(e.Elements) == 1 {
+			f.out.WriteString(",")
+		}
+		f.out.WriteString(")")
+	case *IndexExpression:
+		f.expression(e.Left, precIndex)
+		f.out.WriteString("[")
+		f.expression(e.Index, precLowest)
+		f.out.WriteString("]")
+	case *PropagateErrorExpression:
+		f.expression(e.Inner, precIndex)
+		f.out.WriteString("?")
+	case *ImportExpression:
+		f.out.WriteString(`import "` + e.Path.Value + `"`)
+	case *SliceExpression:
+		f.expression(e.Left, precIndex)
+		f.out.WriteString("[")
+		f.expression(e.Low, precLowest)
+		f.out.WriteString(":")
+		f.expression(e.High, precLowest)
+		f.out.WriteString("]")
+	case *HashLiteral:
+		f.out.WriteString("{")
+		for i, k := range e.OrderedKeys() {
+			if i > 0 {
+				f.out.WriteString(", ")
+			}
+			f.expression(k, precLowest)
+			f.out.WriteString(": ")
+			f.expression(e.Pairs[k], precLowest)
+		}
+		f.out.WriteString("}")
+	default:
+		f.out.WriteString(e.String())
+	}
+}
+
+// 関数リテラル・マクロリテラルの「fn(x, y) 」の部分を出力する
+func (f *formatter) parameters(keyword string, params []*Identifier) {
+	names := []string{}
+	for _, p := range params {
+		names = append(names, p.Value)
+	}
+	f.out.WriteString(keyword + "(")
+	f.out.WriteString(strings.Join(names, ", "))
+	f.out.WriteString(") ")
+}
+
+// case節・default節の行頭を出力する
+// case・defaultはswitchと同じ深さにインデントする
+func (f *formatter) caseHead() {
+	if f.inline {
+		f.out.WriteString(" ")
+		return
+	}
+	f.out.WriteString("\n")
+	f.writeIndent()
+}
+
+// case節・default節の本体を整形する
+func (f *formatter) caseBody(b *BlockStatement) {
+	if f.inline {
+		for _, s := range b.Statements {
+			f.out.WriteString(" ")
+			f.statement(s)
+		}
+		return
+	}
+	f.depth++
+	for _, s := range b.Statements {
+		f.out.WriteString("\n")
+		f.writeIndent()
+		f.statement(s)
+	}
+	f.depth--
+}
+
+// カンマ区切りの式のリストを整形する
+func (f *formatter) expressionList(list []Expression) {
+	for i, e := range list {
+		if i > 0 {
+			f.out.WriteString(", ")
+		}
+		f.expression(e, precLowest)
+	}
+}
+
+// 式の優先順位を返す
+// 中置式・前置式以外は括弧なしでどこにでも置ける
+func expressionPrecedence(e Expression) int {
+	switch e := e.(type) {
+	case *InfixExpression:
+		if p, ok := infixPrecedences[e.Operator]; ok {
+			return p
+		}
+		return precLowest
+	case *PrefixExpression:
+		return precPrefix
+	case *AssignExpression:
+		return precAssign
+	default:
+		return precIndex + 1
+	}
+}
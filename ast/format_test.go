@@ -0,0 +1,214 @@
+package ast_test
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+// Format()の出力をテスト
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=5", "let x = 5;\n"},
+		{"return x", "return x;\n"},
+		{"1+2*3", "1 + 2 * 3;\n"},
+		{"(1+2)*3", "(1 + 2) * 3;\n"},
+		{"1-(2-3)", "1 - (2 - 3);\n"},
+		{"(1-2)-3", "1 - 2 - 3;\n"},
+		{"-(5+5)", "-(5 + 5);\n"},
+		{"!(true==true)", "!(true == true);\n"},
+		{"a*[1,2][b*c]", "a * [1, 2][b * c];\n"},
+		{"add(a,b*2,fn(x){x})", "add(a, b * 2, fn(x) {\n    x;\n});\n"},
+		{`{"b":2,"a":1}`, "{\"b\": 2, \"a\": 1};\n"},
+		{"arr[1:] ; arr[:2]", "arr[1:];\narr[:2];\n"},
+		{"fn(){}", "fn() {};\n"},
+		{"(a||b)&&c||d==e", "(a || b) && c || d == e;\n"},
+		{"(1,(2,),3,)", "(1, (2,), 3);\n"},
+		{"const x=1;x=y=x+1;(x=1)+2", "const x = 1;\nx = y = x + 1;\n(x = 1) + 2;\n"},
+		{"for(let i=0;i<3;puts(i)){let i=i+1}", "for (let i = 0; i < 3; puts(i)) {\n    let i = i + 1;\n}\n"},
+		{"for(;;){}", "for (;;) {}\n"},
+		{"while(x<3){if(x==1){break}continue}", "while (x < 3) {\n    if (x == 1) {\n        break;\n    }\n    continue;\n}\n"},
+		{"switch x{case 1:a;b case 2:default:c}", "switch x {\ncase 1:\n    a;\n    b;\ncase 2:\ndefault:\n    c;\n}\n"},
+		{"fn(){switch(x){}}", "fn() {\n    switch x {\n    }\n};\n"},
+		{
+			"if(x<y){return x}else{let z=y;z}",
+			"if (x < y) {\n    return x;\n} else {\n    let z = y;\n    z;\n}\n",
+		},
+		{
+			"let f=fn(x){if(x){fn(y){x+y}}}; f(1)(2)",
+			"let f = fn(x) {\n    if (x) {\n        fn(y) {\n            x + y;\n        };\n    }\n};\nf(1)(2);\n",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+		if got := ast.Format(program); got != tt.expected {
+			t.Errorf("Format(%q) wrong.\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// 整形結果をパースし直すと等価なASTが得られることをテスト
+func TestFormatRoundTrip(t *testing.T) {
+	inputs := []string{
+		"let a = 1 + 2 * 3 - 4 / 5;",
+		"(a + b) * (c - d) / -e;",
+		"a - (b - c) - d; a / (b * c);",
+		"!(1 < 2) == (3 > 4) != false;",
+		"let add = fn(x, y) { return x + y; }; add(1, add(2, 3));",
+		`let h = {"one": 1}; h["one"] + [1, 2, 3][0];`,
+		"if (a > b) { a } else { if (b > c) { b } else { c } }",
+		"fn(x) { fn(y) { x * y } }(2)(3);",
+		`let s = "hello"[1:3]; [1, 2, 3][:2]; [4, 5][1:];`,
+		"-(-a); -a * b; -(a * b); f(x)[0](y);",
+		"let f = 1.5 * -2.25 + 0.125;",
+		"[1, ...rest, ...f(x)[1:], ...-a];",
+		"fn() {}; if (true) {} else {};",
+		"const c = 1; let a = b = c * 2; (a = 1) * -(b = 2);",
+		"let [x, y] = [1, 2]; let [] = f(x); fn() { let [z] = y; z }",
+		"for (let i = 0; i < 10; i) { let i = i + 1; } for (; x;) {}",
+		"while (a && b) { if (a) { break; } continue; } while ((1, 2)) {}",
+		"try { a / b } catch (e) { puts(e); } try {} catch (e) {}",
+		"let y = f(x)? + -g()?[0]?; (a + b)?;",
+		"fn() { defer f(x, y); defer fn() { puts(1) }(); }",
+		`let io = import "io"; io.puts(1); import "lib/util".f(x);`,
+		"a || b && c || d; (a || b) && !(c && d); x = a && b || c;",
+		"let s = #{1, 2 + 3, #{}}; setUnion(s, #{a});",
+		"let t = (1, (2,), (a + b) * c); t[0]; f((1, 2));",
+		"let y = switch x + 1 { case 1: fn(a) { switch a { default: a } }; case 2: default: 3 }; y",
+	}
+
+	for _, input := range inputs {
+		original := parseProgram(t, input)
+		formatted := ast.Format(original)
+		reparsed := parseProgram(t, formatted)
+
+		if original.String() != reparsed.String() {
+			t.Errorf("round trip changed AST for %q.\nformatted=%q\nwant=%q\ngot=%q",
+				input, formatted, original.String(), reparsed.String())
+		}
+
+		// 整形済みのコードを再度整形しても変わらない
+		if again := ast.Format(reparsed); again != formatted {
+			t.Errorf("Format is not idempotent for %q.\nfirst=%q\nsecond=%q", input, formatted, again)
+		}
+	}
+}
+
+// 必要な箇所にだけ括弧を付けることをテスト
+func TestStringMinimal(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // String()の出力
+		minimal  string // StringMinimal()の出力
+	}{
+		{"(a + b) * c", "((a + b) * c)", "(a + b) * c"},
+		{"a + (b * c)", "(a + (b * c))", "a + b * c"},
+		{"a - (b - c)", "(a - (b - c))", "a - (b - c)"},
+		{"(a - b) - c", "((a - b) - c)", "a - b - c"},
+		{"-a * b", "((-a) * b)", "-a * b"},
+		{"-(a * b)", "(-(a * b))", "-(a * b)"},
+		{"switch (a + b) * c { case 1: x; y default: z }", "switch ((a + b) * c) { case 1: \n\tx\n\n\ty\n default: \n\tz\n }", "switch (a + b) * c { case 1: x; y; default: z; }"},
+		{"a < b == (c > d)", "((a < b) == (c > d))", "a < b == c > d"},
+		{"f(a + b, c)[0]", "(f((a + b), c)[0])", "f(a + b, c)[0]"},
+		{
+			"fn(x) { if (x) { x * 2 } else { (x + 1) * 2 } }",
+			"fn(x) \n\tifx \n\t(x * 2)\nelse \n\t((x + 1) * 2)\n\n",
+			"fn(x) { if (x) { x * 2; } else { (x + 1) * 2; } }",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+		exp := program.Statements[0].(*ast.ExpressionStatement).Expression
+		if got := exp.String(); got != tt.expected {
+			t.Errorf("String() wrong for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+		if got := ast.StringMinimal(exp); got != tt.minimal {
+			t.Errorf("StringMinimal() wrong for %q. want=%q, got=%q", tt.input, tt.minimal, got)
+		}
+	}
+}
+
+// 式や文を単体で整形できることをテスト
+func TestFormatNode(t *testing.T) {
+	program := parseProgram(t, "let x = (1 + 2) * 3;")
+	let := program.Statements[0].(*ast.LetStatement)
+
+	if got := ast.Format(let); got != "let x = (1 + 2) * 3;" {
+		t.Errorf("Format(statement) wrong. got=%q", got)
+	}
+	if got := ast.Format(let.Value); got != "(1 + 2) * 3" {
+		t.Errorf("Format(expression) wrong. got=%q", got)
+	}
+}
+
+// WithComments()でパースしたプログラムのコメントが整形後も残ることをテスト
+func TestFormatComments(t *testing.T) {
+	input := `// header comment
+// second line
+let x=5; // trailing comment
+
+// between statements
+let f=fn(y){
+  // inside function
+  return y*2 // last in block
+};
+for(;;){ // only comment
+}
+// end of file
+`
+	expected := `// header comment
+// second line
+let x = 5;
+// trailing comment
+// between statements
+let f = fn(y) {
+    // inside function
+    return y * 2;
+    // last in block
+};
+for (;;) {
+    // only comment
+}
+// end of file
+`
+
+	parse := func(input string) *ast.Program {
+		p := parser.New(lexer.New(input), parser.WithComments())
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser has errors for %q: %v", input, p.Errors())
+		}
+		return program
+	}
+
+	formatted := ast.Format(parse(input))
+	if formatted != expected {
+		t.Fatalf("Format wrong.\nwant=%q\ngot=%q", expected, formatted)
+	}
+	if again := ast.Format(parse(formatted)); again != formatted {
+		t.Errorf("Format is not idempotent with comments.\nfirst=%q\nsecond=%q", formatted, again)
+	}
+
+	// コメントを保持しない場合は読み飛ばされる
+	withoutComments := "let x = 5;\nlet f = fn(y) {\n    return y * 2;\n};\nfor (;;) {}\n"
+	if got := ast.Format(parseProgram(t, input)); got != withoutComments {
+		t.Errorf("Format without comments wrong.\nwant=%q\ngot=%q", withoutComments, got)
+	}
+}
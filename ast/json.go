@@ -0,0 +1,574 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"monkey/token"
+	"reflect"
+)
+
+// ノードをJSONに変換する
+// 各ノードは種類を表す"type"フィールドを持つJSONオブジェクトになり、
+// トークン・位置・コメントと子ノードをフィールドとして持つ
+// 言語サーバーなどのツールとASTをやり取りしたり、テストのゴールデンファイルに使ったりできる
+func Marshal(node Node) ([]byte, error) {
+	return json.Marshal(encodeNode(node))
+}
+
+// Marshalで変換したJSONからノードを復元する
+// "type"フィールドを見て対応する種類のノードを組み立てる
+func Unmarshal(data []byte) (Node, error) {
+	d := &decoder{}
+	node := d.node(data)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return node, nil
+}
+
+// JSONでのトークンの表現
+type jsonToken struct {
+	Type    token.TokenType `json:"type"`
+	Literal string          `json:"literal"`
+	Pos     jsonPos         `json:"pos"`
+}
+
+// JSONでの位置の表現
+type jsonPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+// JSONでのHashLiteralのキーと値の組の表現
+type jsonPair struct {
+	Key   interface{} `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+func encodeToken(t token.Token) jsonToken {
+	return jsonToken{Type: t.Type, Literal: t.Literal, Pos: encodePos(t.Pos)}
+}
+
+func encodePos(p Pos) jsonPos {
+	return jsonPos{Line: p.Line, Column: p.Column, Offset: p.Offset}
+}
+
+func decodeToken(t jsonToken) token.Token {
+	return token.Token{Type: t.Type, Literal: t.Literal, Pos: decodePos(t.Pos)}
+}
+
+func decodePos(p jsonPos) Pos {
+	return Pos{Line: p.Line, Column: p.Column, Offset: p.Offset}
+}
+
+// ノードをJSONに変換できる値にする
+// nilのノードはnullになる
+func encodeNode(node Node) interface{} {
+	if isNilNode(node) {
+		return nil
+	}
+
+	v := reflect.ValueOf(node).Elem()
+	m := map[string]interface{}{
+		"type": v.Type().Name(),
+		"pos":  encodePos(node.Position()),
+	}
+
+	// トークンとコメントはどの種類のノードでも同じフィールド名で持っている
+	if f := v.FieldByName("Token"); f.IsValid() {
+		m["token"] = encodeToken(f.Interface().(token.Token))
+	}
+	for _, name := range []string{"Comments", "TrailingComments"} {
+		if f := v.FieldByName(name); f.IsValid() && f.Len() > 0 {
+			m[jsonFieldName(name)] = encodeTokens(f.Interface().([]token.Token))
+		}
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		m["statements"] = encodeStatements(n.Statements)
+	case *LetStatement:
+		m["name"] = encodeNode(n.Name)
+		m["value"] = encodeNode(n.Value)
+	case *ConstStatement:
+		m["name"] = encodeNode(n.Name)
+		m["value"] = encodeNode(n.Value)
+	case *DestructuringLetStatement:
+		m["names"] = encodeIdentifiers(n.Names)
+		m["value"] = encodeNode(n.Value)
+	case *ReturnStatement:
+		m["returnValue"] = encodeNode(n.ReturnValue)
+	case *DeferStatement:
+		m["call"] = encodeNode(n.Call)
+	case *ExpressionStatement:
+		m["expression"] = encodeNode(n.Expression)
+	case *BlockStatement:
+		m["statements"] = encodeStatements(n.Statements)
+	case *ForStatement:
+		m["init"] = encodeNode(n.Init)
+		m["condition"] = encodeNode(n.Condition)
+		m["post"] = encodeNode(n.Post)
+		m["body"] = encodeNode(n.Body)
+	case *WhileStatement:
+		m["condition"] = encodeNode(n.Condition)
+		m["body"] = encodeNode(n.Body)
+	case *TryCatchStatement:
+		m["try"] = encodeNode(n.Try)
+		m["errName"] = encodeNode(n.ErrName)
+		m["catch"] = encodeNode(n.Catch)
+	case *BreakStatement, *ContinueStatement, *NullLiteral:
+		// トークン以外に持つものはない
+	case *Identifier:
+		m["value"] = n.Value
+	case *IntegerLiteral:
+		m["value"] = n.Value
+	case *FloatLiteral:
+		m["value"] = n.Value
+	case *Boolean:
+		m["value"] = n.Value
+	case *StringLiteral:
+		m["value"] = n.Value
+	case *PrefixExpression:
+		m["operator"] = n.Operator
+		m["right"] = encodeNode(n.Right)
+	case *InfixExpression:
+		m["left"] = encodeNode(n.Left)
+		m["operator"] = n.Operator
+		m["right"] = encodeNode(n.Right)
+	case *AssignExpression:
+		m["name"] = encodeNode(n.Name)
+		m["value"] = encodeNode(n.Value)
+	case *IfExpression:
+		m["condition"] = encodeNode(n.Condition)
+		m["consequence"] = encodeNode(n.Consequence)
+		m["alternative"] = encodeNode(n.Alternative)
+	case *SwitchExpression:
+		cases := []interface{}{}
+		for _, c := range n.Cases {
+			cases = append(cases, encodeNode(c))
+		}
+		m["subject"] = encodeNode(n.Subject)
+		m["cases"] = cases
+		m["default"] = encodeNode(n.Default)
+	case *CaseClause:
+		m["value"] = encodeNode(n.Value)
+		m["body"] = encodeNode(n.Body)
+	case *FunctionLiteral:
+		m["parameters"] = encodeIdentifiers(n.Parameters)
+		m["body"] = encodeNode(n.Body)
+	case *MacroLiteral:
+		m["parameters"] = encodeIdentifiers(n.Parameters)
+		m["body"] = encodeNode(n.Body)
+	case *CallExpression:
+		m["function"] = encodeNode(n.Function)
+		m["arguments"] = encodeExpressions(n.Arguments)
+	case *SpreadElement:
+		m["expression"] = encodeNode(n.Expression)
+	case *ArrayLiteral:
+		m["elements"] = encodeExpressions(n.Elements)
+	case *TupleLiteral:
+		m["elements"] = encodeExpressions(n.Elements)
+	case *SetLiteral:
+		m["elements"] = encodeExpressions(n.Elements)
+	case *IndexExpression:
+		m["left"] = encodeNode(n.Left)
+		m["index"] = encodeNode(n.Index)
+	case *PropagateErrorExpression:
+		m["inner"] = encodeNode(n.Inner)
+	case *ImportExpression:
+		m["path"] = encodeNode(n.Path)
+	case *SliceExpression:
+		m["left"] = encodeNode(n.Left)
+		m["low"] = encodeNode(n.Low)
+		m["high"] = encodeNode(n.High)
+	case *HashLiteral:
+		pairs := []jsonPair{}
+		for _, k := range n.OrderedKeys() {
+			pairs = append(pairs, jsonPair{Key: encodeNode(k), Value: encodeNode(n.Pairs[k])})
+		}
+		m["pairs"] = pairs
+	}
+	return m
+}
+
+// nilのスライスはnullに、空のスライスは[]にして区別する
+func encodeStatements(list []Statement) interface{} {
+	if list == nil {
+		return nil
+	}
+	out := []interface{}{}
+	for _, s := range list {
+		out = append(out, encodeNode(s))
+	}
+	return out
+}
+
+func encodeExpressions(list []Expression) interface{} {
+	if list == nil {
+		return nil
+	}
+	out := []interface{}{}
+	for _, e := range list {
+		out = append(out, encodeNode(e))
+	}
+	return out
+}
+
+func encodeIdentifiers(list []*Identifier) interface{} {
+	if list == nil {
+		return nil
+	}
+	out := []interface{}{}
+	for _, i := range list {
+		out = append(out, encodeNode(i))
+	}
+	return out
+}
+
+func encodeTokens(list []token.Token) []jsonToken {
+	out := []jsonToken{}
+	for _, t := range list {
+		out = append(out, encodeToken(t))
+	}
+	return out
+}
+
+// Goのフィールド名をJSONのフィールド名にする
+func jsonFieldName(name string) string {
+	return string(name[0]+'a'-'A') + name[1:]
+}
+
+// nilインターフェースだけでなく、nilポインタを入れたインターフェースもnilとみなす
+func isNilNode(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// "type"フィールドの値から空のノードを作る関数
+var nodeConstructors = map[string]func() Node{
+	"Program":                   func() Node { return &Program{} },
+	"LetStatement":              func() Node { return &LetStatement{} },
+	"ConstStatement":            func() Node { return &ConstStatement{} },
+	"DestructuringLetStatement": func() Node { return &DestructuringLetStatement{} },
+	"ReturnStatement":           func() Node { return &ReturnStatement{} },
+	"DeferStatement":            func() Node { return &DeferStatement{} },
+	"ExpressionStatement":       func() Node { return &ExpressionStatement{} },
+	"BlockStatement":            func() Node { return &BlockStatement{} },
+	"ForStatement":              func() Node { return &ForStatement{} },
+	"WhileStatement":            func() Node { return &WhileStatement{} },
+	"TryCatchStatement":         func() Node { return &TryCatchStatement{} },
+	"BreakStatement":            func() Node { return &BreakStatement{} },
+	"ContinueStatement":         func() Node { return &ContinueStatement{} },
+	"Identifier":                func() Node { return &Identifier{} },
+	"IntegerLiteral":            func() Node { return &IntegerLiteral{} },
+	"FloatLiteral":              func() Node { return &FloatLiteral{} },
+	"Boolean":                   func() Node { return &Boolean{} },
+	"NullLiteral":               func() Node { return &NullLiteral{} },
+	"StringLiteral":             func() Node { return &StringLiteral{} },
+	"PrefixExpression":          func() Node { return &PrefixExpression{} },
+	"InfixExpression":           func() Node { return &InfixExpression{} },
+	"AssignExpression":          func() Node { return &AssignExpression{} },
+	"IfExpression":              func() Node { return &IfExpression{} },
+	"SwitchExpression":          func() Node { return &SwitchExpression{} },
+	"CaseClause":                func() Node { return &CaseClause{} },
+	"FunctionLiteral":           func() Node { return &FunctionLiteral{} },
+	"MacroLiteral":              func() Node { return &MacroLiteral{} },
+	"CallExpression":            func() Node { return &CallExpression{} },
+	"SpreadElement":             func() Node { return &SpreadElement{} },
+	"ArrayLiteral":              func() Node { return &ArrayLiteral{} },
+	"TupleLiteral":              func() Node { return &TupleLiteral{} },
+	"SetLiteral":                func() Node { return &SetLiteral{} },
+	"IndexExpression":           func() Node { return &IndexExpression{} },
+	"SliceExpression":           func() Node { return &SliceExpression{} },
+	"PropagateErrorExpression":  func() Node { return &PropagateErrorExpression{} },
+	"ImportExpression":          func() Node { return &ImportExpression{} },
+	"HashLiteral":               func() Node { return &HashLiteral{} },
+}
+
+// JSONからノードを組み立てる
+// 最初に起きたエラーを覚えておき、それ以降の処理は何もしない
+type decoder struct {
+	err error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("ast: "+format, a...)
+	}
+}
+
+// JSONの値をvに読み込む
+// 値がない(nullまたはフィールドがない)場合は何もせずfalseを返す
+func (d *decoder) value(raw json.RawMessage, v interface{}) bool {
+	if d.err != nil || raw == nil || string(raw) == "null" {
+		return false
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		d.fail("%s", err)
+		return false
+	}
+	return true
+}
+
+func (d *decoder) node(raw json.RawMessage) Node {
+	var fields map[string]json.RawMessage
+	if !d.value(raw, &fields) {
+		return nil
+	}
+
+	var typ string
+	d.value(fields["type"], &typ)
+	constructor, ok := nodeConstructors[typ]
+	if !ok {
+		d.fail("unknown node type %q", typ)
+		return nil
+	}
+	node := constructor()
+
+	v := reflect.ValueOf(node).Elem()
+	var pos jsonPos
+	d.value(fields["pos"], &pos)
+	v.FieldByName("NodePos").Set(reflect.ValueOf(decodePos(pos)))
+	if f := v.FieldByName("Token"); f.IsValid() {
+		var tok jsonToken
+		d.value(fields["token"], &tok)
+		f.Set(reflect.ValueOf(decodeToken(tok)))
+	}
+	for _, name := range []string{"Comments", "TrailingComments"} {
+		if f := v.FieldByName(name); f.IsValid() {
+			f.Set(reflect.ValueOf(d.tokens(fields[jsonFieldName(name)])))
+		}
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		n.Statements = d.statements(fields["statements"])
+	case *LetStatement:
+		n.Name = d.identifier(fields["name"])
+		n.Value = d.expression(fields["value"])
+	case *ConstStatement:
+		n.Name = d.identifier(fields["name"])
+		n.Value = d.expression(fields["value"])
+	case *DestructuringLetStatement:
+		n.Names = d.identifiers(fields["names"])
+		n.Value = d.expression(fields["value"])
+	case *ReturnStatement:
+		n.ReturnValue = d.expression(fields["returnValue"])
+	case *DeferStatement:
+		n.Call = d.expression(fields["call"])
+	case *ExpressionStatement:
+		n.Expression = d.expression(fields["expression"])
+	case *BlockStatement:
+		n.Statements = d.statements(fields["statements"])
+	case *ForStatement:
+		n.Init = d.statement(fields["init"])
+		n.Condition = d.expression(fields["condition"])
+		n.Post = d.expression(fields["post"])
+		n.Body = d.block(fields["body"])
+	case *WhileStatement:
+		n.Condition = d.expression(fields["condition"])
+		n.Body = d.block(fields["body"])
+	case *TryCatchStatement:
+		n.Try = d.block(fields["try"])
+		n.ErrName = d.identifier(fields["errName"])
+		n.Catch = d.block(fields["catch"])
+	case *Identifier:
+		d.value(fields["value"], &n.Value)
+	case *IntegerLiteral:
+		d.value(fields["value"], &n.Value)
+	case *FloatLiteral:
+		d.value(fields["value"], &n.Value)
+	case *Boolean:
+		d.value(fields["value"], &n.Value)
+	case *StringLiteral:
+		d.value(fields["value"], &n.Value)
+	case *PrefixExpression:
+		d.value(fields["operator"], &n.Operator)
+		n.Right = d.expression(fields["right"])
+	case *InfixExpression:
+		n.Left = d.expression(fields["left"])
+		d.value(fields["operator"], &n.Operator)
+		n.Right = d.expression(fields["right"])
+	case *AssignExpression:
+		n.Name = d.identifier(fields["name"])
+		n.Value = d.expression(fields["value"])
+	case *IfExpression:
+		n.Condition = d.expression(fields["condition"])
+		n.Consequence = d.block(fields["consequence"])
+		n.Alternative = d.block(fields["alternative"])
+	case *SwitchExpression:
+		n.Subject = d.expression(fields["subject"])
+		var cases []json.RawMessage
+		d.value(fields["cases"], &cases)
+		for _, raw := range cases {
+			c, ok := d.node(raw).(*CaseClause)
+			if !ok {
+				d.fail("switch case is not a CaseClause")
+				break
+			}
+			n.Cases = append(n.Cases, c)
+		}
+		n.Default = d.block(fields["default"])
+	case *CaseClause:
+		n.Value = d.expression(fields["value"])
+		n.Body = d.block(fields["body"])
+	case *FunctionLiteral:
+		n.Parameters = d.identifiers(fields["parameters"])
+		n.Body = d.block(fields["body"])
+	case *MacroLiteral:
+		n.Parameters = d.identifiers(fields["parameters"])
+		n.Body = d.block(fields["body"])
+	case *CallExpression:
+		n.Function = d.expression(fields["function"])
+		n.Arguments = d.expressions(fields["arguments"])
+	case *SpreadElement:
+		n.Expression = d.expression(fields["expression"])
+	case *ArrayLiteral:
+		n.Elements = d.expressions(fields["elements"])
+	case *TupleLiteral:
+		n.Elements = d.expressions(fields["elements"])
+	case *SetLiteral:
+		n.Elements = d.expressions(fields["elements"])
+	case *IndexExpression:
+		n.Left = d.expression(fields["left"])
+		n.Index = d.expression(fields["index"])
+	case *PropagateErrorExpression:
+		n.Inner = d.expression(fields["inner"])
+	case *ImportExpression:
+		path, ok := d.expression(fields["path"]).(*StringLiteral)
+		if !ok {
+			d.fail("path of import is not a string literal")
+		}
+		n.Path = path
+	case *SliceExpression:
+		n.Left = d.expression(fields["left"])
+		n.Low = d.expression(fields["low"])
+		n.High = d.expression(fields["high"])
+	case *HashLiteral:
+		var pairs []struct {
+			Key   json.RawMessage `json:"key"`
+			Value json.RawMessage `json:"value"`
+		}
+		d.value(fields["pairs"], &pairs)
+		n.Pairs = map[Expression]Expression{}
+		for _, pair := range pairs {
+			key := d.expression(pair.Key)
+			n.Pairs[key] = d.expression(pair.Value)
+			n.Keys = append(n.Keys, key)
+		}
+	}
+
+	if d.err != nil {
+		return nil
+	}
+	return node
+}
+
+func (d *decoder) expression(raw json.RawMessage) Expression {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	e, ok := node.(Expression)
+	if !ok {
+		d.fail("%T is not an expression", node)
+	}
+	return e
+}
+
+func (d *decoder) statement(raw json.RawMessage) Statement {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	s, ok := node.(Statement)
+	if !ok {
+		d.fail("%T is not a statement", node)
+	}
+	return s
+}
+
+func (d *decoder) identifier(raw json.RawMessage) *Identifier {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	i, ok := node.(*Identifier)
+	if !ok {
+		d.fail("%T is not an identifier", node)
+	}
+	return i
+}
+
+func (d *decoder) block(raw json.RawMessage) *BlockStatement {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	b, ok := node.(*BlockStatement)
+	if !ok {
+		d.fail("%T is not a block statement", node)
+	}
+	return b
+}
+
+// nullはnilのスライスに、[]は空のスライスにする
+func (d *decoder) list(raw json.RawMessage) []json.RawMessage {
+	var list []json.RawMessage
+	if d.value(raw, &list) && list == nil {
+		list = []json.RawMessage{}
+	}
+	return list
+}
+
+func (d *decoder) statements(raw json.RawMessage) []Statement {
+	list := d.list(raw)
+	if list == nil {
+		return nil
+	}
+	out := []Statement{}
+	for _, r := range list {
+		out = append(out, d.statement(r))
+	}
+	return out
+}
+
+func (d *decoder) expressions(raw json.RawMessage) []Expression {
+	list := d.list(raw)
+	if list == nil {
+		return nil
+	}
+	out := []Expression{}
+	for _, r := range list {
+		out = append(out, d.expression(r))
+	}
+	return out
+}
+
+func (d *decoder) identifiers(raw json.RawMessage) []*Identifier {
+	list := d.list(raw)
+	if list == nil {
+		return nil
+	}
+	out := []*Identifier{}
+	for _, r := range list {
+		out = append(out, d.identifier(r))
+	}
+	return out
+}
+
+func (d *decoder) tokens(raw json.RawMessage) []token.Token {
+	var list []jsonToken
+	if !d.value(raw, &list) {
+		return nil
+	}
+	out := []token.Token{}
+	for _, t := range list {
+		out = append(out, decodeToken(t))
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+package ast_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+// Marshal → Unmarshal → MarshalでJSONが変わらないことをテスト
+func TestMarshalRoundTrip(t *testing.T) {
+	inputs := []string{
+		"let x = 5; const y = -x * 2.5; x = y;",
+		`let [a, b] = [1, "two", ...rest]; return a;`,
+		"if (a < b) { a } else { b }; if (true) { null }",
+		"let f = fn(x, y) { x + y }; f(1, 2)(3);",
+		`let h = {"b": 1, "a": 2, 3: true}; h["a"]; h.b; h[1:]; h[:2];`,
+		"let t = (1, (2,), #{3, 4}); t[0];",
+		"switch x { case 1: 2; case 3: default: 4 } switch y {}",
+		"for (let i = 0; i < 3; i = i + 1) { continue; } for (;;) { break; }",
+		"while (a && b || c) { break; continue; }",
+		"try { a / b } catch (err) { err; }",
+		"f(x)? + 1;",
+		"fn() { defer puts(1); }",
+		`let io = import "io"; io.puts(1);`,
+		"// header\nlet x = 1; // trailing\nfn() {\n  // inside\n};\n// end",
+	}
+
+	for _, input := range inputs {
+		p := parser.New(lexer.New(input), parser.WithComments())
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser has errors for %q: %v", input, p.Errors())
+		}
+
+		data, err := ast.Marshal(program)
+		if err != nil {
+			t.Fatalf("Marshal(%q) failed: %s", input, err)
+		}
+		node, err := ast.Unmarshal(data)
+		if err != nil {
+			t.Fatalf("Unmarshal(%q) failed: %s", input, err)
+		}
+		again, err := ast.Marshal(node)
+		if err != nil {
+			t.Fatalf("Marshal(Unmarshal(%q)) failed: %s", input, err)
+		}
+		if !bytes.Equal(data, again) {
+			t.Errorf("round trip changed JSON for %q.\nwant=%s\ngot=%s", input, data, again)
+		}
+
+		// 復元したノードは元のノードと同じソースコードに整形される
+		if got, want := ast.Format(node), ast.Format(program); got != want {
+			t.Errorf("unmarshaled node formats differently for %q.\nwant=%q\ngot=%q", input, want, got)
+		}
+	}
+}
+
+// JSONの形をテスト
+func TestMarshalFields(t *testing.T) {
+	program := parseProgram(t, "let x = 5;")
+	data, err := ast.Marshal(program.Statements[0])
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+
+	var let map[string]interface{}
+	if err := json.Unmarshal(data, &let); err != nil {
+		t.Fatalf("invalid JSON %s: %s", data, err)
+	}
+	if let["type"] != "LetStatement" {
+		t.Errorf("wrong type. got=%v", let["type"])
+	}
+	name := let["name"].(map[string]interface{})
+	if name["type"] != "Identifier" || name["value"] != "x" {
+		t.Errorf("wrong name. got=%v", name)
+	}
+	value := let["value"].(map[string]interface{})
+	if value["type"] != "IntegerLiteral" || value["value"] != 5.0 {
+		t.Errorf("wrong value. got=%v", value)
+	}
+	pos := value["pos"].(map[string]interface{})
+	if pos["line"] != 1.0 || pos["column"] != 9.0 {
+		t.Errorf("wrong position. got=%v", pos)
+	}
+	tok := let["token"].(map[string]interface{})
+	if tok["type"] != "LET" || tok["literal"] != "let" {
+		t.Errorf("wrong token. got=%v", tok)
+	}
+
+	if data, err := ast.Marshal(nil); err != nil || string(data) != "null" {
+		t.Errorf("Marshal(nil) wrong. got=%s, %v", data, err)
+	}
+}
+
+// 不正なJSONに対するエラーをテスト
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"type": "Unknown"}`, `ast: unknown node type "Unknown"`},
+		{`{"type": "ExpressionStatement", "expression": {"type": "BreakStatement"}}`, "ast: *ast.BreakStatement is not an expression"},
+		{`{"type": "LetStatement", "name": {"type": "IntegerLiteral"}}`, "ast: *ast.IntegerLiteral is not an identifier"},
+		{`{"type": "IntegerLiteral", "value": "five"}`, "ast: json: cannot unmarshal string into Go value of type int64"},
+	}
+
+	for _, tt := range tests {
+		node, err := ast.Unmarshal([]byte(tt.input))
+		if err == nil {
+			t.Errorf("%s: expected error, got %v", tt.input, node)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
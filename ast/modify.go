@@ -0,0 +1,142 @@
+package ast
+
+// ノードを書き換える関数
+// 受け取ったノードの代わりに使うノードを返す。書き換えない場合は受け取ったノードをそのまま返す
+type ModifierFunc func(Node) Node
+
+// nodeの子ノードを深さ優先で書き換えてから、node自身をmodifierで書き換えた結果を返す
+// 子ノードはその場で置き換えるので、元のASTを残したい場合はCloneしたものを渡す
+// 文や式の位置に文・式として使えないノードが返された場合は、元のノードのままにする
+// 関数の仮引数やlet文の名前、catchのエラー名など、束縛される識別子は書き換えない
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+	case *Program:
+		modifyStatements(n.Statements, modifier)
+	case *BlockStatement:
+		if n != nil {
+			modifyStatements(n.Statements, modifier)
+		}
+	case *ExpressionStatement:
+		n.Expression = modifyExpression(n.Expression, modifier)
+	case *LetStatement:
+		n.Value = modifyExpression(n.Value, modifier)
+	case *ConstStatement:
+		n.Value = modifyExpression(n.Value, modifier)
+	case *DestructuringLetStatement:
+		n.Value = modifyExpression(n.Value, modifier)
+	case *ReturnStatement:
+		n.ReturnValue = modifyExpression(n.ReturnValue, modifier)
+	case *DeferStatement:
+		n.Call = modifyExpression(n.Call, modifier)
+	case *ForStatement:
+		if n.Init != nil {
+			if init, ok := Modify(n.Init, modifier).(Statement); ok {
+				n.Init = init
+			}
+		}
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Post = modifyExpression(n.Post, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+	case *WhileStatement:
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+	case *TryCatchStatement:
+		n.Try = modifyBlock(n.Try, modifier)
+		n.Catch = modifyBlock(n.Catch, modifier)
+	case *PrefixExpression:
+		n.Right = modifyExpression(n.Right, modifier)
+	case *InfixExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Right = modifyExpression(n.Right, modifier)
+	case *AssignExpression:
+		n.Value = modifyExpression(n.Value, modifier)
+	case *IfExpression:
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Consequence = modifyBlock(n.Consequence, modifier)
+		n.Alternative = modifyBlock(n.Alternative, modifier)
+	case *SwitchExpression:
+		n.Subject = modifyExpression(n.Subject, modifier)
+		for _, c := range n.Cases {
+			c.Value = modifyExpression(c.Value, modifier)
+			c.Body = modifyBlock(c.Body, modifier)
+		}
+		n.Default = modifyBlock(n.Default, modifier)
+	case *FunctionLiteral:
+		n.Body = modifyBlock(n.Body, modifier)
+	case *MacroLiteral:
+		n.Body = modifyBlock(n.Body, modifier)
+	case *CallExpression:
+		n.Function = modifyExpression(n.Function, modifier)
+		modifyExpressions(n.Arguments, modifier)
+	case *SpreadElement:
+		n.Expression = modifyExpression(n.Expression, modifier)
+	case *ArrayLiteral:
+		modifyExpressions(n.Elements, modifier)
+	case *SetLiteral:
+		modifyExpressions(n.Elements, modifier)
+	case *TupleLiteral:
+		modifyExpressions(n.Elements, modifier)
+	case *IndexExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Index = modifyExpression(n.Index, modifier)
+	case *PropagateErrorExpression:
+		n.Inner = modifyExpression(n.Inner, modifier)
+	case *SliceExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Low = modifyExpression(n.Low, modifier)
+		n.High = modifyExpression(n.High, modifier)
+	case *HashLiteral:
+		// キーを書き換えるとPairsのキーも変わるので、Keysと合わせて作り直す
+		pairs := make(map[Expression]Expression, len(n.Pairs))
+		var keys []Expression
+		for _, k := range n.OrderedKeys() {
+			key := modifyExpression(k, modifier)
+			pairs[key] = modifyExpression(n.Pairs[k], modifier)
+			keys = append(keys, key)
+		}
+		n.Pairs = pairs
+		if n.Keys != nil {
+			n.Keys = keys
+		}
+	}
+
+	return modifier(node)
+}
+
+func modifyStatements(list []Statement, modifier ModifierFunc) {
+	for i, s := range list {
+		if modified, ok := Modify(s, modifier).(Statement); ok {
+			list[i] = modified
+		}
+	}
+}
+
+func modifyExpressions(list []Expression, modifier ModifierFunc) {
+	for i, e := range list {
+		list[i] = modifyExpression(e, modifier)
+	}
+}
+
+// 式を書き換える
+// 省略された式(nil)はそのままにする
+func modifyExpression(e Expression, modifier ModifierFunc) Expression {
+	if e == nil {
+		return nil
+	}
+	if modified, ok := Modify(e, modifier).(Expression); ok {
+		return modified
+	}
+	return e
+}
+
+// ブロック文を書き換える
+// 省略されたブロック(nil)はそのままにする
+func modifyBlock(b *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+	if modified, ok := Modify(b, modifier).(*BlockStatement); ok {
+		return modified
+	}
+	return b
+}
@@ -0,0 +1,85 @@
+package ast_test
+
+import (
+	"monkey/ast"
+	"testing"
+)
+
+// すべての整数リテラル1を2に書き換えるModifierFunc
+func turnOneIntoTwo(node ast.Node) ast.Node {
+	integer, ok := node.(*ast.IntegerLiteral)
+	if !ok || integer.Value != 1 {
+		return node
+	}
+	integer.Value = 2
+	integer.Token.Literal = "2"
+	return integer
+}
+
+// 各種のノードの子ノードが書き換えられることをテスト
+func TestModify(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1", "2"},
+		{"1 + 2", "2 + 2"},
+		{"-1", "-2"},
+		{"let x = 1; const y = 1; let [a] = 1; return 1;", "let x = 2; const y = 2; let [a] = 2; return 2;"},
+		{"if (1) { 1 } else { 1 }", "if (2) { 2; } else { 2; }"},
+		{"fn(x) { 1 }", "fn(x) { 2; }"},
+		{"macro(x) { 1 }", "macro(x) { 2; }"},
+		{"f(1, 1)", "f(2, 2)"},
+		{"[1, ...[1]]; #{1}; (1, 1)", "[2, ...[2]]; #{2}; (2, 2)"},
+		{"a[1]; a[1:1]; a[:1]", "a[2]; a[2:2]; a[:2]"},
+		{"{1: 1, 3: 1}", "{2: 2, 3: 2}"},
+		{"x = 1", "x = 2"},
+		{"switch 1 { case 1: 1 default: 1 }", "switch 2 { case 2: 2; default: 2; }"},
+		{"for (let i = 1; i < 1; 1) { 1 }", "for (let i = 2; i < 2; 2) { 2; }"},
+		{"while (1) { 1 }", "while (2) { 2; }"},
+		{"try { 1 } catch (e) { 1 }", "try { 2; } catch (e) { 2; }"},
+		{"f(1)?", "f(2)?"},
+		{"fn() { defer f(1) }", "fn() { defer f(2) }"},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+		modified := ast.Modify(program, turnOneIntoTwo)
+
+		expected := ast.Format(parseProgram(t, tt.expected))
+		if got := ast.Format(modified); got != expected {
+			t.Errorf("Modify(%q) wrong.\nwant=%q\ngot=%q", tt.input, expected, got)
+		}
+	}
+}
+
+// ノード自体を別の種類のノードに置き換えられることをテスト
+func TestModifyReplacesNodes(t *testing.T) {
+	program := parseProgram(t, "let x = a + 1; f(a)")
+
+	// 識別子aを文字列リテラルに置き換える
+	modified := ast.Modify(program, func(node ast.Node) ast.Node {
+		ident, ok := node.(*ast.Identifier)
+		if !ok || ident.Value != "a" {
+			return node
+		}
+		return &ast.StringLiteral{Value: "a"}
+	})
+
+	expected := "let x = \"a\" + 1;\nf(\"a\");\n"
+	if got := ast.Format(modified); got != expected {
+		t.Errorf("wrong result.\nwant=%q\ngot=%q", expected, got)
+	}
+
+	// 式の位置に文が返された場合は置き換えない
+	program = parseProgram(t, "a")
+	modified = ast.Modify(program, func(node ast.Node) ast.Node {
+		if _, ok := node.(*ast.Identifier); ok {
+			return &ast.BlockStatement{}
+		}
+		return node
+	})
+	if got := ast.Format(modified); got != "a;\n" {
+		t.Errorf("expression replaced with a statement. got=%q", got)
+	}
+}
@@ -0,0 +1,216 @@
+package ast
+
+// ASTを走査する際に各ノードに対して呼ばれるVisitor
+// go/astのVisitorと同様に、Visitが返したVisitorで子ノードを走査する
+// nilを返した場合はそのノードの子ノードは走査しない
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// nodeを深さ優先で走査する
+// まずv.Visit(node)を呼び、返ってきたVisitorがnilでなければ子ノードを再帰的に走査し、
+// 最後にそのVisitorに対してVisit(nil)を呼ぶ
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+	case *LetStatement:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+	case *ConstStatement:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+	case *DestructuringLetStatement:
+		for _, name := range n.Names {
+			Walk(v, name)
+		}
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+	case *ReturnStatement:
+		if n.ReturnValue != nil {
+			Walk(v, n.ReturnValue)
+		}
+	case *DeferStatement:
+		if n.Call != nil {
+			Walk(v, n.Call)
+		}
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			Walk(v, n.Expression)
+		}
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+	case *SwitchExpression:
+		Walk(v, n.Subject)
+		for _, c := range n.Cases {
+			Walk(v, c)
+		}
+		if n.Default != nil {
+			Walk(v, n.Default)
+		}
+	case *CaseClause:
+		Walk(v, n.Value)
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+	case *ForStatement:
+		if n.Init != nil {
+			Walk(v, n.Init)
+		}
+		if n.Condition != nil {
+			Walk(v, n.Condition)
+		}
+		if n.Post != nil {
+			Walk(v, n.Post)
+		}
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+	case *WhileStatement:
+		Walk(v, n.Condition)
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+	case *TryCatchStatement:
+		if n.Try != nil {
+			Walk(v, n.Try)
+		}
+		if n.ErrName != nil {
+			Walk(v, n.ErrName)
+		}
+		if n.Catch != nil {
+			Walk(v, n.Catch)
+		}
+	case *PrefixExpression:
+		Walk(v, n.Right)
+	case *InfixExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *AssignExpression:
+		Walk(v, n.Name)
+		Walk(v, n.Value)
+	case *IfExpression:
+		Walk(v, n.Condition)
+		if n.Consequence != nil {
+			Walk(v, n.Consequence)
+		}
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+	case *FunctionLiteral:
+		for _, p := range n.Parameters {
+			Walk(v, p)
+		}
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+	case *MacroLiteral:
+		for _, p := range n.Parameters {
+			Walk(v, p)
+		}
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+	case *CallExpression:
+		Walk(v, n.Function)
+		walkExpressions(v, n.Arguments)
+	case *SpreadElement:
+		Walk(v, n.Expression)
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+	case *SetLiteral:
+		walkExpressions(v, n.Elements)
+	case *TupleLiteral:
+		walkExpressions(v, n.Elements)
+	case *IndexExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Index)
+	case *PropagateErrorExpression:
+		Walk(v, n.Inner)
+	case *ImportExpression:
+		Walk(v, n.Path)
+	case *SliceExpression:
+		Walk(v, n.Left)
+		if n.Low != nil {
+			Walk(v, n.Low)
+		}
+		if n.High != nil {
+			Walk(v, n.High)
+		}
+	case *HashLiteral:
+		for _, k := range n.OrderedKeys() {
+			Walk(v, k)
+			Walk(v, n.Pairs[k])
+		}
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *Boolean, *NullLiteral, *StringLiteral, *BreakStatement, *ContinueStatement:
+		// 子ノードを持たない
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, list []Statement) {
+	for _, s := range list {
+		Walk(v, s)
+	}
+}
+
+func walkExpressions(v Visitor, list []Expression) {
+	for _, e := range list {
+		Walk(v, e)
+	}
+}
+
+// nodeの直下の子ノードをWalkが走査する順に返す
+// 子ノードの一覧はWalkの型switchだけで管理し、各ノード型にはメソッドを持たせない
+func Children(node Node) []Node {
+	var children []Node
+	Walk(childCollector{root: node, children: &children}, node)
+	return children
+}
+
+// 根のノードだけを走査し、その直下の子ノードを集めるVisitor
+type childCollector struct {
+	root     Node
+	children *[]Node
+}
+
+func (c childCollector) Visit(node Node) Visitor {
+	if node == c.root {
+		return c
+	}
+	if node != nil {
+		*c.children = append(*c.children, node)
+	}
+	return nil
+}
+
+// 関数をVisitorとして扱うためのアダプタ
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// nodeを深さ優先で走査し、各ノードに対してfを呼ぶ
+// fがfalseを返した場合はそのノードの子ノードは走査しない
+// 子ノードの走査が終わるとf(nil)が呼ばれる
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,188 @@
+package ast_test
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"reflect"
+	"testing"
+)
+
+// すべての種類のノードを含む代表的なプログラム
+const walkInput = `
+let add = fn(x, y) { return x + y; };
+let arr = [1, -2, "three", true];
+let h = {"one": 1, 2: false};
+if (add(1, 2) > 2) { arr[0] } else { arr[1:] };
+h["one"];
+`
+
+func parseWalkInput(t *testing.T) *ast.Program {
+	l := lexer.New(walkInput)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors: %v", p.Errors())
+	}
+	return program
+}
+
+// 各ノード型の出現回数が期待通りであることを確認するテスト
+// ノードにフィールドを追加した際にWalkの更新を忘れるとここで検知できる
+func TestWalkNodeCounts(t *testing.T) {
+	program := parseWalkInput(t)
+
+	counts := map[string]int{}
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n != nil {
+			counts[fmt.Sprintf("%T", n)]++
+		}
+		return true
+	})
+
+	expected := map[string]int{
+		"*ast.Program":             1,
+		"*ast.LetStatement":        3,
+		"*ast.ReturnStatement":     1,
+		"*ast.ExpressionStatement": 4,
+		"*ast.BlockStatement":      3,
+		"*ast.Identifier":          11,
+		"*ast.IntegerLiteral":      9,
+		"*ast.StringLiteral":       3,
+		"*ast.Boolean":             2,
+		"*ast.PrefixExpression":    1,
+		"*ast.InfixExpression":     2,
+		"*ast.IfExpression":        1,
+		"*ast.FunctionLiteral":     1,
+		"*ast.CallExpression":      1,
+		"*ast.ArrayLiteral":        1,
+		"*ast.IndexExpression":     2,
+		"*ast.SliceExpression":     1,
+		"*ast.HashLiteral":         1,
+	}
+
+	for typ, want := range expected {
+		if got := counts[typ]; got != want {
+			t.Errorf("wrong count for %s. want=%d, got=%d", typ, want, got)
+		}
+	}
+	for typ := range counts {
+		if _, ok := expected[typ]; !ok {
+			t.Errorf("unexpected node type visited: %s", typ)
+		}
+	}
+}
+
+// depthVisitorは直下の子ノードだけを数えるVisitor
+type depthVisitor struct {
+	depth    int
+	children *int
+}
+
+func (v depthVisitor) Visit(n ast.Node) ast.Visitor {
+	if n == nil {
+		return nil
+	}
+	if v.depth == 1 {
+		*v.children++
+		return nil
+	}
+	return depthVisitor{depth: v.depth + 1, children: v.children}
+}
+
+// 各ノードについて、Walkが訪れる直下の子ノードの数と
+// リフレクションで数えたNode型フィールドの数が一致することを確認するテスト
+func TestWalkVisitsEveryChildField(t *testing.T) {
+	program := parseWalkInput(t)
+
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		var walked int
+		ast.Walk(depthVisitor{children: &walked}, n)
+		if want := countChildFields(n); walked != want {
+			t.Errorf("Walk visited %d children of %T, want %d (%s)", walked, n, want, n.String())
+		}
+		return true
+	})
+}
+
+var nodeType = reflect.TypeOf((*ast.Node)(nil)).Elem()
+
+// ノードの構造体フィールドのうち、nilでないNode型の値の数を数える
+func countChildFields(n ast.Node) int {
+	v := reflect.ValueOf(n).Elem()
+	count := 0
+	for i := 0; i < v.NumField(); i++ {
+		// HashLiteralのKeysはPairsのキーと同じノードを指しているので数えない
+		if _, ok := n.(*ast.HashLiteral); ok && v.Type().Field(i).Name == "Keys" {
+			continue
+		}
+		f := v.Field(i)
+		switch {
+		case f.Type().Implements(nodeType):
+			if !f.IsNil() {
+				count++
+			}
+		case f.Kind() == reflect.Slice && f.Type().Elem().Implements(nodeType):
+			count += f.Len()
+		case f.Kind() == reflect.Map && f.Type().Key().Implements(nodeType):
+			count += f.Len() * 2
+		}
+	}
+	return count
+}
+
+// Childrenが直下の子ノードをソース上の順に返すことを確認するテスト
+func TestChildren(t *testing.T) {
+	program := parseWalkInput(t)
+
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		if got, want := len(ast.Children(n)), countChildFields(n); got != want {
+			t.Errorf("Children(%T) returned %d nodes, want %d (%s)", n, got, want, n.String())
+		}
+		return true
+	})
+
+	let := program.Statements[0].(*ast.LetStatement)
+	children := ast.Children(let)
+	if len(children) != 2 || children[0] != ast.Node(let.Name) || children[1] != ast.Node(let.Value) {
+		t.Errorf("wrong children of let statement. got=%v", children)
+	}
+	if children := ast.Children(let.Name); len(children) != 0 {
+		t.Errorf("identifier has children. got=%v", children)
+	}
+}
+
+// Visitがnilを返した場合に子ノードを走査しないことを確認するテスト
+func TestInspectPrunes(t *testing.T) {
+	program := parseWalkInput(t)
+
+	visited := 0
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		visited++
+		_, isFn := n.(*ast.FunctionLiteral)
+		return !isFn
+	})
+
+	all := 0
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n != nil {
+			all++
+		}
+		return true
+	})
+
+	// fn(x, y) { return x + y; } の内部の7ノードが走査されない
+	if all-visited != 7 {
+		t.Errorf("wrong number of pruned nodes. want=7, got=%d", all-visited)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"monkey/evaluator"
+	"monkey/format"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/repl"
+	"os"
+	user2 "os/user"
+	"path/filepath"
+)
+
+// monkey <file> の終了コード
+const (
+	exitOK           = 0
+	exitRuntimeError = 1 // 実行中にエラーが起きた
+	exitParseError   = 2 // パースに失敗した
+)
+
+func main() {
+	// monkey fmt [file...] でソースコードを整形して標準出力に書き出す
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		os.Exit(formatFiles(os.Args[2:]))
+	}
+
+	// monkey <file> でファイルのプログラムを実行する
+	if len(os.Args) > 1 {
+		os.Exit(runFile(os.Args[1]))
+	}
+
+	user, err := user2.Current()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("Hello %s! This is the Monkey Progamming language!\n",
+		user.Username)
+
+	fmt.Printf("Feel free to type in commands.\n")
+	opts := repl.Options{LineEditor: true}
+	// 入力の履歴はホームディレクトリの.monkey_historyに保存する
+	if home, err := os.UserHomeDir(); err == nil {
+		opts.HistoryFile = filepath.Join(home, ".monkey_history")
+	}
+	opts.ModulePath = modulePath()
+	// REPLでexitが呼ばれたら、その終了コードでプロセスを終了する
+	os.Exit(repl.StartWithOptions(os.Stdin, os.Stdout, opts))
+}
+
+// importや.loadのファイルが見つからなかったときに探すディレクトリを返す
+// 環境変数MONKEY_PATHにパスの区切り文字で区切って指定する
+func modulePath() []string {
+	return filepath.SplitList(os.Getenv("MONKEY_PATH"))
+}
+
+// ファイルのプログラムを評価器で評価し、終了コードを返す
+// VMと違ってすべての文を実行でき、組み込み関数が返したエラーでも実行を止める
+// エラーは標準エラー出力に書き出す
+func runFile(path string) int {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntimeError
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, msg)
+		}
+		return exitParseError
+	}
+
+	// REPLと同じく、マクロを展開してから評価する
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+		return exitRuntimeError
+	}
+
+	// importの相対パスは、実行するファイルがあるディレクトリから探す
+	e := evaluator.New()
+	e.SetDirectory(filepath.Dir(path))
+	e.SetSearchPath(modulePath())
+	switch evaluated := e.Eval(expanded, object.NewEnvironment()).(type) {
+	case *object.Exit:
+		// exitが呼ばれたら、その終了コードでプロセスを終了する
+		return evaluated.Code
+	case *object.Error:
+		if evaluated.File == "" {
+			evaluated.File = path
+		}
+		fmt.Fprintln(os.Stderr, evaluated.Inspect())
+		return exitRuntimeError
+	}
+	return exitOK
+}
+
+// ファイルを順に整形して標準出力に書き出し、終了コードを返す
+// ファイルが指定されなければ標準入力を整形する
+func formatFiles(paths []string) int {
+	if len(paths) == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return formatSource("<stdin>", src)
+	}
+
+	status := 0
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		if formatSource(path, src) != 0 {
+			status = 1
+		}
+	}
+	return status
+}
+
+func formatSource(name string, src []byte) int {
+	out, err := format.Source(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		return 1
+	}
+	os.Stdout.Write(out)
+	return 0
+}
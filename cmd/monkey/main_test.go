@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// テストのバイナリ自身をmonkeyコマンドとして起動するための環境変数
+const runMainEnv = "MONKEY_TEST_RUN_MAIN"
+
+// 環境変数runMainEnvが設定されていれば、テストの代わりにmainを実行する
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// monkey <file> がプログラムを実行し、結果に応じた終了コードで終わることを確認するテスト
+func TestRunFileExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name   string
+		src    string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{"ok.mk", "let add = fn(a, b) { a + b };\nputs(add(1, 2));\n", exitOK, "3\n", ""},
+		{"parse.mk", "let = 1;\nlet x 2;\n", exitParseError, "", "parse.mk: [line 1, col 5] expected next token to be IDENT"},
+		{"runtime.mk", "let f = fn(x) { x + true };\nf(1);\n", exitRuntimeError, "", "traceback (most recent call last):"},
+		{"undefined.mk", "puts(undefinedName);\n", exitRuntimeError, "", "line 1, col 6: identifier not found: undefinedName"},
+		// 組み込み関数が返したエラーでも実行を止める
+		{"builtin.mk", "let x = len(1);\nputs(\"after\");\n", exitRuntimeError, "", "argument to `len` not supported, got INTEGER"},
+		// コンパイラが対応していない文も実行できる
+		{"loop.mk", "let i = 0;\nwhile (i < 2) { i = i + 1; }\ntry { error(\"x\") } catch (e) { puts(e.message) }\nputs(i);\n", exitOK, "x\n2\n", ""},
+		// importの相対パスは実行するファイルがあるディレクトリから探す
+		{"lib.mk", "let x = 5;\n", exitOK, "", ""},
+		{"import.mk", "let lib = import \"lib\";\nputs(lib.x);\n", exitOK, "5\n", ""},
+		{"exit.mk", "puts(1);\nexit(3);\nputs(2);\n", 3, "1\n", ""},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, []byte(tt.src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		code, stdout, stderr := runMonkey(t, path)
+		if code != tt.code {
+			t.Errorf("%s: wrong exit code. want=%d, got=%d (stderr=%q)", tt.name, tt.code, code, stderr)
+		}
+		if stdout != tt.stdout {
+			t.Errorf("%s: wrong stdout. want=%q, got=%q", tt.name, tt.stdout, stdout)
+		}
+		if !strings.Contains(stderr, tt.stderr) || (tt.stderr == "" && stderr != "") {
+			t.Errorf("%s: wrong stderr. want=%q, got=%q", tt.name, tt.stderr, stderr)
+		}
+	}
+
+	if code, _, _ := runMonkey(t, filepath.Join(dir, "missing.mk")); code != exitRuntimeError {
+		t.Errorf("wrong exit code for a missing file. want=%d, got=%d", exitRuntimeError, code)
+	}
+}
+
+// テストのバイナリをmonkeyコマンドとして引数argsで起動し、終了コードと出力を返す
+func runMonkey(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatalf("failed to run monkey: %s", err)
+	}
+	return cmd.ProcessState.ExitCode(), stdout.String(), stderr.String()
+}
@@ -11,35 +11,50 @@ type Instructions []byte
 type Opcode byte
 
 const (
-	OpConstant      Opcode = iota // sets constant value in constant pool.
-	OpAdd                         // pops 2 topmost elements from off the stack and adds them, pushes back on the top of the stack.
-	OpSub                         // pops 2 topmost elements from off the stack and subtracts them, pushes back on the top of the stack.
-	OpMul                         // pops 2 topmost elements from off the stack and multiplies them, pushes back on the top of the stack.
-	OpDiv                         // pops 2 topmost elements from off the stack and divides them, pushes back on the top of the stack.
-	OpPop                         // makes the stack clean after every expression statement.
-	OpTrue                        // pushes an *object.Boolean(true) on to the stack.
-	OpFalse                       // pushed an *object.Boolean(false) on to the stack.
-	OpEqual                       // pops 2 topmost elements from off the stack and compares them, pushes back the result on the top of the stack.
-	OpNotEqual                    // pops 2 topmost elements from off the stack and compares them, pushes back the result on the top of the stack.
-	OpGreaterThan                 // pops 2 topmost elements from off the stack and compares them, pushes back the result on the top of the stack.
-	OpMinus                       // pops 1 topmost element from off the stack and negates it, pushes back the result on the top of the stack.
-	OpBang                        // pops 1 topmost element from off the stack and negates it, pushes back the result on the top of the stack.
-	OpJumpNotTruthy               // jumps to a certain address if the topmost element on the stack is not truthy
-	OpJump                        // jumps whatever the topmost element of the stack is.
-	OpNull                        // pushes an *object.Null on to the stack.
-	OpGetGlobal                   // gets global variable bound to its operand.
-	OpSetGlobal                   // sets global variable bound to its operand.
-	OpGetLocal                    // gets global variable bound to its operand.
-	OpSetLocal                    // sets local variable bound to its operand.
-	OpArray                       // tells how many elements the array has.
-	OpHash                        // tells how many keys and values the hash has.
-	OpIndex                       // pops 2 topmost elements off from the stack and performs the index operation, puts the result back on.
-	OpCall                        // calls function.
-	OpReturnValue                 // returns from function with return value. The returned value sits on top of the stack.
-	OpReturn                      // return from function with no explicit return value, but implicit vm.Null.
-	OpGetBuiltin                  // loads builtin function on to the stack.
-	OpClosure                     // tells VM to wrap the specified *object.CompiledFunction in an *object.Closure.
-	OpGetFree                     // tells the VM to retrieve free variables for the closure function.
+	OpConstant           Opcode = iota // sets constant value in constant pool.
+	OpAdd                              // pops 2 topmost elements from off the stack and adds them, pushes back on the top of the stack.
+	OpSub                              // pops 2 topmost elements from off the stack and subtracts them, pushes back on the top of the stack.
+	OpMul                              // pops 2 topmost elements from off the stack and multiplies them, pushes back on the top of the stack.
+	OpDiv                              // pops 2 topmost elements from off the stack and divides them, pushes back on the top of the stack.
+	OpPop                              // makes the stack clean after every expression statement.
+	OpTrue                             // pushes an *object.Boolean(true) on to the stack.
+	OpFalse                            // pushed an *object.Boolean(false) on to the stack.
+	OpEqual                            // pops 2 topmost elements from off the stack and compares them, pushes back the result on the top of the stack.
+	OpNotEqual                         // pops 2 topmost elements from off the stack and compares them, pushes back the result on the top of the stack.
+	OpGreaterThan                      // pops 2 topmost elements from off the stack and compares them, pushes back the result on the top of the stack.
+	OpMinus                            // pops 1 topmost element from off the stack and negates it, pushes back the result on the top of the stack.
+	OpBang                             // pops 1 topmost element from off the stack and negates it, pushes back the result on the top of the stack.
+	OpJumpNotTruthy                    // jumps to a certain address if the topmost element on the stack is not truthy
+	OpJump                             // jumps whatever the topmost element of the stack is.
+	OpNull                             // pushes an *object.Null on to the stack.
+	OpGetGlobal                        // gets global variable bound to its operand.
+	OpSetGlobal                        // sets global variable bound to its operand.
+	OpGetLocal                         // gets global variable bound to its operand.
+	OpSetLocal                         // sets local variable bound to its operand.
+	OpArray                            // tells how many elements the array has.
+	OpHash                             // tells how many keys and values the hash has.
+	OpIndex                            // pops 2 topmost elements off from the stack and performs the index operation, puts the result back on.
+	OpCall                             // calls function.
+	OpReturnValue                      // returns from function with return value. The returned value sits on top of the stack.
+	OpReturn                           // return from function with no explicit return value, but implicit vm.Null.
+	OpGetBuiltin                       // loads builtin function on to the stack.
+	OpClosure                          // tells VM to wrap the specified *object.CompiledFunction in an *object.Closure.
+	OpGetFree                          // tells the VM to retrieve free variables for the closure function.
+	OpSlice                            // pops the object being sliced and its low and high bounds (vm.Null if omitted), puts the slice back on. the operand tells which bounds were given.
+	OpSpread                           // marks the array on top of the stack to be spread into the array built by the following OpArray.
+	OpGreaterThanOrEqual               // pops 2 topmost elements from off the stack and compares them, pushes back the result on the top of the stack.
+	OpSet                              // tells how many elements the set has.
+	OpTuple                            // tells how many elements the tuple has.
+	OpMod                              // pops 2 topmost elements from off the stack and computes the remainder of dividing them, pushes back on the top of the stack.
+	OpLessThan                         // pops 2 topmost elements from off the stack and compares them, pushes back the result on the top of the stack.
+	OpPropagateError                   // returns from function with the topmost element if it is an *object.Error, otherwise leaves it on the stack.
+	OpLessThanOrEqual                  // pops 2 topmost elements from off the stack and compares them, pushes back the result on the top of the stack.
+)
+
+// Flags of the OpSlice operand. A bound that is not flagged was omitted, so an explicit null bound can be told apart from it.
+const (
+	SliceLow  = 1 << iota // the low bound was given.
+	SliceHigh             // the high bound was given.
 )
 
 type Definition struct {
@@ -77,6 +92,16 @@ var definitions = map[Opcode]*Definition{
 	OpGetBuiltin:    {"OpGetBuiltin", []int{1}},
 	OpClosure:       {"OpClosure", []int{2, 1}},
 	OpGetFree:       {"OpGetFree", []int{1}},
+	OpSlice:         {"OpSlice", []int{1}},
+	OpSpread:        {"OpSpread", []int{}},
+
+	OpGreaterThanOrEqual: {"OpGreaterThanOrEqual", []int{}},
+	OpSet:                {"OpSet", []int{2}},
+	OpTuple:              {"OpTuple", []int{2}},
+	OpMod:                {"OpMod", []int{}},
+	OpLessThan:           {"OpLessThan", []int{}},
+	OpPropagateError:     {"OpPropagateError", []int{}},
+	OpLessThanOrEqual:    {"OpLessThanOrEqual", []int{}},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -112,17 +137,34 @@ func Make(op Opcode, operands ...int) []byte { // note: constant value is indexi
 	return instruction
 }
 
+// Constant is a value in the constant pool as the disassembler sees it. object.Object satisfies it.
+// (code can't refer to object.Object itself, since object depends on code.)
+type Constant interface {
+	Inspect() string
+}
+
 func (ins Instructions) String() string {
+	return ins.Disassemble(nil)
+}
+
+// Disassemble returns the human-readable listing of the instructions, one instruction per line.
+// When constants is non-nil, the value an OpConstant loads is shown after it like "0000 OpConstant 0 (42)".
+func (ins Instructions) Disassemble(constants []Constant) string {
 	var out bytes.Buffer
 	i := 0
 	for i < len(ins) {
 		def, err := Lookup(ins[i])
 		if err != nil {
-			fmt.Fprintf(&out, "ERROR: %s.\n", err)
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
 			continue
 		}
 		operands, read := ReadOperands(def, ins[i+1:])
-		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		fmt.Fprintf(&out, "%04d %s", i, ins.fmtInstruction(def, operands))
+		if Opcode(ins[i]) == OpConstant && constants != nil && operands[0] < len(constants) {
+			fmt.Fprintf(&out, " (%s)", constants[operands[0]].Inspect())
+		}
+		out.WriteString("\n")
 		i += 1 + read
 	}
 	return out.String()
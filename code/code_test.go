@@ -54,6 +54,47 @@ func TestInstructionsString(t *testing.T) {
 	}
 }
 
+type testConstant string
+
+func (c testConstant) Inspect() string { return string(c) }
+
+func TestInstructionsDisassemble(t *testing.T) {
+	instructions := Instructions{}
+	for _, ins := range [][]byte{
+		Make(OpConstant, 1),
+		Make(OpSetGlobal, 3),
+		Make(OpGetGlobal, 3),
+		Make(OpConstant, 2),
+		Make(OpAdd),
+		Make(OpPop),
+	} {
+		instructions = append(instructions, ins...)
+	}
+	constants := []Constant{testConstant("1"), testConstant("42"), testConstant("hello")}
+
+	expected := `0000 OpConstant 1 (42)
+0003 OpSetGlobal 3
+0006 OpGetGlobal 3
+0009 OpConstant 2 (hello)
+0012 OpAdd
+0013 OpPop
+`
+	if got := instructions.Disassemble(constants); got != expected {
+		t.Errorf("instructions wrongly disassembled.\nwant=%q\ngot=%q", expected, got)
+	}
+
+	// without constants, it is the same as String.
+	if got := instructions.Disassemble(nil); got != instructions.String() {
+		t.Errorf("Disassemble(nil) differs from String().\nwant=%q\ngot=%q", instructions.String(), got)
+	}
+
+	// an undefined opcode doesn't stop the listing.
+	expected = "0000 OpPop\nERROR: opcode 255 is undefined.\n0002 OpPop\n"
+	if got := (Instructions{byte(OpPop), 255, byte(OpPop)}).String(); got != expected {
+		t.Errorf("undefined opcode wrongly disassembled.\nwant=%q\ngot=%q", expected, got)
+	}
+}
+
 func TestReadOperands(t *testing.T) {
 	tests := []struct {
 		op        Opcode
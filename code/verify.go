@@ -0,0 +1,58 @@
+package code
+
+import "fmt"
+
+// Verify statically checks the structural invariants of the top-level instructions of a program
+// that refers to numConstants constants. It doesn't run the instructions.
+// The top level has no local bindings, so any OpGetLocal or OpSetLocal is an error.
+func Verify(ins Instructions, numConstants int) error {
+	return VerifyFunction(ins, numConstants, 0)
+}
+
+// VerifyFunction is like Verify, but for the body of a function that has numLocals local bindings.
+// It checks that
+//   - every opcode is defined and its operands are not cut off,
+//   - OpConstant and OpClosure refer to an existing constant,
+//   - OpJump and OpJumpNotTruthy land on the first byte of an instruction or just past the last one, and
+//   - OpGetLocal and OpSetLocal refer to an existing local binding.
+func VerifyFunction(ins Instructions, numConstants, numLocals int) error {
+	// collect where each instruction starts first, since jumps may go forward.
+	// a loop at the end of the program exits by jumping just past the last instruction.
+	starts := map[int]bool{len(ins): true}
+	for i := 0; i < len(ins); {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			return fmt.Errorf("%04d: %s", i, err)
+		}
+		width := 1
+		for _, w := range def.OperandWidth {
+			width += w
+		}
+		if i+width > len(ins) {
+			return fmt.Errorf("%04d: operands of %s are cut off", i, def.Name)
+		}
+		starts[i] = true
+		i += width
+	}
+
+	for i := 0; i < len(ins); {
+		def, _ := Lookup(ins[i])
+		operands, read := ReadOperands(def, ins[i+1:])
+		switch Opcode(ins[i]) {
+		case OpConstant, OpClosure:
+			if operands[0] >= numConstants {
+				return fmt.Errorf("%04d: %s refers to constant %d, but there are only %d", i, def.Name, operands[0], numConstants)
+			}
+		case OpJump, OpJumpNotTruthy:
+			if !starts[operands[0]] {
+				return fmt.Errorf("%04d: %s jumps to %d, which is not the start of an instruction", i, def.Name, operands[0])
+			}
+		case OpGetLocal, OpSetLocal:
+			if operands[0] >= numLocals {
+				return fmt.Errorf("%04d: %s refers to local %d, but there are only %d", i, def.Name, operands[0], numLocals)
+			}
+		}
+		i += 1 + read
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package code
+
+import "testing"
+
+func concat(instructions ...[]byte) Instructions {
+	out := Instructions{}
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name         string
+		ins          Instructions
+		numConstants int
+		numLocals    int
+		expected     string // empty when the instructions are valid
+	}{
+		{
+			"valid",
+			concat(Make(OpConstant, 0), Make(OpJumpNotTruthy, 12), Make(OpConstant, 1), Make(OpJump, 13), Make(OpNull), Make(OpPop)),
+			2, 0, "",
+		},
+		{
+			"jump past the last instruction",
+			concat(Make(OpTrue), Make(OpJumpNotTruthy, 4)),
+			0, 0, "",
+		},
+		{
+			"locals and closures in a function",
+			concat(Make(OpClosure, 0, 0), Make(OpSetLocal, 1), Make(OpGetLocal, 1), Make(OpReturnValue)),
+			1, 2, "",
+		},
+		{
+			"constant out of range",
+			concat(Make(OpConstant, 0), Make(OpConstant, 2)),
+			2, 0, "0003: OpConstant refers to constant 2, but there are only 2",
+		},
+		{
+			"closure out of range",
+			concat(Make(OpClosure, 1, 0)),
+			1, 0, "0000: OpClosure refers to constant 1, but there are only 1",
+		},
+		{
+			"jump into the middle of an instruction",
+			concat(Make(OpJump, 4), Make(OpConstant, 0)),
+			1, 0, "0000: OpJump jumps to 4, which is not the start of an instruction",
+		},
+		{
+			"jump out of range",
+			concat(Make(OpTrue), Make(OpJumpNotTruthy, 100)),
+			0, 0, "0001: OpJumpNotTruthy jumps to 100, which is not the start of an instruction",
+		},
+		{
+			"local at the top level",
+			concat(Make(OpGetLocal, 0)),
+			0, 0, "0000: OpGetLocal refers to local 0, but there are only 0",
+		},
+		{
+			"local out of range",
+			concat(Make(OpSetLocal, 0), Make(OpSetLocal, 1)),
+			0, 1, "0002: OpSetLocal refers to local 1, but there are only 1",
+		},
+		{
+			"undefined opcode",
+			Instructions{byte(OpPop), 255},
+			0, 0, "0001: opcode 255 is undefined.",
+		},
+		{
+			"operands cut off",
+			concat(Make(OpPop), Make(OpConstant, 0)[:2]),
+			1, 0, "0001: operands of OpConstant are cut off",
+		},
+	}
+
+	for _, tt := range tests {
+		err := VerifyFunction(tt.ins, tt.numConstants, tt.numLocals)
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", tt.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected error %q", tt.name, tt.expected)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.name, tt.expected, err.Error())
+		}
+	}
+
+	// Verify checks the top level, which has no locals.
+	if err := Verify(concat(Make(OpGetLocal, 0)), 0); err == nil {
+		t.Errorf("Verify accepted OpGetLocal at the top level")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"monkey/code"
 	"monkey/object"
 	"sort"
+	"strings"
 )
 
 type Compiler struct {
@@ -13,6 +14,8 @@ type Compiler struct {
 	symbolTable *SymbolTable       // holds symbol table, where each identifier is associated with information like its scope.
 	scopes      []CompilationScope // is stack of compilation scopes.
 	scopeIndex  int
+
+	preallocation bool // tells whether to pre-allocate instructions based on the estimated size of the AST.
 }
 
 type EmittedInstruction struct {
@@ -37,10 +40,11 @@ func New() *Compiler {
 		symbolTable.DefineBuiltin(i, v.Name)
 	}
 	return &Compiler{
-		constants:   []object.Object{},
-		symbolTable: symbolTable,
-		scopes:      []CompilationScope{mainScope},
-		scopeIndex:  0,
+		constants:     []object.Object{},
+		symbolTable:   symbolTable,
+		scopes:        []CompilationScope{mainScope},
+		scopeIndex:    0,
+		preallocation: true,
 	}
 }
 
@@ -54,6 +58,7 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 func (c *Compiler) Compile(node ast.Node) error {
 	switch node := node.(type) {
 	case *ast.Program:
+		c.preallocate(node)
 		for _, s := range node.Statements {
 			err := c.Compile(s)
 			if err != nil {
@@ -67,17 +72,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpPop)
 	case *ast.InfixExpression:
-		if node.Operator == "<" {
-			err := c.Compile(node.Right)
-			if err != nil {
-				return err
-			}
-			err = c.Compile(node.Left)
-			if err != nil {
-				return err
-			}
-			c.emit(code.OpGreaterThan)
-			return nil
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
 		}
 		err := c.Compile(node.Left)
 		if err != nil {
@@ -96,8 +92,16 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMul)
 		case "/":
 			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
+		case "<":
+			c.emit(code.OpLessThan)
 		case ">":
 			c.emit(code.OpGreaterThan)
+		case ">=":
+			c.emit(code.OpGreaterThanOrEqual)
+		case "<=":
+			c.emit(code.OpLessThanOrEqual)
 		case "==":
 			c.emit(code.OpEqual)
 		case "!=":
@@ -127,6 +131,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 		} else {
 			c.emit(code.OpFalse)
 		}
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+	case *ast.NullLiteral:
+		c.emit(code.OpNull)
 	case *ast.StringLiteral:
 		str := &object.String{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(str))
@@ -140,6 +149,32 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 		c.emit(code.OpIndex)
+	case *ast.PropagateErrorExpression:
+		err := c.Compile(node.Inner)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpPropagateError)
+	case *ast.SliceExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		// omitted bounds are pushed as null, and the VM fills in their defaults.
+		// the operand flags the given bounds, so that an explicit null is still rejected.
+		flags := 0
+		for i, bound := range []ast.Expression{node.Low, node.High} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			err := c.Compile(bound)
+			if err != nil {
+				return err
+			}
+			flags |= []int{code.SliceLow, code.SliceHigh}[i]
+		}
+		c.emit(code.OpSlice, flags)
 	case *ast.ArrayLiteral:
 		for _, el := range node.Elements {
 			err := c.Compile(el)
@@ -148,6 +183,28 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 		c.emit(code.OpArray, len(node.Elements))
+	case *ast.SetLiteral:
+		for _, el := range node.Elements {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSet, len(node.Elements))
+	case *ast.TupleLiteral:
+		for _, el := range node.Elements {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpTuple, len(node.Elements))
+	case *ast.SpreadElement:
+		err := c.Compile(node.Expression)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpSpread)
 	case *ast.HashLiteral:
 		// Since Golang does not guarantee a consistent order when iterating through the keys and values of a map,
 		// we need to manually sort the keys before we can compile them.
@@ -183,9 +240,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
-		}
+		c.leaveBlockValue()
 
 		// Emit an `OpJump` with a bogus value
 		jumpPos := c.emit(code.OpJump, 9999)
@@ -202,13 +257,108 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 
-			if c.lastInstructionIs(code.OpPop) {
-				c.removeLastPop()
-			}
+			c.leaveBlockValue()
 		}
 		// back-patching method: replace the operand of `OpJump` after emitting Alternative part.
 		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos)
+	case *ast.SwitchExpression:
+		// the subject is evaluated once and kept in a temporary slot to compare it with each case.
+		err := c.Compile(node.Subject)
+		if err != nil {
+			return err
+		}
+		subject := c.symbolTable.defineTemporary()
+		c.setSymbol(subject)
+
+		jumpPositions := []int{}
+		for _, clause := range node.Cases {
+			c.loadSymbol(subject)
+			err := c.Compile(clause.Value)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpEqual)
+			// Emit an `OpJumpNotTruthy` with a bogus value
+			jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+			err = c.Compile(clause.Body)
+			if err != nil {
+				return err
+			}
+			c.leaveBlockValue()
+			// Emit an `OpJump` with a bogus value
+			jumpPositions = append(jumpPositions, c.emit(code.OpJump, 9999))
+
+			// back-patching method: a mismatch jumps to the next case.
+			c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+		}
+
+		if node.Default == nil {
+			c.emit(code.OpNull) // means artificial default for switch.
+		} else {
+			err := c.Compile(node.Default)
+			if err != nil {
+				return err
+			}
+			c.leaveBlockValue()
+		}
+
+		// back-patching method: every matched case jumps to the end of the switch.
+		afterSwitchPos := len(c.currentInstructions())
+		for _, pos := range jumpPositions {
+			c.changeOperand(pos, afterSwitchPos)
+		}
+	case *ast.WhileStatement, *ast.BreakStatement, *ast.ContinueStatement, *ast.MacroLiteral, *ast.TryCatchStatement, *ast.DeferStatement, *ast.ImportExpression:
+		return fmt.Errorf("%s is not supported by the compiler", node.TokenLiteral())
+	case *ast.ForStatement:
+		// the loop has its own block scope, so the loop variable and the lets in the body are not visible after the loop.
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+		defer func() { c.symbolTable = c.symbolTable.Outer }()
+
+		if node.Init != nil {
+			err := c.Compile(node.Init)
+			if err != nil {
+				return err
+			}
+		}
+
+		conditionPos := len(c.currentInstructions())
+		jumpNotTruthyPos := -1
+		if node.Condition != nil {
+			err := c.Compile(node.Condition)
+			if err != nil {
+				return err
+			}
+			// Emit an `OpJumpNotTruthy` with a bogus value
+			jumpNotTruthyPos = c.emit(code.OpJumpNotTruthy, 9999)
+		}
+
+		// the body has a block scope inside the loop's, so a let in the body shadows the loop variable
+		// instead of updating it, as in the evaluator. The loop variable is updated by assignment.
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+		err := c.Compile(node.Body)
+		c.symbolTable = c.symbolTable.Outer
+		if err != nil {
+			return err
+		}
+
+		if node.Post != nil {
+			err := c.Compile(node.Post)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpPop) // the value of the post expression is not used.
+		}
+
+		// back-edge to the condition check.
+		c.emit(code.OpJump, conditionPos)
+
+		// back-patching method: replace the operand of `OpJumpNotTruthy` after emitting the loop.
+		if jumpNotTruthyPos >= 0 {
+			afterLoopPos := len(c.currentInstructions())
+			c.changeOperand(jumpNotTruthyPos, afterLoopPos)
+		}
 	case *ast.BlockStatement:
 		for _, s := range node.Statements {
 			err := c.Compile(s)
@@ -217,50 +367,61 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 	case *ast.LetStatement:
-		symbol := c.symbolTable.Define(node.Name.Value)
-		err := c.Compile(node.Value)
+		symbol, err := c.defineLet(node.Name.Value, node.Value, "")
 		if err != nil {
 			return err
 		}
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
-		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
-		}
-	case *ast.Identifier:
-		symbol, ok := c.symbolTable.Resolve(node.Value)
-		if !ok {
-			return fmt.Errorf("undefined variable %s", node.Value)
+		c.setSymbol(symbol)
+	case *ast.DestructuringLetStatement:
+		// the array is kept in a temporary slot and each name is bound to `array[i]`,
+		// which is null when the array is too short. Unlike the evaluator, the value isn't checked to be an array.
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
 		}
-		c.loadSymbol(symbol)
-	case *ast.FunctionLiteral:
-		c.enterScope() // entering new scope.
-		for _, p := range node.Parameters {
-			c.symbolTable.Define(p.Value)
+		array := c.symbolTable.defineTemporary()
+		c.setSymbol(array)
+		for i, name := range node.Names {
+			c.loadSymbol(array)
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: int64(i)}))
+			c.emit(code.OpIndex)
+			symbol, ok := c.symbolTable.Lookup(name.Value)
+			if !ok || (symbol.Scope != GlobalScope && symbol.Scope != LocalScope) {
+				symbol = c.symbolTable.Define(name.Value)
+			}
+			c.setSymbol(symbol)
 		}
-		err := c.Compile(node.Body)
+	case *ast.ConstStatement:
+		// Constants are compiled just like let bindings for now. The annotation is there for future optimizations.
+		symbol, err := c.defineLet(node.Name.Value, node.Value, ConstScope)
 		if err != nil {
 			return err
 		}
-		if c.lastInstructionIs(code.OpPop) {
-			c.replaceLastPopWithReturn()
+		c.setSymbol(symbol)
+	case *ast.AssignExpression:
+		symbol, ok := c.symbolTable.Resolve(node.Name.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", node.Name.Value)
 		}
-		if !c.lastInstructionIs(code.OpReturnValue) {
-			c.emit(code.OpReturn)
+		if symbol.Scope != GlobalScope && symbol.Scope != LocalScope {
+			return fmt.Errorf("cannot assign to %s variable %s", strings.ToLower(string(symbol.Scope)), node.Name.Value)
 		}
-		freeSymbols := c.symbolTable.FreeSymbols
-		numLocals := c.symbolTable.numDefinitions
-		instructions := c.leaveScope()
-		for _, s := range freeSymbols { // put free variables onto the stack
-			c.loadSymbol(s)
+		if symbol.Annotation == ConstScope {
+			return fmt.Errorf("cannot assign to constant %s", node.Name.Value)
 		}
-		compiledFn := &object.CompiledFunction{
-			Instructions:  instructions,
-			NumLocals:     numLocals,
-			NumParameters: len(node.Parameters),
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.setSymbol(symbol)
+		c.loadSymbol(symbol)
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", node.Value)
 		}
-		fnIndex := c.addConstant(compiledFn)
-		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+		c.loadSymbol(symbol)
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node, "")
 	case *ast.ReturnStatement:
 		err := c.Compile(node.ReturnValue)
 		if err != nil {
@@ -295,11 +456,62 @@ type Bytecode struct {
 	Constants    []object.Object   // serves as constant pool. each object is already evaluated by compiler.
 }
 
+// Disassemble returns the listing of the top-level instructions with the values of the constants they load.
+func (b *Bytecode) Disassemble() string {
+	constants := make([]code.Constant, len(b.Constants))
+	for i, constant := range b.Constants {
+		constants[i] = constant
+	}
+	return b.Instructions.Disassemble(constants)
+}
+
+// Verify checks the structural invariants of the top-level instructions and of every compiled function
+// in the constant pool with code.Verify, so that a compiler bug shows up before the VM runs the bytecode.
+func (b *Bytecode) Verify() error {
+	if err := code.Verify(b.Instructions, len(b.Constants)); err != nil {
+		return fmt.Errorf("main program: %s", err)
+	}
+	for i, constant := range b.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		if err := code.VerifyFunction(fn.Instructions, len(b.Constants), fn.NumLocals); err != nil {
+			return fmt.Errorf("function in constant %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
 func (c *Compiler) addConstant(obj object.Object) int {
+	// reuse an equal literal already in the pool so that repeated literals are stored only once.
+	for i, constant := range c.constants {
+		if sameConstant(constant, obj) {
+			return i
+		}
+	}
 	c.constants = append(c.constants, obj) // adds obj to compiler's constant pool
 	return len(c.constants) - 1            // and return its index.
 }
 
+// sameConstant reports whether a and b are literals of the same type and value.
+// Compiled functions are never shared, even if their instructions happen to be identical.
+func sameConstant(a, b object.Object) bool {
+	switch a := a.(type) {
+	case *object.Integer:
+		b, ok := b.(*object.Integer)
+		return ok && a.Value == b.Value
+	case *object.Float:
+		b, ok := b.(*object.Float)
+		return ok && a.Value == b.Value
+	case *object.String:
+		b, ok := b.(*object.String)
+		return ok && a.Value == b.Value
+	default:
+		return false
+	}
+}
+
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
@@ -337,6 +549,19 @@ func (c *Compiler) removeLastPop() {
 	c.scopes[c.scopeIndex].lastInstruction = previous
 }
 
+// leaveBlockValue makes sure a compiled branch of a conditional leaves exactly one value on the stack.
+// A branch ending with an expression keeps that value by dropping its OpPop,
+// while an empty branch or one ending with a let statement evaluates to Null, just like in the evaluator.
+func (c *Compiler) leaveBlockValue() {
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+		return
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpNull)
+	}
+}
+
 func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) { // What is this function doing ?
 	ins := c.currentInstructions()
 	for i := 0; i < len(newInstruction); i++ {
@@ -354,6 +579,102 @@ func (c *Compiler) currentInstructions() code.Instructions {
 	return c.scopes[c.scopeIndex].instructions
 }
 
+// defineLet compiles the value of a let (or const) statement and returns the symbol the value should be bound to,
+// annotated with annotation.
+// Rebinding a name already defined in the current scope reuses its slot, so that `let x = x + 1` reads the old value.
+// A name bound by const can't be rebound.
+// A new name is defined after compiling the value, so that it can refer to an outer binding of the same name,
+// except for function literals, which are defined first so that they can call themselves recursively.
+func (c *Compiler) defineLet(name string, value ast.Expression, annotation SymbolScope) (Symbol, error) {
+	symbol, ok := c.symbolTable.Lookup(name)
+	fn, isFunction := value.(*ast.FunctionLiteral)
+	if ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		if symbol.Annotation == ConstScope {
+			return Symbol{}, fmt.Errorf("cannot redeclare constant %s", name)
+		}
+		if isFunction {
+			return c.symbolTable.annotate(name, annotation), c.compileFunctionLiteral(fn, name)
+		}
+		return c.symbolTable.annotate(name, annotation), c.Compile(value)
+	}
+	if isFunction {
+		c.symbolTable.Define(name)
+		return c.symbolTable.annotate(name, annotation), c.compileFunctionLiteral(fn, name)
+	}
+	if err := c.Compile(value); err != nil {
+		return Symbol{}, err
+	}
+	c.symbolTable.Define(name)
+	return c.symbolTable.annotate(name, annotation), nil
+}
+
+// compileFunctionLiteral compiles a function literal into a closure.
+// name is the name a let statement binds the function to, and is kept for stack traces. it's empty for anonymous functions.
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral, name string) error {
+	c.enterScope() // entering new scope.
+	c.preallocate(node.Body)
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+	err := c.Compile(node.Body)
+	if err != nil {
+		return err
+	}
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	instructions := c.leaveScope()
+	for _, s := range freeSymbols { // put free variables onto the stack
+		c.loadSymbol(s)
+	}
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Name:          name,
+	}
+	fnIndex := c.addConstant(compiledFn)
+	c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+	return nil
+}
+
+// compileLogicalExpression compiles `a && b` and `a || b` so that they short-circuit.
+// The left operand is kept in a temporary slot, since it's both the condition and possibly the result:
+// `a || b` results in a if it's truthy and b otherwise, `a && b` results in a if it's falsy and b otherwise.
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+	left := c.symbolTable.defineTemporary()
+	c.setSymbol(left)
+	c.loadSymbol(left)
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	// the left operand is truthy.
+	if node.Operator == "||" {
+		c.loadSymbol(left)
+	} else if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	// the left operand is falsy.
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	if node.Operator == "&&" {
+		c.loadSymbol(left)
+	} else if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
 func (c *Compiler) enterScope() {
 	scope := CompilationScope{
 		instructions:        code.Instructions{},
@@ -379,6 +700,15 @@ func (c *Compiler) replaceLastPopWithReturn() {
 	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
 }
 
+// setSymbol emits the instruction that pops the top of the stack into the slot of s.
+func (c *Compiler) setSymbol(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
 func (c *Compiler) loadSymbol(s Symbol) {
 	switch s.Scope {
 	case GlobalScope:
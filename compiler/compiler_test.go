@@ -81,9 +81,12 @@ func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 			t.Fatalf("compiler error: %s", err)
 		}
 		bytecode := compiler.Bytecode()
+		if err := bytecode.Verify(); err != nil {
+			t.Fatalf("invalid bytecode: %s", err)
+		}
 		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
 		if err != nil {
-			t.Fatalf("testInstructions failed: %s", err)
+			t.Fatalf("testInstructions failed: %s\nwith constants:\n%s", err, bytecode.Disassemble())
 		}
 		err = testConstants(tt.expectedConstants, bytecode.Constants)
 		if err != nil {
@@ -135,6 +138,11 @@ func testConstants(expected []interface{}, actual []object.Object) error {
 			if err != nil {
 				return fmt.Errorf("constant %d - testStringObject failed: %s", i, err)
 			}
+		case bool:
+			err := testBooleanObject(constant, actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testBooleanObject failed: %s", i, err)
+			}
 		case []code.Instructions:
 			fn, ok := actual[i].(*object.CompiledFunction)
 			if !ok {
@@ -171,6 +179,41 @@ func testStringObject(expected string, actual object.Object) error {
 	return nil
 }
 
+func testBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T (%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+	}
+	return nil
+}
+
+func TestBooleanConstants(t *testing.T) {
+	// no construct emits boolean constants yet (booleans use OpTrue/OpFalse),
+	// so check the helper directly against a hand-made constant pool.
+	actual := []object.Object{
+		&object.Integer{Value: 1},
+		&object.Boolean{Value: true},
+		&object.Boolean{Value: false},
+	}
+	if err := testConstants([]interface{}{1, true, false}, actual); err != nil {
+		t.Fatalf("testConstants failed: %s", err)
+	}
+
+	mismatches := [][]interface{}{
+		{1, false, false},
+		{1, true, true},
+		{true, true, false},
+	}
+	for _, expected := range mismatches {
+		if err := testConstants(expected, actual); err == nil {
+			t.Errorf("testConstants(%v) should fail", expected)
+		}
+	}
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -201,11 +244,31 @@ func TestBooleanExpressions(t *testing.T) {
 		},
 		{
 			input:             "1 < 2",
-			expectedConstants: []interface{}{2, 1},
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGreaterThan),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 >= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGreaterThanOrEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 <= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThanOrEqual),
 				code.Make(code.OpPop),
 			},
 		},
@@ -262,6 +325,56 @@ func TestBooleanExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestLogicalExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 && 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003 - the left operand is kept in a temporary slot.
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpJumpNotTruthy, 18),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpJump, 21),
+				// 0018
+				code.Make(code.OpGetGlobal, 0),
+				// 0021
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 || 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpJumpNotTruthy, 18),
+				// 0012
+				code.Make(code.OpGetGlobal, 0),
+				// 0015
+				code.Make(code.OpJump, 21),
+				// 0018
+				code.Make(code.OpConstant, 1),
+				// 0021
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
 func TestConditionals(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -398,6 +511,41 @@ func TestConditionals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestLetInsideIfBlock(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// there is no block scope: x is defined as a global and the branch evaluates to Null.
+			input:             `if (true) { let x = 9 }; x`,
+			expectedConstants: []interface{}{9},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),              // 0000
+				code.Make(code.OpJumpNotTruthy, 14), // 0001
+				code.Make(code.OpConstant, 0),       // 0004
+				code.Make(code.OpSetGlobal, 0),      // 0007
+				code.Make(code.OpNull),              // 0010 value of the consequence
+				code.Make(code.OpJump, 15),          // 0011
+				code.Make(code.OpNull),              // 0014 artificial alternative
+				code.Make(code.OpPop),               // 0015
+				code.Make(code.OpGetGlobal, 0),      // 0016
+				code.Make(code.OpPop),               // 0019
+			},
+		},
+		{
+			input:             `if (true) { } else { }`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 8), // 0001
+				code.Make(code.OpNull),             // 0004
+				code.Make(code.OpJump, 9),          // 0005
+				code.Make(code.OpNull),             // 0008
+				code.Make(code.OpPop),              // 0009
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
 func TestGlobalLetStatements(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -446,6 +594,272 @@ func TestGlobalLetStatements(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestLetRebinding(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let x = 1; let x = x + 1; x",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0), // rebinding reuses the slot of x.
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "const x = 1; x",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+
+	program := parse("const x = 1; let y = 2; fn() { const z = x; z }")
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	expected := map[string]SymbolScope{"x": ConstScope, "y": ""}
+	for name, annotation := range expected {
+		symbol, ok := compiler.symbolTable.Resolve(name)
+		if !ok {
+			t.Fatalf("name %s not resolvable", name)
+		}
+		if symbol.Annotation != annotation {
+			t.Errorf("wrong annotation for %s. want=%q, got=%q", name, annotation, symbol.Annotation)
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let x = 1; x = 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { let x = 1; x = 2 }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+
+	errors := map[string]string{
+		"x = 1":                       "undefined variable x",
+		"len = 1":                     "cannot assign to builtin variable len",
+		"fn(x) { fn() { x = 1 } }":    "cannot assign to free variable x",
+		"const x = 1; x = 2":          "cannot assign to constant x",
+		"const x = 1; fn() { x = 2 }": "cannot assign to constant x",
+		"const x = 1; let x = 2":      "cannot redeclare constant x",
+	}
+	for input, expected := range errors {
+		err := New().Compile(parse(input))
+		if err == nil || err.Error() != expected {
+			t.Errorf("wrong compile error for %q. want=%q, got=%v", input, expected, err)
+		}
+	}
+}
+
+// Statements that only the evaluator runs are rejected with a compile error instead of being skipped.
+func TestUnsupportedStatements(t *testing.T) {
+	tests := map[string]string{
+		"while (true) { }":          "while is not supported by the compiler",
+		"for (;;) { break; }":       "break is not supported by the compiler",
+		"for (;;) { continue; }":    "continue is not supported by the compiler",
+		"try { 1 } catch (e) { 2 }": "try is not supported by the compiler",
+		"macro(x) { x }":            "macro is not supported by the compiler",
+		"fn() { defer f() }":        "defer is not supported by the compiler",
+		`import "io"`:               "import is not supported by the compiler",
+	}
+	for input, expected := range tests {
+		err := New().Compile(parse(input))
+		if err == nil || err.Error() != expected {
+			t.Errorf("wrong compile error for %q. want=%q, got=%v", input, expected, err)
+		}
+	}
+}
+
+func TestSwitchExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "switch 1 { case 1: 10; default: 20 }",
+			expectedConstants: []interface{}{1, 10, 20},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003 - the subject is kept in a temporary slot.
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpConstant, 0),
+				// 0012
+				code.Make(code.OpEqual),
+				// 0013
+				code.Make(code.OpJumpNotTruthy, 22),
+				// 0016
+				code.Make(code.OpConstant, 1),
+				// 0019
+				code.Make(code.OpJump, 25),
+				// 0022
+				code.Make(code.OpConstant, 2),
+				// 0025
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(x) { switch x { case 2: 3 } }",
+			expectedConstants: []interface{}{
+				2,
+				3,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0),
+					// 0002 - the temporary slot follows the parameter.
+					code.Make(code.OpSetLocal, 1),
+					// 0004
+					code.Make(code.OpGetLocal, 1),
+					// 0006
+					code.Make(code.OpConstant, 0),
+					// 0009
+					code.Make(code.OpEqual),
+					// 0010
+					code.Make(code.OpJumpNotTruthy, 19),
+					// 0013
+					code.Make(code.OpConstant, 1),
+					// 0016
+					code.Make(code.OpJump, 20),
+					// 0019
+					code.Make(code.OpNull),
+					// 0020
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "for (let i = 0; i < 3; i) { i }",
+			expectedConstants: []interface{}{0, 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpLessThan),
+				// 0013
+				code.Make(code.OpJumpNotTruthy, 27),
+				// 0016
+				code.Make(code.OpGetGlobal, 0),
+				// 0019
+				code.Make(code.OpPop),
+				// 0020
+				code.Make(code.OpGetGlobal, 0),
+				// 0023
+				code.Make(code.OpPop),
+				// 0024
+				code.Make(code.OpJump, 6),
+			},
+		},
+		{
+			input:             "let i = 1; for (let i = 0;;) { }",
+			expectedConstants: []interface{}{1, 0},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpConstant, 1),
+				// 0009 - the loop variable shadows the outer i with its own slot.
+				code.Make(code.OpSetGlobal, 1),
+				// 0012
+				code.Make(code.OpJump, 12),
+			},
+		},
+		{
+			input:             "for (let i = 0;;) { let i = 1; }",
+			expectedConstants: []interface{}{0, 1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpConstant, 1),
+				// 0009 - the let in the body shadows the loop variable with its own slot.
+				code.Make(code.OpSetGlobal, 1),
+				// 0012
+				code.Make(code.OpJump, 6),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestForStatementScope(t *testing.T) {
+	program := parse("for (let i = 0; false; i) { let j = i; }; i")
+	compiler := New()
+	err := compiler.Compile(program)
+	if err == nil {
+		t.Fatalf("expected compiler error but resulted in none.")
+	}
+	if err.Error() != "undefined variable i" {
+		t.Fatalf("wrong compiler error. got=%q", err)
+	}
+}
+
 func TestStringExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -508,6 +922,72 @@ func TestArrayLiterals(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             "[1, ...[2, 3]]",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpSpread),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestSetLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "#{}",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpSet, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "#{1, 2 + 3}",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSet, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestTupleLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "(1, 2 + 3)",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpTuple, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "(1,)",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpTuple, 1),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -556,18 +1036,35 @@ func TestHashLiterals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestDotExpressionCompilesLikeIndexExpression(t *testing.T) {
+	dot := New()
+	if err := dot.Compile(parse(`let h = {"name": 1}; h.name`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	index := New()
+	if err := index.Compile(parse(`let h = {"name": 1}; h["name"]`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	if dot.Bytecode().Instructions.String() != index.Bytecode().Instructions.String() {
+		t.Errorf("wrong instructions.\nwant=%s\ngot=%s", index.Bytecode().Instructions, dot.Bytecode().Instructions)
+	}
+	if err := testConstants([]interface{}{"name", 1}, dot.Bytecode().Constants); err != nil {
+		t.Errorf("testConstants failed: %s", err)
+	}
+}
+
 func TestIndexExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
 			input:             "[1, 2, 3][1 + 1]",
-			expectedConstants: []interface{}{1, 2, 3, 1, 1},
+			expectedConstants: []interface{}{1, 2, 3},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
 				code.Make(code.OpArray, 3),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpAdd),
 				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
@@ -575,13 +1072,13 @@ func TestIndexExpressions(t *testing.T) {
 		},
 		{
 			input:             "{1: 2}[2 - 1]",
-			expectedConstants: []interface{}{1, 2, 2, 1},
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpHash, 2),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpSub),
 				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
@@ -591,6 +1088,49 @@ func TestIndexExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestSliceExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[1, 2, 3][1:2]",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 3),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSlice, code.SliceLow|code.SliceHigh),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"monkey"[:3]`,
+			expectedConstants: []interface{}{"monkey", 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSlice, code.SliceHigh),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1][1:]",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpSlice, code.SliceLow),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
 func TestFunctions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -1024,3 +1564,182 @@ func TestClosures(t *testing.T) {
 	}
 	runCompilerTests(t, tests)
 }
+
+func TestDeadCodeElimination(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (false) { 9999 }; 1;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpFalse),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 8),
+				// 0004
+				code.Make(code.OpNull),
+				// 0005
+				code.Make(code.OpJump, 9),
+				// 0008
+				code.Make(code.OpNull),
+				// 0009
+				code.Make(code.OpPop),
+				// 0010
+				code.Make(code.OpConstant, 0),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { 10 } else { 9999 };",
+			expectedConstants: []interface{}{10},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		original := program.String()
+
+		compiler := New()
+		if err := compiler.Compile(EliminateDeadCode(program)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := compiler.Bytecode()
+		if err := testInstructions(tt.expectedInstructions, bytecode.Instructions); err != nil {
+			t.Fatalf("testInstructions failed: %s", err)
+		}
+		if err := testConstants(tt.expectedConstants, bytecode.Constants); err != nil {
+			t.Fatalf("testConstants failed: %s", err)
+		}
+
+		if program.String() != original {
+			t.Errorf("EliminateDeadCode modified its input. want=%q, got=%q", original, program.String())
+		}
+	}
+
+	// Branches nested in functions are removed too, and other conditions are kept as they are.
+	program := EliminateDeadCode(parse("fn(x) { if (false) { 9999 } else { if (x) { 1 } else { 2 } } }"))
+	expected := "fn(x) { if (false) {} else { if (x) { 1; } else { 2; } } }"
+	if got := ast.StringMinimal(program.Statements[0].(*ast.ExpressionStatement).Expression); got != expected {
+		t.Errorf("wrong program after elimination.\nwant=%q\ngot=%q", expected, got)
+	}
+}
+
+func TestConstantDeduplication(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let x = "hello"; let y = "hello";`,
+			expectedConstants: []interface{}{"hello"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 1),
+			},
+		},
+		{
+			// literals of different types are kept apart even if they print the same.
+			input:             `1; "1"; 1.5; 1; 1.5`,
+			expectedConstants: []interface{}{1, "1", 1.5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// identical functions are separate constants; the literal inside them is shared.
+			input: "fn() { 1 }; fn() { 1 }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestModuloCompilation(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "10 % 3",
+			expectedConstants: []interface{}{10, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMod),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestPropagateErrorExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn() { len(1)? + 1 }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpPropagateError),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestLessThanKeepsOperandOrder(t *testing.T) {
+	compiler := New()
+	if err := compiler.Compile(parse("1 < 2")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	expected := "0000 OpConstant 0 (1)\n0003 OpConstant 1 (2)\n0006 OpLessThan\n0007 OpPop\n"
+	if got := compiler.Bytecode().Disassemble(); got != expected {
+		t.Errorf("wrong disassembly.\nwant=%q\ngot=%q", expected, got)
+	}
+}
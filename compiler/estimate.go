@@ -0,0 +1,74 @@
+package compiler
+
+import (
+	"monkey/ast"
+	"monkey/code"
+)
+
+// estimateInstructionSize walks node and estimates how many bytes of instructions compiling it will emit
+// in the current scope. It counts nodes by kind and uses the width of the instruction each kind typically emits.
+// Function bodies are compiled into their own scope, so it does not descend into them.
+// The estimate only needs to be close enough to avoid repeated reallocation; it never affects the output.
+func estimateInstructionSize(node ast.Node) int {
+	e := &sizeEstimator{}
+	ast.Walk(e, node)
+	return e.size
+}
+
+type sizeEstimator struct {
+	size int
+}
+
+func (e *sizeEstimator) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Identifier:
+		e.size += 3 // OpConstant, OpGetGlobal, or OpSetGlobal for the name of a let statement, with a 2-byte operand.
+	case *ast.Boolean, *ast.NullLiteral, *ast.SpreadElement, *ast.PrefixExpression, *ast.InfixExpression, *ast.IndexExpression, *ast.PropagateErrorExpression:
+		e.size += 1 // OpTrue, OpSpread, OpMinus, OpAdd, OpIndex ...
+		if n, ok := n.(*ast.InfixExpression); ok && (n.Operator == "&&" || n.Operator == "||") {
+			// OpSetGlobal and two OpGetGlobal for the left operand, OpJumpNotTruthy and OpJump.
+			e.size += 3*3 + 3 + 3 - 1
+		}
+	case *ast.DestructuringLetStatement:
+		// OpSetGlobal for the array, and OpGetGlobal, OpConstant and OpIndex for each name.
+		e.size += 3 + (3+3+1)*len(n.Names)
+	case *ast.AssignExpression:
+		e.size += 3 // OpGetGlobal to load the assigned value, on top of OpSetGlobal counted for the name.
+	case *ast.ExpressionStatement, *ast.ReturnStatement:
+		e.size += 1 // OpPop, OpReturnValue.
+	case *ast.SwitchExpression:
+		e.size += 3 + 1 // OpSetGlobal for the subject and OpNull for a missing default.
+	case *ast.CaseClause:
+		e.size += 3 + 1 + 3 + 3 // OpGetGlobal for the subject, OpEqual, OpJumpNotTruthy and OpJump.
+	case *ast.ForStatement:
+		e.size += 3 + 3 + 1 // OpJumpNotTruthy, OpJump and OpPop for the post expression.
+	case *ast.IfExpression:
+		e.size += 3 + 3 + 1 // OpJumpNotTruthy, OpJump and a possible OpNull.
+	case *ast.ArrayLiteral, *ast.HashLiteral, *ast.SetLiteral, *ast.TupleLiteral:
+		e.size += 3 // OpArray, OpHash, OpSet, OpTuple.
+	case *ast.SliceExpression:
+		e.size += 2 + 2 // OpSlice with its flags and OpNull for the omitted bounds.
+	case *ast.CallExpression:
+		e.size += 2 // OpCall.
+	case *ast.FunctionLiteral:
+		e.size += 4 // OpClosure.
+		return nil
+	}
+	return e
+}
+
+// preallocate grows the capacity of the current scope's instructions so that compiling node
+// does not have to reallocate them over and over again.
+func (c *Compiler) preallocate(node ast.Node) {
+	if !c.preallocation {
+		return
+	}
+	ins := c.currentInstructions()
+	estimated := len(ins) + estimateInstructionSize(node)
+	if cap(ins) >= estimated {
+		return
+	}
+	grown := make(code.Instructions, len(ins), estimated)
+	copy(grown, ins)
+	c.scopes[c.scopeIndex].instructions = grown
+}
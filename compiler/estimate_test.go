@@ -0,0 +1,134 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+// largeProgram generates a synthetic program with n blocks of lets, functions, conditionals and calls.
+func largeProgram(n int) string {
+	var out strings.Builder
+	for i := 0; i < n; i++ {
+		a, f := "arg"+letters(i), "fun"+letters(i)
+		fmt.Fprintf(&out, "let %s = %d;\n", a, i)
+		fmt.Fprintf(&out, "let %s = fn(x, y) { let z = x * y; if (z > %d) { return [z, \"%s\"]; } else { {x: y}[x] } };\n", f, i, a)
+		fmt.Fprintf(&out, "%s(%s, -%s + 2)[0];\n", f, a, a)
+	}
+	return out.String()
+}
+
+// letters encodes i with lowercase letters since identifiers cannot contain digits.
+func letters(i int) string {
+	s := string(rune('a' + i%26))
+	for i /= 26; i > 0; i /= 26 {
+		s = string(rune('a'+i%26)) + s
+	}
+	return s
+}
+
+func TestPreallocationDoesNotChangeBytecode(t *testing.T) {
+	inputs := []string{
+		"1 + 2",
+		"if (true) { 10 } else { 20 }; 3333;",
+		`let f = fn(a, b) { let c = a + b; fn(d) { c * d } }; f(1, 2)(3);`,
+		`{"one": 1, "two": [1, 2, 3][1]}["two"]`,
+		largeProgram(50),
+	}
+
+	for _, input := range inputs {
+		program := parseWithoutErrors(t, input)
+
+		withPrealloc := New()
+		if err := withPrealloc.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		withoutPrealloc := New()
+		withoutPrealloc.preallocation = false
+		if err := withoutPrealloc.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		want := withoutPrealloc.Bytecode()
+		got := withPrealloc.Bytecode()
+		if want.Instructions.String() != got.Instructions.String() {
+			t.Errorf("instructions differ for %q.\nwant=%s\ngot=%s", input, want.Instructions, got.Instructions)
+		}
+		if len(want.Constants) != len(got.Constants) {
+			t.Fatalf("wrong number of constants. want=%d, got=%d", len(want.Constants), len(got.Constants))
+		}
+		for i := range want.Constants {
+			wantFn, ok := want.Constants[i].(*object.CompiledFunction)
+			if !ok {
+				if want.Constants[i].Inspect() != got.Constants[i].Inspect() {
+					t.Errorf("constant %d differs. want=%s, got=%s", i, want.Constants[i].Inspect(), got.Constants[i].Inspect())
+				}
+				continue
+			}
+			gotFn := got.Constants[i].(*object.CompiledFunction)
+			if wantFn.Instructions.String() != gotFn.Instructions.String() {
+				t.Errorf("constant %d differs.\nwant=%s\ngot=%s", i, wantFn.Instructions, gotFn.Instructions)
+			}
+		}
+	}
+}
+
+func TestEstimateInstructionSize(t *testing.T) {
+	inputs := []string{
+		"1 + 2; 3 * 4;",
+		"let a = 1; let b = a; a + b;",
+		`[1, 2, 3][0]; {"a": 1}["a"];`,
+		largeProgram(10),
+	}
+
+	for _, input := range inputs {
+		program := parseWithoutErrors(t, input)
+		compiler := New()
+		compiler.preallocation = false
+		if err := compiler.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		actual := len(compiler.Bytecode().Instructions)
+		estimated := estimateInstructionSize(program)
+
+		// the estimate does not need to be exact, but should be in the right ballpark.
+		if estimated < actual/2 || estimated > actual*2 {
+			t.Errorf("estimate too far off for %q. actual=%d, estimated=%d", input, actual, estimated)
+		}
+	}
+}
+
+func parseWithoutErrors(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors: %v", p.Errors())
+	}
+	return program
+}
+
+func BenchmarkCompileLargeProgram(b *testing.B) {
+	program := parse(largeProgram(1000))
+	for _, prealloc := range []bool{false, true} {
+		b.Run(fmt.Sprintf("preallocation=%t", prealloc), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				compileWith(b, program, prealloc)
+			}
+		})
+	}
+}
+
+func compileWith(b *testing.B, program *ast.Program, prealloc bool) {
+	compiler := New()
+	compiler.preallocation = prealloc
+	if err := compiler.Compile(program); err != nil {
+		b.Fatalf("compiler error: %s", err)
+	}
+}
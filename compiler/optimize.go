@@ -0,0 +1,32 @@
+package compiler
+
+import "monkey/ast"
+
+// EliminateDeadCode returns a copy of program with the branches of if expressions that can never run removed.
+// When the condition is the literal false, the consequence is emptied; when it is the literal true, the alternative
+// is dropped. The if expression itself stays, so it still evaluates to Null when the remaining branch is empty.
+// The program passed in is left untouched.
+func EliminateDeadCode(program *ast.Program) *ast.Program {
+	optimized := ast.Clone(program).(*ast.Program)
+	ast.Inspect(optimized, func(node ast.Node) bool {
+		ie, ok := node.(*ast.IfExpression)
+		if !ok {
+			return true
+		}
+		condition, ok := ie.Condition.(*ast.Boolean)
+		if !ok {
+			return true
+		}
+		if condition.Value {
+			ie.Alternative = nil
+		} else {
+			ie.Consequence = &ast.BlockStatement{
+				Token:      ie.Consequence.Token,
+				NodePos:    ie.Consequence.NodePos,
+				Statements: []ast.Statement{},
+			}
+		}
+		return true
+	})
+	return optimized
+}
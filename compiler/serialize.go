@@ -0,0 +1,166 @@
+package compiler
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"monkey/object"
+)
+
+// The serialized form of Bytecode is:
+//
+//	magic "MNKY" | version (1 byte) | instructions | number of constants | constants...
+//
+// instructions are written as their length followed by the raw bytes, and each constant as
+// a one-byte tag followed by its value. integers and lengths are varint-encoded.
+const (
+	serializationMagic   = "MNKY"
+	serializationVersion = 3
+)
+
+// tags of the constants in the serialized form.
+const (
+	tagInteger byte = iota + 1
+	tagFloat
+	tagString
+	tagCompiledFunction
+)
+
+// Serialize writes the bytecode to w so that it can be cached and run later without recompiling.
+// it fails if the constant pool holds an object that the compiler never emits.
+func (b *Bytecode) Serialize(w io.Writer) error {
+	buf := []byte(serializationMagic)
+	buf = append(buf, serializationVersion)
+	buf = appendBytes(buf, b.Instructions)
+	buf = binary.AppendUvarint(buf, uint64(len(b.Constants)))
+	for i, constant := range b.Constants {
+		switch constant := constant.(type) {
+		case *object.Integer:
+			buf = append(buf, tagInteger)
+			buf = binary.AppendVarint(buf, constant.Value)
+		case *object.Float:
+			buf = append(buf, tagFloat)
+			buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(constant.Value))
+		case *object.String:
+			buf = append(buf, tagString)
+			buf = appendBytes(buf, []byte(constant.Value))
+		case *object.CompiledFunction:
+			buf = append(buf, tagCompiledFunction)
+			buf = appendBytes(buf, constant.Instructions)
+			buf = binary.AppendUvarint(buf, uint64(constant.NumLocals))
+			buf = binary.AppendUvarint(buf, uint64(constant.NumParameters))
+			buf = appendBytes(buf, []byte(constant.Name))
+		default:
+			return fmt.Errorf("cannot serialize constant %d: %s", i, constant.Type())
+		}
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// Deserialize reads bytecode written by Serialize from r.
+func Deserialize(r io.Reader) (*Bytecode, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+
+	magic := d.bytes(len(serializationMagic))
+	if d.err == nil && string(magic) != serializationMagic {
+		return nil, errors.New("not a serialized bytecode: wrong magic")
+	}
+	if version := d.byte(); d.err == nil && version != serializationVersion {
+		return nil, fmt.Errorf("unsupported bytecode version: %d", version)
+	}
+
+	bytecode := &Bytecode{Instructions: d.bytes(d.length())}
+	n := d.length()
+	for i := 0; i < n && d.err == nil; i++ {
+		switch tag := d.byte(); tag {
+		case tagInteger:
+			value, err := binary.ReadVarint(d.r)
+			d.fail(err)
+			bytecode.Constants = append(bytecode.Constants, &object.Integer{Value: value})
+		case tagFloat:
+			bits := d.bytes(8)
+			if d.err == nil {
+				value := math.Float64frombits(binary.BigEndian.Uint64(bits))
+				bytecode.Constants = append(bytecode.Constants, &object.Float{Value: value})
+			}
+		case tagString:
+			bytecode.Constants = append(bytecode.Constants, &object.String{Value: string(d.bytes(d.length()))})
+		case tagCompiledFunction:
+			bytecode.Constants = append(bytecode.Constants, &object.CompiledFunction{
+				Instructions:  d.bytes(d.length()),
+				NumLocals:     d.length(),
+				NumParameters: d.length(),
+				Name:          string(d.bytes(d.length())),
+			})
+		default:
+			if d.err == nil {
+				d.err = fmt.Errorf("unknown constant tag %d", tag)
+			}
+		}
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return bytecode, nil
+}
+
+// appendBytes appends the length of p followed by p itself.
+func appendBytes(buf, p []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(p)))
+	return append(buf, p...)
+}
+
+// decoder reads the parts of serialized bytecode, remembering the first error.
+// once an error occurred, every read returns a zero value.
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *decoder) fail(err error) {
+	if d.err != nil || err == nil {
+		return
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	d.err = fmt.Errorf("malformed bytecode: %w", err)
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	d.fail(err)
+	return b
+}
+
+// length reads a varint-encoded length. lengths beyond math.MaxInt32 are rejected as malformed.
+func (d *decoder) length() int {
+	if d.err != nil {
+		return 0
+	}
+	n, err := binary.ReadUvarint(d.r)
+	d.fail(err)
+	if d.err == nil && n > math.MaxInt32 {
+		d.fail(fmt.Errorf("length %d too large", n))
+	}
+	return int(n)
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	p := make([]byte, n)
+	_, err := io.ReadFull(d.r, p)
+	d.fail(err)
+	return p
+}
@@ -0,0 +1,92 @@
+package compiler
+
+import (
+	"bytes"
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+func TestSerializeRoundTrip(t *testing.T) {
+	input := `
+let x = 1.5;
+let greet = fn(name) { let suffix = "!"; "hello " + name + suffix };
+greet("monkey");
+-9223372036854775807 + 9223372036854775807;
+`
+	comp := New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	original := comp.Bytecode()
+
+	var buf bytes.Buffer
+	if err := original.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize failed: %s", err)
+	}
+	restored, err := Deserialize(&buf)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %s", err)
+	}
+
+	if !bytes.Equal(restored.Instructions, original.Instructions) {
+		t.Errorf("instructions differ.\nwant=%q\ngot=%q", original.Instructions, restored.Instructions)
+	}
+	if len(restored.Constants) != len(original.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d", len(original.Constants), len(restored.Constants))
+	}
+	for i, want := range original.Constants {
+		got := restored.Constants[i]
+		if fn, ok := want.(*object.CompiledFunction); ok {
+			restoredFn, ok := got.(*object.CompiledFunction)
+			if !ok {
+				t.Fatalf("constant %d is not CompiledFunction. got=%T", i, got)
+			}
+			if !bytes.Equal(restoredFn.Instructions, fn.Instructions) ||
+				restoredFn.NumLocals != fn.NumLocals || restoredFn.NumParameters != fn.NumParameters ||
+				restoredFn.Name != fn.Name {
+				t.Errorf("constant %d differs. want=%+v, got=%+v", i, fn, restoredFn)
+			}
+			continue
+		}
+		if !sameConstant(want, got) {
+			t.Errorf("constant %d differs. want=%s, got=%s", i, want.Inspect(), got.Inspect())
+		}
+	}
+}
+
+func TestDeserializeErrors(t *testing.T) {
+	var valid bytes.Buffer
+	bytecode := &Bytecode{Constants: []object.Object{&object.String{Value: "hello"}}}
+	if err := bytecode.Serialize(&valid); err != nil {
+		t.Fatalf("Serialize failed: %s", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", "malformed bytecode: unexpected EOF"},
+		{"MONKEY", "not a serialized bytecode: wrong magic"},
+		{"MNKY\x01", "unsupported bytecode version: 1"},
+		{"MNKY\x02", "unsupported bytecode version: 2"},
+		{"MNKY\x03\x00\x01\x09", "unknown constant tag 9"},
+		{valid.String()[:valid.Len()-2], "malformed bytecode: unexpected EOF"},
+	}
+
+	for _, tt := range tests {
+		_, err := Deserialize(strings.NewReader(tt.input))
+		if err == nil {
+			t.Errorf("%q: expected error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+
+	bytecode.Constants = append(bytecode.Constants, &object.Builtin{})
+	if err := bytecode.Serialize(&bytes.Buffer{}); err == nil || err.Error() != "cannot serialize constant 1: BUILTIN" {
+		t.Errorf("wrong error for unserializable constant. got=%v", err)
+	}
+}
@@ -1,5 +1,7 @@
 package compiler
 
+import "sort"
+
 type SymbolScope string
 
 const (
@@ -7,12 +9,17 @@ const (
 	GlobalScope  SymbolScope = "GLOBAL"
 	LocalScope   SymbolScope = "LOCAL"
 	FreeScope    SymbolScope = "FREE"
+
+	// ConstScope annotates symbols bound by const. Unlike the other scopes it doesn't tell where the value lives,
+	// so it's stored in Symbol.Annotation rather than Symbol.Scope.
+	ConstScope SymbolScope = "CONST"
 )
 
 type Symbol struct {
-	Name  string
-	Scope SymbolScope
-	Index int
+	Name       string
+	Scope      SymbolScope
+	Index      int
+	Annotation SymbolScope // ConstScope for symbols bound by const, empty otherwise.
 }
 
 type SymbolTable struct {
@@ -20,6 +27,7 @@ type SymbolTable struct {
 	store          map[string]Symbol
 	numDefinitions int
 	FreeSymbols    []Symbol
+	block          bool // tells whether this table is the scope of a block inside its outer table, like the body of a for loop.
 }
 
 func NewSymbolTable() *SymbolTable {
@@ -34,20 +42,84 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	return s
 }
 
+// NewBlockSymbolTable returns a symbol table for a block scope inside outer.
+// Names defined in a block shadow the outer ones, but they share the slots of the enclosing function
+// (or the globals), so resolving outer names from a block never turns them into free variables.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	return s
+}
+
 func (s *SymbolTable) Define(name string) Symbol {
-	symbol := Symbol{Name: name, Index: s.numDefinitions, Scope: GlobalScope}
-	if s.Outer == nil {
-		symbol.Scope = GlobalScope
-	} else {
-		symbol.Scope = LocalScope
-	}
+	symbol := Symbol{Name: name, Index: s.nextIndex(), Scope: s.scope()}
 	s.store[name] = symbol
-	s.numDefinitions++
 	return symbol
 }
 
+// DefineConst defines name like Define and annotates it with ConstScope, as a const statement does.
+func (s *SymbolTable) DefineConst(name string) Symbol {
+	s.Define(name)
+	return s.annotate(name, ConstScope)
+}
+
+// annotate sets the annotation of the symbol defined as name in this table and returns the updated symbol.
+func (s *SymbolTable) annotate(name string, annotation SymbolScope) Symbol {
+	symbol := s.store[name]
+	symbol.Annotation = annotation
+	s.store[name] = symbol
+	return symbol
+}
+
+// defineTemporary allocates a slot for a value the compiler needs to keep around, like the subject of a switch.
+// The symbol has no name, so it can't be resolved from the source code.
+func (s *SymbolTable) defineTemporary() Symbol {
+	return Symbol{Index: s.nextIndex(), Scope: s.scope()}
+}
+
+// scope returns the scope of the symbols defined in this table.
+func (s *SymbolTable) scope() SymbolScope {
+	switch {
+	case s.block:
+		return s.Outer.scope()
+	case s.Outer == nil:
+		return GlobalScope
+	default:
+		return LocalScope
+	}
+}
+
+// nextIndex allocates a slot for a new symbol. Block tables allocate slots from their outer table.
+func (s *SymbolTable) nextIndex() int {
+	if s.block {
+		return s.Outer.nextIndex()
+	}
+	index := s.numDefinitions
+	s.numDefinitions++
+	return index
+}
+
+// Lookup returns the symbol defined in this very table, without looking into the outer tables.
+func (s *SymbolTable) Lookup(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	return symbol, ok
+}
+
+// Symbols returns the symbols defined in this very table sorted by name, including builtins and free symbols.
+func (s *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(s.store))
+	for _, symbol := range s.store {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].Name < symbols[j].Name })
+	return symbols
+}
+
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
+	if !ok && s.block {
+		return s.Outer.Resolve(name)
+	}
 	if !ok && s.Outer != nil {
 		obj, ok = s.Outer.Resolve(name)
 		if !ok {
@@ -70,7 +142,7 @@ func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 
 func (s *SymbolTable) defineFree(original Symbol) Symbol {
 	s.FreeSymbols = append(s.FreeSymbols, original)
-	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Annotation: original.Annotation}
 	symbol.Scope = FreeScope
 	s.store[original.Name] = symbol
 	return symbol
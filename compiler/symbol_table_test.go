@@ -1,6 +1,9 @@
 package compiler
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 // assertions about the Define method.
 func TestDefine(t *testing.T) {
@@ -226,6 +229,82 @@ func TestResolveFree(t *testing.T) {
 	}
 }
 
+func TestBlockSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	globalBlock := NewBlockSymbolTable(global)
+	globalBlock.Define("a")
+	globalBlock.Define("b")
+	global.Define("c")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("d")
+	block := NewBlockSymbolTable(local)
+	block.Define("e")
+	nestedBlock := NewBlockSymbolTable(block)
+	nestedBlock.Define("d")
+	inner := NewEnclosedSymbolTable(nestedBlock)
+
+	tests := []struct {
+		table    *SymbolTable
+		expected []Symbol
+	}{
+		{
+			global,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "c", Scope: GlobalScope, Index: 3},
+			},
+		},
+		{
+			globalBlock,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 1},
+				{Name: "b", Scope: GlobalScope, Index: 2},
+				{Name: "c", Scope: GlobalScope, Index: 3},
+			},
+		},
+		{
+			nestedBlock,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "d", Scope: LocalScope, Index: 2},
+				{Name: "e", Scope: LocalScope, Index: 1},
+			},
+		},
+		{
+			inner,
+			[]Symbol{
+				{Name: "d", Scope: FreeScope, Index: 0},
+				{Name: "e", Scope: FreeScope, Index: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		for _, sym := range tt.expected {
+			result, ok := tt.table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+	}
+
+	// block tables never create free symbols, and their slots are counted by the enclosing table.
+	if len(block.FreeSymbols) != 0 || len(nestedBlock.FreeSymbols) != 0 {
+		t.Errorf("block tables have free symbols: %+v, %+v", block.FreeSymbols, nestedBlock.FreeSymbols)
+	}
+	if local.numDefinitions != 3 {
+		t.Errorf("wrong number of definitions in local. want=3, got=%d", local.numDefinitions)
+	}
+	if len(inner.FreeSymbols) != 2 || inner.FreeSymbols[0] != (Symbol{Name: "d", Scope: LocalScope, Index: 2}) {
+		t.Errorf("wrong free symbols of inner. got=%+v", inner.FreeSymbols)
+	}
+}
+
 func TestResolveUnresolvableFree(t *testing.T) {
 	global := NewSymbolTable()
 	global.Define("a")
@@ -261,3 +340,27 @@ func TestResolveUnresolvableFree(t *testing.T) {
 		}
 	}
 }
+
+func TestSymbols(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("b")
+	global.Define("a")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("c")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 1},
+		{Name: "b", Scope: GlobalScope, Index: 0},
+		{Name: "len", Scope: BuiltinScope, Index: 0},
+	}
+	if got := global.Symbols(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong global symbols.\nwant=%+v\ngot=%+v", expected, got)
+	}
+
+	expected = []Symbol{{Name: "c", Scope: LocalScope, Index: 0}}
+	if got := local.Symbols(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong local symbols.\nwant=%+v\ngot=%+v", expected, got)
+	}
+}
@@ -0,0 +1,355 @@
+package enginetest
+
+// 組み込み関数keysとvaluesのケース
+// 結果はキーの文字列表現の辞書順に並ぶ。整数のキーも数値の順ではなく文字列表現の順になる
+var KeysValuesBuiltins = []Case{
+	{`keys({"b": 1, "c": 2, "a": 3})`, []string{"a", "b", "c"}},
+	{`values({"b": 1, "c": 2, "a": 3})`, []int{3, 1, 2}},
+	{"keys({10: 1, 9: 2, 1: 3})", []int{1, 10, 9}},
+	{"values({10: 1, 9: 2, 1: 3})", []int{3, 1, 2}},
+	{`keys({true: 1, "b": 2, 1: 3})`, Inspect("[1, b, true]")},
+	// 文字列表現が同じキーは型の名前の順に並ぶ
+	{`type(keys({"1": 1, 1: 2})[0])`, "INTEGER"},
+	{`values({"1": "b", 1: "a", "true": 2, true: 1})`, Inspect("[a, b, 1, 2]")},
+	{`let h = {"2": 9, 2: 0, "1": "b", 1: "a"}; [keys(h) == keys(h), values(h)]`, Inspect("[true, [a, b, 0, 9]]")},
+	{"keys({})", []int{}},
+	{"values({})", []int{}},
+	// キーはHashKeyではなく登録したObjectそのものが返る
+	{"keys({(1, 2): 3})[0][1]", 2},
+	{`let h = {"a": 1, "b": 2}; let k = keys(h); h[k[1]]`, 2},
+	{"len(values({1: [1, 2], 2: [3]}))", 2},
+	{"keys([1])", Error("argument to `keys` must be HASH, got ARRAY")},
+	{"values(1)", Error("argument to `values` must be HASH, got INTEGER")},
+	{"keys({}, {})", Error("wrong number of arguments. got=2, want=1")},
+}
+
+// 組み込み関数has_keyとcontainsのケース
+var HasKeyContainsBuiltins = []Case{
+	{`has_key({"a": 1}, "a")`, true},
+	{`has_key({"a": 1}, "b")`, false},
+	// 値がnullでもキーがあればtrue
+	{`has_key({"a": null}, "a")`, true},
+	{`has_key({1: 1}, "1")`, false},
+	{"has_key({(1, 2): 1}, (1, 2))", true},
+	{"has_key({}, 1)", false},
+	{"contains([1, 2, 3], 2)", true},
+	{"contains([1, 2, 3], 4)", false},
+	{"contains([], 1)", false},
+	{"contains([1, 2], 2.0)", true},
+	{`contains([1, 2], "1")`, false},
+	{"contains([[1, 2], [3]], [1, 2])", true},
+	{"contains([[1, 2], [3]], [2, 1])", false},
+	{`contains([{"a": [1]}], {"a": [1]})`, true},
+	{"contains([null], null)", true},
+	{`contains("hello", "ell")`, true},
+	{`contains("hello", "elo")`, false},
+	{`contains("hello", "")`, true},
+	{`contains("日本語", "本")`, true},
+	{`has_key({}, [1])`, Error("unusable as hash key: ARRAY")},
+	{`has_key([1], 0)`, Error("first argument to `has_key` must be HASH, got ARRAY")},
+	{`has_key({})`, Error("wrong number of arguments. got=1, want=2")},
+	{`contains("123", 1)`, Error("second argument to `contains` must be STRING when searching a STRING, got INTEGER")},
+	{`contains({1: 1}, 1)`, Error("first argument to `contains` must be ARRAY or STRING, got HASH")},
+	{`contains([1], 1, 1)`, Error("wrong number of arguments. got=3, want=2")},
+}
+
+// 組み込み関数deleteとremoveのケース
+var DeleteRemoveBuiltins = []Case{
+	{`delete({"a": 1}, "a")`, Inspect("{}")},
+	{`delete({"a": 1, "b": 2}, "a")`, Inspect("{b: 2}")},
+	{`delete({"a": 1}, "b")`, Inspect("{a: 1}")},
+	{`delete({"a": 1}, "b")["a"]`, 1},
+	{"delete({}, 1)", Inspect("{}")},
+	{"delete({(1, 2): 1, 1: 2}, (1, 2))", Inspect("{1: 2}")},
+	{"remove([1, 2, 3], 0)", []int{2, 3}},
+	{"remove([1, 2, 3], 2)", []int{1, 2}},
+	{"remove([1, 2, 3], 1)", []int{1, 3}},
+	{"remove([1, 2, 3], -1)", []int{1, 2}},
+	{"remove([1], 0)", []int{}},
+	// 元のハッシュや配列は変更しない
+	{`let h = {"a": 1}; delete(h, "a"); h`, Inspect("{a: 1}")},
+	{"let a = [1, 2, 3]; remove(a, 0); a", []int{1, 2, 3}},
+	// 結果への代入は元の配列に影響しない
+	{"let a = [1, 2, 3]; let b = remove(a, 2); b[0] = 9; a", []int{1, 2, 3}},
+	{"let a = [1, 2, 3]; let b = remove(a, 0); a[2] = 9; b", []int{2, 3}},
+	{"remove([1, 2, 3], 3)", Error("index out of range for `remove`: 3 (length 3)")},
+	{"remove([1, 2, 3], -4)", Error("index out of range for `remove`: -4 (length 3)")},
+	{"remove([], 0)", Error("index out of range for `remove`: 0 (length 0)")},
+	{`remove([1], "0")`, Error("second argument to `remove` must be INTEGER, got STRING")},
+	{"remove({0: 1}, 0)", Error("first argument to `remove` must be ARRAY, got HASH")},
+	{"delete([1], 0)", Error("first argument to `delete` must be HASH, got ARRAY")},
+	{"delete({}, [1])", Error("unusable as hash key: ARRAY")},
+	{"delete({})", Error("wrong number of arguments. got=1, want=2")},
+}
+
+// 組み込み関数typeのケース
+var TypeBuiltin = []Case{
+	{"type(1)", "INTEGER"},
+	{"type(1.5)", "FLOAT"},
+	{`type("a")`, "STRING"},
+	{"type(true)", "BOOLEAN"},
+	{"type(null)", "NULL"},
+	{"type(if (false) { 1 })", "NULL"},
+	{"type(fn(x) { x })", "FUNCTION"},
+	{"let f = fn(x) { fn(y) { x + y } }; type(f(1))", "FUNCTION"},
+	{"type(len)", "BUILTIN"},
+	{"type(type)", "BUILTIN"},
+	{"type([1])", "ARRAY"},
+	{"type({1: 1})", "HASH"},
+	{"type(#{1})", "SET"},
+	{"type((1, 2))", "TUPLE"},
+	{"type(type(1))", "STRING"},
+	{"type(1, 2)", Error("wrong number of arguments. got=2, want=1")},
+}
+
+// 組み込み関数is_errorがエラーかどうかを返すケースと、組み込み関数errorが作るエラーのケース
+var IsErrorBuiltin = []Case{
+	{`is_error(error("oops"))`, true},
+	{`is_error(1)`, false},
+	{`is_error("oops")`, false},
+	{`is_error(null)`, false},
+	{`let f = fn(x) { if (x < 0) { return error("negative") } x }; is_error(f(-1))`, true},
+	{`let f = fn(x) { if (x < 0) { return error("negative") } x }; is_error(f(1))`, false},
+	{`is_error(if (true) { error("in block") })`, true},
+	// 組み込み関数のエラーも調べられる
+	{`is_error(len(1))`, true},
+	{`error(1)`, Error("1")},
+	{`error([1, "a"])`, Error("[1, a]")},
+}
+
+// 数値を扱う組み込み関数abs・min・max・powのケース
+// 浮動小数点数が混ざると結果は浮動小数点数になる
+var MathBuiltins = []Case{
+	{"abs(-5)", 5},
+	{"abs(5)", 5},
+	{"abs(0)", 0},
+	{"abs(-2.5)", 2.5},
+	{"abs(2.5)", 2.5},
+	{"min(3, 1, 2)", 1},
+	{"max(3, 1, 2)", 3},
+	{"min(2, 2)", 2},
+	{"min([3, 1.5, 2])", 1.5},
+	{"max([3, 1.5, 2])", 3.0},
+	{"max(1, 2.5)", 2.5},
+	{"min(1, 2.5)", 1.0},
+	{"min(-0.5, -1)", -1.0},
+	{"max([9223372036854775807, 9223372036854775806])", 9223372036854775807},
+	{"pow(2, 10)", 1024},
+	{"pow(-3, 3)", -27},
+	{"pow(5, 0)", 1},
+	{"pow(0, 0)", 1},
+	{"pow(2, -1)", 0.5},
+	{"pow(1.5, 2)", 2.25},
+	{"pow(4, 0.5)", 2.0},
+	{"pow(2, 62)", 4611686018427387904},
+	{"pow(-2, 63)", -9223372036854775808},
+	{"pow(-1, 9223372036854775807)", -1},
+	{"abs(-9223372036854775807)", 9223372036854775807},
+	{"abs(true)", Error("argument to `abs` must be INTEGER or FLOAT, got BOOLEAN")},
+	{"abs(1, 2)", Error("wrong number of arguments. got=2, want=1")},
+	{`min(1, "2")`, Error("arguments to `min` must be INTEGER or FLOAT, got STRING")},
+	{`max(["a"])`, Error("elements of `max` must be INTEGER or FLOAT, got STRING")},
+	{"max(1)", Error("argument to `max` must be ARRAY, got INTEGER")},
+	{"max()", Error("wrong number of arguments. got=0, want=1 or more")},
+	{"min([])", Error("`min` of empty array")},
+	{`pow(2, "3")`, Error("arguments to `pow` must be INTEGER or FLOAT, got STRING")},
+	{"pow(2)", Error("wrong number of arguments. got=1, want=2")},
+	// 結果が整数で表せない場合は桁あふれした値ではなくエラーを返す
+	{"pow(2, 63)", Error("result of `pow` does not fit in INTEGER: pow(2, 63)")},
+	{"pow(3, 40)", Error("result of `pow` does not fit in INTEGER: pow(3, 40)")},
+	{"pow(-2, 64)", Error("result of `pow` does not fit in INTEGER: pow(-2, 64)")},
+	{"abs(-9223372036854775807 - 1)", Error("result of `abs` does not fit in INTEGER: abs(-9223372036854775808)")},
+	// clampとbetweenもmin/maxと同様に浮動小数点数を受け付け、一つでも混ざっていれば浮動小数点数として扱う
+	{"clamp(2.5, 0, 3)", 2.5},
+	{"clamp(5, 0, 2.5)", 2.5},
+	{"clamp(-1, 0.5, 3)", 0.5},
+	{"clamp(2, 0, 3.0)", 2.0},
+	{"clamp(9223372036854775807, 0, 9223372036854775806)", 9223372036854775806},
+	{"clamp(1.5, 2.5, 0.5)", Error("invalid range for `clamp`: lo=2.5 > hi=0.5")},
+	{`clamp(1, "0", 3)`, Error("arguments to `clamp` must be INTEGER or FLOAT, got STRING")},
+	{"between(1.5, 1, 2)", true},
+	{"between(2, 1.5, 1.9)", false},
+	{"between(1, 1.0, 1)", true},
+	{"between(9223372036854775807, 0, 9223372036854775806)", false},
+	{"between(1, 2)", Error("wrong number of arguments. got=2, want=3")},
+	{`between(1, 0, "2")`, Error("arguments to `between` must be INTEGER or FLOAT, got STRING")},
+}
+
+// 後置演算子?がエラーを関数の外に伝え、エラーでなければ値をそのまま返すケース
+var PropagateErrorExpression = []Case{
+	{"let f = fn() { len([1])? + 1 }; f()", 2},
+	{`let f = fn(x) { let n = int(x)?; n * 2 }; f("21")`, 42},
+	{`let f = fn() { error("oops")? + 1 }; f()`, Error("oops")},
+	{`let f = fn(x) { int(x)? * 2 }; f("a")`, Error(`cannot convert "a" to INTEGER`)},
+	// ?が伝えるエラーはis_errorやTRY文に捕まらず、関数の残りを評価しない
+	{`let f = fn() { let r = is_error(error("boom")?); "reached" }; f()`, Error("boom")},
+	{`let f = fn() { is_error(error("boom")?) }; is_error(f())`, true},
+	// トップレベルでは戻る先の関数がないので、エラーでプログラムが止まる
+	{`error("oops")?; 1`, Error("oops")},
+}
+
+// 組み込み関数rangeのケース
+var RangeBuiltin = []Case{
+	{"range(5)", []int{0, 1, 2, 3, 4}},
+	{"range(0)", []int{}},
+	{"range(-3)", []int{}},
+	{"range(2, 5)", []int{2, 3, 4}},
+	{"range(5, 2)", []int{}},
+	{"range(-2, 1)", []int{-2, -1, 0}},
+	{"range(10, 0, -2)", []int{10, 8, 6, 4, 2}},
+	{"range(0, 10, 3)", []int{0, 3, 6, 9}},
+	{"range(0, 10, -1)", []int{}},
+	{"range(10, 0, 1)", []int{}},
+	{"range(3, 3)", []int{}},
+	{"range(9223372036854775806, 9223372036854775807)", []int{9223372036854775806}},
+	{"len(range(1000000))", 1000000},
+	{"range(1, 5, 0)", Error("step of `range` must not be zero")},
+	{"range(1000001)", Error("`range` too large: 1000001 elements, limit is 1000000")},
+	{"range(-9223372036854775807, 9223372036854775807)", Error("`range` too large: 18446744073709551614 elements, limit is 1000000")},
+	{"range(0, 9223372036854775807, 2)", Error("`range` too large: 4611686018427387904 elements, limit is 1000000")},
+	{`range("5")`, Error("arguments to `range` must be INTEGER, got STRING")},
+	{"range(1, 2.5)", Error("arguments to `range` must be INTEGER, got FLOAT")},
+	{"range()", Error("wrong number of arguments. got=0, want=1 to 3")},
+	{"range(1, 2, 3, 4)", Error("wrong number of arguments. got=4, want=1 to 3")},
+}
+
+// 組み込み関数now・clock・rand・seedのケース
+// randはseedで生成元を固定すれば同じ値の列を返す
+var TimeAndRandomBuiltins = []Case{
+	{"now() > 1600000000", true},
+	{"let a = clock(); let b = clock(); a <= b", true},
+	{"seed(42); let a = [rand(10), rand(10), rand(10)]; seed(42); a == [rand(10), rand(10), rand(10)]", true},
+	{"seed(1); rand(1)", 0},
+	{"rand(0)", Error("argument to `rand` must be positive, got 0")},
+}
+
+// 組み込み関数reverse・index_of・sliceのケース
+// いずれも引数の配列・文字列を変更せず、sliceはスライス式と同じ範囲の扱いをする
+var SequenceBuiltins = []Case{
+	{"reverse([1, 2, 3])", []int{3, 2, 1}},
+	{"reverse([])", []int{}},
+	{`reverse("日本語")`, "語本日"},
+	{`reverse("")`, ""},
+	{"let a = [1, 2]; reverse(a); a", []int{1, 2}},
+	{"index_of([1, 2, 3, 2], 2)", 1},
+	{"index_of([1, 2], 5)", -1},
+	{"index_of([[1], [2]], [2])", 1},
+	{`index_of([1, "1"], "1")`, 1},
+	{`index_of("日本語の本", "本")`, 1},
+	{`index_of("abc", "")`, 0},
+	{`index_of("abc", "d")`, -1},
+	{"slice([1, 2, 3, 4], 1, 3)", []int{2, 3}},
+	{"slice([1, 2, 3], 1)", []int{2, 3}},
+	{"slice([1, 2, 3], -5, 10)", []int{1, 2, 3}},
+	{"slice([1, 2, 3], 2, 2)", []int{}},
+	{`slice("日本語", 1, 2)`, "本"},
+	{`slice("日本語", 1)`, "本語"},
+	{"let a = [1, 2, 3]; let b = slice(a, 0, 2); push(b, 9); a", []int{1, 2, 3}},
+	{"let a = [1, 2, 3, 4]; slice(a, 1, 3) == a[1:3]", true},
+	{"slice([1, 2, 3], 2, 1)", Error("slice bounds out of range: low=2 > high=1")},
+	{`slice([1, 2], "1")`, Error("bounds of `slice` must be INTEGER, got STRING")},
+	{"slice(1, 0, 1)", Error("first argument to `slice` must be ARRAY or STRING, got INTEGER")},
+	{"slice([1])", Error("wrong number of arguments. got=1, want=2 or 3")},
+	{"reverse(1)", Error("argument to `reverse` must be ARRAY or STRING, got INTEGER")},
+	{"reverse([1], [2])", Error("wrong number of arguments. got=2, want=1")},
+	{`index_of("abc", 1)`, Error("second argument to `index_of` must be STRING when searching a STRING, got INTEGER")},
+	{"index_of({}, 1)", Error("first argument to `index_of` must be ARRAY or STRING, got HASH")},
+}
+
+// 組み込み関数strとintによる変換のケース
+var StrIntBuiltins = []Case{
+	{"str(42)", "42"},
+	{"str(-7)", "-7"},
+	{"str(1.5)", "1.5"},
+	{"str(true)", "true"},
+	{"str(null)", "Null"},
+	{`str("abc")`, "abc"},
+	{"str([1, 2])", "[1, 2]"},
+	{`str(1) + str(2)`, "12"},
+	{`int("42")`, 42},
+	{`int("-42")`, -42},
+	{`int("+42")`, 42},
+	{`int("  7 ")`, 7},
+	{"int(5)", 5},
+	{"int(str(123))", 123},
+	{"int(str(-123))", -123},
+	{"let n = 9876; int(str(n)) == n", true},
+	{"let n = -9876; int(str(n)) == n", true},
+	{`int("12a")`, Error(`cannot convert "12a" to INTEGER`)},
+	{`int("")`, Error(`cannot convert "" to INTEGER`)},
+	{`int("1.5")`, Error(`cannot convert "1.5" to INTEGER`)},
+	{`int("99999999999999999999")`, Error(`cannot convert "99999999999999999999" to INTEGER`)},
+	{"int(true)", Error("argument to `int` must be INTEGER or STRING, got BOOLEAN")},
+	{"int()", Error("wrong number of arguments. got=0, want=1")},
+	{"str(1, 2)", Error("wrong number of arguments. got=2, want=1")},
+}
+
+// 文字列を扱う組み込み関数のケース
+// 文字列の分割や置換はUTF-8の文字単位で行われる
+var StringBuiltins = []Case{
+	{`split("a,b,c", ",")`, []string{"a", "b", "c"}},
+	{`split("a, b", ", ")`, []string{"a", "b"}},
+	{`split("abc", ";")`, []string{"abc"}},
+	{`split("abc", "")`, []string{"a", "b", "c"}},
+	{`split("日本語", "")`, []string{"日", "本", "語"}},
+	{`split("", ",")`, []string{""}},
+	{`split("", "")`, []string{}},
+	{`split(",a,", ",")`, []string{"", "a", ""}},
+	{`len(split("a,b,c", ","))`, 3},
+	{`split("日本語", "")[1]`, "本"},
+	{`join(["a", "b"], "-")`, "a-b"},
+	{`join([], "-")`, ""},
+	{`join(["a"], "")`, "a"},
+	{`join(split("a b c", " "), "+")`, "a+b+c"},
+	{"trim(\"\t hi\n\")", "hi"},
+	{`trim("  hi  ")`, "hi"},
+	{`trim("   ")`, ""},
+	{`trim(" 日本 ")`, "日本"},
+	{`upper("Hello")`, "HELLO"},
+	{`lower("Hello")`, "hello"},
+	// 一文字が複数の文字に変わる変換はしない
+	{`upper("straße")`, "STRAßE"},
+	{`lower("ÀÉ")`, "àé"},
+	{`upper("")`, ""},
+	{`replace("a-b-c", "-", "+")`, "a+b+c"},
+	{`replace("abc", "x", "y")`, "abc"},
+	{`replace("aaa", "a", "")`, ""},
+	{`replace("日本語", "本", "ほん")`, "日ほん語"},
+	{`split(1, ",")`, Error("arguments to `split` must be STRING, got INTEGER")},
+	{`split("a")`, Error("wrong number of arguments. got=1, want=2")},
+	{`join(["a", 1], ",")`, Error("elements of `join` must be STRING, got INTEGER")},
+	{`join("ab", ",")`, Error("first argument to `join` must be ARRAY, got STRING")},
+	{`join(["a"], 1)`, Error("second argument to `join` must be STRING, got INTEGER")},
+	{`trim(1)`, Error("argument to `trim` must be STRING, got INTEGER")},
+	{`upper(["a"])`, Error("argument to `upper` must be STRING, got ARRAY")},
+	{`lower()`, Error("wrong number of arguments. got=0, want=1")},
+	{`replace("a", "a", 1)`, Error("arguments to `replace` must be STRING, got INTEGER")},
+}
+
+// 組み込み関数formatのケース
+var FormatBuiltins = []Case{
+	{`format("x = {}", 1)`, "x = 1"},
+	{`format("{} and {}", "a", "b")`, "a and b"},
+	{`format("{}, {}, {}, {}, {}", 1.5, true, null, [1, "a"], {"k": 2})`, "1.5, true, Null, [1, a], {k: 2}"},
+	{`format("no placeholders")`, "no placeholders"},
+	{`format("")`, ""},
+	{`format("{{}} is {}", "literal")`, "{} is literal"},
+	{`format("{{}} is {}", [1, "a"])`, "{} is [1, a]"},
+	{`format("{{{}}}", 1)`, "{1}"},
+	{`format("}")`, "}"},
+	{`format("{}{}", "日本", "語")`, "日本語"},
+	{`format("{} {}", 1)`, Error("too few arguments to `format`: the format has more than 1 {}")},
+	{`format("{}", 1, 2)`, Error("too many arguments to `format`: the format has 1 {}, got 2 arguments")},
+	{`format("{x}", 1)`, Error("unmatched { in the format of `format`, use {{ for a literal {")},
+	{`format(1)`, Error("first argument to `format` must be STRING, got INTEGER")},
+	{`format()`, Error("wrong number of arguments. got=0, want=1 or more")},
+	{`printf("{}", 1, 2)`, Error("too many arguments to `printf`: the format has 1 {}, got 2 arguments")},
+}
+
+// 組み込み関数exitが残りの実行を打ち切るケース
+var ExitBuiltin = []ExitCase{
+	{"let f = fn(x) { exit(x) }; f(42); 1", 42},
+	{"exit(); 1", 0},
+	{"let x = 1; if (x == 1) { exit(2); } x", 2},
+	{"for (let i = 0; i < 10; i = i + 1) { if (i == 3) { exit(i) } }; 99", 3},
+}
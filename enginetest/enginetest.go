@@ -0,0 +1,31 @@
+// 評価器(evaluator)と仮想マシン(vm)の両方で実行するテストケースを提供するパッケージ
+// 二つの実行方式が同じ入力に同じ結果を返すことを、一つの表で確かめるために使う
+// どちらか一方でしか成り立たないケースは、それぞれのパッケージのテストに置く
+package enginetest
+
+// 入力と、それを実行した結果として期待する値の組
+// Expectedには次のいずれかを入れる
+//   - int, float64, bool, string: 同じ値を持つINTEGER・FLOAT・BOOLEAN・STRING
+//   - nil: NULL
+//   - []int, []string: 同じ要素を持つARRAY
+//   - Inspect: Inspect()が同じ文字列を返すオブジェクト
+//   - Error: 同じメッセージを持つエラー
+type Case struct {
+	Input    string
+	Expected interface{}
+}
+
+// Inspect()による文字列表現で比べる期待値
+// 集合やハッシュのように要素を一つずつ比べにくい値に使う
+type Inspect string
+
+// 期待するエラーのメッセージ
+// 評価器が付ける「line 1: 」のような位置は含めない
+// 仮想マシンでは、組み込み関数が値として返したエラーと、実行を止めたエラーのどちらでもよい
+type Error string
+
+// 組み込み関数exitを呼ぶ入力と、期待する終了コードの組
+type ExitCase struct {
+	Input string
+	Code  int
+}
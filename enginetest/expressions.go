@@ -0,0 +1,150 @@
+package enginetest
+
+// &&と||が真偽値以外の被演算子に対して結果を決めた方の値を返し、
+// 左辺で結果が決まれば右辺を評価しないことを確かめるケース
+var LogicalExpressions = []Case{
+	{"true && true", true},
+	{"true && false", false},
+	{"false || true", true},
+	{"false || false", false},
+	{"1 && 2", 2},
+	{"0 && 2", 2},
+	{"null && 2", nil},
+	{"false && 2", false},
+	{"1 || 2", 1},
+	{"null || 2", 2},
+	{"false || null", nil},
+	{`let name = null || "default"; name`, "default"},
+	{`let name = "monkey" || "default"; name`, "monkey"},
+	{"1 < 2 && 3 > 2", true},
+	{"false || true && false", false},
+	{"null || false || 3", 3},
+	{"let f = fn(a) { a > 1 && a < 10 }; f(5)", true},
+	{"let f = fn(a) { a > 1 && a < 10 }; f(10)", false},
+	{"let f = fn(a) { a || 0 }; [f(3), f(null)]", []int{3, 0}},
+	{"let called = 0; let f = fn() { called = called + 1 }; false && f(); true || f(); called", 0},
+	{"let called = 0; let f = fn() { called = called + 1 }; true && f(); false || f(); called", 2},
+}
+
+// 配列やハッシュが==と!=で中身によって比較されることを確かめるケース
+var DeepEquality = []Case{
+	{"[1, 2] == [1, 2]", true},
+	{"[1, 2] != [1, 2]", false},
+	{"[1, 2] == [2, 1]", false},
+	{"[1, 2] == [1, 2, 3]", false},
+	{"[] == []", true},
+	{"[1, [2, [3]]] == [1, [2, [3]]]", true},
+	{"[1, [2, [3]]] == [1, [2, [4]]]", false},
+	{`{"a": 1, "b": 2} == {"b": 2, "a": 1}`, true},
+	{`{"a": 1, "b": 2} == {"a": 1}`, false},
+	{`{"a": 1} == {"a": 2}`, false},
+	{`{"a": 1} == {"b": 1}`, false},
+	{`{"a": [1, {"b": [2]}]} == {"a": [1, {"b": [2]}]}`, true},
+	{`[{"a": 1}, {}] == [{"a": 1}, {}]`, true},
+	{"(1, [2]) == (1, [2])", true},
+	{"#{1, 2} == #{2, 1}", true},
+	{"[1] == [1.0]", true},
+	// 型が異なれば等しくない
+	{`[1] == ["1"]`, false},
+	{`[1] != ["1"]`, true},
+	{`[1] == {1: 1}`, false},
+	{"[] == null", false},
+	// nullは評価器・VM・組み込み関数で同じオブジェクトを使う
+	{"null == first([])", true},
+	{"[null, last([])] == [first([]), null]", true},
+	{"[1] == (1,)", false},
+	{`{} == []`, false},
+	// 関数は同一のオブジェクトである場合だけ等しい
+	{"let f = fn(x) { x }; [f] == [f]", true},
+	{"[fn(x) { x }] == [fn(x) { x }]", false},
+	{"let a = [1]; let b = a[:]; a == b", true},
+}
+
+// ブロックスコープは導入せず、ブロック内のLET文はIF式を囲む環境に束縛される（関数スコープ）
+// また、値を持たないブロック（空、もしくはLET文で終わる）はNULLに評価される
+var LetInsideIfBlock = []Case{
+	{"if (true) { let x = 9 }; x", 9},
+	{"if (false) { 1 } else { let y = 2 }; y", 2},
+	{"let x = 1; if (true) { let x = 9 }; x", 9},
+	{"let f = fn() { if (true) { let x = 9 }; x }; f()", 9},
+	{"if (true) { let x = 9 }", nil},
+	{"if (true) { }", nil},
+	{"if (false) { 1 } else { }", nil},
+}
+
+// FOR文のケース
+// ループ変数は代入式で更新し、Body部のLET文はループ変数や外側の変数を隠す新しい束縛を作る
+var ForStatements = []Case{
+	{"let f = fn() { for (let i = 0; i < 10; i = i + 1) { if (i == 3) { return i; } } 99 }; f()", 3},
+	{"let f = fn() { for (let i = 0; i < 3; i = i + 1) { } 99 }; f()", 99},
+	{"let f = fn() { for (let i = 0; ; i = i + 1) { if (i > 4) { return i * 10; } } }; f()", 50},
+	{"let f = fn() { for (let i = 0; i < 5; if (i == 2) { return 20; }) { i = i + 1; } }; f()", 20},
+	{"let f = fn() { for (; false;) { return 1; } 2 }; f()", 2},
+	{"let s = 0; for (let i = 0; i < 4; i = i + 1) { s = s + i; }; s", 6},
+	// ループ変数はループの外側の束縛を隠すだけで書き換えない
+	{"let f = fn() { let i = 42; for (let i = 0; i < 3; i = i + 1) { } i }; f()", 42},
+	{"let i = 42; for (let i = 0; i < 3; i = i + 1) { }; i", 42},
+	// Body部のLET文はループ変数も外側の変数も書き換えない
+	{"let n = 0; for (let i = 0; i < 3; i = i + 1) { let i = 10; n = n + i; }; n", 30},
+	{"let f = fn() { let n = 0; for (let i = 0; i < 3; i = i + 1) { let i = i + 5; n = n + i; } n }; f()", 18},
+	{"let s = 7; for (let i = 0; i < 3; i = i + 1) { let s = s + i; }; s", 7},
+	// Body部のCONST文は繰り返しごとに束縛し直せる
+	{"let n = 0; for (let q = 0; q < 3; q = q + 1) { const y = q; n = n + y; }; n", 3},
+	{"let f = fn(n) { for (let i = 0; i < n; i = i + 1) { let g = fn() { i * 100 }; if (i == n - 1) { return g(); } } }; f(3)", 200},
+}
+
+// 集合リテラルと集合を扱う組み込み関数のケース
+// 集合のInspect()は要素を文字列表現の順に並べる
+var Sets = []Case{
+	{"#{1, 2, 3}", Inspect("#{1, 2, 3}")},
+	{"#{}", Inspect("#{}")},
+	{"#{1, 1, 2}", Inspect("#{1, 2}")},
+	{`#{"a", "b", "a", 1 + 1, 2}`, Inspect("#{2, a, b}")},
+	{`#{true, false, true}`, Inspect("#{false, true}")},
+	{"let f = fn(x) { #{x, x + 1} }; f(1)", Inspect("#{1, 2}")},
+	{"len(#{1, 1, 2})", 2},
+	{"len(#{})", 0},
+	{"setUnion(#{1, 2}, #{2, 3})", Inspect("#{1, 2, 3}")},
+	{"setUnion(#{}, #{})", Inspect("#{}")},
+	{"setIntersect(#{1, 2}, #{2, 3})", Inspect("#{2}")},
+	{"setIntersect(#{1}, #{2})", Inspect("#{}")},
+	{"setDiff(#{1, 2}, #{2, 3})", Inspect("#{1}")},
+	{"setDiff(#{2, 3}, #{1, 2})", Inspect("#{3}")},
+	{"setContains(#{1, 2}, 2)", true},
+	{`setContains(#{1, 2}, "2")`, false},
+	// 引数の集合は書き換えない
+	{"let a = #{1}; let b = setUnion(a, #{2}); a", Inspect("#{1}")},
+	{"#{[1]}", Error("unusable as set element: ARRAY")},
+	{"setUnion(#{1}, [1])", Error("arguments to `setUnion` must be SET, got ARRAY")},
+	{"setIntersect(1, #{1})", Error("arguments to `setIntersect` must be SET, got INTEGER")},
+	{"setDiff(#{1})", Error("wrong number of arguments. got=1, want=2")},
+	{"setContains([1], 1)", Error("first argument to `setContains` must be SET, got ARRAY")},
+	{"setContains(#{1}, [1])", Error("unusable as set element: ARRAY")},
+}
+
+// タプルの生成・添字によるアクセス・ハッシュのキーとしての利用のケース
+var Tuples = []Case{
+	{"(1, 2 + 3, (4,))", Inspect("(1, 5, (4,))")},
+	{"(1, 2)[0]", 1},
+	{"(1, 2)[1]", 2},
+	{"(1, 2)[-1]", 2},
+	{"(1, 2)[2]", nil},
+	{"let t = (1, (2, 3)); t[1][0]", 2},
+	{"let f = fn(a, b) { (b, a) }; f(1, 2)[0]", 2},
+	{"len((1, 2, 3))", 3},
+	{"len((1,))", 1},
+	{`tuple([1, "a"])`, Inspect("(1, a)")},
+	{"tuple([])", Inspect("()")},
+	{"array((1, 2))", []int{1, 2}},
+	// 変換した結果を書き換えても元は変わらない
+	{"let a = [1]; let t = tuple(a); let b = push(a, 2); t", Inspect("(1,)")},
+	{`let h = {(1, "a"): 10, (1, "b"): 20}; h[(1, "a")] + h[(1, "b")]`, 30},
+	{`let h = {(1, (2, 3)): 1}; h[(1, (2, 3))]`, 1},
+	{`let h = {(1, 2): 1}; h[(2, 1)]`, nil},
+	{`{(1, 2): 1}[tuple([1, 2])]`, 1},
+	{"len(#{(1, 2), (1, 2), (2, 1)})", 2},
+	{"{(1, [2]): 1}", Error("unusable as hash key: TUPLE")},
+	{"{1: 1}[([1],)]", Error("unusable as hash key: TUPLE")},
+	{"tuple((1, 2))", Error("argument to `tuple` must be ARRAY, got TUPLE")},
+	{"array([1])", Error("argument to `array` must be TUPLE, got ARRAY")},
+}
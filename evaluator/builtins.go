@@ -2,164 +2,201 @@ package evaluator
 
 import (
 	"monkey/object"
+	"sort"
 )
 
-// 組み込み関数を表すオブジェクトを登録するmap
-var builtin = map[string]*object.Builtin{
+// 引数に受け取った関数を呼び出す組み込み関数
+// 関数の呼び出しには評価器のapplyFunctionを使うのでobject.Builtinsには置けず、VMからは使えない
+// 評価器ごとにbuiltinメソッドでその評価器に結び付けて使う
+// applyFunctionからの参照による初期化の循環を避けるために、init()で登録する
+var evaluatorBuiltins = map[string]func(e *Evaluator, args ...object.Object) object.Object{}
 
-	// USAGE:
-	// len("string") -> 6
-	// len([1, 23, 4]) -> 3
-	// "len": {
-	// 	Fn: func(args ...object.Object) object.Object {
-	//
-	// 		// ERROR: len("123", "234")
-	// 		if len(args) != 1 {
-	// 			return newError("wrong number of arguments. got=%d, want=1",
-	// 				len(args))
-	// 		}
-	// 		switch arg := args[0].(type) {
-	//
-	// 		// len("string")
-	// 		case *object.String:
-	// 			return &object.Integer{Value: int64(len(arg.Value))}
-	//
-	// 			// len([1, 2, 3])
-	// 		case *object.Array:
-	// 			return &object.Integer{Value: int64(len(arg.Elements))}
-	//
-	// 			// ERROR: len(123) etc.
-	// 		default:
-	// 			return newError("argument to `len` not supported, got=%s",
-	// 				args[0].Type())
-	// 		}
-	// 	},
-	// },
-	"len": object.GetBuiltinByName("len"),
+func init() {
 
 	// USAGE:
-	// first(["A", 123, "54"]) -> "A"
-	// "first": {
-	// 	Fn: func(args ...object.Object) object.Object {
-	//
-	// 		// ERROR: first(["A", 123, "54"], [45, "45"])
-	// 		if len(args) != 1 {
-	// 			return newError("wrong number if arguments. got=%d, want=1",
-	// 				len(args))
-	// 		}
-	//
-	// 		// ERROR: first("array")
-	// 		if args[0].Type() != object.ARRAY_OBJ {
-	// 			return newError("argument to `first` must be ARRAY, got %s",
-	// 				args[0].Type())
-	// 		}
-	//
-	// 		arr := args[0].(*object.Array)
-	// 		if len(arr.Elements) > 0 {
-	// 			return arr.Elements[0]
-	// 		}
-	//
-	// 		return NULL
-	// 	},
-	// },
-	"first": object.GetBuiltinByName("first"),
+	// flat_map([1, 2], fn(x) { [x, x * 10] }) -> [1, 10, 2, 20]
+	// flat_map([1, 2], fn(x) { x }) -> [1, 2] (配列以外を返した場合はその値を一つの要素として連結する)
+	// flat_map([], fn(x) { [x] }) -> []
+	evaluatorBuiltins["flat_map"] = (*Evaluator).flatMap
 
 	// USAGE:
-	// last(["A", 123, "54"]) -> "54"
-	// "last": {
-	// 	Fn: func(args ...object.Object) object.Object {
-	//
-	// 		// ERROR: last(["A", 123, "54"], [45, "45"])
-	// 		if len(args) != 1 {
-	// 			return newError("wrong number if arguments. got=%d, want=1",
-	// 				len(args))
-	// 		}
-	//
-	// 		// ERROR: last("array")
-	// 		if args[0].Type() != object.ARRAY_OBJ {
-	// 			return newError("argument to `last` must be ARRAY, got %s",
-	// 				args[0].Type())
-	// 		}
-	//
-	// 		arr := args[0].(*object.Array)
-	// 		length := len(arr.Elements)
-	// 		if length > 0 {
-	// 			return arr.Elements[length-1]
-	// 		}
-	//
-	// 		return NULL
-	// 	},
-	// },
-	"last": object.GetBuiltinByName("last"),
+	// filter([1, 2, 3, 4], fn(x) { x > 2 }) -> [3, 4]
+	// filter([1, null, 2], fn(x) { x }) -> [1, 2] (関数の返り値はif式の条件と同じく真偽を判定する)
+	// filter([1, 2], fn(x) { false }) -> []
+	evaluatorBuiltins["filter"] = (*Evaluator).filter
 
 	// USAGE:
-	// rest(["A", 123, "54"]) -> [123, "54"]
-	// "rest": {
-	// 	Fn: func(args ...object.Object) object.Object {
-	//
-	// 		// ERROR: rest(["A", 123, "54"], [45, "45"])
-	// 		if len(args) != 1 {
-	// 			return newError("wrong number if arguments. got=%d, want=1",
-	// 				len(args))
-	// 		}
-	//
-	// 		// ERROR: rest("array")
-	// 		if args[0].Type() != object.ARRAY_OBJ {
-	// 			return newError("argument to `rest` must be ARRAY, got %s",
-	// 				args[0].Type())
-	// 		}
-	//
-	// 		arr := args[0].(*object.Array)
-	// 		length := len(arr.Elements)
-	// 		if length > 0 {
-	//
-	// 			// 組み込み関数restは非破壊的な関数で、新たに割り当てられたArrayを返す
-	// 			newElements := make([]object.Object, length-1, length-1)
-	// 			copy(newElements, arr.Elements[1:length])
-	// 			return &object.Array{Elements: newElements}
-	// 		}
-	//
-	// 		return NULL
-	// 	},
-	// },
-	"rest": object.GetBuiltinByName("rest"),
+	// sort([3, 1, 2]) -> [1, 2, 3] (数値だけ、または文字列だけの配列を昇順に並べる)
+	// sort(["b", "a"]) -> [a, b]
+	// sort([3, 1, 2], fn(a, b) { b - a }) -> [3, 2, 1] (比較関数はaが先なら負、bが先なら正、同順なら0の整数を返す)
+	// 元の配列は変更せず、同順の要素は元の順序を保つ
+	evaluatorBuiltins["sort"] = (*Evaluator).sort
+}
 
-	// USAGE:
-	// push(["A", 123, "54"], 45) -> ["A", 123, "54", 45]
-	// "push": {
-	// 	Fn: func(args ...object.Object) object.Object {
-	//
-	// 		// ERROR: push(["A", 123, "54"], 45, 45)
-	// 		if len(args) != 2 {
-	// 			return newError("wrong number if arguments. got=%d, want=2",
-	// 				len(args))
-	// 		}
-	//
-	// 		// ERROR: push("array")
-	// 		if args[0].Type() != object.ARRAY_OBJ {
-	// 			return newError("argument to `push` must be ARRAY, got %s",
-	// 				args[0].Type())
-	// 		}
-	//
-	// 		arr := args[0].(*object.Array)
-	// 		length := len(arr.Elements)
-	// 		newElements := make([]object.Object, length+1, length+1)
-	// 		copy(newElements, arr.Elements)
-	// 		newElements[length] = args[1]
-	// 		return &object.Array{Elements: newElements}
-	// 	},
-	// },
-	"push": object.GetBuiltinByName("push"),
+// fnがこの評価器に結び付けた組み込み関数かを確認するヘルパー関数
+func (e *Evaluator) isBound(fn *object.Builtin) bool {
+	for _, b := range e.builtins {
+		if b == fn {
+			return true
+		}
+	}
+	return false
+}
 
-	// USAGE:
-	// puts("Hello World") -> "Hello World"
-	// "puts": {
-	// 	Fn: func(args ...object.Object) object.Object {
-	// 		for _, arg := range args {
-	// 			fmt.Println(arg.Inspect())
-	// 		}
-	// 		return NULL
-	// 	},
-	// },
-	"puts": object.GetBuiltinByName("puts"),
+// 評価器を使う組み込み関数nameをこの評価器に結び付けて返す
+// 同じ名前には同じオブジェクトを返す。該当する関数がなければnilを返す
+func (e *Evaluator) builtin(name string) *object.Builtin {
+	if b, ok := e.builtins[name]; ok {
+		return b
+	}
+	fn, ok := evaluatorBuiltins[name]
+	if !ok {
+		return nil
+	}
+	b := &object.Builtin{Fn: func(args ...object.Object) object.Object { return fn(e, args...) }}
+	e.builtins[name] = b
+	return b
+}
+
+func (e *Evaluator) flatMap(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError(e.callSite(nil), "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return newError(e.callSite(nil), "argument to `flat_map` must be ARRAY, got %s", args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return newError(e.callSite(nil), "second argument to `flat_map` must be FUNCTION, got %s", args[1].Type())
+	}
+
+	result := []object.Object{}
+	for _, el := range array.Elements {
+		mapped := e.applyFunction(args[1], []object.Object{el}, nil)
+		if isError(mapped) {
+			return mapped
+		}
+		if mappedArray, ok := mapped.(*object.Array); ok {
+			result = append(result, mappedArray.Elements...)
+		} else {
+			result = append(result, mapped)
+		}
+	}
+	return &object.Array{Elements: result}
+}
+
+// 関数が真を返した要素だけを元の順に並べた新しい配列を返す
+func (e *Evaluator) filter(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError(e.callSite(nil), "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return newError(e.callSite(nil), "argument to `filter` must be ARRAY, got %s", args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return newError(e.callSite(nil), "second argument to `filter` must be FUNCTION, got %s", args[1].Type())
+	}
+
+	result := []object.Object{}
+	for _, el := range array.Elements {
+		keep := e.applyFunction(args[1], []object.Object{el}, nil)
+		if isError(keep) {
+			return keep
+		}
+		if isTruthy(keep) {
+			result = append(result, el)
+		}
+	}
+	return &object.Array{Elements: result}
+}
+
+// 配列を並べ替えた新しい配列を返す
+func (e *Evaluator) sort(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError(e.callSite(nil), "wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return newError(e.callSite(nil), "argument to `sort` must be ARRAY, got %s", args[0].Type())
+	}
+	elements := make([]object.Object, len(array.Elements))
+	copy(elements, array.Elements)
+
+	if len(args) == 1 {
+		less, err := e.naturalOrder(elements)
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(elements, less)
+		return &object.Array{Elements: elements}
+	}
+
+	if !isCallable(args[1]) {
+		return newError(e.callSite(nil), "second argument to `sort` must be FUNCTION, got %s", args[1].Type())
+	}
+	// 比較関数で起きたエラーは並べ替えを中断できないので、最初のエラーを覚えておいて後で返す
+	var err object.Object
+	sort.SliceStable(elements, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		result := e.applyFunction(args[1], []object.Object{elements[i], elements[j]}, nil)
+		if isError(result) {
+			err = result
+			return false
+		}
+		order, ok := result.(*object.Integer)
+		if !ok {
+			err = newError(e.callSite(nil), "comparator of `sort` must return INTEGER (negative, zero or positive), got %s", result.Type())
+			return false
+		}
+		return order.Value < 0
+	})
+	if err != nil {
+		return err
+	}
+	return &object.Array{Elements: elements}
+}
+
+// 比較関数を指定しないsortで使う昇順の比較関数を返す
+// 要素は数値だけ、または文字列だけでなければならない
+func (e *Evaluator) naturalOrder(elements []object.Object) (func(i, j int) bool, *object.Error) {
+	if len(elements) == 0 {
+		return func(i, j int) bool { return false }, nil
+	}
+	isNumber := func(obj object.Object) bool {
+		return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+	}
+	first := elements[0]
+	for _, el := range elements {
+		sameKind := isNumber(first) && isNumber(el) || first.Type() == object.STRING_OBJ && el.Type() == object.STRING_OBJ
+		if !sameKind {
+			return nil, newError(e.callSite(nil), "cannot sort %s and %s without a comparator", first.Type(), el.Type())
+		}
+	}
+
+	if first.Type() == object.STRING_OBJ {
+		return func(i, j int) bool {
+			return elements[i].(*object.String).Value < elements[j].(*object.String).Value
+		}, nil
+	}
+	return func(i, j int) bool {
+		a, aIsInt := elements[i].(*object.Integer)
+		b, bIsInt := elements[j].(*object.Integer)
+		if aIsInt && bIsInt {
+			return a.Value < b.Value
+		}
+		return toFloat(elements[i]) < toFloat(elements[j])
+	}, nil
+}
+
+// applyFunctionで呼び出せるオブジェクトかを確認するヘルパー関数
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Builtin:
+		return true
+	default:
+		return false
+	}
 }
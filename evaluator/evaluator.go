@@ -2,101 +2,219 @@ package evaluator
 
 import (
 	"fmt"
+	"io"
+	"math"
 	"monkey/ast"
 	"monkey/object"
+	"strings"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL     = object.NULL
+	TRUE     = object.TRUE
+	FALSE    = object.FALSE
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
-// ast.Node型を受け取り評価して、適切なobject.Objectを返す
+// 評価器
+// 評価の上限などの設定と、評価中の状態を持つ
+type Evaluator struct {
+	budget int // 評価できるノードの数の上限。0なら上限なし
+	steps  int // これまでに評価したノードの数
+
+	builtins map[string]*object.Builtin // 評価器を使う組み込み関数をこの評価器に結び付けたもの
+	out      io.Writer                  // putsなどの組み込み関数の出力先。nilなら標準出力
+
+	stack       []object.StackFrame    // 評価中の関数呼び出しの履歴
+	builtinCall *ast.CallExpression    // 呼び出し中の組み込み関数の呼び出し式
+	deferred    [][]deferredExpression // 評価中の関数ごとに、DEFER文で評価を遅らせた式を積んだもの
+
+	dir        string                    // 評価中のファイルがあるディレクトリ。importの相対パスはここから探す
+	searchPath []string                  // importの相対パスがdirに見つからなかったときに探すディレクトリ
+	modules    map[string]*object.Module // 読み込んだモジュール。ファイルの絶対パスをキーとする
+}
+
+// DEFER文で評価を遅らせた式と、それを評価する環境
+type deferredExpression struct {
+	expression ast.Expression
+	env        *object.Environment
+}
+
+// 設定が既定値の評価器を返す
+func New() *Evaluator {
+	return &Evaluator{builtins: map[string]*object.Builtin{}, modules: map[string]*object.Module{}}
+}
+
+// 評価できるノードの数の上限を設定する
+// 上限を超えるとそれ以上評価せずに「evaluation budget exceeded」のエラーを返す
+// 0なら上限を設けない
+// ノード一つの評価を1ステップとし、組み込み関数の呼び出しはそれに加えて関数ごとの手間を数える
+func (e *Evaluator) SetBudget(steps int) {
+	e.budget = steps
+	e.steps = 0
+}
+
+// putsなどの組み込み関数の出力先を標準出力からwに差し替える
+func (e *Evaluator) SetOutput(w io.Writer) {
+	e.out = w
+}
+
+// 既定の設定の評価器でnodeを評価する
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New().Eval(node, env)
+}
+
+// ast.Node型を受け取り評価して、適切なobject.Objectを返す
+func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	if !e.consume(1) {
+		return budgetExceededError(node)
+	}
 
 	// 引数nodeの型によって処理を振り分ける
 	switch node := node.(type) {
 
 	// 文だった
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return e.evalBlockStatement(node, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.Eval(node.Expression, env)
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		if env.IsConst(node.Name.Value) {
+			return newError(node, "cannot redeclare constant %s", node.Name.Value)
+		}
+		val := e.Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
+	case *ast.DestructuringLetStatement:
+		if err := e.evalDestructuringLetStatement(node, env); err != nil {
+			return err
+		}
+	case *ast.ConstStatement:
+		if env.IsConst(node.Name.Value) {
+			return newError(node, "cannot redeclare constant %s", node.Name.Value)
+		}
+		val := e.Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		env.SetConst(node.Name.Value, val)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := e.Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
+	case *ast.ForStatement:
+		return e.evalForStatement(node, env)
+	case *ast.WhileStatement:
+		return e.evalWhileStatement(node, env)
+	case *ast.TryCatchStatement:
+		return e.evalTryCatchStatement(node, env)
+	case *ast.DeferStatement:
+		return e.evalDeferStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 
 	// 式だった
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
+	case *ast.NullLiteral:
+		return NULL
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return evalPrefixExpression(node, right)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
+		if node.Operator == "&&" || node.Operator == "||" {
+			return e.evalLogicalExpression(node, left, env)
+		}
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return evalInfixExpression(node, node.Operator, left, right)
+	case *ast.AssignExpression:
+		return e.evalAssignExpression(node, env)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
+	case *ast.SwitchExpression:
+		return e.evalSwitchExpression(node, env)
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return e.evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
 		return &object.Function{Parameters: params, Body: body, Env: env}
+	case *ast.MacroLiteral:
+		// マクロはDefineMacrosで評価の前に取り除かれる
+		return newError(node, "macro can only be defined by a top-level let statement")
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		// quoteは引数を評価せずにASTノードのまま返す
+		if isCallTo(node, "quote") {
+			return e.quote(node, env)
+		}
+		function := e.Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		// 引数の評価で起きたエラーは関数を呼び出さずに外側に伝える。ただしis_errorにはそのまま渡す
+		args := e.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) && !passesErrors(function, node, args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		return e.applyFunction(function, args, node)
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
+		return e.evalArrayLiteral(node, env)
+	case *ast.SetLiteral:
+		return e.evalSetLiteral(node, env)
+	case *ast.TupleLiteral:
+		elements := e.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return &object.Tuple{Elements: elements}
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		index := e.Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return evalIndexExpression(node, left, index)
+	case *ast.SliceExpression:
+		return e.evalSliceExpression(node, env)
+	case *ast.ImportExpression:
+		return e.evalImportExpression(node)
+	case *ast.PropagateErrorExpression:
+		// エラーはTRY文やis_errorに捕まらずに、それを囲む関数の呼び出し元まで伝える
+		inner := e.Eval(node.Inner, env)
+		if err, ok := inner.(*object.Error); ok {
+			return &object.Propagate{Error: err}
+		}
+		return inner
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return e.evalHashLiteral(node, env)
 	}
 
 	return nil
@@ -125,14 +243,14 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 }
 
 // operatorがサポート対象の演算子であることを確認するヘルパー関数
-func evalPrefixExpression(operator string, right object.Object) object.Object {
-	switch operator {
+func evalPrefixExpression(node *ast.PrefixExpression, right object.Object) object.Object {
+	switch node.Operator {
 	case "!": // 演算子!を評価するヘルパー関数に処理を譲渡
 		return evalBangOperatorExpression(right)
 	case "-": // 演算子-を評価するヘルパー関数に処理を譲渡
-		return evalMinusPrefixOperatorExpression(right)
+		return evalMinusPrefixOperatorExpression(node, right)
 	default: // サポートしていない演算子に遭遇したらErrorObjectを返す
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newError(node, "unknown operator: %s%s", node.Operator, right.Type())
 	}
 }
 
@@ -152,38 +270,102 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 // 演算子-を評価して適切なObjectを返すヘルパー関数
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+func evalMinusPrefixOperatorExpression(node ast.Node, right object.Object) object.Object {
 
 	// 演算子-のサポートしていない型に対して作用させようとしているときにはErrorObjectを返す
-	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return newError(node, "unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
 // 中置式を構成するオペランドに応じて適切な評価関数へ処理を振り分けるヘルパー関数
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+// nodeはエラーメッセージに位置を示すための、演算を行う式のノード
+func evalInfixExpression(node ast.Node, operator string, left, right object.Object) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
+		return evalIntegerInfixExpression(node, operator, left, right)
+	case isNumber(left) && isNumber(right): // 片方が浮動小数点数なら浮動小数点数として計算する
+		return evalFloatInfixExpression(node, operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
-	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return evalStringInfixExpression(node, operator, left, right)
+	case operator == "==": // 配列やハッシュは中身を再帰的に比較する
+		return nativeBoolToBooleanObject(object.Equals(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!object.Equals(left, right))
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s",
+		return newError(node, "type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newError(node, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
 
+// &&と||を短絡評価する
+// a || bはaが真ならa、そうでなければbを、a && bはaが偽ならa、そうでなければbを返す
+// 左辺で結果が決まる場合は右辺を評価しない
+func (e *Evaluator) evalLogicalExpression(node *ast.InfixExpression, left object.Object, env *object.Environment) object.Object {
+	if isTruthy(left) == (node.Operator == "||") {
+		return left
+	}
+	return e.Eval(node.Right, env)
+}
+
+// 浮動小数点数による中置式を評価してObjectを返すヘルパー関数
+// 整数のオペランドは浮動小数点数に変換してから計算する
+func evalFloatInfixExpression(node ast.Node, operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		// 除算と同じく、0で割ってもエラーにせずNaNとする
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError(node, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// 整数か浮動小数点数かどうかを返す
+func isNumber(obj object.Object) bool {
+	t := obj.Type()
+	return t == object.INTEGER_OBJ || t == object.FLOAT_OBJ
+}
+
+// 整数か浮動小数点数をfloat64にする
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
 // 整数による中置式を評価してObjectを返すヘルパー関数
-func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+func evalIntegerInfixExpression(node ast.Node, operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 	switch operator {
@@ -194,34 +376,52 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		// Goの整数の0除算はpanicするので、エラーオブジェクトにして返す
+		if rightVal == 0 {
+			return newError(node, "division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError(node, "division by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newError(node, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
 
 // IfExpression型のASTノードを引数にとって評価して適切なObjectを返すヘルパー関数
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.Eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
+	var result object.Object
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		result = e.Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
-	} else {
+		result = e.Eval(ie.Alternative, env)
+	}
+
+	// ブロックが空だったりLET文で終わっていたりして値を持たない場合もNULLとする
+	if result == nil {
 		return NULL
 	}
+	return result
 }
 
 // 引数objがTruthyであるかを確認するヘルパー関数
@@ -239,12 +439,12 @@ func isTruthy(obj object.Object) bool {
 }
 
 // プログラムを評価してObjectを返すヘルパー関数
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (e *Evaluator) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 	for _, statement := range program.Statements {
 
 		// プログラムを構成する一文一文を一つずつ評価していく
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
 		// 評価した結果得られたObjectがReturnValue型であったならばそれを返す
 		switch result := result.(type) {
@@ -252,64 +452,407 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 			return result.Value
 		case *object.Error: // 評価した結果得られたObjectがError型であったならばそれを返す
 			return result
+		case *object.Exit: // 組み込み関数exitが呼ばれたならば残りの文を評価せずに終える
+			return result
+		case *object.Propagate: // 関数の外で?が受け取ったエラーはプログラムを止める
+			return result.Error
+		case *object.Break, *object.Continue: // ループの外にあるbreak文・continue文
+			return loopControlError(statement, result)
 		}
 	}
 	return result
 }
 
 // ブロック文を評価してObjectを返すヘルパー関数
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (e *Evaluator) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
 	// ブロックに含まれている各文を評価していく
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
+		// RETURN文、エラー、exit、break文・continue文はブロックの残りを評価せずに外側に伝える
+		if result != nil {
+			switch result.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.EXIT_OBJ, object.PROPAGATE_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+				return result
+			}
+		}
+	}
+
+	// 空のブロックやlet文などの値を持たない文で終わるブロックの値は共有のNULLにする
+	// Goのnilのまま返すと、if式や関数呼び出しの値として==で比較できない
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// SWITCH式を評価するヘルパー関数
+// Subject部を一度だけ評価し、各case節の値と==で比較して最初に一致したcase節の本体の値を返す
+// 一致するcase節がなければdefault節の本体の値を、default節もなければNULLを返す
+func (e *Evaluator) evalSwitchExpression(se *ast.SwitchExpression, env *object.Environment) object.Object {
+	subject := e.Eval(se.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	var body *ast.BlockStatement
+	for _, c := range se.Cases {
+		value := e.Eval(c.Value, env)
+		if isError(value) {
+			return value
+		}
+		matched := evalInfixExpression(c.Value, "==", subject, value)
+		if isError(matched) {
+			return matched
+		}
+		if isTruthy(matched) {
+			body = c.Body
+			break
+		}
+	}
+	if body == nil {
+		body = se.Default
+	}
+	if body == nil {
+		return NULL
+	}
+
+	// IF式と同様に、本体が値を持たない場合はNULLとする
+	result := e.Eval(body, env)
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// FOR文を評価するヘルパー関数
+// Init部は新しく作った環境で一度だけ評価し、Condition部が真である間Body部とPost部を繰り返し評価する
+// Body部は繰り返しごとにInit部の環境を拡張した環境で評価する
+// Body部のLET文はループ変数を隠す新しい束縛を作るだけなので、ループ変数は代入式で更新する
+// FOR文自体の値はNULLとする
+func (e *Evaluator) evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	loopEnv := object.NewEnclosedEnvironment(env)
+
+	if fs.Init != nil {
+		init := e.Eval(fs.Init, loopEnv)
+		if isError(init) {
+			return init
+		}
+	}
+
+	for {
+		if fs.Condition != nil {
+			condition := e.Eval(fs.Condition, loopEnv)
+			if isError(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				break
+			}
+		}
+
+		// Body部は繰り返しごとに新しい環境で評価するので、Body部のCONST文は毎回束縛し直せる
+		// RETURN文やエラーはループを抜けてそのまま外側に伝える
+		// break文はループを抜け、continue文はPost部の評価に移る
+		result := e.Eval(fs.Body, object.NewEnclosedEnvironment(loopEnv))
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || isError(result) {
 				return result
 			}
+			if rt == object.BREAK_OBJ {
+				break
+			}
+		}
+
+		if fs.Post != nil {
+			post := e.Eval(fs.Post, loopEnv)
+			if post != nil {
+				rt := post.Type()
+				if rt == object.RETURN_VALUE_OBJ || isError(post) {
+					return post
+				}
+			}
+		}
+	}
+	return NULL
+}
+
+// WHILE文を評価するヘルパー関数
+// Condition部が真である間Body部を繰り返し評価する
+// Body部はループ用に作った環境で評価するので、Body部のLET文はループの外からは見えない
+// WHILE文自体の値はNULLとする
+func (e *Evaluator) evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	loopEnv := object.NewEnclosedEnvironment(env)
+
+	for {
+		condition := e.Eval(ws.Condition, loopEnv)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			break
+		}
+
+		// Body部は繰り返しごとに新しい環境で評価するので、Body部のCONST文は毎回束縛し直せる
+		// RETURN文やエラーはループを抜けてそのまま外側に伝える
+		// break文はループを抜け、continue文は次の繰り返しに移る
+		result := e.Eval(ws.Body, object.NewEnclosedEnvironment(loopEnv))
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || isError(result) {
+				return result
+			}
+			if rt == object.BREAK_OBJ {
+				break
+			}
+		}
+	}
+	return NULL
+}
+
+// TRY文を評価するヘルパー関数
+// Try部の評価中にエラーが起きた場合は、エラーを表すハッシュをErrNameに束縛した環境でCatch部を評価する
+// Catch部で起きたエラーはそのまま外側に伝える
+// 評価の上限を超えたことによるエラーは捕まえない
+// TRY文自体の値は最後に評価したブロックの値とする
+func (e *Evaluator) evalTryCatchStatement(ts *ast.TryCatchStatement, env *object.Environment) object.Object {
+	result := e.Eval(ts.Try, env)
+	errObj, ok := result.(*object.Error)
+	if !ok || e.budgetExhausted() {
+		return result
+	}
+
+	catchEnv := object.NewEnclosedEnvironment(env)
+	catchEnv.Set(ts.ErrName.Value, caughtError(errObj))
+	return e.Eval(ts.Catch, catchEnv)
+}
+
+// Catch部でErrNameに束縛する、捕まえたエラーを表すハッシュを返すヘルパー関数
+// Errorをそのまま束縛すると参照しただけでエラーとして伝わってしまうので、ただの値に変換する
+// e.messageで位置を除いたメッセージを、e.lineとe.columnでエラーが起きた位置を参照できる
+func caughtError(errObj *object.Error) *object.Hash {
+	fields := []struct {
+		name  string
+		value object.Object
+	}{
+		{"message", &object.String{Value: errObj.Text()}},
+		{"line", &object.Integer{Value: int64(errObj.Line)}},
+		{"column", &object.Integer{Value: int64(errObj.Column)}},
+	}
+	pairs := make(map[object.HashKey]object.HashPair, len(fields))
+	for _, f := range fields {
+		key := &object.String{Value: f.name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: f.value}
+	}
+	return &object.Hash{Pairs: pairs}
+}
+
+// DEFER文を評価するヘルパー関数
+// 式はここでは評価せず、それを囲む関数から返るときに評価するように積んでおく
+func (e *Evaluator) evalDeferStatement(ds *ast.DeferStatement, env *object.Environment) object.Object {
+	if len(e.deferred) == 0 {
+		return newError(ds, "defer outside of function")
+	}
+	top := len(e.deferred) - 1
+	e.deferred[top] = append(e.deferred[top], deferredExpression{expression: ds.Call, env: env})
+	return nil
+}
+
+// 関数から返るときに、DEFER文で遅らせた式を積んだのと逆の順に評価するヘルパー関数
+// RETURN文で返る場合や本体でエラーが起きた場合も評価する
+// 関数の値はresultのままとするが、本体でエラーが起きずに遅らせた式でエラーが起きた場合はそのエラーとする
+// exitが呼ばれた場合はただちに終了するので、残りの遅らせた式は評価しない
+func (e *Evaluator) runDeferred(result object.Object) object.Object {
+	top := len(e.deferred) - 1
+	deferred := e.deferred[top]
+	e.deferred = e.deferred[:top]
+	if _, ok := result.(*object.Exit); ok {
+		return result
+	}
+
+	for i := len(deferred) - 1; i >= 0; i-- {
+		val := e.Eval(deferred[i].expression, deferred[i].env)
+		if _, ok := val.(*object.Exit); ok {
+			return val
+		}
+		if isError(val) && !isError(result) {
+			result = val
 		}
 	}
 	return result
 }
 
+// ループの外で評価されたbreak文・continue文に対するエラーを返すヘルパー関数
+func loopControlError(node ast.Node, signal object.Object) *object.Error {
+	return newError(node, "%s outside of loop", signal.Inspect())
+}
+
 // フォーマットと内容を引数にエラーメッセージを格納したErrorObjectを返すヘルパー関数
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+// nodeはエラーの起きた箇所のノードで、メッセージの先頭に「line 4: 」のようにその行番号を付ける
+// nodeがnilか位置を持たない場合は行番号を付けない
+func newError(node ast.Node, format string, a ...interface{}) *object.Error {
+	if node == nil {
+		return &object.Error{Message: fmt.Sprintf(format, a...)}
+	}
+	return newErrorAt(node.Position().Line, node.Position().Column, format, a...)
+}
+
+// line行column列で起きたエラーを生成する
+// lineが0のときは位置の分からないエラーとなる
+func newErrorAt(line, column int, format string, a ...interface{}) *object.Error {
+	return withLocation(line, column, &object.Error{Message: fmt.Sprintf(format, a...)})
+}
+
+// エラーにnodeの位置を記録するヘルパー関数
+func withPosition(node ast.Node, err *object.Error) *object.Error {
+	if node == nil {
+		return err
+	}
+	return withLocation(node.Position().Line, node.Position().Column, err)
+}
+
+// エラーに位置を記録し、メッセージの先頭に行番号を付けるヘルパー関数
+func withLocation(line, column int, err *object.Error) *object.Error {
+	if line == 0 {
+		return err
+	}
+	err.Message = fmt.Sprintf("line %d: %s", line, err.Message)
+	err.Line, err.Column = line, column
+	return err
 }
 
 // 引数objがError型であるかを確認するヘルパー関数
+// 組み込み関数exitが返すExitも、エラーと同じくそれ以降の評価を打ち切って外側に伝えるのでtrueとする
 func isError(obj object.Object) bool {
 	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+		return obj.Type() == object.ERROR_OBJ || obj.Type() == object.EXIT_OBJ || obj.Type() == object.PROPAGATE_OBJ
 	}
 	return false
 }
 
 // Identifier型のASTノードを引数に環境内に登録されている対応するObjectを返すヘルパー関数
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+func (e *Evaluator) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
-	if builtin, ok := builtin[node.Value]; ok {
+	if builtin := object.GetBuiltinByName(node.Value); builtin != nil {
 		return builtin
 	}
-	return newError("identifier not found: " + node.Value)
+	if builtin := e.builtin(node.Value); builtin != nil {
+		return builtin
+	}
+	return newError(node, "identifier not found: %s", node.Value)
+}
+
+// 配列を分割して束縛するLET文を評価する
+// 配列が名前より短ければ余った名前にはNULLを束縛し、長ければ余った要素は無視する
+func (e *Evaluator) evalDestructuringLetStatement(node *ast.DestructuringLetStatement, env *object.Environment) object.Object {
+	for _, name := range node.Names {
+		if env.IsConst(name.Value) {
+			return newError(name, "cannot redeclare constant %s", name.Value)
+		}
+	}
+	val := e.Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+	array, ok := val.(*object.Array)
+	if !ok {
+		return newError(node, "destructuring let requires ARRAY, got %s", val.Type())
+	}
+	for i, name := range node.Names {
+		if i < len(array.Elements) {
+			env.Set(name.Value, array.Elements[i])
+		} else {
+			env.Set(name.Value, NULL)
+		}
+	}
+	return nil
+}
+
+// 代入式を評価する
+// 代入先は名前が束縛されているもっとも内側の環境で、定数には代入できない
+// 関数の中からの代入もその関数を定義した環境の束縛を書き換えるので、クロージャで状態を持てる
+// 名前が束縛されていない場合のエラーは右辺を評価した後に返す
+func (e *Evaluator) evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	name := node.Name.Value
+	if owner := env.Owner(name); owner != nil && owner.IsConst(name) {
+		return newError(node, "cannot assign to constant %s", name)
+	}
+	val := e.Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+	if !env.Assign(name, val) {
+		return newError(node, "identifier not found: %s", name)
+	}
+	return val
+}
+
+// 配列リテラルを評価する
+// スプレッド要素は評価した配列の要素をその位置に展開する
+func (e *Evaluator) evalArrayLiteral(node *ast.ArrayLiteral, env *object.Environment) object.Object {
+	elements := make([]object.Object, 0, len(node.Elements))
+	for _, el := range node.Elements {
+		spread, ok := el.(*ast.SpreadElement)
+		if !ok {
+			evaluated := e.Eval(el, env)
+			if isError(evaluated) {
+				return evaluated
+			}
+			elements = append(elements, evaluated)
+			continue
+		}
+		evaluated := e.Eval(spread.Expression, env)
+		if isError(evaluated) {
+			return evaluated
+		}
+		array, ok := evaluated.(*object.Array)
+		if !ok {
+			return newError(spread, "spread operator requires ARRAY, got %s", evaluated.Type())
+		}
+		elements = append(elements, array.Elements...)
+	}
+	return &object.Array{Elements: elements}
+}
+
+// 集合リテラルを評価する
+// 要素はHashKeyで重複を取り除くので、ハッシュのキーに使えない要素はエラーになる
+func (e *Evaluator) evalSetLiteral(node *ast.SetLiteral, env *object.Environment) object.Object {
+	elements := e.evalExpressions(node.Elements, env)
+	if len(elements) == 1 && isError(elements[0]) {
+		return elements[0]
+	}
+	set, unusable := object.NewSet(elements)
+	if unusable != nil {
+		return newError(node, "unusable as set element: %s", unusable.Type())
+	}
+	return set
+}
+
+// 呼び出し式callの引数の評価で起きたエラーを、外側に伝えずに値として関数に渡すかを確認するヘルパー関数
+// is_errorはエラーかどうかを調べる関数なので、ただ一つの引数の式がエラーになってもそのまま渡す
+// 調べられるのはその引数の式自体が生んだエラーだけで、「let e = error("..."); is_error(e)」は
+// LET文の評価でエラーが伝わって止まるので、is_errorが呼ばれることはない
+func passesErrors(function object.Object, call *ast.CallExpression, arg object.Object) bool {
+	_, ok := arg.(*object.Error)
+	return ok && len(call.Arguments) == 1 && function == object.GetBuiltinByName("is_error")
 }
 
 // 一連の式を評価し適切なオブジェクトのスライスを返すヘルパー関数
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func (e *Evaluator) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 
 	// 返すObjectのスライス
 	var result []object.Object
 
 	// 各式に対してい
-	for _, e := range exps {
+	for _, exp := range exps {
 
 		// 評価しObjectを得る
-		evaluated := Eval(e, env)
+		evaluated := e.Eval(exp, env)
 
 		// エラーが起きたらそこで一連の評価を中断しエラーのみを一つ含むスライスを返す
 		if isError(evaluated) {
@@ -323,27 +866,148 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 }
 
 // 関数を引数に対して適応させ得られたObjectを返すヘルパー関数
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// callは関数を呼び出した式で、組み込み関数が引数の関数を呼び出す場合はnilになる
+func (e *Evaluator) applyFunction(fn object.Object, args []object.Object, call *ast.CallExpression) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		// 引数の数が仮引数の数と違うと環境を拡張できない
+		if len(args) != len(fn.Parameters) {
+			return newError(e.callSite(call), "wrong number of arguments to %s: want=%d, got=%d",
+				functionSignature(fn), len(fn.Parameters), len(args))
+		}
+
 		// 関数の持っている環境で環境を拡張する
 		extendedEnv := extendFunctionEnv(fn, args)
 
-		// 関数を引数に対して適応
-		evaluated := Eval(fn.Body, extendedEnv)
+		// 関数を引数に対して適応し、本体を評価し終えたらDEFER文で遅らせた式を評価する
+		// 本体の中で起きたエラーには、その時点の関数呼び出しの履歴を付ける
+		e.stack = append(e.stack, e.stackFrame(fn, call))
+		e.deferred = append(e.deferred, nil)
+		evaluated := e.runDeferred(e.Eval(fn.Body, extendedEnv))
+		// ?が伝えたエラーは、この関数が返したエラーになる
+		if propagate, ok := evaluated.(*object.Propagate); ok {
+			evaluated = propagate.Error
+		}
+		if err, ok := evaluated.(*object.Error); ok && err.Stack == nil {
+			err.Stack = append([]object.StackFrame{}, e.stack...)
+		}
+		e.stack = e.stack[:len(e.stack)-1]
+
+		// 関数の本体から漏れ出たbreak文・continue文は呼び出し元のループには伝えない
+		switch evaluated.(type) {
+		case *object.Break, *object.Continue:
+			return loopControlError(e.callSite(call), evaluated)
+		}
 
 		// ReturnValueObjectでったらならば皮を剥いでObject.Objectにする必要がある
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
+		site := e.callSite(call)
+		if !e.consume(builtinCost(fn, args)) {
+			return budgetExceededError(site)
+		}
+		outer := e.builtinCall
+		e.builtinCall = call
+		result := fn.CallWithOutput(e.out, args...)
+		e.builtinCall = outer
+
+		// 組み込み関数は呼び出された位置を知らないので、返したエラーに呼び出し位置を付ける
+		// 評価器を使う組み込み関数のエラーは、引数の関数から伝わったものも含めて位置付きで作られる
+		if err, ok := result.(*object.Error); ok && !e.isBound(fn) {
+			return withPosition(site, err)
+		}
+		if result != nil {
 			return result
 		}
 		return NULL
 	default:
-		return newError("not a function: %s", fn.Type())
+		return newError(e.callSite(call), "not a function: %s", fn.Type())
 	}
 }
 
+// エラーメッセージに示す、関数を呼び出した位置のノードを返すヘルパー関数
+// 組み込み関数が引数の関数を呼び出した場合は、その組み込み関数を呼び出した式を返す
+// どちらもなければnilを返す
+func (e *Evaluator) callSite(call *ast.CallExpression) ast.Node {
+	if call != nil {
+		return call
+	}
+	if e.builtinCall != nil {
+		return e.builtinCall
+	}
+	return nil
+}
+
+// 関数呼び出しの履歴に積む一つ分を作るヘルパー関数
+// 識別子を介して呼び出した関数はその名前で示す
+// 組み込み関数が引数の関数を呼び出した場合は、その組み込み関数を呼び出した位置を呼び出し位置とする
+func (e *Evaluator) stackFrame(fn *object.Function, call *ast.CallExpression) object.StackFrame {
+	frame := object.StackFrame{Function: functionSignature(fn), Defined: fn.Body.Position()}
+	if call != nil {
+		if ident, ok := call.Function.(*ast.Identifier); ok {
+			frame.Name = ident.Value
+		}
+		frame.Call = call.Function.Position()
+	} else if e.builtinCall != nil {
+		frame.Call = e.builtinCall.Function.Position()
+	}
+	return frame
+}
+
+// エラーメッセージで関数を示すための「fn(x, y)」という文字列を返すヘルパー関数
+func functionSignature(fn *object.Function) string {
+	params := []string{}
+	for _, p := range fn.Parameters {
+		params = append(params, p.Value)
+	}
+	return "fn(" + strings.Join(params, ", ") + ")"
+}
+
+// 評価のステップをn消費する
+// 上限を超えた場合はfalseを返す
+func (e *Evaluator) consume(n int) bool {
+	if e.budget == 0 {
+		return true
+	}
+	e.steps += n
+	return e.steps <= e.budget
+}
+
+// 評価のステップを使い切ったかを返す
+func (e *Evaluator) budgetExhausted() bool {
+	return e.budget != 0 && e.steps > e.budget
+}
+
+func budgetExceededError(node ast.Node) *object.Error {
+	return newError(node, "evaluation budget exceeded")
+}
+
+// 引数の配列をすべて複製して新しい配列などを作る組み込み関数
+var copyingBuiltins = map[*object.Builtin]bool{
+	object.GetBuiltinByName("rest"):      true,
+	object.GetBuiltinByName("push"):      true,
+	object.GetBuiltinByName("transpose"): true,
+	object.GetBuiltinByName("tuple"):     true,
+	object.GetBuiltinByName("array"):     true,
+}
+
+// 組み込み関数の呼び出しに消費するステップ数を返すヘルパー関数
+// 呼び出しの1ステップに加えて、配列を複製する組み込み関数は複製する要素の数だけ消費する
+func builtinCost(fn *object.Builtin, args []object.Object) int {
+	cost := 1
+	if copyingBuiltins[fn] {
+		for _, arg := range args {
+			switch arg := arg.(type) {
+			case *object.Array:
+				cost += len(arg.Elements)
+			case *object.Tuple:
+				cost += len(arg.Elements)
+			}
+		}
+	}
+	return cost
+}
+
 // 関数ごとに拡張された環境を返すヘルパー関数
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
 
@@ -367,29 +1031,49 @@ func unwrapReturnValue(obj object.Object) object.Object {
 }
 
 // 文字列による中置式を評価して適切なObjectを返すヘルパーヘルパー関数
-func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+func evalStringInfixExpression(node ast.Node, operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
 
-	// 文字列に対して+しかサポートしていない
-	// TODO: 文字列に対する!=演算子をサポートするならここに書く
-	if operator != "+" {
-		return newError("unknown operator: %s %s %s",
+	// 比較は値(辞書順)で行う
+	// 同じ内容でも別々に生成された*object.Stringなので、ポインタで比較してはいけない
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError(node, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
-
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
 }
 
 // 添字演算子式が適切なオペランドに対して用いられているかを確認しつつ、適切なObjectに評価するヘルパー関数
-func evalIndexExpression(left object.Object, index object.Object) object.Object {
+// nodeはエラーメッセージに位置を示すための添字演算子式のノード
+func evalIndexExpression(node ast.Node, left object.Object, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpressions(left, index)
+	case left.Type() == object.TUPLE_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalElementIndex(left.(*object.Tuple).Elements, index.(*object.Integer).Value)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
-		return evalHashIndexExpression(left, index)
+		return evalHashIndexExpression(node, left, index)
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		return evalModuleMemberExpression(node, left, index)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newError(node, "index operator not supported: %s", left.Type())
 	}
 }
 
@@ -397,31 +1081,133 @@ func evalIndexExpression(left object.Object, index object.Object) object.Object
 func evalArrayIndexExpressions(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
 	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
+	return evalElementIndex(arrayObject.Elements, idx)
+}
 
+// 配列やタプルの要素を添字で取り出すヘルパー関数
+func evalElementIndex(elements []object.Object, idx int64) object.Object {
+	max := int64(len(elements) - 1)
+
+	// 負のインデックスは末尾から数える
+	if idx < 0 {
+		idx = int64(len(elements)) + idx
+	}
 	// 配列に格納している要素数を超えたインデックスに対してはNULLObjectを返す
 	if idx < 0 || max < idx {
 		return NULL
 	}
-	return arrayObject.Elements[idx]
+	return elements[idx]
+}
+
+// 文字列に対する添字演算子式を1文字の文字列に評価するヘルパー関数
+// スライスと同様にバイト単位ではなく文字（コードポイント）単位で数える
+// 負のインデックスや範囲外のインデックスの扱いは配列と同じ
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	runes := []rune(str.(*object.String).Value)
+	idx := index.(*object.Integer).Value
+	if idx < 0 {
+		idx = int64(len(runes)) + idx
+	}
+	if idx < 0 || int64(len(runes)) <= idx {
+		return NULL
+	}
+	return &object.String{Value: string(runes[idx])}
+}
+
+// スライス式を評価して適切なObjectを返すヘルパー関数
+// 配列に対しては要素をコピーした新しい配列を、文字列に対しては部分文字列を返す
+func (e *Evaluator) evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := e.Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	// 文字列はlenと同様にバイト単位ではなく文字（コードポイント）単位でスライスする
+	var length int64
+	var runes []rune
+	switch left := left.(type) {
+	case *object.Array:
+		length = int64(len(left.Elements))
+	case *object.String:
+		runes = []rune(left.Value)
+		length = int64(len(runes))
+	default:
+		return newError(node, "slice operator not supported: %s", left.Type())
+	}
+
+	// 省略された下限は0、上限は長さとして扱う
+	low, err := e.evalSliceBound(node.Low, env, 0)
+	if err != nil {
+		return err
+	}
+	high, err := e.evalSliceBound(node.High, env, length)
+	if err != nil {
+		return err
+	}
+	if low > high {
+		return newError(node, "slice bounds out of range: low=%d > high=%d", low, high)
+	}
+
+	// 範囲外の添字は有効な範囲に丸める
+	low = clampIndex(low, length)
+	high = clampIndex(high, length)
+
+	switch left := left.(type) {
+	case *object.Array:
+		elements := make([]object.Object, high-low)
+		copy(elements, left.Elements[low:high])
+		return &object.Array{Elements: elements}
+	default:
+		return &object.String{Value: string(runes[low:high])}
+	}
+}
+
+// スライスの上限・下限を評価して整数値を返すヘルパー関数
+// 省略されていた場合はdefaultValueを返す
+func (e *Evaluator) evalSliceBound(node ast.Expression, env *object.Environment, defaultValue int64) (int64, *object.Error) {
+	if node == nil {
+		return defaultValue, nil
+	}
+	bound := e.Eval(node, env)
+	if errObj, ok := bound.(*object.Error); ok {
+		return 0, errObj
+	}
+	integer, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, newError(node, "slice bound must be INTEGER, got %s", bound.Type())
+	}
+	return integer.Value, nil
+}
+
+// 添字を[0, length]の範囲に丸めるヘルパー関数
+func clampIndex(idx, length int64) int64 {
+	if idx < 0 {
+		return 0
+	}
+	if idx > length {
+		return length
+	}
+	return idx
 }
 
 // ハッシュリテラルを評価してObjectを返す関数
 // リテラルのペアに対するHashKeyを生成して、リテラルのペアとそのHashKeyの組をObjectとして保存しておく
 // {"one": 1, "two": 2}というリテラルのハッシュに対してこれを評価した結果得られるのは
 // {「"one"-1」というペアとこれに対するHashKey、「"two"-2」というペアとこれに対するHashKey}というObject
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+func (e *Evaluator) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+	// キーと値はソース上に現れた順に評価する
+	for _, keyNode := range node.OrderedKeys() {
+		valueNode := node.Pairs[keyNode]
+		key := e.Eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
-		hashKey, ok := key.(object.Hashable)
+		hashKey, ok := object.AsHashable(key)
 		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+			return newError(keyNode, "unusable as hash key: %s", key.Type())
 		}
-		value := Eval(valueNode, env)
+		value := e.Eval(valueNode, env)
 		if isError(value) {
 			return value
 		}
@@ -431,11 +1217,11 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 	return &object.Hash{Pairs: pairs}
 }
 
-func evalHashIndexExpression(hash, index object.Object) object.Object {
+func evalHashIndexExpression(node ast.Node, hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
-	key, ok := index.(object.Hashable)
+	key, ok := object.AsHashable(index)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return newError(node, "unusable as hash key: %s", index.Type())
 	}
 	pair, ok := hashObject.Pairs[key.HashKey()]
 	if !ok {
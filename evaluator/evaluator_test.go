@@ -1,10 +1,16 @@
 package evaluator
 
 import (
+	"bytes"
+	"io"
+	"monkey/enginetest"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 // Integerを正しく評価できているかをテスト
@@ -30,6 +36,9 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"10 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 + 10 % 4 * 3", 8},
 	}
 
 	// 各テストセットに対して
@@ -81,6 +90,83 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+// 浮動小数点数を含む式を正しく評価できているかをテスト
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1.5", 1.5},
+		{"-2.25", -2.25},
+		{"1.5 + 2.25", 3.75},
+		{"1 / 2.0", 0.5},
+		{"7 / 2", 3},
+		{"2 * 1.5 - 1", 2.0},
+		{"-(1 - 1.5)", 0.5},
+		{"0.1 * 3 > 0.3", true},
+		{"1 < 1.5", true},
+		{"1 == 1.0", true},
+		{"0.5 != 0.5", false},
+		{`{1.5: "a", 0.0: "b"}[1.5]`, "a"},
+		{`{1.5: "a", 0.0: "b"}[-0.0]`, "b"},
+		{`{1: "a"}[1.0]`, nil},
+		{"7.5 % 2", 1.5},
+		{"-7.5 % 2", -1.5},
+		{"7 % 2.5", 2.0},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case float64:
+			result, ok := evaluated.(*object.Float)
+			if !ok {
+				t.Errorf("object is not Float for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if result.Value != expected {
+				t.Errorf("object has wrong value for %q. got=%v, want=%v", tt.input, result.Value, expected)
+			}
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("wrong result for %q. want=%q, got=%+v", tt.input, expected, evaluated)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	errors := map[string]string{
+		`1.5 + "a"`:   "line 1: type mismatch: FLOAT + STRING",
+		"-true + 1.5": "line 1: unknown operator: -BOOLEAN",
+		"1.5 + true":  "line 1: type mismatch: FLOAT + BOOLEAN",
+		"[1.5][0.0]":  "line 1: index operator not supported: ARRAY",
+	}
+	for input, expected := range errors {
+		errObj, ok := testEval(input).(*object.Error)
+		if !ok || errObj.Message != expected {
+			t.Errorf("wrong error for %q. want=%q, got=%+v", input, expected, errObj)
+		}
+	}
+}
+
+// 浮動小数点数の演算で知らない演算子のエラーに、実際のオペランドの型を示すことをテスト
+func TestFloatInfixUnknownOperator(t *testing.T) {
+	evaluated := evalFloatInfixExpression(nil, "^", &object.Integer{Value: 1}, &object.Float{Value: 2})
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if expected := "unknown operator: INTEGER ^ FLOAT"; errObj.Message != expected {
+		t.Errorf("wrong error message. want=%q, got=%q", expected, errObj.Message)
+	}
+}
+
 // Booleanを正しく評価できているかをテスト
 func TestEvalBooleanExpression(t *testing.T) {
 
@@ -108,6 +194,13 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"2.5 >= 2", true},
+		{"2 <= 1.5", false},
 	}
 
 	// 各テストセットに対して
@@ -121,6 +214,78 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+// NULLを生成するすべての経路が同じNULLを返し、==で比較できることをテスト
+func TestNullComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"null == null", true},
+		{"null != null", false},
+		{"null == 0", false},
+		{"null != 0", true},
+		{"null == false", false},
+		{"if (false) { 1 } == null", true},
+		{"if (true) { } == null", true},
+		{"if (true) { let a = 1 } == null", true},
+		{"fn() {}() == null", true},
+		{"fn() { let a = 1 }() == null", true},
+		{"[1][5] == null", true},
+		{`{"a": 1}["b"] == null`, true},
+		{"switch 1 { case 2: 2 } == null", true},
+		{"puts() == null", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testNullObject(t, testEval("null"))
+	testNullObject(t, testEval("let f = fn() { }; f()"))
+}
+
+// &&と||が真偽値以外の被演算子に対して、結果を決めた方の値を返すことをテスト
+func TestLogicalExpressions(t *testing.T) {
+	runEngineTests(t, enginetest.LogicalExpressions)
+}
+
+// 左辺で結果が決まる場合に右辺が評価されないことをテスト
+// 右辺が評価されると未定義の識別子によってエラーになる
+func TestLogicalExpressionsShortCircuit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"false && undefined", false},
+		{"null && undefined", nil},
+		{"true || undefined", true},
+		{"1 || undefined", 1},
+		{"true && undefined", "line 1: identifier not found: undefined"},
+		{"false || undefined", "line 1: identifier not found: undefined"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
 // 引数objが期待するBooleanObjectであることを確認するヘルパー関数
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 
@@ -202,6 +367,320 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 }
 
+// IF式のブロック内のLET文のスコープをテスト
+// ブロックスコープは導入せず、ブロック内のLET文はIF式を囲む環境に束縛される（関数スコープ）
+// また、値を持たないブロック（空、もしくはLET文で終わる）はNULLに評価される
+func TestLetInsideIfBlock(t *testing.T) {
+	runEngineTests(t, enginetest.LetInsideIfBlock)
+
+	// 条件が偽でブロックが評価されなければ束縛も行われない
+	evaluated := testEval("if (false) { let z = 1 }; z")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "line 1: identifier not found: z" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestSwitchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"switch 1 { case 1: 10; case 2: 20; default: 30 }", 10},
+		{"switch 2 { case 1: 10; case 2: 20; default: 30 }", 20},
+		{"switch 3 { case 1: 10; case 2: 20; default: 30 }", 30},
+		{"switch 3 { case 1: 10; case 2: 20 }", nil},
+		{"switch 1 { }", nil},
+		{"switch 1 { case 1: }", nil},
+		{"switch 1 { case 1: let x = 5 }", nil},
+		{"switch 2 { case 1 + 1: 3; case 2: 4 }", 3},
+		{"switch true { case 1 > 2: 1; case 2 > 1: 2 }", 2},
+		{"switch 1 { case true: 1; default: 2 }", 2},
+		{"let f = fn(x) { switch x { case 0: return 100; default: x } 200 }; f(0) + f(1)", 300},
+		// Subject部は一度だけ評価される
+		{"let n = 0; let next = fn() { let n = n + 1; n }; switch next() { case 2: 20; case 1: 10 }", 10},
+		// case節の本体のLET文はIF式と同様に外側の環境を更新する
+		{"switch 1 { case 1: let y = 7 }; y", 7},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+
+	evaluated := testEval("switch 1 { case 1 + true: 1 }")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "line 1: type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	runEngineTests(t, enginetest.ForStatements)
+
+	// FOR文自体の値は、breakで抜けた場合もNULL
+	for _, input := range []string{
+		"for (let i = 0; i < 3; i = i + 1) { i }",
+		"for (let i = 0; ; i = i + 1) { break }",
+		"for (let i = 0; i < 3; i = i + 1) { let i = 10 }",
+	} {
+		testNullObject(t, testEval(input))
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (let i = 0; i < 3; i) { i + true }", "line 1: type mismatch: INTEGER + BOOLEAN"},
+		{"for (let i = 0; i + true; i) { }", "line 1: type mismatch: INTEGER + BOOLEAN"},
+		{"for (let i = 0; i < 3; i + true) { }", "line 1: type mismatch: INTEGER + BOOLEAN"},
+		{"for (let i = 0; false; i) { }; i", "line 1: identifier not found: i"},
+	}
+
+	for _, tt := range errorTests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%q: wrong error message. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+// 0除算がpanicせずにエラーオブジェクトになり、プログラムの評価が止まることをテスト
+func TestDivisionByZero(t *testing.T) {
+	tests := []string{
+		"5 / 0",
+		"let x = 0; 10 / x",
+		"1 + 10 / (5 - 5) * 2",
+		"let a = 5 / 0; 1",
+		"let f = fn(x) { 10 / x; 99 }; f(0); 1",
+		"let i = 3; while (true) { i = i - 1; 6 / i }; i",
+		"[1, 2 / 0, 3]",
+		"5 % 0",
+	}
+
+	for _, input := range tests {
+		evaluated := testEval(input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != "line 1: division by zero" {
+			t.Errorf("%q: wrong error message. want=%q, got=%q", input, "line 1: division by zero", errObj.Message)
+		}
+	}
+}
+
+// WHILE文とbreak文・continue文の評価をテスト
+func TestWhileStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 5) { i = i + 1; }; i", 5},
+		{"let i = 0; while (true) { i = i + 1; if (i == 7) { break; } }; i", 7},
+		// continueで偶数を読み飛ばして奇数だけを足す
+		{"let i = 0; let sum = 0; while (i < 10) { i = i + 1; if (i / 2 * 2 == i) { continue; } sum = sum + i; }; sum", 25},
+		{"let f = fn() { let i = 0; while (true) { i = i + 1; if (i == 3) { return i * 10; } } 99 }; f()", 30},
+		{"let f = fn() { while (true) { while (true) { return 1; } } }; f()", 1},
+		// breakは最も内側のループだけを抜ける
+		{"let n = 0; let i = 0; while (i < 3) { i = i + 1; while (true) { n = n + 1; break; } }; n", 3},
+		{"let n = 0; for (let i = 0; i < 10; i = i + 1) { if (i == 4) { break; } n = n + 1; }; n", 4},
+		{"let n = 0; for (let i = 0; i < 10; i = i + 1) { if (i < 6) { continue; } n = n + 1; }; n", 4},
+		{"let i = 0; while (false) { i = 1 }", nil},
+		{"while (false) { let x = 1 }; let x = 2; x", 2},
+		// Body部は繰り返しごとに新しい環境で評価するので、CONST文は毎回宣言できる
+		{"let i = 0; while (i < 3) { const y = i + 1; i = y; }; i", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (1 + true) { }", "line 1: type mismatch: INTEGER + BOOLEAN"},
+		{"while (true) { -true }", "line 1: unknown operator: -BOOLEAN"},
+		{"break; 1", "line 1: break outside of loop"},
+		{"if (true) { continue }", "line 1: continue outside of loop"},
+		{"let f = fn() { break }; while (true) { f() }", "line 1: break outside of loop"},
+	}
+
+	for _, tt := range errorTests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%q: wrong error message. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+// 後置演算子?がエラーを関数の外に伝え、エラーでなければ値をそのまま返すことをテスト
+func TestPropagateErrorExpression(t *testing.T) {
+	runEngineTests(t, enginetest.PropagateErrorExpression)
+
+	runEngineTests(t, []enginetest.Case{
+		// エラーが起きた後の式は評価しない
+		{Input: `let x = 0; let f = fn() { error("oops")?; x = 1 }; try { f() } catch (e) { 0 }; x`, Expected: 0},
+		{Input: `try { let f = fn() { error("oops")? + 1 }; f() } catch (e) { e.message }`, Expected: "oops"},
+		// 関数の中のTRY文は?が伝えるエラーを捕まえない
+		{Input: `let f = fn() { try { error("oops")? } catch (e) { 1 }; 2 }; f()`, Expected: enginetest.Error("oops")},
+	})
+}
+
+// TRY文でエラーを捕まえられることをテスト
+func TestTryCatchStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// エラーが起きなければCatch部は評価しない
+		{"try { 1 + 1 } catch (e) { 0 }", 2},
+		{"try { 10 / 0 } catch (e) { e.message }", "division by zero"},
+		{"try { foobar } catch (e) { e.message }", "identifier not found: foobar"},
+		{"let f = fn(x) { x / 0 }; try { f(1); 2 } catch (e) { -1 }", -1},
+		{`try { error("oops") } catch (e) { e.message }`, "oops"},
+		// エラーが起きた位置も参照できる
+		{"try {\n  1 / 0\n} catch (e) { e.line }", 2},
+		{"try { 1 / 0 } catch (e) { e.column }", 9},
+		{"try { 1 / 0 } catch (e) { type(e) }", "HASH"},
+		// Try部で起きたエラー以降は評価しない
+		{"let x = 1; try { x = 2; 1 / 0; x = 3 } catch (e) { x }", 2},
+		// 内側のTRY文で捕まえたエラーは外側には伝わらない
+		{"try { try { 1 / 0 } catch (e) { 5 } } catch (e) { 6 }", 5},
+		// Catch部で起きたエラーは外側のTRY文が捕まえる
+		{"try { try { 1 / 0 } catch (e) { foo } } catch (e) { e.message }", "identifier not found: foo"},
+		// エラー名はCatch部の中だけで見える
+		{"let e = 1; try { 1 / 0 } catch (e) { e }; e", 1},
+		{"let f = fn() { try { return 1 } catch (e) { 2 }; 3 }; f()", 1},
+		{"let f = fn() { try { 1 / 0 } catch (e) { return 2 }; 3 }; f()", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("%q: object is not String. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("%q: wrong value. want=%q, got=%q", tt.input, expected, str.Value)
+			}
+		}
+	}
+
+	// Catch部で起きたエラーはそのまま伝わる
+	evaluated := testEval("try { 1 / 0 } catch (e) { -true }")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "line 1: unknown operator: -BOOLEAN" {
+		t.Errorf("error in catch block not propagated. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	// 評価の上限を超えたエラーは捕まえない
+	e := New()
+	e.SetBudget(100)
+	program := parser.New(lexer.New("try { while (true) { } } catch (e) { 1 }")).ParseProgram()
+	evaluated = e.Eval(program, object.NewEnvironment())
+	errObj, ok = evaluated.(*object.Error)
+	if !ok || errObj.Message != "line 1: evaluation budget exceeded" {
+		t.Errorf("budget error caught. got=%T(%+v)", evaluated, evaluated)
+	}
+}
+
+// DEFER文で遅らせた式が、関数から返るときに積んだのと逆の順で評価されることをテスト
+func TestDeferStatement(t *testing.T) {
+	tests := []struct {
+		input  string
+		output string
+	}{
+		{`fn() { defer puts("last"); puts("first") }()`, "first\nlast\n"},
+		{`fn() { defer puts(1); defer puts(2); defer puts(3) }()`, "3\n2\n1\n"},
+		// RETURN文で返る場合やエラーが起きた場合も評価する
+		{`fn() { defer puts("deferred"); return 1; puts("unreachable") }()`, "deferred\n"},
+		{`fn() { defer puts("deferred"); 1 / 0 }()`, "deferred\n"},
+		{`fn() { if (true) { defer puts("in block") } puts("after block") }()`, "after block\nin block\n"},
+		{`fn() { for (let i = 0; i < 3; i = i + 1) { defer puts("loop") } }()`, "loop\nloop\nloop\n"},
+		// 遅らせた式は関数から返るときの環境で評価する
+		{`fn() { let x = 1; defer puts(x); x = 2 }()`, "2\n"},
+		// 内側の関数のDEFER文は内側の関数から返るときに評価する
+		{`fn() { defer puts("outer"); fn() { defer puts("inner") }(); puts("body") }()`, "inner\nbody\nouter\n"},
+		// exitが呼ばれた場合は評価しない
+		{`fn() { defer puts("deferred"); exit(1) }()`, ""},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := New()
+		e.SetOutput(&out)
+		e.Eval(parser.New(lexer.New(tt.input)).ParseProgram(), object.NewEnvironment())
+		if got := out.String(); got != tt.output {
+			t.Errorf("wrong output for %q. want=%q, got=%q", tt.input, tt.output, got)
+		}
+	}
+
+	values := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 関数の値は遅らせた式の値ではなく本体の値になる
+		{"let f = fn() { defer len([]); return 5 }; f()", 5},
+		{"let f = fn() { defer len([]); 7 }; f()", 7},
+		// 本体でエラーが起きなければ、遅らせた式で起きたエラーを関数の値とする
+		{"let g = fn(x) { 1 / x }; let f = fn() { defer g(0); 7 }; f()", "line 1: division by zero"},
+		{"let f = fn() { defer foo(); 1 / 0 }; f()", "line 1: division by zero"},
+		{"defer puts(1)", "line 1: defer outside of function"},
+	}
+
+	for _, tt := range values {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("%q: wrong error message. want=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
 // 引数objがNullObjectであるかを確認するヘルパー関数
 func testNullObject(t *testing.T, obj object.Object) bool {
 	if obj != NULL {
@@ -211,6 +690,77 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	return true
 }
 
+// 仮想マシンと共有するテストケースを評価し、結果を期待値と比べる
+// エラーのメッセージは位置を除いた部分を比べる
+func runEngineTests(t *testing.T, tests []enginetest.Case) {
+	t.Helper()
+	for _, tt := range tests {
+		evaluated := testEval(tt.Input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if expected, ok := tt.Expected.(enginetest.Error); !ok || errObj.Text() != string(expected) {
+				t.Errorf("%q: unexpected error. want=%v, got=%q", tt.Input, tt.Expected, errObj.Message)
+			}
+			continue
+		}
+
+		switch expected := tt.Expected.(type) {
+		case int:
+			if !testIntegerObject(t, evaluated, int64(expected)) {
+				t.Errorf("wrong result for %q", tt.Input)
+			}
+		case float64:
+			f, ok := evaluated.(*object.Float)
+			if !ok || f.Value != expected {
+				t.Errorf("%q: wrong result. want=%g, got=%T(%+v)", tt.Input, expected, evaluated, evaluated)
+			}
+		case bool:
+			if !testBooleanObject(t, evaluated, expected) {
+				t.Errorf("wrong result for %q", tt.Input)
+			}
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%q: wrong result. want=%q, got=%T(%+v)", tt.Input, expected, evaluated, evaluated)
+			}
+		case nil:
+			if !testNullObject(t, evaluated) {
+				t.Errorf("wrong result for %q", tt.Input)
+			}
+		case []int:
+			arr, ok := evaluated.(*object.Array)
+			if !ok || len(arr.Elements) != len(expected) {
+				t.Errorf("%q: wrong result. want=%v, got=%T(%+v)", tt.Input, expected, evaluated, evaluated)
+				continue
+			}
+			for i, want := range expected {
+				if !testIntegerObject(t, arr.Elements[i], int64(want)) {
+					t.Errorf("wrong element %d for %q", i, tt.Input)
+				}
+			}
+		case []string:
+			arr, ok := evaluated.(*object.Array)
+			if !ok || len(arr.Elements) != len(expected) {
+				t.Errorf("%q: wrong result. want=%q, got=%T(%+v)", tt.Input, expected, evaluated, evaluated)
+				continue
+			}
+			for i, want := range expected {
+				str, ok := arr.Elements[i].(*object.String)
+				if !ok || str.Value != want {
+					t.Errorf("wrong element %d for %q. want=%q, got=%+v", i, tt.Input, want, arr.Elements[i])
+				}
+			}
+		case enginetest.Inspect:
+			if evaluated.Inspect() != string(expected) {
+				t.Errorf("wrong result for %q. want=%s, got=%s", tt.Input, expected, evaluated.Inspect())
+			}
+		case enginetest.Error:
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.Input, evaluated, evaluated)
+		default:
+			t.Fatalf("%q: unsupported expected value %T", tt.Input, tt.Expected)
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 
 	// テストセット
@@ -252,27 +802,27 @@ func TestErrorHandling(t *testing.T) {
 	}{
 		{
 			"5 + true;",
-			"type mismatch: INTEGER + BOOLEAN",
+			"line 1: type mismatch: INTEGER + BOOLEAN",
 		},
 		{
 			"5 + true; 5;",
-			"type mismatch: INTEGER + BOOLEAN",
+			"line 1: type mismatch: INTEGER + BOOLEAN",
 		},
 		{
 			"-true",
-			"unknown operator: -BOOLEAN",
+			"line 1: unknown operator: -BOOLEAN",
 		},
 		{
 			"true + false;",
-			"unknown operator: BOOLEAN + BOOLEAN",
+			"line 1: unknown operator: BOOLEAN + BOOLEAN",
 		},
 		{
 			"5; true + false; 5",
-			"unknown operator: BOOLEAN + BOOLEAN",
+			"line 1: unknown operator: BOOLEAN + BOOLEAN",
 		},
 		{
 			"if (10 > 1) { true + false; }",
-			"unknown operator: BOOLEAN + BOOLEAN",
+			"line 1: unknown operator: BOOLEAN + BOOLEAN",
 		},
 		{
 			`
@@ -284,19 +834,27 @@ if (10 > 1) {
   return 1;
 }
 `,
-			"unknown operator: BOOLEAN + BOOLEAN",
+			"line 4: unknown operator: BOOLEAN + BOOLEAN",
 		},
 		{
 			"foobar",
-			"identifier not found: foobar",
+			"line 1: identifier not found: foobar",
 		},
 		{
 			`"hello" - "world"`,
-			"unknown operator: STRING - STRING",
+			"line 1: unknown operator: STRING - STRING",
+		},
+		{
+			`"a" < 1`,
+			"line 1: type mismatch: STRING < INTEGER",
+		},
+		{
+			`1 >= "a"`,
+			"line 1: type mismatch: INTEGER >= STRING",
 		},
 		{
 			`{"name": "Monkey"}[fn(x) { x }];`,
-			"unusable as hash key: FUNCTION",
+			"line 1: unusable as hash key: FUNCTION",
 		},
 	}
 
@@ -343,34 +901,144 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
-// 正しくFunction型のObjectを生成することができているかを確認するテスト
-func TestFunctionObject(t *testing.T) {
-
-	// 関数の入力
-	input := "fn(x) { x + 2; };"
-
-	// ここで評価
-	evaluated := testEval(input)
-
-	// 評価して得られたObjectの型を確認
-	fn, ok := evaluated.(*object.Function)
-	if !ok {
-		t.Fatalf("object is not Function. gpt=%T(%+v)",
-			evaluated, evaluated)
-	}
-
-	// 評価して得られたFunction型のObjectのParametersの個数を確認
-	if len(fn.Parameters) != 1 {
-		t.Fatalf("function has wrong paramaters. Parameters=%+v",
-			fn.Parameters)
+// 配列を分割して束縛するLet文の評価をテストする
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let [x, y] = [1, 2]; x + y", 3},
+		{"let [x, y] = [1, 2, 3]; y", 2},
+		{"let [x, y, z] = [1, 2]; z", nil},
+		{"let f = fn(a) { let [h, t] = [a, a * 2]; h + t }; f(3)", 9},
+		{"let x = 1; let [x] = [x + 1]; x", 2},
+		{"let [x] = 1", "line 1: destructuring let requires ARRAY, got INTEGER"},
+		{"const x = 1; let [y, x] = [1, 2]", "line 1: cannot redeclare constant x"},
 	}
 
-	// 評価して得られたFunction型のObjectのParametersのリテラルを確認
-	if fn.Parameters[0].String() != "x" {
-		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+// Const文と定数への再宣言・代入をテストする
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"const a = 5; a;", 5},
+		{"const a = 5; const b = a * 2; a + b;", 15},
+		{"const a = 5; let f = fn() { let a = 10; a }; f() + a", 15},
+		{"const x = 5; x = 6", "line 1: cannot assign to constant x"},
+		{"const x = 5; let f = fn() { x = 6 }; f()", "line 1: cannot assign to constant x"},
+		{"const x = 5; let x = 6", "line 1: cannot redeclare constant x"},
+		{"const x = 5; const x = 6", "line 1: cannot redeclare constant x"},
+		{"const x = 5; if (true) { let x = 6 }", "line 1: cannot redeclare constant x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+// 代入式の評価をテストする
+// 代入は名前が束縛されている環境の値を書き換える
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = 1; a = 2; a", 2},
+		{"let a = 1; a = a + 10", 11},
+		{"let a = 1; let b = 2; a = b = 3; a + b", 6},
+		{"let n = 0; let inc = fn() { n = n + 1 }; inc(); inc(); n", 2},
+		{"let f = fn(x) { x = x * 2; x }; f(4)", 8},
+		{"a = 1", "line 1: identifier not found: a"},
+		// 代入は名前を定義した環境の束縛を書き換えるので、クロージャが状態を持てる
+		{"let makeCounter = fn() { let n = 0; fn() { n = n + 1 } }; let c = makeCounter(); [c(), c(), c()][2]", 3},
+		{"let makeCounter = fn() { let n = 0; fn() { n = n + 1 } }; let a = makeCounter(); let b = makeCounter(); a(); a(); b()", 1},
+		// letは常に今の環境に新しく束縛するので、外側の同じ名前は変わらない
+		{"let x = 1; let f = fn() { let x = 2; x = 3; x }; f() + x", 4},
+		{"let x = 1; let i = 0; while (i < 1) { let x = 10; x = 20; i = i + 1 }; x", 1},
+		{"let f = fn() { undefined = 1 }; f()", "line 1: identifier not found: undefined"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+// 正しくFunction型のObjectを生成することができているかを確認するテスト
+func TestFunctionObject(t *testing.T) {
+
+	// 関数の入力
+	input := "fn(x) { x + 2; };"
+
+	// ここで評価
+	evaluated := testEval(input)
+
+	// 評価して得られたObjectの型を確認
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. gpt=%T(%+v)",
+			evaluated, evaluated)
+	}
+
+	// 評価して得られたFunction型のObjectのParametersの個数を確認
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong paramaters. Parameters=%+v",
+			fn.Parameters)
+	}
+
+	// 評価して得られたFunction型のObjectのParametersのリテラルを確認
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
 	}
 
-	expectedBody := "(x + 2)"
+	// ブロック文の文字列表現では各文が改行とタブで囲まれる
+	expectedBody := "\n\t(x + 2)\n"
 
 	// 評価して得られたFunction型のObjectのBodyのリテラルを確認
 	if fn.Body.String() != expectedBody {
@@ -413,6 +1081,43 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+// 仮引数と数の合わない引数で関数を呼び出すとエラーになることをテスト
+func TestFunctionArity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(x, y) { x + y }; f(1)", "line 1: wrong number of arguments to fn(x, y): want=2, got=1"},
+		{"let f = fn(x, y) { x + y }; f(1, 2, 3)", "line 1: wrong number of arguments to fn(x, y): want=2, got=3"},
+		{"let f = fn() { 1 }; f(1)", "line 1: wrong number of arguments to fn(): want=0, got=1"},
+		{"let f = fn(x) { x }; f()", "line 1: wrong number of arguments to fn(x): want=1, got=0"},
+		{"let f = fn(x) { x }; let y = f(); 99", "line 1: wrong number of arguments to fn(x): want=1, got=0"},
+		{"flat_map([1], fn(x, y) { x })", "line 1: wrong number of arguments to fn(x, y): want=2, got=1"},
+		{"let f = fn(x, y) { x + y }; f(1, 2)", 3},
+		{"let f = fn() { 1 }; f()", 1},
+		// 組み込み関数はそれぞれで引数の数を確かめる
+		{`len("abc")`, 3},
+		{`len("a", "b")`, "line 1: wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("%q: wrong error message. want=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
 // ast.StringLiteralをobject.Stringに変換することができるかのテスト
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
@@ -454,6 +1159,40 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+// 配列やハッシュが==と!=で中身によって比較されることをテスト
+func TestDeepEquality(t *testing.T) {
+	runEngineTests(t, enginetest.DeepEquality)
+}
+
+// 文字列の比較が辞書順・値で行われることをテスト
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"abc" < "abd"`, true},
+		{`"abd" < "abc"`, false},
+		{`"abc" > "ab"`, true},
+		{`"" < "a"`, true},
+		{`"B" < "a"`, true},
+		{`"abc" <= "abc"`, true},
+		{`"abd" <= "abc"`, false},
+		{`"abc" >= "abc"`, true},
+		{`"ab" >= "abc"`, false},
+		// 別々に生成された同じ内容の文字列は等しい
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`let s = "mon"; s + "key" == "monkey"`, true},
+		{`"1" == 1`, false},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 
 	// テストケース
@@ -464,20 +1203,23 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
-		{`len(1)`, "argument to `len` not supported, got=INTEGER"},
-		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len("a")`, 1},
+		{`len("café")`, 4},
+		{`len("日本語")`, 3},
+		{`len(1)`, "line 1: argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "line 1: wrong number of arguments. got=2, want=1"},
 		{`len([1, 2, 3])`, 3},
 		{`len([])`, 0},
 		{`first([1, 2, 3])`, 1},
 		{`first([])`, nil},
-		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`first(1)`, "line 1: argument to `first` must be ARRAY, got INTEGER"},
 		{`last([1, 2, 3])`, 3},
 		{`last([])`, nil},
-		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+		{`last(1)`, "line 1: argument to `last` must be ARRAY, got INTEGER"},
 		{`rest([1, 2, 3])`, []int{2, 3}},
 		{`rest([])`, nil},
 		{`push([], 1)`, []int{1}},
-		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`push(1, 1)`, "line 1: argument to `push` must be ARRAY, got INTEGER"},
 	}
 
 	// 各テストケースに対して
@@ -503,139 +1245,1080 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
-// ArrayLiteral型のASTノードを評価して正しいArray型のObjectを得られるかをテスト
-func TestArrayLiterals(t *testing.T) {
-	input := "[1, 2 * 2, 3 + 3]"
-
-	// ここで評価
-	evaluated := testEval(input)
-
-	// Arrayオブジェクトであることを確認
-	result, ok := evaluated.(*object.Array)
-	if !ok {
-		t.Fatalf("object is not Array. got=%T(%+v)", evaluated, evaluated)
-	}
-	if len(result.Elements) != 3 {
-		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
-	}
-	testIntegerObject(t, result.Elements[0], 1)
-	testIntegerObject(t, result.Elements[1], 4)
-	testIntegerObject(t, result.Elements[2], 6)
-}
-
-func TestArrayIndexExpressions(t *testing.T) {
+// 組み込み関数assertの評価をテスト
+func TestAssertBuiltin(t *testing.T) {
 
 	// テストケース
+	// 条件がtruthyならNULL、そうでなければメッセージを含んだErrorObjectが返る
 	tests := []struct {
 		input    string
 		expected interface{}
 	}{
-		{
-			"[1, 2, 3][0]",
-			1,
-		},
-		{
-			"[1, 2, 3][1]",
-			2,
-		},
-		{
-			"[1, 2, 3][2]",
-			3,
-		},
-		{
-			"let i = 0; [1][i];",
-			1,
-		},
-		{
-			"[1, 2, 3][1 + 1];",
-			3,
-		},
-		{
-			"let myArray = [1, 2, 3]; myArray[2];",
-			3,
-		},
-		{
-			"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
-			6,
-		},
-		{
-			"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
-			2,
-		},
-		{
-			"[1, 2, 3][3]",
-			nil,
-		},
-		{
-			"[1, 2, 3][-1]",
-			nil,
-		},
+		{`assert(true)`, nil},
+		{`assert(1 + 1 == 2, "addition broken")`, nil},
+		{`assert(5, "truthy")`, nil},
+		{`assert(false)`, "line 1: assertion failed"},
+		{`assert(1 + 1 == 3, "addition broken")`, "line 1: assertion failed: addition broken"},
+		{`assert(if (false) { 1 }, "null is falsy")`, "line 1: assertion failed: null is falsy"},
+		{`let f = fn() { assert(false, "in function"); 10 }; f()`, "line 1: assertion failed: in function"},
+		{`assert()`, "line 1: wrong number of arguments. got=0, want=1 or 2"},
 	}
 
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
-		integer, ok := tt.expected.(int)
-		if ok {
-			testIntegerObject(t, evaluated, int64(integer))
-		} else {
+		switch expected := tt.expected.(type) {
+		case nil:
 			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
 		}
 	}
 }
 
-func TestHashLiterals(t *testing.T) {
-	input := `
-	let two = "two";
-	{"one": 10 - 9, two: 1 + 1, "thr" + "ee": 6 / 2, 4: 4, true: 5, false: 6}
-`
-	// ここで評価
-	evaluated := testEval(input)
-
-	result, ok := evaluated.(*object.Hash)
-	if !ok {
-		t.Fatalf("Eval didn't return Hash. got=%T(%+v)", evaluated, evaluated)
-	}
-	expected := map[object.HashKey]int64{
-		(&object.String{Value: "one"}).HashKey():   1,
-		(&object.String{Value: "two"}).HashKey():   2,
-		(&object.String{Value: "three"}).HashKey(): 3,
-		(&object.Integer{Value: 4}).HashKey():      4,
-		TRUE.HashKey():                             5,
-		FALSE.HashKey():                            6,
-	}
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+// 組み込み関数clampとbetweenの評価をテスト
+func TestClampAndBetweenBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`clamp(5, 0, 3)`, 3},
+		{`clamp(-1, 0, 3)`, 0},
+		{`clamp(2, 0, 3)`, 2},
+		{`clamp(3, 3, 3)`, 3},
+		{`clamp(1, 3, 0)`, "line 1: invalid range for `clamp`: lo=3 > hi=0"},
+		{`clamp("a", 0, 3)`, "line 1: arguments to `clamp` must be INTEGER or FLOAT, got STRING"},
+		{`clamp(1, 2)`, "line 1: wrong number of arguments. got=2, want=3"},
+		{`between(2, 1, 3)`, true},
+		{`between(1, 1, 3)`, true},
+		{`between(3, 1, 3)`, true},
+		{`between(4, 1, 3)`, false},
+		{`!between(4, 1, 3)`, true},
+		{`between(true, 1, 3)`, "line 1: arguments to `between` must be INTEGER or FLOAT, got BOOLEAN"},
 	}
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
-		if !ok {
-			t.Errorf("no pair for given key in Pairs")
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
 		}
-		testIntegerObject(t, pair.Value, expectedValue)
 	}
 }
 
-func TestHashIndexExpressions(t *testing.T) {
+// 組み込み関数errorの評価をテスト
+func TestErrorBuiltin(t *testing.T) {
 
 	// テストケース
+	// errorが返したErrorObjectは他のエラーと同様に伝播する
 	tests := []struct {
-		input    string
-		expected interface{}
+		input           string
+		expectedMessage string
 	}{
-		{
-			`{"foo": 5}["foo"]`,
-			5,
-		},
-		{
-			`{"foo": 5}["bar"]`,
-			nil,
-		},
-		{
-			`let key = "foo"; {"foo": 5}[key]`,
-			5,
-		},
-		{
-			`{}["foo"]`,
+		{`error("oops")`, "line 1: oops"},
+		{`let e = error("oops"); 5`, "line 1: oops"},
+		{`let e = error("oops"); e`, "line 1: oops"},
+		{`
+let check = fn(x) {
+	if (x < 0) { return error("negative input") }
+	x
+};
+let double = fn(x) { check(x) * 2 };
+let run = fn(x) { let y = double(x); y + 1 };
+run(-1);
+`, "line 3: negative input"},
+		// 文字列以外の値は文字列表現がメッセージになる
+		{`error(1)`, "line 1: 1"},
+		{`error([1, "a"])`, "line 1: [1, a]"},
+		{`error()`, "line 1: wrong number of arguments. got=0, want=1"},
+		// ブロックの途中で起きたエラーは残りの文を評価せずに伝播する
+		{`if (true) { error("in block"); 1 }`, "line 1: in block"},
+		// コールバックの中で起きたエラーは処理を打ち切ってそのまま伝播する
+		{`flat_map([1, 2], fn(x) { error("bad " + str(x)) })`, "line 1: bad 1"},
+		{`filter([1, 2], fn(x) { if (x == 2) { error("bad") } else { true } })`, "line 1: bad"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !isError(evaluated) {
+			t.Errorf("isError() returned false. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		errObj := evaluated.(*object.Error)
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+
+	// エラーが起きなければ通常の値が返る
+	input := `
+let check = fn(x) {
+	if (x < 0) { return error("negative input") }
+	x
+};
+check(3) + 1;
+`
+	testIntegerObject(t, testEval(input), 4)
+}
+
+// 組み込み関数is_errorが、エラーを伝播させずに値がエラーかどうかを返すことをテスト
+func TestIsErrorBuiltin(t *testing.T) {
+	runEngineTests(t, enginetest.IsErrorBuiltin)
+
+	// 評価器ではエラーがLET文や中置演算子からも伝わるので、関数の値や式の値としてエラーを受け取れる
+	// 一方で、引数の数が誤っている場合や、引数の式より前にエラーが伝わった場合はエラーになる
+	runEngineTests(t, []enginetest.Case{
+		{Input: `let g = fn() { let e = error("oops"); 1 }; is_error(g())`, Expected: true},
+		{Input: `is_error(1 + "a")`, Expected: true},
+		{Input: `is_error(error("a"), 1)`, Expected: enginetest.Error("a")},
+		{Input: `let e = error("oops"); is_error(e)`, Expected: enginetest.Error("oops")},
+	})
+}
+
+// 組み込み関数exitが残りの評価を打ち切り、終了コードを持つExitを返すことをテスト
+// プロセスは終了させない
+func TestExitBuiltin(t *testing.T) {
+	tests := append([]enginetest.ExitCase{
+		{Input: "let f = fn(x) { exit(x) }; [1, f(7), undefined]", Code: 7},
+		// exitはTRY文でも捕まえられない
+		{Input: "try { exit(5) } catch (e) { 1 }; 2", Code: 5},
+	}, enginetest.ExitBuiltin...)
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := New()
+		e.SetOutput(&out)
+		program := parser.New(lexer.New(tt.Input + "; puts(\"unreachable\")")).ParseProgram()
+		evaluated := e.Eval(program, object.NewEnvironment())
+		exit, ok := evaluated.(*object.Exit)
+		if !ok {
+			t.Errorf("%q: object is not Exit. got=%T(%+v)", tt.Input, evaluated, evaluated)
+			continue
+		}
+		if exit.Code != tt.Code {
+			t.Errorf("%q: wrong exit code. want=%d, got=%d", tt.Input, tt.Code, exit.Code)
+		}
+		if out.Len() != 0 {
+			t.Errorf("%q: statements after exit were evaluated. output=%q", tt.Input, out.String())
+		}
+	}
+
+	evaluated := testEval(`exit("1")`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "line 1: argument to `exit` must be INTEGER, got STRING" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+// 組み込み関数transposeの評価をテスト
+func TestTransposeBuiltin(t *testing.T) {
+
+	// テストケース
+	// 正常系は結果のInspect()で比較し、異常系はエラーメッセージで比較する
+	tests := []struct {
+		input    string
+		expected string
+		isError  bool
+	}{
+		{`transpose([[1, 2, 3], [4, 5, 6]])`, "[[1, 4], [2, 5], [3, 6]]", false},
+		{`transpose([[1, 4], [2, 5], [3, 6]])`, "[[1, 2, 3], [4, 5, 6]]", false},
+		{`transpose([[1, 2]])`, "[[1], [2]]", false},
+		{`transpose([[], []])`, "[]", false},
+		{`transpose([])`, "[]", false},
+		{`transpose([[1, 2, 3], [4, 5]])`, "line 1: rows of `transpose` must have the same length. row 0 has 3, row 1 has 2", true},
+		{`transpose([[1], 2])`, "line 1: rows of `transpose` must be ARRAY, got INTEGER", true},
+		{`transpose(1)`, "line 1: argument to `transpose` must be ARRAY, got INTEGER", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if tt.isError {
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if _, ok := evaluated.(*object.Array); !ok {
+			t.Errorf("object is not Array. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result. expected=%q, got=%q", tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// ハッシュの表示が毎回同じになることをテスト
+func TestHashInspectIsDeterministic(t *testing.T) {
+	input := `{"e": 5, "b": 2, 3: "three", true: false, "a": 1 + 1}`
+	expected := "{3: three, a: 2, b: 2, e: 5, true: false}"
+
+	for i := 0; i < 20; i++ {
+		evaluated := testEval(input)
+		if got := evaluated.Inspect(); got != expected {
+			t.Fatalf("Inspect() wrong at run %d. want=%q, got=%q", i, expected, got)
+		}
+	}
+
+	// 文字列表現が同じキーも、型の名前の順に並べて毎回同じ順で表示する
+	input = `{1: "a", "1": "b", true: 1, "true": 2, 2: 0, "2": 9}`
+	expected = "{1: a, 1: b, 2: 0, 2: 9, true: 1, true: 2}"
+	for i := 0; i < 200; i++ {
+		evaluated := testEval(input)
+		if got := evaluated.Inspect(); got != expected {
+			t.Fatalf("Inspect() wrong at run %d for mixed keys. want=%q, got=%q", i, expected, got)
+		}
+	}
+}
+
+func TestAggregateBuiltins(t *testing.T) {
+
+	// テストケース
+	// 正常系は整数で比較し、異常系はエラーメッセージで比較する
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`sum([1, 2, 3, 4])`, 10},
+		{`sum([-5])`, -5},
+		{`sum([])`, 0},
+		// 平均は整数の除算で0の方向に切り捨てる
+		{`avg([1, 2])`, 1},
+		{`avg([1, 2, 3, 4])`, 2},
+		{`avg([-7, 0])`, -3},
+		{`avg([5])`, 5},
+		{`avg([])`, "line 1: `avg` of empty array"},
+		{`min([3, -1, 2])`, -1},
+		{`min([7])`, 7},
+		{`min([])`, "line 1: `min` of empty array"},
+		{`max([3, -1, 2])`, 3},
+		{`max([-7])`, -7},
+		{`max([])`, "line 1: `max` of empty array"},
+		{`sum([1, "2"])`, "line 1: elements of `sum` must be INTEGER, got STRING"},
+		{`max([1, [2]])`, "line 1: elements of `max` must be INTEGER or FLOAT, got ARRAY"},
+		{`avg(1)`, "line 1: argument to `avg` must be ARRAY, got INTEGER"},
+		{`min([1], [2])`, "line 1: arguments to `min` must be INTEGER or FLOAT, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+// 組み込み関数inputが標準入力から一行ずつ読み込むことをテスト
+func TestInputBuiltin(t *testing.T) {
+	r, w := io.Pipe()
+	var out bytes.Buffer
+	object.SetStdin(r)
+	object.SetStdout(&out)
+	defer object.SetStdin(os.Stdin)
+	defer object.SetStdout(os.Stdout)
+
+	go func() {
+		io.WriteString(w, "Monkey\r\nbanana\n")
+		w.Close()
+	}()
+
+	evaluated := testEval(`input("name: ")`)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T(%+v)", evaluated, evaluated)
+	}
+	if str.Value != "Monkey" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+	if out.String() != "name: " {
+		t.Errorf("wrong prompt. got=%q", out.String())
+	}
+
+	// プロンプトなしでも読み込める
+	evaluated = testEval(`input()`)
+	str, ok = evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T(%+v)", evaluated, evaluated)
+	}
+	if str.Value != "banana" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+
+	// EOFに達したらNULLを返す
+	testNullObject(t, testEval(`input()`))
+
+	evaluated = testEval(`input(1)`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "line 1: argument to `input` must be STRING, got INTEGER" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+// ArrayLiteral型のASTノードを評価して正しいArray型のObjectを得られるかをテスト
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	// ここで評価
+	evaluated := testEval(input)
+
+	// Arrayオブジェクトであることを確認
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T(%+v)", evaluated, evaluated)
+	}
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+// スプレッド要素を含む配列リテラルの評価をテスト
+func TestSpreadElements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []int64
+	}{
+		{"[...[1, 2], 3, ...[4, 5]]", []int64{1, 2, 3, 4, 5}},
+		{"let rest = [2, 3]; [1, ...rest, 4]", []int64{1, 2, 3, 4}},
+		{"[...[]]", []int64{}},
+		{"let a = [1]; let b = [...a, 2]; a", []int64{1}},
+	}
+
+	for _, tt := range tests {
+		result, ok := testEval(tt.input).(*object.Array)
+		if !ok {
+			t.Errorf("object is not Array for %q. got=%T", tt.input, testEval(tt.input))
+			continue
+		}
+		if len(result.Elements) != len(tt.expected) {
+			t.Errorf("wrong number of elements for %q. want=%d, got=%d", tt.input, len(tt.expected), len(result.Elements))
+			continue
+		}
+		for i, expected := range tt.expected {
+			testIntegerObject(t, result.Elements[i], expected)
+		}
+	}
+
+	errObj, ok := testEval("[1, ...2]").(*object.Error)
+	if !ok || errObj.Message != "line 1: spread operator requires ARRAY, got INTEGER" {
+		t.Errorf("wrong error for spreading an integer. got=%+v", errObj)
+	}
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+
+	// テストケース
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			"[1, 2, 3][0]",
+			1,
+		},
+		{
+			"[1, 2, 3][1]",
+			2,
+		},
+		{
+			"[1, 2, 3][2]",
+			3,
+		},
+		{
+			"let i = 0; [1][i];",
+			1,
+		},
+		{
+			"[1, 2, 3][1 + 1];",
+			3,
+		},
+		{
+			"let myArray = [1, 2, 3]; myArray[2];",
+			3,
+		},
+		{
+			"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
+			6,
+		},
+		{
+			"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+			2,
+		},
+		{
+			"[1, 2, 3][3]",
+			nil,
+		},
+		{
+			"[1, 2, 3][-1]",
+			3,
+		},
+		{
+			"[1, 2, 3][-3]",
+			1,
+		},
+		{
+			"[1, 2, 3][-4]",
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+// 文字列に対する添字演算子式の評価をテスト
+// 添字は文字（コードポイント）単位で数える
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello"[0]`, "h"},
+		{`"hello"[4]`, "o"},
+		{`let s = "hello"; s[len(s) - 1]`, "o"},
+		{`"hello"[-1]`, "o"},
+		{`"hello"[-5]`, "h"},
+		{`"hello"[5]`, nil},
+		{`"hello"[-6]`, nil},
+		{`"日本語"[-2]`, "本"},
+		{`""[0]`, nil},
+		{`"日本語"[1]`, "本"},
+		{`"café"[-1]`, "é"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		expected, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("%q: object is not String. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != expected {
+			t.Errorf("%q: wrong value. want=%q, got=%q", tt.input, expected, str.Value)
+		}
+	}
+}
+
+// スライス式の評価をテスト
+func TestSliceExpressions(t *testing.T) {
+
+	// テストケース
+	// 範囲外の添字は丸められ、配列のスライスは新しい配列になる
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3, 4][1:3]", []int64{2, 3}},
+		{"[1, 2, 3, 4][:2]", []int64{1, 2}},
+		{"[1, 2, 3, 4][2:]", []int64{3, 4}},
+		{"[1, 2, 3, 4][:]", []int64{1, 2, 3, 4}},
+		{"[1, 2, 3][1:1]", []int64{}},
+		{"[][:]", []int64{}},
+		{"[1, 2, 3][-5:2]", []int64{1, 2}},
+		{"[1, 2, 3][1:100]", []int64{2, 3}},
+		{"[1, 2, 3][5:10]", []int64{}},
+		{"let a = [1, 2, 3]; let i = 1; a[i:i + 1]", []int64{2}},
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[:2]`, "he"},
+		{`"hello"[3:]`, "lo"},
+		{`"hello"[:]`, "hello"},
+		{`""[:]`, ""},
+		{`"hello"[2:2]`, ""},
+		{`"hello"[0:100]`, "hello"},
+		{`"日本語"[1:]`, "本語"},
+		{`let s = "café"; s[len(s) - 1:]`, "é"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case []int64:
+			arr, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(arr.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(arr.Elements))
+				continue
+			}
+			for i, e := range expected {
+				testIntegerObject(t, arr.Elements[i], e)
+			}
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		}
+	}
+}
+
+// スライスした配列が元の配列と要素を共有しないことをテスト
+func TestSliceExpressionCopiesArray(t *testing.T) {
+	arr := &object.Array{Elements: []object.Object{
+		&object.Integer{Value: 1},
+		&object.Integer{Value: 2},
+	}}
+	env := object.NewEnvironment()
+	env.Set("arr", arr)
+
+	l := lexer.New("arr[:]")
+	p := parser.New(l)
+	evaluated := Eval(p.ParseProgram(), env)
+
+	sliced, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T(%+v)", evaluated, evaluated)
+	}
+	if sliced == arr {
+		t.Fatalf("slice returned the original array")
+	}
+
+	// スライス側を書き換えても元の配列には影響しない
+	sliced.Elements[0] = &object.Integer{Value: 99}
+	testIntegerObject(t, arr.Elements[0], 1)
+}
+
+// スライス式のエラーをテスト
+func TestSliceExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"[1, 2, 3][2:1]", "line 1: slice bounds out of range: low=2 > high=1"},
+		{`"hello"[3:1]`, "line 1: slice bounds out of range: low=3 > high=1"},
+		{`[1, 2, 3]["a":]`, "line 1: slice bound must be INTEGER, got STRING"},
+		{"[1, 2, 3][:true]", "line 1: slice bound must be INTEGER, got BOOLEAN"},
+		{"[1, 2][null:]", "line 1: slice bound must be INTEGER, got NULL"},
+		{"5[1:2]", "line 1: slice operator not supported: INTEGER"},
+		{"[1, 2, 3][:foo]", "line 1: identifier not found: foo"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `
+	let two = "two";
+	{"one": 10 - 9, two: 1 + 1, "thr" + "ee": 6 / 2, 4: 4, true: 5, false: 6}
+`
+	// ここで評価
+	evaluated := testEval(input)
+
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T(%+v)", evaluated, evaluated)
+	}
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+}
+
+func TestFlatMapBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"flat_map([1, 2], fn(x) { [x, x] })", []int64{1, 1, 2, 2}},
+		{"flat_map([], fn(x) { [x, x] })", []int64{}},
+		{"flat_map([1, 2, 3], fn(x) { [] })", []int64{}},
+		{"flat_map([1, 2], fn(x) { x * 10 })", []int64{10, 20}},
+		{"flat_map([1, 2], fn(x) { [[x]] })[1][0]", 2},
+		{"let n = 3; flat_map([1, 2], fn(x) { [x + n] })", []int64{4, 5}},
+		{"flat_map([[1, 2], [3]], first)", []int64{1, 3}},
+		{"let a = [1, 2]; flat_map(a, fn(x) { [x, x] }); a", []int64{1, 2}},
+		{"flat_map(1, fn(x) { [x] })", "line 1: argument to `flat_map` must be ARRAY, got INTEGER"},
+		{"flat_map([1], 1)", "line 1: second argument to `flat_map` must be FUNCTION, got INTEGER"},
+		{"flat_map([1])", "line 1: wrong number of arguments. got=1, want=2"},
+		{"flat_map([1, 2], fn(x) { x + true })", "line 1: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements for %q. want=%d, got=%d", tt.input, len(expected), len(array.Elements))
+				continue
+			}
+			for i, el := range expected {
+				testIntegerObject(t, array.Elements[i], el)
+			}
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestFilterBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"filter([1, 2, 3, 4], fn(x) { x > 2 })", []int64{3, 4}},
+		{"filter([4, 1, 3, 2], fn(x) { x != 3 })", []int64{4, 1, 2}},
+		{"filter([1, 2, 3], fn(x) { false })", []int64{}},
+		{"filter([], fn(x) { true })", []int64{}},
+		// 返り値は条件式と同じく真偽を判定する
+		{"filter([1, 2, 3], fn(x) { if (x != 2) { x } })", []int64{1, 3}},
+		{"filter([1, 2, 3], fn(x) { 0 })", []int64{1, 2, 3}},
+		{"let n = 1; filter([1, 2, 3], fn(x) { x > n })", []int64{2, 3}},
+		{"let a = [1, 2, 3]; filter(a, fn(x) { x == 2 }); a", []int64{1, 2, 3}},
+		{"let a = [1, 2]; let b = filter(a, fn(x) { true }); b[0] = 9; a[0]", 1},
+		{"filter(1, fn(x) { true })", "line 1: argument to `filter` must be ARRAY, got INTEGER"},
+		{"filter([1], 1)", "line 1: second argument to `filter` must be FUNCTION, got INTEGER"},
+		{"filter([1])", "line 1: wrong number of arguments. got=1, want=2"},
+		{"filter([1, 2], fn(x) { x + true })", "line 1: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements for %q. want=%d, got=%d", tt.input, len(expected), len(array.Elements))
+				continue
+			}
+			for i, el := range expected {
+				testIntegerObject(t, array.Elements[i], el)
+			}
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestSortBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"sort([3, 1, 2])", "[1, 2, 3]"},
+		{"sort([])", "[]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{"sort([2.5, 1, -0.5, 2])", "[-0.5, 1, 2, 2.5]"},
+		{"sort([3, 1, 2], fn(a, b) { b - a })", "[3, 2, 1]"},
+		{`sort(["bb", "a", "ccc"], fn(a, b) { len(a) - len(b) })`, "[a, bb, ccc]"},
+		// 元の配列は変更しない
+		{"let a = [3, 1, 2]; sort(a); a", "[3, 1, 2]"},
+		{"let a = [3, 1, 2]; sort(a, fn(a, b) { a - b }); a", "[3, 1, 2]"},
+		// 同順の要素は元の順序を保つ
+		{`sort([(1, "a"), (0, "b"), (1, "c"), (0, "d"), (1, "e")], fn(x, y) { x[0] - y[0] })`,
+			"[(0, b), (0, d), (1, a), (1, c), (1, e)]"},
+		{`sort([3, 1, 2], fn(a, b) { 0 })`, "[3, 1, 2]"},
+		{`sort([1, "a"])`, "line 1: cannot sort INTEGER and STRING without a comparator"},
+		{`sort([true, false])`, "line 1: cannot sort BOOLEAN and BOOLEAN without a comparator"},
+		{"sort([2, 1], fn(a, b) { a < b })", "line 1: comparator of `sort` must return INTEGER (negative, zero or positive), got BOOLEAN"},
+		{"sort([2, 1], fn(a, b) { a + true })", "line 1: type mismatch: INTEGER + BOOLEAN"},
+		{"sort(1)", "line 1: argument to `sort` must be ARRAY, got INTEGER"},
+		{"sort([1], 1)", "line 1: second argument to `sort` must be FUNCTION, got INTEGER"},
+		{"sort()", "line 1: wrong number of arguments. got=0, want=1 or 2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		expected := tt.expected.(string)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != expected {
+				t.Errorf("%q: wrong error message. want=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != expected {
+			t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+		}
+	}
+}
+
+// 集合リテラルの評価と集合を扱う組み込み関数をテスト
+func TestSets(t *testing.T) {
+	runEngineTests(t, enginetest.Sets)
+
+	// 要素の式のエラーはそのまま伝わる
+	// 関数の型名は仮想マシンではCLOSUREになるので、評価器だけで確かめる
+	runEngineTests(t, []enginetest.Case{
+		{Input: "#{1, fn(x) { x }}", Expected: enginetest.Error("unusable as set element: FUNCTION")},
+		{Input: "#{1, -true}", Expected: enginetest.Error("unknown operator: -BOOLEAN")},
+	})
+}
+
+// タプルの生成・添字によるアクセス・ハッシュのキーとしての利用をテスト
+func TestTuples(t *testing.T) {
+	runEngineTests(t, enginetest.Tuples)
+
+	// 要素の式のエラーはそのまま伝わる
+	runEngineTests(t, []enginetest.Case{
+		{Input: "(1, -true)", Expected: enginetest.Error("unknown operator: -BOOLEAN")},
+	})
+}
+
+// タプルの要素には代入できないことをテスト
+func TestTupleElementsAreNotAssignable(t *testing.T) {
+	p := parser.New(lexer.New("let t = (1, 2); t[0] = 5;"))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 || errors[0].Error() != "[line 1, col 18] cannot assign to (t[0])" {
+		t.Errorf("wrong parser errors. got=%q", errors)
+	}
+}
+
+// 負の整数と大きな正の整数のキーが衝突しないことをテスト
+func TestHashIntegerKeysDoNotCollide(t *testing.T) {
+	input := `let h = {-1: "a", 9223372036854775807: "b", 1: "c"}; [h[-1], h[9223372036854775807], h[1], h[-9223372036854775807]]`
+	result, ok := testEval(input).(*object.Array)
+	if !ok {
+		t.Fatalf("Eval didn't return Array. got=%T", testEval(input))
+	}
+	expected := []string{"a", "b", "c"}
+	for i, want := range expected {
+		str, ok := result.Elements[i].(*object.String)
+		if !ok || str.Value != want {
+			t.Errorf("wrong value for key %d. want=%q, got=%+v", i, want, result.Elements[i])
+		}
+	}
+	testNullObject(t, result.Elements[3])
+}
+
+// 組み込み関数mergeの評価をテスト
+func TestMergeBuiltin(t *testing.T) {
+
+	// テストケース
+	// 後に渡したハッシュのキーが優先される
+	tests := []struct {
+		input    string
+		expected map[object.HashKey]int64
+	}{
+		{
+			`merge({"a": 1, "b": 2}, {"b": 3, "c": 4})`,
+			map[object.HashKey]int64{
+				(&object.String{Value: "a"}).HashKey(): 1,
+				(&object.String{Value: "b"}).HashKey(): 3,
+				(&object.String{Value: "c"}).HashKey(): 4,
+			},
+		},
+		{
+			`merge({"a": 1}, {})`,
+			map[object.HashKey]int64{
+				(&object.String{Value: "a"}).HashKey(): 1,
+			},
+		},
+		{
+			`merge({}, {1: 1}, {1: 2}, {1: 3})`,
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey(): 3,
+			},
+		},
+		{
+			`merge()`,
+			map[object.HashKey]int64{},
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		result, ok := evaluated.(*object.Hash)
+		if !ok {
+			t.Errorf("Eval didn't return Hash. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if len(result.Pairs) != len(tt.expected) {
+			t.Errorf("Hash has wrong num of pairs. want=%d, got=%d", len(tt.expected), len(result.Pairs))
+			continue
+		}
+		for expectedKey, expectedValue := range tt.expected {
+			pair, ok := result.Pairs[expectedKey]
+			if !ok {
+				t.Errorf("no pair for given key in Pairs")
+				continue
+			}
+			testIntegerObject(t, pair.Value, expectedValue)
+		}
+	}
+
+	// 引数のハッシュは変更されない
+	input := `let a = {"x": 1}; let b = merge(a, {"x": 2}); a["x"]`
+	testIntegerObject(t, testEval(input), 1)
+
+	evaluated := testEval(`merge({"a": 1}, [1])`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "line 1: argument to `merge` must be HASH, got ARRAY" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+// 組み込み関数keysとvaluesの評価をテスト
+// 結果はキーの文字列表現の辞書順に並ぶ。整数のキーも数値の順ではなく文字列表現の順になる
+func TestKeysValuesBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.KeysValuesBuiltins)
+
+	// 文字列表現が同じキーがあっても毎回同じ順で返す
+	input := `let h = {1: "a", "1": "b", true: 1, "true": 2, 2: 0, "2": 9}; [keys(h), values(h)]`
+	expected := "[[1, 1, 2, 2, true, true], [a, b, 0, 9, 1, 2]]"
+	for i := 0; i < 200; i++ {
+		if got := testEval(input).Inspect(); got != expected {
+			t.Fatalf("wrong order at run %d. want=%s, got=%s", i, expected, got)
+		}
+	}
+}
+
+// 組み込み関数has_keyとcontainsの評価をテスト
+func TestHasKeyContainsBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.HasKeyContainsBuiltins)
+}
+
+// 組み込み関数deleteとremoveの評価をテスト
+func TestDeleteRemoveBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.DeleteRemoveBuiltins)
+}
+
+// 組み込み関数typeの評価をテスト
+func TestTypeBuiltin(t *testing.T) {
+	runEngineTests(t, enginetest.TypeBuiltin)
+}
+
+// 数値を扱う組み込み関数abs・min・max・powの評価をテスト
+// 浮動小数点数が混ざると結果は浮動小数点数になる
+func TestMathBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.MathBuiltins)
+}
+
+// 組み込み関数rangeの評価をテスト
+func TestRangeBuiltin(t *testing.T) {
+	runEngineTests(t, enginetest.RangeBuiltin)
+
+	// 要素数の上限は変更できる
+	defer func(max int) { object.MaxRangeLength = max }(object.MaxRangeLength)
+	object.MaxRangeLength = 3
+	if got := testEval("range(3)").Inspect(); got != "[0, 1, 2]" {
+		t.Errorf("wrong result for range(3) with limit 3. got=%s", got)
+	}
+	errObj, ok := testEval("range(4)").(*object.Error)
+	if !ok || errObj.Message != "line 1: `range` too large: 4 elements, limit is 3" {
+		t.Errorf("range(4) with limit 3 didn't return the expected error. got=%+v", errObj)
+	}
+}
+
+// 組み込み関数reverse・index_of・sliceをテスト
+// いずれも引数の配列・文字列を変更せず、sliceはスライス式と同じ範囲の扱いをする
+func TestSequenceBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.SequenceBuiltins)
+}
+
+// 組み込み関数now・clock・rand・seedをテスト
+// randはseedで生成元を固定すれば同じ値の列を返す
+func TestTimeAndRandomBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.TimeAndRandomBuiltins)
+
+	before := time.Now().Unix()
+	now, ok := testEval("now()").(*object.Integer)
+	if !ok || now.Value < before || now.Value > time.Now().Unix() {
+		t.Errorf("now() is not the current Unix time. got=%v", now)
+	}
+
+	// clockは単調に増加する
+	input := `let last = clock();
+let ok = true;
+for (let i = 0; i < 1000; i = i + 1) {
+  let c = clock();
+  if (c < last) { ok = false; }
+  last = c;
+}
+ok`
+	testBooleanObject(t, testEval(input), true)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"seed(42); let a = [rand(10), rand(10), rand(10), rand(10)]; seed(42); a == [rand(10), rand(10), rand(10), rand(10)]", true},
+		{"seed(1); let a = []; for (let i = 0; i < 1000; i = i + 1) { a = push(a, rand(3)) }; min(a) == 0 && max(a) == 2", true},
+		{"seed(1); rand(1)", 0},
+		{"seed(5)", nil},
+		{"rand(0)", "line 1: argument to `rand` must be positive, got 0"},
+		{"rand(-3)", "line 1: argument to `rand` must be positive, got -3"},
+		{"rand(1.5)", "line 1: argument to `rand` must be INTEGER, got FLOAT"},
+		{"rand()", "line 1: wrong number of arguments. got=0, want=1"},
+		{`seed("x")`, "line 1: argument to `seed` must be INTEGER, got STRING"},
+		{"now(1)", "line 1: wrong number of arguments. got=1, want=0"},
+		{"clock(1)", "line 1: wrong number of arguments. got=1, want=0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("%q: wrong error message. want=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+// 組み込み関数strとintによる変換をテスト
+func TestStrIntBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.StrIntBuiltins)
+}
+
+// 文字列を扱う組み込み関数の評価をテスト
+// 文字列の分割や置換はUTF-8の文字単位で行われる
+func TestStringBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.StringBuiltins)
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+
+	// テストケース
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			`{"foo": 5}["foo"]`,
+			5,
+		},
+		{
+			`let h = {"foo": {"bar": 7}}; h.foo.bar`,
+			7,
+		},
+		{
+			`{"foo": 5}.bar`,
+			nil,
+		},
+		{
+			`{"foo": 5}["bar"]`,
+			nil,
+		},
+		{
+			`let key = "foo"; {"foo": 5}[key]`,
+			5,
+		},
+		{
+			`{}["foo"]`,
 			nil,
 		},
 		{
@@ -662,3 +2345,311 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+// putsの出力がSetOutputで指定した出力先に順番に書き込まれることをテスト
+func TestSetOutput(t *testing.T) {
+	var out bytes.Buffer
+	e := New()
+	e.SetOutput(&out)
+
+	program := parser.New(lexer.New(`puts("hi", 42); let f = fn() { puts(true) }; f()`)).ParseProgram()
+	testNullObject(t, e.Eval(program, object.NewEnvironment()))
+
+	if expected := "hi\n42\ntrue\n"; out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+// 組み込み関数formatとprintfの評価をテスト
+func TestFormatBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.FormatBuiltins)
+
+	// printfは改行を付けずに出力先に書き込む
+	var out bytes.Buffer
+	e := New()
+	e.SetOutput(&out)
+	program := parser.New(lexer.New(`printf("{} + {} = ", 1, 2); printf("{}", 1 + 2)`)).ParseProgram()
+	testNullObject(t, e.Eval(program, object.NewEnvironment()))
+	if expected := "1 + 2 = 3"; out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+// 評価できるノードの数に上限を設けられることをテスト
+func TestEvaluationBudget(t *testing.T) {
+	evalWithBudget := func(input string, budget int) (object.Object, *object.Environment) {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		env := object.NewEnvironment()
+		e := New()
+		e.SetBudget(budget)
+		return e.Eval(program, env), env
+	}
+
+	// 準備に4ステップ(プログラム、LET文、0、WHILE文)、繰り返し一回に7ステップ
+	// (条件、ブロック、式文、代入、中置式、i、1)を使うので、100ステップでは13回目の代入までしか終わらない
+	evaluated, env := evalWithBudget("let i = 0; while (true) { i = i + 1 }", 100)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "line 1: evaluation budget exceeded" {
+		t.Fatalf("expected budget error, got=%T(%+v)", evaluated, evaluated)
+	}
+	i, _ := env.Get("i")
+	testIntegerObject(t, i, 13)
+
+	// 配列を複製する組み込み関数は要素の数だけ余分にステップを使う
+	// 呼び出しまでに17ステップ、restの呼び出しに1+10ステップ
+	input := "let a = [1, 2, 3, 4, 5, 6, 7, 8, 9, 10]; rest(a)"
+	if evaluated, _ := evalWithBudget(input, 27); !isError(evaluated) {
+		t.Errorf("expected budget error with 27 steps, got=%T(%+v)", evaluated, evaluated)
+	}
+	if evaluated, _ := evalWithBudget(input, 28); isError(evaluated) {
+		t.Errorf("unexpected error with 28 steps: %s", evaluated.Inspect())
+	}
+
+	// 0なら上限はない
+	evaluated, _ = evalWithBudget("let i = 0; while (i < 10000) { i = i + 1 }; i", 0)
+	testIntegerObject(t, evaluated, 10000)
+}
+
+// 関数の中で起きたエラーに関数呼び出しの履歴が付くことをテスト
+func TestErrorCallStack(t *testing.T) {
+	input := `let c = fn(z) { z + missing };
+let b = fn(y) { c(y) };
+let a = fn(x) { b(x) };
+a(1);`
+
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+	expected := []string{
+		"a called at line 4, col 1",
+		"b called at line 3, col 17",
+		"c called at line 2, col 17",
+	}
+	if len(errObj.Stack) != len(expected) {
+		t.Fatalf("wrong number of frames. want=%d, got=%d (%v)", len(expected), len(errObj.Stack), errObj.Stack)
+	}
+	for i, want := range expected {
+		if got := errObj.Stack[i].String(); got != want {
+			t.Errorf("Stack[%d] wrong. want=%q, got=%q", i, want, got)
+		}
+	}
+
+	wantInspect := "ERROR at line 1, col 21: identifier not found: missing\n" +
+		"traceback (most recent call last):\n" +
+		"  a called at line 4, col 1\n" +
+		"  b called at line 3, col 17\n" +
+		"  c called at line 2, col 17"
+	if got := errObj.Inspect(); got != wantInspect {
+		t.Errorf("Inspect wrong.\nwant=%q\ngot=%q", wantInspect, got)
+	}
+
+	// 名前のない関数は仮引数と定義した行で示す
+	// 組み込み関数から呼び出された関数は、組み込み関数を呼び出した位置で示す
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"fn(x, y) {\n  x / y\n}(1, 0)", []string{"fn(x, y) (defined at line 1) called at line 1, col 1"}},
+		{
+			"let f = fn(x) { flat_map([x], fn(y) { -true }) };\nf(1)",
+			[]string{"f called at line 2, col 1", "fn(y) (defined at line 1) called at line 1, col 17"},
+		},
+		// 最上位で起きたエラーには履歴が付かない
+		{"let f = fn(x) { x }; f(1); -true", nil},
+		{"len(1)", nil},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned", tt.input)
+			continue
+		}
+		if len(errObj.Stack) != len(tt.expected) {
+			t.Errorf("%q: wrong number of frames. want=%d, got=%d (%v)", tt.input, len(tt.expected), len(errObj.Stack), errObj.Stack)
+			continue
+		}
+		for i, want := range tt.expected {
+			if got := errObj.Stack[i].String(); got != want {
+				t.Errorf("%q: Stack[%d] wrong. want=%q, got=%q", tt.input, i, want, got)
+			}
+		}
+	}
+}
+
+// エラーにそれが起きたソースコード上の行と列が記録されることをテスト
+func TestErrorSourceLocation(t *testing.T) {
+	tests := []struct {
+		input  string
+		line   int
+		column int
+	}{
+		{"let x = 1;\n  y", 2, 3},
+		{"let x = 1;\nx + true", 2, 3},
+		{"5 / 0", 1, 3},
+		// 呼び出しのエラーは「(」の位置を記録する
+		{"let f = 1;\n\n  f(2)", 3, 4},
+		{"let f = fn(x) { x };\nf(1, 2)", 2, 2},
+		{"len(1)", 1, 4},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Line != tt.line || errObj.Column != tt.column {
+			t.Errorf("wrong location for %q. want=%d:%d, got=%d:%d (%s)",
+				tt.input, tt.line, tt.column, errObj.Line, errObj.Column, errObj.Message)
+		}
+	}
+
+	errObj := testEval("let x = 1;\n  y").(*object.Error)
+	expected := "ERROR at line 2, col 3: identifier not found: y"
+	if got := errObj.Inspect(); got != expected {
+		t.Errorf("Inspect wrong. want=%q, got=%q", expected, got)
+	}
+}
+
+// エラーメッセージにエラーの起きた行が付くことをテスト
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let a = 1;\nlet b = true;\n\na + b;",
+			"line 4: type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			"let f = fn(x) {\n  x + y\n};\nf(1)",
+			"line 2: identifier not found: y",
+		},
+		{
+			"let xs = [1, 2];\nlen(xs,\n  xs)",
+			"line 2: wrong number of arguments. got=2, want=1",
+		},
+		{
+			"let f = fn(x) { x };\n\nf(1, 2)",
+			"line 3: wrong number of arguments to fn(x): want=1, got=2",
+		},
+		// 組み込み関数が呼び出した組み込み関数のエラーは、外側の呼び出しの位置を示す
+		{
+			"1;\nflat_map([1], len)",
+			"line 2: argument to `len` not supported, got INTEGER",
+		},
+		{
+			"1;\nflat_map(1, len)",
+			"line 2: argument to `flat_map` must be ARRAY, got INTEGER",
+		},
+		{
+			"let h = {};\nh[fn(x) { x }]",
+			"line 2: unusable as hash key: FUNCTION",
+		},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%q: wrong error message. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+// IMPORT式がファイルを評価したモジュールを返し、プロパティアクセスで束縛を取り出せることをテスト
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"io.mk":           "let greeting = \"hello\";\nlet puts = fn(x) { greeting + \" \" + x };\n",
+		"lib/util.mk":     "let helper = import \"helper\";\nlet twice = fn(x) { helper.double(x) };\n", // モジュールのディレクトリから探す
+		"lib/helper.mk":   "let double = fn(x) { x * 2 };\n",
+		"a.mk":            "let b = import \"b\";\nlet name = \"a\";\n",
+		"b.mk":            "let a = import \"a\";\nlet get = fn() { a.name };\n",
+		"broken.mk":       "let x = 1;\nx + true;\n",
+		"invalid.mk":      "let = 1;\n",
+		"search/extra.mk": "let value = 42;\n",
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	eval := func(input string) object.Object {
+		e := New()
+		e.SetDirectory(dir)
+		e.SetSearchPath([]string{filepath.Join(dir, "search")})
+		return e.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let io = import "io"; io.puts("world")`, "hello world"},
+		{`let io = import "io.mk"; io.greeting`, "hello"},
+		{`import "io".greeting`, "hello"},
+		{`let util = import "lib/util"; util.twice(21)`, 42},
+		{`let extra = import "extra"; extra.value`, 42},
+		// 循環したimportは評価途中のモジュールを受け取る
+		{`let a = import "a"; a.b.get()`, "a"},
+		// 二度目のimportは同じモジュールを返す
+		{`let x = import "io"; let y = import "io"; type(x) == type(y) && x.puts == y.puts`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := eval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("%q: object is not String. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("%q: wrong value. want=%q, got=%q", tt.input, expected, str.Value)
+			}
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "missing"`, `line 1: module "missing" not found`},
+		{`let io = import "io"; io.undefined`, `line 1: module "io" has no member undefined`},
+		{`import "broken"`, "line 2: type mismatch: INTEGER + BOOLEAN"},
+		{`import "invalid"`, `line 1: cannot import "invalid": ` + filepath.Join(dir, "invalid.mk") + ": [line 1, col 5] expected next token to be IDENT, got = instead"},
+	}
+
+	for _, tt := range errorTests {
+		errObj, ok := eval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%q: wrong error message. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+
+	// モジュールの中で起きたエラーにはモジュールのファイル名を記録する
+	errObj := eval(`import "broken"`).(*object.Error)
+	if expected := filepath.Join(dir, "broken.mk"); errObj.File != expected {
+		t.Errorf("wrong file. want=%q, got=%q", expected, errObj.File)
+	}
+}
@@ -0,0 +1,112 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+)
+
+// importのパスで拡張子が省略されたときに補う拡張子
+const ModuleExtension = ".mk"
+
+// 評価中のファイルがあるディレクトリを設定する
+// importの相対パスはまずこのディレクトリから探す。空なら現在のディレクトリから探す
+func (e *Evaluator) SetDirectory(dir string) {
+	e.dir = dir
+}
+
+// 評価中のファイルがあるディレクトリを返す
+func (e *Evaluator) Directory() string {
+	return e.dir
+}
+
+// importの相対パスが評価中のファイルのディレクトリに見つからなかったときに、順に探すディレクトリを設定する
+func (e *Evaluator) SetSearchPath(dirs []string) {
+	e.searchPath = dirs
+}
+
+// importのパスpathを読み込むファイルの絶対パスに解決する
+// 相対パスは評価中のファイルのディレクトリ、検索パスの各ディレクトリの順に探す
+// それぞれの場所でpathそのもの、pathにModuleExtensionを付けたものの順に探す
+func (e *Evaluator) ResolveModule(path string) (string, error) {
+	candidates := []string{path}
+	if !filepath.IsAbs(path) {
+		candidates = []string{filepath.Join(e.dir, path)}
+		for _, dir := range e.searchPath {
+			candidates = append(candidates, filepath.Join(dir, path))
+		}
+	}
+	for _, candidate := range candidates {
+		for _, name := range []string{candidate, candidate + ModuleExtension} {
+			if info, err := os.Stat(name); err == nil && !info.IsDir() {
+				return filepath.Abs(name)
+			}
+		}
+	}
+	return "", fmt.Errorf("module %q not found", path)
+}
+
+// IMPORT式を評価するヘルパー関数
+// モジュールのファイルを新しい環境で評価し、その環境を持つModuleを返す
+// 一度読み込んだモジュールは評価し直さずに同じModuleを返す
+// 評価を始める前に読み込んだモジュールとして登録するので、循環したimportは評価途中のModuleを受け取る
+func (e *Evaluator) evalImportExpression(ie *ast.ImportExpression) object.Object {
+	path, err := e.ResolveModule(ie.Path.Value)
+	if err != nil {
+		return newError(ie, "%s", err)
+	}
+	if module, ok := e.modules[path]; ok {
+		return module
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return newError(ie, "cannot import %q: %s", ie.Path.Value, err)
+	}
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newError(ie, "cannot import %q: %s: %s", ie.Path.Value, path, p.Errors()[0])
+	}
+	// モジュールで定義したマクロはそのモジュールの中だけで展開する
+	macroEnv := object.NewEnvironment()
+	DefineMacros(program, macroEnv)
+	expanded, err := ExpandMacros(program, macroEnv)
+	if err != nil {
+		return newError(ie, "cannot import %q: %s: %s", ie.Path.Value, path, err)
+	}
+
+	module := &object.Module{Name: ie.Path.Value, Env: object.NewEnvironment()}
+	e.modules[path] = module
+
+	// モジュールの中のimportは、モジュールのファイルがあるディレクトリから探す
+	dir := e.dir
+	e.dir = filepath.Dir(path)
+	evaluated := e.Eval(expanded, module.Env)
+	e.dir = dir
+
+	if isError(evaluated) {
+		// 評価に失敗したモジュールは、次のimportで読み込み直す
+		delete(e.modules, path)
+		if errObj, ok := evaluated.(*object.Error); ok && errObj.File == "" {
+			errObj.File = path
+		}
+		return evaluated
+	}
+	return module
+}
+
+// モジュールに対するプロパティアクセスmodule.nameを、モジュールの環境でnameに束縛された値に評価するヘルパー関数
+func evalModuleMemberExpression(node ast.Node, module, name object.Object) object.Object {
+	moduleObject := module.(*object.Module)
+	key := name.(*object.String).Value
+	val, ok := moduleObject.Env.Get(key)
+	if !ok {
+		return newError(node, "module %q has no member %s", moduleObject.Name, key)
+	}
+	return val
+}
@@ -0,0 +1,86 @@
+package evaluator
+
+import (
+	"errors"
+	"monkey/ast"
+	"monkey/object"
+)
+
+// プログラムの最上位にある「let name = macro(...) { ... };」を取り除き、マクロとしてenvに登録する
+// マクロはほかの文より先にすべて登録されるので、定義より前にある呼び出しも展開される
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := program.Statements[:0]
+	for _, statement := range program.Statements {
+		if !defineMacro(statement, env) {
+			statements = append(statements, statement)
+		}
+	}
+	program.Statements = statements
+}
+
+// statementがマクロの定義であればenvに登録してtrueを返す
+func defineMacro(statement ast.Statement, env *object.Environment) bool {
+	let, ok := statement.(*ast.LetStatement)
+	if !ok {
+		return false
+	}
+	literal, ok := let.Value.(*ast.MacroLiteral)
+	if !ok {
+		return false
+	}
+	env.Set(let.Name.Value, &object.Macro{Parameters: literal.Parameters, Body: literal.Body, Env: env})
+	return true
+}
+
+// program中のマクロの呼び出しを、マクロを評価して得られたASTノードで置き換える
+// マクロの引数は評価せずにQuoteとして渡し、マクロの本体はquote(...)でASTノードを返さなければならない
+// マクロの評価中にエラーが起きた場合は最初のエラーを返す
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	var err error
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil {
+			return node
+		}
+		macro, ok := macroOf(call, env)
+		if !ok {
+			return node
+		}
+
+		if len(call.Arguments) != len(macro.Parameters) {
+			err = errors.New(newError(call, "wrong number of arguments to macro: want=%d, got=%d",
+				len(macro.Parameters), len(call.Arguments)).Message)
+			return node
+		}
+		evalEnv := object.NewEnclosedEnvironment(macro.Env)
+		for i, param := range macro.Parameters {
+			evalEnv.Set(param.Value, &object.Quote{Node: call.Arguments[i]})
+		}
+
+		evaluated := unwrapReturnValue(Eval(macro.Body, evalEnv))
+		switch evaluated := evaluated.(type) {
+		case *object.Quote:
+			return evaluated.Node
+		case *object.Error:
+			err = errors.New(evaluated.Message)
+		default:
+			err = errors.New(newError(call, "macro must return a quoted node, got %s", evaluated.Type()).Message)
+		}
+		return node
+	})
+	return expanded, err
+}
+
+// 呼び出し式callが呼び出しているマクロを返すヘルパー関数
+func macroOf(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+	obj, ok := env.Get(ident.Value)
+	if !ok {
+		return nil, false
+	}
+	macro, ok := obj.(*object.Macro)
+	return macro, ok
+}
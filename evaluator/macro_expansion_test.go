@@ -0,0 +1,175 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func testParseProgram(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+// 最上位のlet文で定義したマクロだけが環境に登録され、プログラムから取り除かれることをテスト
+func TestDefineMacros(t *testing.T) {
+	input := `
+let number = 1;
+let function = fn(x, y) { x + y };
+let mymacro = macro(x, y) { x + y; };
+`
+	env := object.NewEnvironment()
+	program := testParseProgram(t, input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+	if _, ok := env.Get("number"); ok {
+		t.Fatalf("number should not be defined")
+	}
+	if _, ok := env.Get("function"); ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("Wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+	if macro.Parameters[0].String() != "x" || macro.Parameters[1].String() != "y" {
+		t.Fatalf("parameters wrong. got=%v", macro.Parameters)
+	}
+	if expectedBody := "(x + y)"; strings.TrimSpace(macro.Body.String()) != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, macro.Body.String())
+	}
+}
+
+// マクロの呼び出しがマクロの返したASTノードに置き換えられることをテスト
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+let infixExpression = macro() { quote(1 + 2); };
+
+infixExpression();
+`,
+			`(1 + 2)`,
+		},
+		{
+			`
+let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+
+reverse(2 + 2, 10 - 5);
+`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+let unless = macro(condition, consequence, alternative) {
+    quote(if (!(unquote(condition))) {
+        unquote(consequence);
+    } else {
+        unquote(alternative);
+    });
+};
+
+unless(10 > 5, puts("not greater"), puts("greater"));
+`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		// マクロの中で引数以外の値を計算して埋め込める
+		{
+			`
+let square = macro(n) { let v = 1; quote(unquote(n) * unquote(n) + unquote(v + 1)); };
+square(x);
+`,
+			`x * x + 2`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(t, tt.expected)
+		program := testParseProgram(t, tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("ExpandMacros returned error: %s", err)
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q", expected.String(), expanded.String())
+		}
+	}
+}
+
+// 展開したプログラムを評価するとマクロに渡した式が必要な分だけ評価されることをテスト
+func TestEvalExpandedMacros(t *testing.T) {
+	input := `
+let unless = macro(condition, consequence, alternative) {
+    quote(if (!(unquote(condition))) {
+        unquote(consequence);
+    } else {
+        unquote(alternative);
+    });
+};
+
+let count = 0;
+unless(10 > 5, count = count + 100, count = count + 1);
+unless(10 < 5, count = count + 10, missing);
+count
+`
+	program := testParseProgram(t, input)
+	macroEnv := object.NewEnvironment()
+	DefineMacros(program, macroEnv)
+	expanded, err := ExpandMacros(program, macroEnv)
+	if err != nil {
+		t.Fatalf("ExpandMacros returned error: %s", err)
+	}
+	testIntegerObject(t, Eval(expanded, object.NewEnvironment()), 11)
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let m = macro(x) { x };\nm(1, 2)", "line 2: wrong number of arguments to macro: want=1, got=2"},
+		{"let m = macro(x) { 1 };\nm(1)", "line 2: macro must return a quoted node, got INTEGER"},
+		{"let m = macro(x) {\n  quote(unquote(y))\n};\nm(1)", "line 2: identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(t, tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Errorf("%q: expected error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+	"strconv"
+)
+
+// quote(...)の呼び出しを評価する
+// 引数の式は評価せずにASTノードのままQuoteに包んで返す
+// ただし引数の中にあるunquote(...)の呼び出しはその場で評価し、結果をASTノードに戻して埋め込む
+// 元のASTを書き換えないように、引数を複製してから埋め込む
+func (e *Evaluator) quote(call *ast.CallExpression, env *object.Environment) object.Object {
+	if len(call.Arguments) != 1 {
+		return newError(call, "wrong number of arguments to quote: want=1, got=%d", len(call.Arguments))
+	}
+	node, err := e.evalUnquoteCalls(ast.Clone(call.Arguments[0]), env)
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
+
+// quoted中のunquote(...)の呼び出しを評価し、その結果のASTノードで置き換える
+// 最初に起きたエラーを返す
+func (e *Evaluator) evalUnquoteCalls(quoted ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	var err *object.Error
+	modified := ast.Modify(quoted, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || !isCallTo(call, "unquote") || err != nil {
+			return node
+		}
+		if len(call.Arguments) != 1 {
+			err = newError(call, "wrong number of arguments to unquote: want=1, got=%d", len(call.Arguments))
+			return node
+		}
+
+		unquoted := e.Eval(call.Arguments[0], env)
+		if errObj, ok := unquoted.(*object.Error); ok {
+			err = errObj
+			return node
+		}
+		converted := convertObjectToASTNode(unquoted, call.Position())
+		if converted == nil {
+			err = newError(call, "cannot unquote %s", unquoted.Type())
+			return node
+		}
+		return converted
+	})
+	return modified, err
+}
+
+// 呼び出し式callが識別子nameで示される関数の呼び出しかを確認するヘルパー関数
+func isCallTo(call *ast.CallExpression, name string) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
+
+// unquoteで評価した値をquoteの中に埋め込むASTノードに変換する
+// 変換したノードの位置はposとする
+// ASTノードで表せない値に対してはnilを返す
+func convertObjectToASTNode(obj object.Object, pos ast.Pos) ast.Node {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		t := token.Token{Type: token.INT, Literal: strconv.FormatInt(obj.Value, 10), Pos: pos}
+		return &ast.IntegerLiteral{Token: t, NodePos: pos, Value: obj.Value}
+	case *object.Float:
+		t := token.Token{Type: token.FLOAT, Literal: obj.Inspect(), Pos: pos}
+		return &ast.FloatLiteral{Token: t, NodePos: pos, Value: obj.Value}
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value, Pos: pos}
+		return &ast.StringLiteral{Token: t, NodePos: pos, Value: obj.Value}
+	case *object.Boolean:
+		t := token.Token{Type: token.FALSE, Literal: "false", Pos: pos}
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true", Pos: pos}
+		}
+		return &ast.Boolean{Token: t, NodePos: pos, Value: obj.Value}
+	case *object.Null:
+		return &ast.NullLiteral{Token: token.Token{Type: token.NULL, Literal: "null", Pos: pos}, NodePos: pos}
+	case *object.Quote:
+		return obj.Node
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,109 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"testing"
+)
+
+// quoteが引数を評価せずにASTノードのまま返すことをテスト
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+		{`let f = fn(x) { quote(x * 2) }; f(1)`, `(x * 2)`},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, tt.input, tt.expected)
+	}
+}
+
+// quoteの中のunquoteだけが評価され、その結果がASTノードとして埋め込まれることをテスト
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let quotedInfixExpression = quote(4 + 4);
+quote(unquote(4 + 4) + unquote(quotedInfixExpression))`, `(8 + (4 + 4))`},
+		{`quote(unquote("a" + "b"))`, `ab`},
+		{`quote(unquote(1.5 * 2))`, `3.0`},
+		{`quote(unquote(null))`, `null`},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, tt.input, tt.expected)
+	}
+}
+
+// quoteを評価しても元のASTが書き換わらないことをテスト
+func TestQuoteDoesNotModifySource(t *testing.T) {
+	input := `let f = fn(x) { quote(unquote(x) + 1) }; let a = f(1); let b = f(2); [a, b]`
+	array, ok := testEval(input).(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T", testEval(input))
+	}
+	expected := []string{"(1 + 1)", "(2 + 1)"}
+	for i, want := range expected {
+		quote, ok := array.Elements[i].(*object.Quote)
+		if !ok {
+			t.Fatalf("element %d is not Quote. got=%T", i, array.Elements[i])
+		}
+		if got := quote.Node.String(); got != want {
+			t.Errorf("element %d wrong. want=%q, got=%q", i, want, got)
+		}
+	}
+}
+
+func TestQuoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(1, 2)`, "line 1: wrong number of arguments to quote: want=1, got=2"},
+		{`quote(unquote())`, "line 1: wrong number of arguments to unquote: want=1, got=0"},
+		{`quote(unquote(fn(x) { x }))`, "line 1: cannot unquote FUNCTION"},
+		{"quote(1 +\n  unquote(missing))", "line 2: identifier not found: missing"},
+		{`macro(x) { x }`, "line 1: macro can only be defined by a top-level let statement"},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%q: wrong error message. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func testQuoteObject(t *testing.T, input, expected string) {
+	t.Helper()
+	evaluated := testEval(input)
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		t.Fatalf("%q: expected *object.Quote. got=%T (%+v)", input, evaluated, evaluated)
+	}
+	if quote.Node == nil {
+		t.Fatalf("%q: quote.Node is nil", input)
+	}
+	if got := quote.Node.String(); got != expected {
+		t.Errorf("%q: not equal. got=%q, want=%q", input, got, expected)
+	}
+}
@@ -0,0 +1,47 @@
+// Monkeyのソースコードを決まった形に整形するパッケージ
+// ブロックは4スペースでインデントし、二項演算子の前後には空白を一つ置き、
+// 関数呼び出しの「(」の前には空白を置かない
+package format
+
+import (
+	"errors"
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+)
+
+// プログラムを整形したソースコードを返す
+// 整形結果をパースし直して元のプログラムと同じASTになることを確かめ、
+// パースできないか別のプログラムになってしまう場合はエラーを返す
+func Format(program *ast.Program) (string, error) {
+	if program == nil {
+		return "", errors.New("format: nil program")
+	}
+	out := ast.Format(program)
+
+	p := parser.New(lexer.New(out))
+	reparsed := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", fmt.Errorf("format: formatted source does not parse: %s", p.Errors()[0])
+	}
+	if reparsed.String() != program.String() {
+		return "", errors.New("format: formatting changed the meaning of the program")
+	}
+	return out, nil
+}
+
+// ソースコードをパースして整形する
+// コメントは残す
+func Source(src []byte) ([]byte, error) {
+	p := parser.New(lexer.New(string(src)), parser.WithComments())
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("format: %s", p.Errors()[0])
+	}
+	out, err := Format(program)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out), nil
+}
@@ -0,0 +1,115 @@
+package format
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+// 整形結果をパースし直すと元と同じASTになり、もう一度整形しても変わらないことをテスト
+func TestFormatRoundTrip(t *testing.T) {
+	inputs := []string{
+		"let x=5",
+		"let add=fn(a,b){return a+b};add(1,2*3)",
+		"(1+2)*3-4/(5-6)",
+		"!(a==b)!=(c<d)",
+		"let [a,b]=[1,...rest]",
+		"const c=1;let d=c=2",
+		`let h={"one":1,"two":2};h["one"]+h.two`,
+		"let s=\"hello\"[1:3];[1,2,3][:2]",
+		"if(x>y){x}else{if(y>z){y}else{z}}",
+		"let fib=fn(n){if(n<2){return n}fib(n-1)+fib(n-2)};fib(10)",
+		"for(let i=0;i<10;i=i+1){puts(i)}",
+		"while(i<3){if(i==1){break}i=i+1;continue}",
+		"switch x{case 1:\"one\" case 2:\"two\" default:\"many\"}",
+		"let t=(1,(2,),#{3,4});t[0]",
+		"a||b&&!c;1.5*-2.25",
+		"fn(x){fn(y){x*y}}(2)(3)",
+	}
+
+	for _, input := range inputs {
+		original := parse(t, input)
+		formatted, err := Format(original)
+		if err != nil {
+			t.Errorf("Format(%q) failed: %s", input, err)
+			continue
+		}
+
+		reparsed := parse(t, formatted)
+		if reparsed.String() != original.String() {
+			t.Errorf("round trip changed AST for %q.\nformatted=%q\nwant=%q\ngot=%q",
+				input, formatted, original.String(), reparsed.String())
+		}
+		again, err := Format(reparsed)
+		if err != nil || again != formatted {
+			t.Errorf("Format is not idempotent for %q.\nfirst=%q\nsecond=%q (err=%v)", input, formatted, again, err)
+		}
+	}
+}
+
+// 整形の規則をテスト
+func TestFormatStyle(t *testing.T) {
+	input := "let f=fn(x,y){if(x){return x*y}};f (1,2)"
+	expected := "let f = fn(x, y) {\n    if (x) {\n        return x * y;\n    }\n};\nf(1, 2);\n"
+
+	got, err := Format(parse(t, input))
+	if err != nil {
+		t.Fatalf("Format failed: %s", err)
+	}
+	if got != expected {
+		t.Errorf("Format wrong.\nwant=%q\ngot=%q", expected, got)
+	}
+}
+
+// 整形してもプログラムが変わらないことを確かめられない場合のエラーをテスト
+func TestFormatErrors(t *testing.T) {
+	if _, err := Format(nil); err == nil || err.Error() != "format: nil program" {
+		t.Errorf("wrong error for nil program. got=%v", err)
+	}
+
+	// パーサが受け付けない演算子を持つ、手で組み立てたAST
+	program := &ast.Program{Statements: []ast.Statement{
+		&ast.ExpressionStatement{
+			Token: token.Token{Type: token.IDENT, Literal: "a"},
+			Expression: &ast.InfixExpression{
+				Token:    token.Token{Type: token.ILLEGAL, Literal: "^"},
+				Left:     &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: "a"}, Value: "a"},
+				Operator: "^",
+				Right:    &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: "b"}, Value: "b"},
+			},
+		},
+	}}
+	if _, err := Format(program); err == nil {
+		t.Errorf("expected error for program that cannot be reparsed")
+	}
+}
+
+// Sourceでコメントを残したまま整形できることをテスト
+func TestSource(t *testing.T) {
+	src := "// add two numbers\nlet add=fn(a,b){a+b} // done\n"
+	expected := "// add two numbers\nlet add = fn(a, b) {\n    a + b;\n};\n// done\n"
+
+	got, err := Source([]byte(src))
+	if err != nil {
+		t.Fatalf("Source failed: %s", err)
+	}
+	if string(got) != expected {
+		t.Errorf("Source wrong.\nwant=%q\ngot=%q", expected, got)
+	}
+
+	if _, err := Source([]byte("let = 5")); err == nil || err.Error() != "format: [line 1, col 5] expected next token to be IDENT, got = instead" {
+		t.Errorf("wrong error for invalid source. got=%v", err)
+	}
+}
@@ -1,23 +1,41 @@
 package lexer
 
-import "monkey/token"
+import (
+	"monkey/token"
+	"strings"
+)
 
 type Lexer struct {
 	input        string
 	position     int  // 入力における現在の位置
 	readPosition int  // これから読み込む文字の位置（すなわち現在の文字の次の文字）
 	ch           byte // 現在検査中の文字
+	line         int  // 現在の文字の行番号
+	column       int  // 現在の文字の列番号
+
+	emitComments bool // trueならコメントを読み飛ばさずにCOMMENTトークンとして返す
 }
 
 // 入力によって初期化済みの字句解析器を与える
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
+// コメントを読み飛ばさずにCOMMENTトークンとして返すようにする
+// 整形ツールなどでコメントを保持したいときに使う
+func (l *Lexer) EmitComments() {
+	l.emitComments = true
+}
+
 // 文字を一つ読み込む
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -28,10 +46,23 @@ func (l *Lexer) readChar() {
 }
 
 // 読み込んだ文字を判別して対応するトークンを返す
+// トークンには先頭の文字の位置を付ける
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
-
 	l.skipWhiteSpace()
+	for !l.emitComments && l.ch == '/' && l.peekChar() == '/' {
+		l.readComment()
+		l.skipWhiteSpace()
+	}
+
+	pos := token.Pos{Line: l.line, Column: l.column, Offset: l.position}
+	tok := l.readToken()
+	tok.Pos = pos
+	return tok
+}
+
+// 現在の文字から始まるトークンを読み込む
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '!':
@@ -52,22 +83,61 @@ func (l *Lexer) NextToken() token.Token {
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
+	case '&':
+		if l.peekChar() == '&' {
+			l.readChar()
+			tok = token.Token{Type: token.AND, Literal: "&&"}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			l.readChar()
+			tok = token.Token{Type: token.OR, Literal: "||"}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '+':
 		tok = newToken(token.PLUS, l.ch)
 	case '-':
 		tok = newToken(token.MINUS, l.ch)
 	case '/':
+		if l.peekChar() == '/' {
+			return token.Token{Type: token.COMMENT, Literal: l.readComment()}
+		}
 		tok = newToken(token.SLASH, l.ch)
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.LT_EQ, Literal: "<="}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.GT_EQ, Literal: ">="}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.readPosition+1 < len(l.input) && l.input[l.readPosition+1] == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '?':
+		tok = newToken(token.QUESTION, l.ch)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -80,6 +150,13 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.COMMA, l.ch)
 	case '{':
 		tok = newToken(token.LBRACE, l.ch)
+	case '#':
+		if l.peekChar() == '{' {
+			l.readChar()
+			tok = token.Token{Type: token.SET_LBRACE, Literal: "#{"}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
 	case '"':
@@ -95,8 +172,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.LookupIdent(tok.Literal)
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Literal, tok.Type = l.readNumber()
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -138,12 +214,21 @@ func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func (l *Lexer) readNumber() string {
+// 数字を読み進めていき、得られた数値リテラルとその種類を返す
+// 「.」の後に数字が続いていれば小数部として読み、FLOATとする
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	if l.ch != '.' || !isDigit(l.peekChar()) {
+		return l.input[position:l.position], token.INT
+	}
+	l.readChar()
+	for isDigit(l.ch) {
+		l.readChar()
+	}
+	return l.input[position:l.position], token.FLOAT
 }
 
 // readPositionの文字を処理する前に覗き見peekする関数
@@ -155,6 +240,16 @@ func (l *Lexer) peekChar() byte {
 	}
 }
 
+// 「//」から行末までを読み進めていき、得られたコメントを返す関数
+// 返すコメントは「//」を含み、行末の空白は取り除く
+func (l *Lexer) readComment() string {
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	return strings.TrimRight(l.input[position:l.position], " \t\r")
+}
+
 // 文字列として扱われるべき部分まで読み進めていき、得られた文字列を返す関数
 func (l *Lexer) readString() string {
 
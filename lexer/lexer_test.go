@@ -16,7 +16,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/*%5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -31,6 +31,20 @@ if (5 < 10) {
 "foo bar";
 [1, 2];
 {"foo": "bar"};
+for (;;) {}
+switch x { case 1: default: }
+const c = 1;
+null
+1.25 arr[1.]
+[...a]
+a && b || c
+a <= b >= c
+#{1}
+macro(x) { x };
+try {} catch (e) {}
+f()?
+defer f()
+import "io"
 `
 	// テストケース
 	tests := []struct {
@@ -78,6 +92,7 @@ if (5 < 10) {
 		{token.MINUS, "-"},
 		{token.SLASH, "/"},
 		{token.ASTERISK, "*"},
+		{token.PERCENT, "%"},
 		{token.INT, "5"},
 		{token.SEMICOLON, ";"},
 		{token.INT, "5"},
@@ -127,6 +142,78 @@ if (5 < 10) {
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
 		{token.SEMICOLON, ";"},
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.SEMICOLON, ";"},
+		{token.SEMICOLON, ";"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.SWITCH, "switch"},
+		{token.IDENT, "x"},
+		{token.LBRACE, "{"},
+		{token.CASE, "case"},
+		{token.INT, "1"},
+		{token.COLON, ":"},
+		{token.DEFAULT, "default"},
+		{token.COLON, ":"},
+		{token.RBRACE, "}"},
+		{token.CONST, "const"},
+		{token.IDENT, "c"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.NULL, "null"},
+		{token.FLOAT, "1.25"},
+		{token.IDENT, "arr"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.DOT, "."},
+		{token.RBRACKET, "]"},
+		{token.LBRACKET, "["},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "a"},
+		{token.RBRACKET, "]"},
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.IDENT, "c"},
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.SET_LBRACE, "#{"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.MACRO, "macro"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+		{token.TRY, "try"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.CATCH, "catch"},
+		{token.LPAREN, "("},
+		{token.IDENT, "e"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+		{token.QUESTION, "?"},
+		{token.DEFER, "defer"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+		{token.IMPORT, "import"},
+		{token.STRING, "io"},
 		{token.EOF, ""},
 	}
 
@@ -152,3 +239,83 @@ if (5 < 10) {
 		}
 	}
 }
+
+// コメントの読み飛ばしとCOMMENTトークンの出力をテスト
+func TestComments(t *testing.T) {
+	input := `// header
+let x = 10 / 2; // trailing  
+//
+x`
+
+	skipped := []token.TokenType{
+		token.LET, token.IDENT, token.ASSIGN, token.INT, token.SLASH, token.INT, token.SEMICOLON,
+		token.IDENT, token.EOF,
+	}
+	l := New(input)
+	for i, want := range skipped {
+		if tok := l.NextToken(); tok.Type != want {
+			t.Fatalf("skipped[%d] - tokentype wrong. expected=%q, got=%q", i, want, tok.Type)
+		}
+	}
+
+	emitted := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.COMMENT, "// header"},
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "10"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.COMMENT, "// trailing"},
+		{token.COMMENT, "//"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+	l = New(input)
+	l.EmitComments()
+	for i, tt := range emitted {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("emitted[%d] - token wrong. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+// トークンに行・列・オフセットが付くことをテスト
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  // comment
+  x >= "ab"
+`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedPos     token.Pos
+	}{
+		{"let", token.Pos{Line: 1, Column: 1, Offset: 0}},
+		{"x", token.Pos{Line: 1, Column: 5, Offset: 4}},
+		{"=", token.Pos{Line: 1, Column: 7, Offset: 6}},
+		{"5", token.Pos{Line: 1, Column: 9, Offset: 8}},
+		{";", token.Pos{Line: 1, Column: 10, Offset: 9}},
+		{"x", token.Pos{Line: 3, Column: 3, Offset: 26}},
+		{">=", token.Pos{Line: 3, Column: 5, Offset: 28}},
+		{"ab", token.Pos{Line: 3, Column: 8, Offset: 31}},
+		{"", token.Pos{Line: 4, Column: 1, Offset: 36}},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos != tt.expectedPos {
+			t.Errorf("tests[%d] - position of %q wrong. expected=%#v, got=%#v", i, tok.Literal, tt.expectedPos, tok.Pos)
+		}
+	}
+}
@@ -1,20 +0,0 @@
-package main
-
-import (
-	"fmt"
-	"monkey/repl"
-	"os"
-	user2 "os/user"
-)
-
-func main() {
-	user, err := user2.Current()
-	if err != nil {
-		panic(err)
-	}
-	fmt.Printf("Hello %s! This is the Monkey Progamming language!\n",
-		user.Username)
-
-	fmt.Printf("Feel free to type in commands.\n")
-	repl.Start(os.Stdin, os.Stdout)
-}
@@ -1,11 +1,59 @@
 package object
 
-import "fmt"
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
 
-var Builtins = []struct {
+// 組み込み関数inputが読み込む入力元とプロンプトの出力先
+var (
+	stdin            = bufio.NewScanner(os.Stdin)
+	stdout io.Writer = os.Stdout
+)
+
+// 組み込み関数inputの入力元を差し替える
+func SetStdin(r io.Reader) {
+	stdin = bufio.NewScanner(r)
+}
+
+// 組み込み関数inputのプロンプトの出力先を差し替える
+func SetStdout(w io.Writer) {
+	stdout = w
+}
+
+// 組み込み関数randが使う乱数の生成元と、組み込み関数clockが経過時間を測る起点
+var (
+	random     = rand.New(rand.NewSource(time.Now().UnixNano()))
+	clockStart = time.Now()
+)
+
+// 組み込み関数randが使う乱数の生成元を差し替える
+// 固定のシードを持つ生成元を渡せば、randの返す値の列を再現できる
+func SetRandSource(src rand.Source) {
+	random = rand.New(src)
+}
+
+// 組み込み関数rangeが生成できる配列の要素数の上限
+// 大きすぎる範囲で実行環境のメモリを使い果たさないようにする
+var MaxRangeLength = 1000000
+
+// 組み込み関数の名前とその実体の組
+type BuiltinEntry struct {
 	Name    string
 	Builtin *Builtin
-}{
+}
+
+// 評価器とVMで共有する組み込み関数の一覧
+// コンパイラはこの並び順の添字をOpGetBuiltinのオペランドにするので、既存の関数の順序は変えずに末尾に追加する
+var Builtins = []BuiltinEntry{
 	{
 		"len",
 		&Builtin{
@@ -17,7 +65,11 @@ var Builtins = []struct {
 				case *Array:
 					return &Integer{Value: int64(len(arg.Elements))}
 				case *String:
-					return &Integer{Value: int64(len(arg.Value))}
+					return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+				case *Set:
+					return &Integer{Value: int64(len(arg.Elements))}
+				case *Tuple:
+					return &Integer{Value: int64(len(arg.Elements))}
 				default:
 					return newError("argument to `len` not supported, got %s", args[0].Type())
 				}
@@ -28,11 +80,9 @@ var Builtins = []struct {
 		"puts",
 		&Builtin{
 			Fn: func(args ...Object) Object {
-				for _, arg := range args {
-					fmt.Println(arg.Inspect())
-				}
-				return nil
+				return puts(os.Stdout, args...)
 			},
+			WriteFn: puts,
 		},
 	},
 	{
@@ -49,7 +99,7 @@ var Builtins = []struct {
 				if len(arr.Elements) > 0 {
 					return arr.Elements[0]
 				}
-				return nil
+				return NULL
 			},
 		},
 	},
@@ -68,7 +118,7 @@ var Builtins = []struct {
 				if length > 0 {
 					return arr.Elements[length-1]
 				}
-				return nil
+				return NULL
 			},
 		},
 	},
@@ -89,7 +139,7 @@ var Builtins = []struct {
 					copy(newElements, arr.Elements[1:length])
 					return &Array{Elements: newElements}
 				}
-				return nil
+				return NULL
 			},
 		},
 	},
@@ -112,17 +162,1214 @@ var Builtins = []struct {
 			},
 		},
 	},
-}
-
-func newError(format string, a ...interface{}) *Error {
-	return &Error{Message: fmt.Sprintf(format, a...)}
-}
-
-func GetBuiltinByName(name string) *Builtin {
-	for _, def := range Builtins {
-		if def.Name == name {
-			return def.Builtin
-		}
+	{
+		"assert",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 && len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+				}
+				if isTruthy(args[0]) {
+					return NULL
+				}
+				// 失敗したassertはVMでもプログラムを止める
+				if len(args) == 1 {
+					return &Error{Message: "assertion failed", Halt: true}
+				}
+				return &Error{Message: "assertion failed: " + args[1].Inspect(), Halt: true}
+			},
+		},
+	},
+	{
+		"clamp",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				hasFloat, err := numberArguments("clamp", args, 3)
+				if err != nil {
+					return err
+				}
+				x, lo, hi := args[0], args[1], args[2]
+				if lessNumber(hi, lo) {
+					return newError("invalid range for `clamp`: lo=%s > hi=%s", lo.Inspect(), hi.Inspect())
+				}
+				result := x
+				if lessNumber(x, lo) {
+					result = lo
+				} else if lessNumber(hi, x) {
+					result = hi
+				}
+				// min/maxと同様に、浮動小数点数が一つでも混ざっていれば結果は浮動小数点数にする
+				if hasFloat {
+					return &Float{Value: toFloat(result)}
+				}
+				return result
+			},
+		},
+	},
+	{
+		"between",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				hasFloat, err := numberArguments("between", args, 3)
+				if err != nil {
+					return err
+				}
+				if hasFloat {
+					x, lo, hi := toFloat(args[0]), toFloat(args[1]), toFloat(args[2])
+					return NativeBoolToBooleanObject(lo <= x && x <= hi)
+				}
+				x, lo, hi := args[0].(*Integer).Value, args[1].(*Integer).Value, args[2].(*Integer).Value
+				return NativeBoolToBooleanObject(lo <= x && x <= hi)
+			},
+		},
+	},
+	{
+		"error",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				// 文字列以外は文字列表現(Inspect)をメッセージにする
+				if msg, ok := args[0].(*String); ok {
+					return &Error{Message: msg.Value}
+				}
+				return &Error{Message: args[0].Inspect()}
+			},
+		},
+	},
+	{
+		"merge",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				pairs := make(map[HashKey]HashPair)
+				for _, arg := range args {
+					hash, ok := arg.(*Hash)
+					if !ok {
+						return newError("argument to `merge` must be HASH, got %s", arg.Type())
+					}
+					for k, pair := range hash.Pairs {
+						pairs[k] = pair
+					}
+				}
+				return &Hash{Pairs: pairs}
+			},
+		},
+	},
+	{
+		"exit",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) > 1 {
+					return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+				}
+				if len(args) == 0 {
+					return &Exit{Code: 0}
+				}
+				code, ok := args[0].(*Integer)
+				if !ok {
+					return newError("argument to `exit` must be INTEGER, got %s", args[0].Type())
+				}
+				return &Exit{Code: int(code.Value)}
+			},
+		},
+	},
+	{
+		"transpose",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `transpose` must be ARRAY, got %s", args[0].Type())
+				}
+				rows := args[0].(*Array).Elements
+				if len(rows) == 0 {
+					return &Array{Elements: []Object{}}
+				}
+				width := -1
+				for i, row := range rows {
+					r, ok := row.(*Array)
+					if !ok {
+						return newError("rows of `transpose` must be ARRAY, got %s", row.Type())
+					}
+					if width == -1 {
+						width = len(r.Elements)
+					} else if len(r.Elements) != width {
+						return newError("rows of `transpose` must have the same length. row 0 has %d, row %d has %d",
+							width, i, len(r.Elements))
+					}
+				}
+				columns := make([]Object, width)
+				for j := 0; j < width; j++ {
+					column := make([]Object, len(rows))
+					for i, row := range rows {
+						column[i] = row.(*Array).Elements[j]
+					}
+					columns[j] = &Array{Elements: column}
+				}
+				return &Array{Elements: columns}
+			},
+		},
+	},
+	{
+		"input",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) > 1 {
+					return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+				}
+				if len(args) == 1 {
+					prompt, ok := args[0].(*String)
+					if !ok {
+						return newError("argument to `input` must be STRING, got %s", args[0].Type())
+					}
+					fmt.Fprint(stdout, prompt.Value)
+				}
+				if !stdin.Scan() {
+					return NULL
+				}
+				return &String{Value: stdin.Text()}
+			},
+		},
+	},
+	{
+		"sum",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				values, err := integerElements("sum", args)
+				if err != nil {
+					return err
+				}
+				var sum int64
+				for _, v := range values {
+					sum += v
+				}
+				return &Integer{Value: sum}
+			},
+		},
+	},
+	{
+		"avg",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				values, err := integerElements("avg", args)
+				if err != nil {
+					return err
+				}
+				if len(values) == 0 {
+					return newError("`avg` of empty array")
+				}
+				var sum int64
+				for _, v := range values {
+					sum += v
+				}
+				// 要素は整数だけなので、平均も整数の除算で求める
+				// 割り切れない場合は0の方向に切り捨てる（avg([1, 2])は1、avg([-7, 0])は-3）
+				return &Integer{Value: sum / int64(len(values))}
+			},
+		},
+	},
+	{
+		"min",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return extremum("min", args, func(a, b Object) bool { return lessNumber(a, b) })
+			},
+		},
+	},
+	{
+		"max",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return extremum("max", args, func(a, b Object) bool { return lessNumber(b, a) })
+			},
+		},
+	},
+	{
+		"setUnion",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				a, b, err := setArguments("setUnion", args)
+				if err != nil {
+					return err
+				}
+				union := &Set{Elements: make(map[HashKey]Object, len(a.Elements)+len(b.Elements))}
+				for k, el := range a.Elements {
+					union.Elements[k] = el
+				}
+				for k, el := range b.Elements {
+					union.Elements[k] = el
+				}
+				return union
+			},
+		},
+	},
+	{
+		"setIntersect",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				a, b, err := setArguments("setIntersect", args)
+				if err != nil {
+					return err
+				}
+				intersection := &Set{Elements: map[HashKey]Object{}}
+				for k, el := range a.Elements {
+					if _, ok := b.Elements[k]; ok {
+						intersection.Elements[k] = el
+					}
+				}
+				return intersection
+			},
+		},
+	},
+	{
+		"setDiff",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				a, b, err := setArguments("setDiff", args)
+				if err != nil {
+					return err
+				}
+				diff := &Set{Elements: map[HashKey]Object{}}
+				for k, el := range a.Elements {
+					if _, ok := b.Elements[k]; !ok {
+						diff.Elements[k] = el
+					}
+				}
+				return diff
+			},
+		},
+	},
+	{
+		"setContains",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				set, ok := args[0].(*Set)
+				if !ok {
+					return newError("first argument to `setContains` must be SET, got %s", args[0].Type())
+				}
+				elem, ok := AsHashable(args[1])
+				if !ok {
+					return newError("unusable as set element: %s", args[1].Type())
+				}
+				return NativeBoolToBooleanObject(set.Contains(elem))
+			},
+		},
+	},
+	{
+		"tuple",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				array, ok := args[0].(*Array)
+				if !ok {
+					return newError("argument to `tuple` must be ARRAY, got %s", args[0].Type())
+				}
+				elements := make([]Object, len(array.Elements))
+				copy(elements, array.Elements)
+				return &Tuple{Elements: elements}
+			},
+		},
+	},
+	{
+		"array",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				tuple, ok := args[0].(*Tuple)
+				if !ok {
+					return newError("argument to `array` must be TUPLE, got %s", args[0].Type())
+				}
+				elements := make([]Object, len(tuple.Elements))
+				copy(elements, tuple.Elements)
+				return &Array{Elements: elements}
+			},
+		},
+	},
+	{
+		"keys",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				pairs, err := hashPairs("keys", args)
+				if err != nil {
+					return err
+				}
+				keys := make([]Object, len(pairs))
+				for i, pair := range pairs {
+					keys[i] = pair.Key
+				}
+				return &Array{Elements: keys}
+			},
+		},
+	},
+	{
+		"values",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				pairs, err := hashPairs("values", args)
+				if err != nil {
+					return err
+				}
+				values := make([]Object, len(pairs))
+				for i, pair := range pairs {
+					values[i] = pair.Value
+				}
+				return &Array{Elements: values}
+			},
+		},
+	},
+	{
+		"has_key",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				hash, ok := args[0].(*Hash)
+				if !ok {
+					return newError("first argument to `has_key` must be HASH, got %s", args[0].Type())
+				}
+				key, ok := AsHashable(args[1])
+				if !ok {
+					return newError("unusable as hash key: %s", args[1].Type())
+				}
+				_, ok = hash.Pairs[key.HashKey()]
+				return NativeBoolToBooleanObject(ok)
+			},
+		},
+	},
+	{
+		"contains",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				switch haystack := args[0].(type) {
+				case *Array:
+					for _, el := range haystack.Elements {
+						if Equals(el, args[1]) {
+							return TRUE
+						}
+					}
+					return FALSE
+				case *String:
+					needle, ok := args[1].(*String)
+					if !ok {
+						return newError("second argument to `contains` must be STRING when searching a STRING, got %s", args[1].Type())
+					}
+					return NativeBoolToBooleanObject(strings.Contains(haystack.Value, needle.Value))
+				default:
+					return newError("first argument to `contains` must be ARRAY or STRING, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"delete",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				hash, ok := args[0].(*Hash)
+				if !ok {
+					return newError("first argument to `delete` must be HASH, got %s", args[0].Type())
+				}
+				key, ok := AsHashable(args[1])
+				if !ok {
+					return newError("unusable as hash key: %s", args[1].Type())
+				}
+				// 元のハッシュは変更せず、キーを除いた新しいハッシュを返す
+				pairs := make(map[HashKey]HashPair, len(hash.Pairs))
+				for k, pair := range hash.Pairs {
+					pairs[k] = pair
+				}
+				delete(pairs, key.HashKey())
+				return &Hash{Pairs: pairs}
+			},
+		},
+	},
+	{
+		"remove",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				arr, ok := args[0].(*Array)
+				if !ok {
+					return newError("first argument to `remove` must be ARRAY, got %s", args[0].Type())
+				}
+				index, ok := args[1].(*Integer)
+				if !ok {
+					return newError("second argument to `remove` must be INTEGER, got %s", args[1].Type())
+				}
+				// 添字の指定は添字式と同じく、負の値なら末尾から数える
+				length := int64(len(arr.Elements))
+				i := index.Value
+				if i < 0 {
+					i += length
+				}
+				if i < 0 || length <= i {
+					return newError("index out of range for `remove`: %d (length %d)", index.Value, length)
+				}
+				// 元の配列と記憶領域を共有しないように、新しいスライスに要素をコピーする
+				elements := make([]Object, 0, length-1)
+				elements = append(elements, arr.Elements[:i]...)
+				elements = append(elements, arr.Elements[i+1:]...)
+				return &Array{Elements: elements}
+			},
+		},
+	},
+	{
+		"type",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				// VMの関数はクロージャやコンパイルされた関数として表されるが、評価器と同じくFUNCTIONとする
+				switch t := args[0].Type(); t {
+				case CLOSURE_OBJ, COMPILED_FUNCTION_OBJECT:
+					return &String{Value: FUNCTION_OBJ}
+				default:
+					return &String{Value: string(t)}
+				}
+			},
+		},
+	},
+	{
+		"str",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if str, ok := args[0].(*String); ok {
+					return str
+				}
+				return &String{Value: args[0].Inspect()}
+			},
+		},
+	},
+	{
+		"int",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Integer:
+					return arg
+				case *String:
+					// 前後の空白は無視し、符号付きの10進数として読む
+					value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+					if err != nil {
+						return newError("cannot convert %q to INTEGER", arg.Value)
+					}
+					return &Integer{Value: value}
+				default:
+					return newError("argument to `int` must be INTEGER or STRING, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"split",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				strs, err := stringArguments("split", args, 2)
+				if err != nil {
+					return err
+				}
+				// 区切り文字が空文字列なら一文字(UTF-8の1文字)ずつに分ける
+				parts := strings.Split(strs[0], strs[1])
+				elements := make([]Object, len(parts))
+				for i, part := range parts {
+					elements[i] = &String{Value: part}
+				}
+				return &Array{Elements: elements}
+			},
+		},
+	},
+	{
+		"join",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				arr, ok := args[0].(*Array)
+				if !ok {
+					return newError("first argument to `join` must be ARRAY, got %s", args[0].Type())
+				}
+				sep, ok := args[1].(*String)
+				if !ok {
+					return newError("second argument to `join` must be STRING, got %s", args[1].Type())
+				}
+				parts := make([]string, len(arr.Elements))
+				for i, el := range arr.Elements {
+					str, ok := el.(*String)
+					if !ok {
+						return newError("elements of `join` must be STRING, got %s", el.Type())
+					}
+					parts[i] = str.Value
+				}
+				return &String{Value: strings.Join(parts, sep.Value)}
+			},
+		},
+	},
+	{
+		"trim",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				strs, err := stringArguments("trim", args, 1)
+				if err != nil {
+					return err
+				}
+				// ASCIIの空白文字だけを取り除く
+				return &String{Value: strings.Trim(strs[0], " \t\n\v\f\r")}
+			},
+		},
+	},
+	{
+		"upper",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				strs, err := stringArguments("upper", args, 1)
+				if err != nil {
+					return err
+				}
+				return &String{Value: strings.ToUpper(strs[0])}
+			},
+		},
+	},
+	{
+		"lower",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				strs, err := stringArguments("lower", args, 1)
+				if err != nil {
+					return err
+				}
+				return &String{Value: strings.ToLower(strs[0])}
+			},
+		},
+	},
+	{
+		"replace",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				strs, err := stringArguments("replace", args, 3)
+				if err != nil {
+					return err
+				}
+				return &String{Value: strings.ReplaceAll(strs[0], strs[1], strs[2])}
+			},
+		},
+	},
+	{
+		"abs",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Integer:
+					// 最小の整数の絶対値は整数で表せない
+					if arg.Value == math.MinInt64 {
+						return newError("result of `abs` does not fit in INTEGER: abs(%d)", arg.Value)
+					}
+					if arg.Value < 0 {
+						return &Integer{Value: -arg.Value}
+					}
+					return arg
+				case *Float:
+					return &Float{Value: math.Abs(arg.Value)}
+				default:
+					return newError("argument to `abs` must be INTEGER or FLOAT, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"pow",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				for _, arg := range args {
+					if !isNumber(arg) {
+						return newError("arguments to `pow` must be INTEGER or FLOAT, got %s", arg.Type())
+					}
+				}
+				// 整数の非負の整数乗は整数で計算し、それ以外は浮動小数点数で計算する
+				base, ok1 := args[0].(*Integer)
+				exp, ok2 := args[1].(*Integer)
+				if ok1 && ok2 && exp.Value >= 0 {
+					result, ok := integerPow(base.Value, exp.Value)
+					if !ok {
+						return newError("result of `pow` does not fit in INTEGER: pow(%d, %d)", base.Value, exp.Value)
+					}
+					return &Integer{Value: result}
+				}
+				return &Float{Value: math.Pow(toFloat(args[0]), toFloat(args[1]))}
+			},
+		},
+	},
+	{
+		"range",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) < 1 || 3 < len(args) {
+					return newError("wrong number of arguments. got=%d, want=1 to 3", len(args))
+				}
+				bounds := make([]int64, len(args))
+				for i, arg := range args {
+					integer, ok := arg.(*Integer)
+					if !ok {
+						return newError("arguments to `range` must be INTEGER, got %s", arg.Type())
+					}
+					bounds[i] = integer.Value
+				}
+
+				// range(end)、range(start, end)、range(start, end, step)
+				start, end, step := int64(0), bounds[0], int64(1)
+				if len(bounds) >= 2 {
+					start, end = bounds[0], bounds[1]
+				}
+				if len(bounds) == 3 {
+					step = bounds[2]
+				}
+				if step == 0 {
+					return newError("step of `range` must not be zero")
+				}
+
+				n := rangeLength(start, end, step)
+				if n > uint64(MaxRangeLength) {
+					return newError("`range` too large: %d elements, limit is %d", n, MaxRangeLength)
+				}
+				elements := make([]Object, n)
+				for i := range elements {
+					elements[i] = &Integer{Value: start + int64(i)*step}
+				}
+				return &Array{Elements: elements}
+			},
+		},
+	},
+	{
+		"format",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				s, err := formatArguments("format", args)
+				if err != nil {
+					return err
+				}
+				return &String{Value: s}
+			},
+		},
+	},
+	{
+		"printf",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return printf(os.Stdout, args...)
+			},
+			WriteFn: printf,
+		},
+	},
+	{
+		"reverse",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				// 元の配列・文字列は変更せず、逆順にした新しい値を返す
+				switch arg := args[0].(type) {
+				case *Array:
+					elements := make([]Object, len(arg.Elements))
+					for i, el := range arg.Elements {
+						elements[len(elements)-1-i] = el
+					}
+					return &Array{Elements: elements}
+				case *String:
+					// 文字列は文字（コードポイント）単位で逆順にする
+					runes := []rune(arg.Value)
+					for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+						runes[i], runes[j] = runes[j], runes[i]
+					}
+					return &String{Value: string(runes)}
+				default:
+					return newError("argument to `reverse` must be ARRAY or STRING, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"index_of",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				// 見つからなければ-1を返す
+				switch haystack := args[0].(type) {
+				case *Array:
+					for i, el := range haystack.Elements {
+						if Equals(el, args[1]) {
+							return &Integer{Value: int64(i)}
+						}
+					}
+					return &Integer{Value: -1}
+				case *String:
+					needle, ok := args[1].(*String)
+					if !ok {
+						return newError("second argument to `index_of` must be STRING when searching a STRING, got %s", args[1].Type())
+					}
+					// 添字はlenや添字演算子と同様に文字（コードポイント）単位で数える
+					i := strings.Index(haystack.Value, needle.Value)
+					if i < 0 {
+						return &Integer{Value: -1}
+					}
+					return &Integer{Value: int64(utf8.RuneCountInString(haystack.Value[:i]))}
+				default:
+					return newError("first argument to `index_of` must be ARRAY or STRING, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"slice",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 && len(args) != 3 {
+					return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+				}
+				var length int64
+				var runes []rune
+				switch arg := args[0].(type) {
+				case *Array:
+					length = int64(len(arg.Elements))
+				case *String:
+					runes = []rune(arg.Value)
+					length = int64(len(runes))
+				default:
+					return newError("first argument to `slice` must be ARRAY or STRING, got %s", args[0].Type())
+				}
+
+				// スライス式x[low:high]と同じく、省略された上限は長さとして扱い、範囲外の添字は丸める
+				bounds := []int64{0, length}
+				for i, arg := range args[1:] {
+					integer, ok := arg.(*Integer)
+					if !ok {
+						return newError("bounds of `slice` must be INTEGER, got %s", arg.Type())
+					}
+					bounds[i] = integer.Value
+				}
+				low, high := bounds[0], bounds[1]
+				if low > high {
+					return newError("slice bounds out of range: low=%d > high=%d", low, high)
+				}
+				low, high = clampIndex(low, length), clampIndex(high, length)
+
+				switch arg := args[0].(type) {
+				case *Array:
+					elements := make([]Object, high-low)
+					copy(elements, arg.Elements[low:high])
+					return &Array{Elements: elements}
+				default:
+					return &String{Value: string(runes[low:high])}
+				}
+			},
+		},
+	},
+	{
+		"now",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments. got=%d, want=0", len(args))
+				}
+				// 現在のUnix時間を秒単位で返す
+				return &Integer{Value: time.Now().Unix()}
+			},
+		},
+	},
+	{
+		"clock",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments. got=%d, want=0", len(args))
+				}
+				// 処理時間の計測に使うので、時計の調整に左右されない単調増加の経過時間をミリ秒単位で返す
+				return &Integer{Value: time.Since(clockStart).Milliseconds()}
+			},
+		},
+	},
+	{
+		"rand",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				n, ok := args[0].(*Integer)
+				if !ok {
+					return newError("argument to `rand` must be INTEGER, got %s", args[0].Type())
+				}
+				if n.Value <= 0 {
+					return newError("argument to `rand` must be positive, got %d", n.Value)
+				}
+				// [0, n)の範囲の整数を一様に返す
+				return &Integer{Value: random.Int63n(n.Value)}
+			},
+		},
+	},
+	{
+		"seed",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				seed, ok := args[0].(*Integer)
+				if !ok {
+					return newError("argument to `seed` must be INTEGER, got %s", args[0].Type())
+				}
+				SetRandSource(rand.NewSource(seed.Value))
+				return NULL
+			},
+		},
+	},
+	{
+		"is_error",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				// 評価器は、ただ一つの引数の式が生んだエラーだけを伝えずにここへ渡す
+				// 変数に束縛しようとしたエラーはLET文で伝わってしまうので、調べられない
+				_, ok := args[0].(*Error)
+				return NativeBoolToBooleanObject(ok)
+			},
+		},
+	},
+}
+
+// 添字を[0, length]の範囲に丸めるヘルパー関数
+func clampIndex(idx, length int64) int64 {
+	if idx < 0 {
+		return 0
+	}
+	if idx > length {
+		return length
+	}
+	return idx
+}
+
+// 組み込み関数format/printfの第一引数の書式文字列の「{}」を、残りの引数で前から順に置き換える
+// 引数は文字列表現(Inspect)で埋め込む。「{{」と「}}」はそれぞれ「{」と「}」になる
+// 「{}」の数と残りの引数の数が合わなければエラーを返す
+func formatArguments(name string, args []Object) (string, *Error) {
+	if len(args) == 0 {
+		return "", newError("wrong number of arguments. got=0, want=1 or more")
+	}
+	format, ok := args[0].(*String)
+	if !ok {
+		return "", newError("first argument to `%s` must be STRING, got %s", name, args[0].Type())
+	}
+	values := args[1:]
+
+	var out strings.Builder
+	used := 0
+	s := format.Value
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "{{"), strings.HasPrefix(s[i:], "}}"):
+			out.WriteByte(s[i])
+			i++
+		case strings.HasPrefix(s[i:], "{}"):
+			if used == len(values) {
+				return "", newError("too few arguments to `%s`: the format has more than %d {}", name, len(values))
+			}
+			out.WriteString(values[used].Inspect())
+			used++
+			i++
+		case s[i] == '{':
+			return "", newError("unmatched { in the format of `%s`, use {{ for a literal {", name)
+		default:
+			out.WriteByte(s[i])
+		}
+	}
+	if used < len(values) {
+		return "", newError("too many arguments to `%s`: the format has %d {}, got %d arguments", name, used, len(values))
+	}
+	return out.String(), nil
+}
+
+// 書式文字列に従って引数を埋め込んだ文字列を、改行を付けずにoutに出力する
+func printf(out io.Writer, args ...Object) Object {
+	s, err := formatArguments("printf", args)
+	if err != nil {
+		return err
+	}
+	io.WriteString(out, s)
+	return NULL
+}
+
+// 文字列を扱う組み込み関数の引数がn個の文字列であることを確認して、それらの値を返す
+func stringArguments(name string, args []Object, n int) ([]string, *Error) {
+	if len(args) != n {
+		return nil, newError("wrong number of arguments. got=%d, want=%d", len(args), n)
+	}
+	strs := make([]string, n)
+	for i, arg := range args {
+		str, ok := arg.(*String)
+		if !ok {
+			if n == 1 {
+				return nil, newError("argument to `%s` must be STRING, got %s", name, arg.Type())
+			}
+			return nil, newError("arguments to `%s` must be STRING, got %s", name, arg.Type())
+		}
+		strs[i] = str.Value
+	}
+	return strs, nil
+}
+
+// 組み込み関数keys/valuesの引数がハッシュ一つであることを確認して、その組をキーの文字列表現の順に返す
+// 文字列表現が同じキーの順もHash.SortedPairsで決まるので、結果の順は毎回同じになる
+func hashPairs(name string, args []Object) ([]HashPair, *Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return nil, newError("argument to `%s` must be HASH, got %s", name, args[0].Type())
+	}
+	return hash.SortedPairs(), nil
+}
+
+// 集合演算を行う組み込み関数の引数が集合二つであることを確認して、それらを返す
+func setArguments(name string, args []Object) (*Set, *Set, *Error) {
+	if len(args) != 2 {
+		return nil, nil, newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	a, ok := args[0].(*Set)
+	if !ok {
+		return nil, nil, newError("arguments to `%s` must be SET, got %s", name, args[0].Type())
+	}
+	b, ok := args[1].(*Set)
+	if !ok {
+		return nil, nil, newError("arguments to `%s` must be SET, got %s", name, args[1].Type())
+	}
+	return a, b, nil
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// 名前がnameの組み込み関数を返す。該当する関数がなければnilを返す
+func GetBuiltinByName(name string) *Builtin {
+	return GetBuiltinByIndex(GetBuiltinIndex(name))
+}
+
+// Builtinsのi番目の組み込み関数を返す。範囲外の添字に対してはnilを返す
+func GetBuiltinByIndex(i int) *Builtin {
+	if i < 0 || len(Builtins) <= i {
+		return nil
+	}
+	return Builtins[i].Builtin
+}
+
+// 名前がnameの組み込み関数のBuiltinsでの添字を返す。該当する関数がなければ-1を返す
+func GetBuiltinIndex(name string) int {
+	for i, def := range Builtins {
+		if def.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// 数値を扱う組み込み関数の引数がn個の整数か浮動小数点数であることを確認して、浮動小数点数が混ざっているかを返す
+func numberArguments(name string, args []Object, n int) (bool, *Error) {
+	if len(args) != n {
+		return false, newError("wrong number of arguments. got=%d, want=%d", len(args), n)
+	}
+	hasFloat := false
+	for _, arg := range args {
+		if !isNumber(arg) {
+			return false, newError("arguments to `%s` must be INTEGER or FLOAT, got %s", name, arg.Type())
+		}
+		hasFloat = hasFloat || arg.Type() == FLOAT_OBJ
+	}
+	return hasFloat, nil
+}
+
+// 集計を行う組み込み関数の引数が整数の配列一つであることを確認して、その要素の値を返す
+func integerElements(name string, args []Object) ([]int64, *Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	values := make([]int64, len(arr.Elements))
+	for i, el := range arr.Elements {
+		integer, ok := el.(*Integer)
+		if !ok {
+			return nil, newError("elements of `%s` must be INTEGER, got %s", name, el.Type())
+		}
+		values[i] = integer.Value
+	}
+	return values, nil
+}
+
+// 組み込み関数min/maxの引数の数値のうち、lessで比べて最も前に来るものを返す
+// 引数が一つならその配列の要素を、二つ以上なら引数そのものを比べる
+// 浮動小数点数が一つでも混ざっていれば結果は浮動小数点数にする
+func extremum(name string, args []Object, less func(a, b Object) bool) Object {
+	values := args
+	what := "arguments to"
+	switch len(args) {
+	case 0:
+		return newError("wrong number of arguments. got=0, want=1 or more")
+	case 1:
+		arr, ok := args[0].(*Array)
+		if !ok {
+			return newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+		}
+		if len(arr.Elements) == 0 {
+			return newError("`%s` of empty array", name)
+		}
+		values = arr.Elements
+		what = "elements of"
+	}
+
+	hasFloat := false
+	for _, v := range values {
+		if !isNumber(v) {
+			return newError("%s `%s` must be INTEGER or FLOAT, got %s", what, name, v.Type())
+		}
+		hasFloat = hasFloat || v.Type() == FLOAT_OBJ
+	}
+
+	result := values[0]
+	for _, v := range values[1:] {
+		if less(v, result) {
+			result = v
+		}
+	}
+	if hasFloat {
+		return &Float{Value: toFloat(result)}
+	}
+	return result
+}
+
+// 数値aがbより小さいかを返す。整数どうしは精度を落とさずに整数のまま比べる
+func lessNumber(a, b Object) bool {
+	if a, ok := a.(*Integer); ok {
+		if b, ok := b.(*Integer); ok {
+			return a.Value < b.Value
+		}
+	}
+	return toFloat(a) < toFloat(b)
+}
+
+// startからstep刻みでendの手前まで進むときの要素数を返す
+// stepの向きではendに届かない場合は0を返す
+// 差がint64に収まらない範囲でも正しく数えられるようにuint64で計算する
+func rangeLength(start, end, step int64) uint64 {
+	switch {
+	case step > 0 && start < end:
+		return (uint64(end)-uint64(start)-1)/uint64(step) + 1
+	case step < 0 && start > end:
+		return (uint64(start)-uint64(end)-1)/(-uint64(step)) + 1
+	default:
+		return 0
+	}
+}
+
+// 繰り返し二乗法でbaseのexp乗を計算する。expは0以上でなければならない
+// 結果がint64に収まらない場合はfalseを返す
+func integerPow(base, exp int64) (int64, bool) {
+	result := int64(1)
+	ok := true
+	for exp > 0 {
+		if exp&1 == 1 {
+			if result, ok = multiplyInt64(result, base); !ok {
+				return 0, false
+			}
+		}
+		exp >>= 1
+		// 最後の二乗は結果に使わないので計算しない。計算すると結果が収まる場合でも桁あふれしうる
+		if exp > 0 {
+			if base, ok = multiplyInt64(base, base); !ok {
+				return 0, false
+			}
+		}
+	}
+	return result, true
+}
+
+// a*bを計算する。結果がint64に収まらない場合はfalseを返す
+func multiplyInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	result := a * b
+	if result/b != a || (a == math.MinInt64 && b == -1) {
+		return 0, false
+	}
+	return result, true
+}
+
+func isNumber(obj Object) bool {
+	t := obj.Type()
+	return t == INTEGER_OBJ || t == FLOAT_OBJ
+}
+
+// 数値を浮動小数点数に変換する。objは整数か浮動小数点数でなければならない
+func toFloat(obj Object) float64 {
+	if i, ok := obj.(*Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*Float).Value
+}
+
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return true
+	}
+}
+
+// 引数を一つずつoutに出力する
+func puts(out io.Writer, args ...Object) Object {
+	for _, arg := range args {
+		fmt.Fprintln(out, arg.Inspect())
 	}
-	return nil
+	return NULL
 }
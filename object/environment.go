@@ -1,5 +1,7 @@
 package object
 
+import "sort"
+
 // -----------------------------------------------------
 // Environmentの定義
 type Environment struct {
@@ -7,6 +9,9 @@ type Environment struct {
 	// 識別子に対応するObjectを保存する
 	store map[string]Object
 
+	// constで束縛された識別子の集合
+	consts map[string]bool
+
 	// 拡張環境
 	outer *Environment
 }
@@ -15,7 +20,8 @@ type Environment struct {
 // 常に一つの環境を使いまわしたいのでポインタで渡す
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s}
+	c := make(map[string]bool)
+	return &Environment{store: s, consts: c}
 }
 
 // 環境内にnameという名前で登録されているObjectを持ってくる
@@ -37,6 +43,66 @@ func (e *Environment) Set(name string, val Object) Object {
 	return val
 }
 
+// 環境内にnameという名前でObjectを定数として登録する
+func (e *Environment) SetConst(name string, val Object) Object {
+	e.consts[name] = true
+	return e.Set(name, val)
+}
+
+// この環境でnameが定数として登録されているかどうかを返す
+// 外側の環境は探さない
+func (e *Environment) IsConst(name string) bool {
+	return e.consts[name]
+}
+
+// nameが登録されている環境を内側から順に探して返す
+// 見つからなければnilを返す
+func (e *Environment) Owner(name string) *Environment {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			return env
+		}
+	}
+	return nil
+}
+
+// nameが登録されている環境を内側から順に探し、その環境でnameにvalを登録し直す
+// 内側の環境に新しく登録するのではないので、クロージャが捕まえた外側の変数も書き換えられる
+// nameがどの環境にも登録されていなければ何もせずfalseを返す
+func (e *Environment) Assign(name string, val Object) bool {
+	owner := e.Owner(name)
+	if owner == nil {
+		return false
+	}
+	owner.Set(name, val)
+	return true
+}
+
+// この環境に直接登録されている名前を辞書順に並べて返す
+// 外側の環境の名前は含まない
+func (e *Environment) Keys() []string {
+	keys := make([]string, 0, len(e.store))
+	for name := range e.store {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// この環境から見えるすべての名前とObjectを返す
+// 外側の環境もたどり、同じ名前が複数の環境にあれば内側の束縛を優先する
+func (e *Environment) All() map[string]Object {
+	all := make(map[string]Object)
+	for env := e; env != nil; env = env.outer {
+		for name, val := range env.store {
+			if _, ok := all[name]; !ok {
+				all[name] = val
+			}
+		}
+	}
+	return all
+}
+
 // 拡張環境をセットする
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
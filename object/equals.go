@@ -0,0 +1,74 @@
+package object
+
+// aとbが等しいかを返す
+// 数値・文字列・真偽値は値で比較し、整数と浮動小数点数は数値として比較する
+// 配列・タプルは長さと各要素を、ハッシュはキーの集合と各キーの値を、集合は要素の集合を再帰的に比較する
+// 関数など、それ以外のオブジェクトは同一のオブジェクトである場合だけ等しい
+func Equals(a, b Object) bool {
+	switch a := a.(type) {
+	case *Integer:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value == b.Value
+		case *Float:
+			return float64(a.Value) == b.Value
+		}
+		return false
+	case *Float:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value == float64(b.Value)
+		case *Float:
+			return a.Value == b.Value
+		}
+		return false
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && elementsEqual(a.Elements, b.Elements)
+	case *Tuple:
+		b, ok := b.(*Tuple)
+		return ok && elementsEqual(a.Elements, b.Elements)
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			other, ok := b.Pairs[key]
+			if !ok || !Equals(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	case *Set:
+		b, ok := b.(*Set)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for key := range a.Elements {
+			if _, ok := b.Elements[key]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func elementsEqual(a, b []Object) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equals(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
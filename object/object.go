@@ -2,10 +2,15 @@ package object
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"hash/fnv"
+	"io"
+	"math"
 	"monkey/ast"
 	"monkey/code"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -21,17 +26,27 @@ type Object interface {
 
 const (
 	INTEGER_OBJ              = "INTEGER"
+	FLOAT_OBJ                = "FLOAT"
 	BOOLEAN_OBJ              = "BOOLEAN"
 	NULL_OBJ                 = "NULL"
 	RETURN_VALUE_OBJ         = "RETURN_VAL"
+	BREAK_OBJ                = "BREAK"
+	CONTINUE_OBJ             = "CONTINUE"
+	EXIT_OBJ                 = "EXIT"
+	PROPAGATE_OBJ            = "PROPAGATE"
 	ERROR_OBJ                = "ERROR"
 	FUNCTION_OBJ             = "FUNCTION"
 	STRING_OBJ               = "STRING"
 	BUILTIN_OBJ              = "BUILTIN"
 	ARRAY_OBJ                = "ARRAY"
 	HASH_OBJ                 = "HASH"
+	SET_OBJ                  = "SET"
+	TUPLE_OBJ                = "TUPLE"
 	COMPILED_FUNCTION_OBJECT = "COMPILED_FUNCTION_OBJECT"
 	CLOSURE_OBJ              = "CLOSURE"
+	QUOTE_OBJ                = "QUOTE"
+	MACRO_OBJ                = "MACRO"
+	MODULE_OBJ               = "MODULE"
 )
 
 // ハッシュテーブルにおける管理用オブジェクトとしてのHashKey
@@ -45,6 +60,25 @@ type Hashable interface {
 	HashKey() HashKey
 }
 
+// タプルのように、要素によってハッシュのキーに使えるかどうかが変わるオブジェクト
+type conditionallyHashable interface {
+	Hashable
+	hashable() bool
+}
+
+// objがハッシュのキーに使えればHashableとして返す
+// 型アサーションobj.(Hashable)の代わりに使う
+func AsHashable(obj Object) (Hashable, bool) {
+	h, ok := obj.(Hashable)
+	if !ok {
+		return nil, false
+	}
+	if c, ok := h.(conditionallyHashable); ok && !c.hashable() {
+		return nil, false
+	}
+	return h, true
+}
+
 // -----------------------------------------------------
 
 // -----------------------------------------------------
@@ -55,18 +89,68 @@ type Integer struct {
 
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+
+// int64からuint64への変換はビット列をそのまま解釈し直すだけで単射なので、
+// -1と大きな正の整数のように符号の異なる値同士が同じキーになることはない
+// （-1はuint64では18446744073709551615になるが、その値はint64では表せずリテラルとしてもパースできない）
 func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
 // -----------------------------------------------------
 
+// -----------------------------------------------------
+// Floatの定義
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// 普通の大きさの値は指数表記を使わずに出力する
+// 整数と区別できるように、整数値でも「.0」を付ける
+func (f *Float) Inspect() string {
+	abs := math.Abs(f.Value)
+	if math.IsInf(f.Value, 0) || math.IsNaN(f.Value) || abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		return strconv.FormatFloat(f.Value, 'g', -1, 64)
+	}
+	s := strconv.FormatFloat(f.Value, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// 0.0と-0.0は等しいので同じキーにする
+func (f *Float) HashKey() HashKey {
+	if f.Value == 0 {
+		return HashKey{Type: f.Type(), Value: 0}
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
+// -----------------------------------------------------
+
 // -----------------------------------------------------
 // Booleanの定義
 type Boolean struct {
 	Value bool
 }
 
+// 評価器・VM・組み込み関数で共有する真偽値のシングルトン
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+// bool値に対して共有のBooleanオブジェクトを返す
+func NativeBoolToBooleanObject(input bool) *Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
 func (b *Boolean) HashKey() HashKey {
@@ -85,6 +169,11 @@ func (b *Boolean) HashKey() HashKey {
 // Nullの定義
 type Null struct{}
 
+// 評価器・VM・組み込み関数で共有するNullのシングルトン
+// Nullは大きさが0の構造体なので、別々に生成したポインタが等しくなるかはGoの仕様で決まっていない
+// nullの比較はポインタで行うので、必ずこれを使う
+var NULL = &Null{}
+
 func (n *Null) Type() ObjectType { return NULL_OBJ }
 func (n *Null) Inspect() string  { return "Null" }
 
@@ -101,14 +190,113 @@ func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
 // -----------------------------------------------------
 
+// -----------------------------------------------------
+// BreakとContinueの定義
+// break文・continue文を評価したことを最も内側のループまで伝えるための目印で、値としては現れない
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+// -----------------------------------------------------
+
+// -----------------------------------------------------
+// Exitの定義
+// 組み込み関数exitが返す、プログラムの実行を終えるための目印で、値としては現れない
+// 評価器とVMはこれを受け取るとそれ以降を実行せずに終わり、REPLやmonkeyコマンドがCodeを終了コードにする
+// 組み込み関数がプロセスごと終了させると、Monkeyを組み込んだプログラムまで終了してしまう
+type Exit struct {
+	Code int
+}
+
+func (e *Exit) Type() ObjectType { return EXIT_OBJ }
+func (e *Exit) Inspect() string  { return fmt.Sprintf("exit(%d)", e.Code) }
+
+// VMは実行を打ち切った理由をerrorとして返すので、errorとしても扱えるようにする
+func (e *Exit) Error() string { return fmt.Sprintf("exit status %d", e.Code) }
+
+// -----------------------------------------------------
+
+// -----------------------------------------------------
+// Propagateの定義
+// 後置演算子?が受け取ったエラーを、それを囲む関数の呼び出し元まで伝えるための目印で、値としては現れない
+// 関数呼び出しで包みを剥がしてErrorに戻るまでは、TRY文やis_errorにも捕まらない
+type Propagate struct {
+	Error *Error
+}
+
+func (p *Propagate) Type() ObjectType { return PROPAGATE_OBJ }
+func (p *Propagate) Inspect() string  { return p.Error.Inspect() }
+
+// -----------------------------------------------------
+
 // -----------------------------------------------------
 // Errorの定義
 type Error struct {
 	Message string
+	Stack   []StackFrame // エラーが起きたときの関数呼び出しの履歴。外側の呼び出しから順に並ぶ
+	Line    int          // エラーが起きた行。位置が分からなければ0
+	Column  int          // エラーが起きた列
+	File    string       // エラーが起きたソースファイルの名前。分からなければ空
+
+	// trueなら、VMでも値として扱わずにプログラムを止める。assertの失敗がこれにあたる
+	Halt bool
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+
+// 位置の分かるエラーは「ERROR at line 5, col 12: ...」のように位置を付けて表示する
+// 関数の中で起きたエラーは、メッセージに続けて関数呼び出しの履歴(traceback)を表示する
+func (e *Error) Inspect() string {
+	var out bytes.Buffer
+	if e.Line > 0 {
+		location := fmt.Sprintf("line %d, col %d", e.Line, e.Column)
+		if e.File != "" {
+			location = e.File + ", " + location
+		}
+		out.WriteString("ERROR at " + location + ": " + e.Text())
+	} else {
+		out.WriteString("ERROR: " + e.Message)
+	}
+	if len(e.Stack) > 0 {
+		out.WriteString("\ntraceback (most recent call last):")
+		for _, f := range e.Stack {
+			out.WriteString("\n  " + f.String())
+		}
+	}
+	return out.String()
+}
+
+// 位置を除いたエラーメッセージを返す
+// 評価器はメッセージの先頭に「line 5: 」のように行番号を付けるので、それを取り除く
+func (e *Error) Text() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return strings.TrimPrefix(e.Message, fmt.Sprintf("line %d: ", e.Line))
+}
+
+// 関数呼び出しの履歴の一つ分
+type StackFrame struct {
+	Name     string  // 呼び出した関数の名前。識別子を介さずに呼び出した関数では空
+	Function string  // 関数の仮引数を示す「fn(x, y)」という文字列
+	Defined  ast.Pos // 関数を定義した位置
+	Call     ast.Pos // 関数を呼び出した位置
+}
+
+// 名前のない関数は仮引数と定義した行で示す
+func (f StackFrame) String() string {
+	call := fmt.Sprintf("called at line %d, col %d", f.Call.Line, f.Call.Column)
+	if f.Name != "" {
+		return f.Name + " " + call
+	}
+	return fmt.Sprintf("%s (defined at line %d) %s", f.Function, f.Defined.Line, call)
+}
 
 // -----------------------------------------------------
 
@@ -138,12 +326,64 @@ func (f *Function) Inspect() string {
 
 // -----------------------------------------------------
 
+// -----------------------------------------------------
+// quote(...)で評価せずに包んだASTノードを表現するオブジェクトの定義
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string  { return "QUOTE(" + q.Node.String() + ")" }
+
+// -----------------------------------------------------
+
+// -----------------------------------------------------
+// マクロを表現するオブジェクトの定義
+// 関数と同じく仮引数と本体、定義された環境を持つが、引数は評価せずにQuoteとして受け取る
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+	return out.String()
+}
+
+// -----------------------------------------------------
+
+// -----------------------------------------------------
+// importで読み込んだモジュールを表現するオブジェクトの定義
+// モジュールのファイルを評価した環境を持ち、module.nameでその環境に束縛された値を取り出す
+type Module struct {
+	Name string // importに渡したパス
+	Env  *Environment
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "module(" + m.Name + ")" }
+
+// -----------------------------------------------------
+
 // -----------------------------------------------------
 // コンパイルされた関数を表現するオブジェクトの定義
 type CompiledFunction struct {
 	Instructions  code.Instructions // この関数をコンパイルして得られる命令列
 	NumLocals     int               // 関数内で使われるローカル変数の個数
 	NumParameters int               // 関数リテラルが実行しようとしているときに保持している引数の個数
+	Name          string            // let文で束縛した関数の名前。無名関数では空
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJECT }
@@ -172,8 +412,23 @@ func (s *String) HashKey() HashKey {
 // -----------------------------------------------------
 // Builtinの定義
 type BuiltinFunction func(args ...Object) Object
+
+// 出力先を受け取る組み込み関数
+// putsのように出力を伴う組み込み関数が、呼び出し側の指定した出力先に書き込むために使う
+type WriterBuiltinFunction func(out io.Writer, args ...Object) Object
+
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn      BuiltinFunction
+	WriteFn WriterBuiltinFunction // 出力を伴う組み込み関数のみ持つ
+}
+
+// 出力先をoutとして組み込み関数を呼び出す
+// WriteFnを持たない組み込み関数やoutがnilの場合はFnを呼び出す
+func (b *Builtin) CallWithOutput(out io.Writer, args ...Object) Object {
+	if b.WriteFn != nil && out != nil {
+		return b.WriteFn(out, args...)
+	}
+	return b.Fn(args...)
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -202,6 +457,55 @@ func (ao *Array) Inspect() string {
 
 // -----------------------------------------------------
 
+// -----------------------------------------------------
+// Tupleオブジェクトの定義
+// 要素を書き換えられない配列で、すべての要素がハッシュのキーに使えればタプルもキーに使える
+type Tuple struct {
+	Elements []Object
+}
+
+func (t *Tuple) Type() ObjectType { return TUPLE_OBJ }
+func (t *Tuple) Inspect() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, e := range t.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	out.WriteString("(")
+	out.WriteString(strings.Join(elements, ", "))
+	// 要素が一つのタプルは括弧で囲んだ式と区別するためにコンマを付ける
+	if len(t.Elements) == 1 {
+		out.WriteString(",")
+	}
+	out.WriteString(")")
+	return out.String()
+}
+
+func (t *Tuple) hashable() bool {
+	for _, e := range t.Elements {
+		if _, ok := AsHashable(e); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// 各要素のHashKeyを順に混ぜ合わせたHashKeyを返す
+// 要素がハッシュのキーに使えるかはAsHashableで事前に確認しておくこと
+func (t *Tuple) HashKey() HashKey {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	for _, e := range t.Elements {
+		key := e.(Hashable).HashKey()
+		h.Write([]byte(key.Type))
+		binary.LittleEndian.PutUint64(buf, key.Value)
+		h.Write(buf)
+	}
+	return HashKey{Type: t.Type(), Value: h.Sum64()}
+}
+
+// -----------------------------------------------------
+
 // -----------------------------------------------------
 // Hashオブジェクトの定義
 type HashPair struct {
@@ -217,7 +521,7 @@ func (h *Hash) Type() ObjectType { return HASH_OBJ }
 func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.SortedPairs() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 	out.WriteString("{")
@@ -226,6 +530,72 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// ハッシュの組をキーの文字列表現の順に並べて返す
+// mapの走査順は不定なので、表示や組み込み関数keys/valuesの結果が毎回同じになるようにする
+// 1と"1"のように文字列表現が同じキーは、型の名前、HashKeyの値の順で並べる
+func (h *Hash) SortedPairs() []HashPair {
+	sorted := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		sorted = append(sorted, pair)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i].Key.Inspect(), sorted[j].Key.Inspect()
+		if a != b {
+			return a < b
+		}
+		ka, kb := sorted[i].Key.(Hashable).HashKey(), sorted[j].Key.(Hashable).HashKey()
+		if ka.Type != kb.Type {
+			return ka.Type < kb.Type
+		}
+		return ka.Value < kb.Value
+	})
+	return sorted
+}
+
+// -----------------------------------------------------
+
+// -----------------------------------------------------
+// Setオブジェクトの定義
+// 要素はHashKeyで重複を取り除いて保持する
+type Set struct {
+	Elements map[HashKey]Object
+}
+
+// elementsからSetを生成する
+// 同じHashKeyを持つ要素は一つにまとめ、Hashableでない要素があればそれを返す
+func NewSet(elements []Object) (*Set, Object) {
+	set := &Set{Elements: make(map[HashKey]Object, len(elements))}
+	for _, el := range elements {
+		hashable, ok := AsHashable(el)
+		if !ok {
+			return nil, el
+		}
+		set.Elements[hashable.HashKey()] = el
+	}
+	return set, nil
+}
+
+// 要素がelemと同じHashKeyを持つかを返す
+func (s *Set) Contains(elem Hashable) bool {
+	_, ok := s.Elements[elem.HashKey()]
+	return ok
+}
+
+func (s *Set) Type() ObjectType { return SET_OBJ }
+func (s *Set) Inspect() string {
+	var out bytes.Buffer
+	// Hashと同様に、表示が毎回同じになるように要素の文字列表現でソートする
+	elements := []string{}
+	for _, el := range s.Elements {
+		elements = append(elements, el.Inspect())
+	}
+	sort.Strings(elements)
+	out.WriteString("#{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
 // -----------------------------------------------------
 
 // -----------------------------------------------------
@@ -1,6 +1,10 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"reflect"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -17,3 +21,320 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("StringObjects with different content have same hash keys")
 	}
 }
+
+func TestFloatHashKey(t *testing.T) {
+	if (&Float{Value: 1.5}).HashKey() != (&Float{Value: 1.5}).HashKey() {
+		t.Errorf("FloatObjects with same value have different hash keys")
+	}
+	if (&Float{Value: 1.5}).HashKey() == (&Float{Value: 2.5}).HashKey() {
+		t.Errorf("FloatObjects with different values have same hash keys")
+	}
+	if (&Float{Value: 0}).HashKey() != (&Float{Value: math.Copysign(0, -1)}).HashKey() {
+		t.Errorf("0.0 and -0.0 have different hash keys")
+	}
+	if (&Float{Value: 1}).HashKey() == (&Integer{Value: 1}).HashKey() {
+		t.Errorf("FloatObject and IntegerObject have same hash keys")
+	}
+}
+
+func TestIntegerHashKeySignedness(t *testing.T) {
+	values := []int64{0, 1, -1, 2, -2, math.MaxInt64, math.MinInt64, math.MaxInt64 - 1, math.MinInt64 + 1}
+	seen := map[HashKey]int64{}
+	for _, v := range values {
+		key := (&Integer{Value: v}).HashKey()
+		if other, ok := seen[key]; ok {
+			t.Errorf("IntegerObjects %d and %d have same hash keys", other, v)
+		}
+		seen[key] = v
+	}
+	if (&Integer{Value: -1}).HashKey() != (&Integer{Value: -1}).HashKey() {
+		t.Errorf("IntegerObjects with same value have different hash keys")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{1.5, "1.5"},
+		{2, "2.0"},
+		{-0.25, "-0.25"},
+		{1234567.125, "1234567.125"},
+		{1e20, "100000000000000000000.0"},
+		{1e21, "1e+21"},
+		{0.000001, "0.000001"},
+		{1e-7, "1e-07"},
+		{0, "0.0"},
+	}
+
+	for _, tt := range tests {
+		if got := (&Float{Value: tt.value}).Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect for %v. want=%q, got=%q", tt.value, tt.expected, got)
+		}
+	}
+}
+
+func TestHashInspectIsDeterministic(t *testing.T) {
+	pairs := map[HashKey]HashPair{}
+	for _, key := range []Hashable{
+		&String{Value: "e"},
+		&String{Value: "b"},
+		&Integer{Value: 3},
+		&Boolean{Value: true},
+		&String{Value: "a"},
+	} {
+		pairs[key.HashKey()] = HashPair{Key: key.(Object), Value: &Integer{Value: 1}}
+	}
+	hash := &Hash{Pairs: pairs}
+
+	expected := "{3: 1, a: 1, b: 1, e: 1, true: 1}"
+	for i := 0; i < 20; i++ {
+		if got := hash.Inspect(); got != expected {
+			t.Fatalf("Inspect() wrong at run %d. want=%q, got=%q", i, expected, got)
+		}
+	}
+
+	// 文字列表現が同じキーは型の名前の順に並ぶ
+	mixed := map[HashKey]HashPair{}
+	for i, key := range []Hashable{
+		&Integer{Value: 1},
+		&String{Value: "1"},
+		&Boolean{Value: true},
+		&String{Value: "true"},
+		&Integer{Value: 2},
+		&String{Value: "2"},
+	} {
+		mixed[key.HashKey()] = HashPair{Key: key.(Object), Value: &Integer{Value: int64(i)}}
+	}
+	hash = &Hash{Pairs: mixed}
+
+	expected = "{1: 0, 1: 1, 2: 4, 2: 5, true: 2, true: 3}"
+	for i := 0; i < 200; i++ {
+		if got := hash.Inspect(); got != expected {
+			t.Fatalf("Inspect() wrong at run %d for mixed keys. want=%q, got=%q", i, expected, got)
+		}
+	}
+}
+
+func TestNewSet(t *testing.T) {
+	set, unusable := NewSet([]Object{
+		&Integer{Value: 2},
+		&String{Value: "a"},
+		&Integer{Value: 2},
+		&String{Value: "a"},
+		&Integer{Value: 1},
+	})
+	if unusable != nil {
+		t.Fatalf("NewSet returned unusable element %s", unusable.Inspect())
+	}
+	if len(set.Elements) != 3 {
+		t.Errorf("duplicate elements are not removed. got=%d elements", len(set.Elements))
+	}
+	if !set.Contains(&Integer{Value: 1}) || set.Contains(&Integer{Value: 3}) {
+		t.Errorf("Contains wrong for %s", set.Inspect())
+	}
+	if got := set.Inspect(); got != "#{1, 2, a}" {
+		t.Errorf("Inspect() wrong. want=%q, got=%q", "#{1, 2, a}", got)
+	}
+
+	array := &Array{}
+	if _, unusable := NewSet([]Object{&Integer{Value: 1}, array}); unusable != array {
+		t.Errorf("NewSet did not return the unusable element. got=%v", unusable)
+	}
+}
+
+// 同じ要素を同じ順に持つタプルだけが同じHashKeyになることをテスト
+func TestTupleHashKey(t *testing.T) {
+	tuple := func(elements ...Object) *Tuple { return &Tuple{Elements: elements} }
+	one := &Integer{Value: 1}
+	two := &Integer{Value: 2}
+	a := &String{Value: "a"}
+
+	if tuple(one, a).HashKey() != tuple(&Integer{Value: 1}, &String{Value: "a"}).HashKey() {
+		t.Errorf("tuples with same elements have different hash keys")
+	}
+	different := [][2]*Tuple{
+		{tuple(one, two), tuple(two, one)},
+		{tuple(one), tuple(one, one)},
+		{tuple(one), tuple(&Boolean{Value: true})},
+		{tuple(tuple(one, two)), tuple(one, two)},
+	}
+	for _, pair := range different {
+		if pair[0].HashKey() == pair[1].HashKey() {
+			t.Errorf("%s and %s have same hash keys", pair[0].Inspect(), pair[1].Inspect())
+		}
+	}
+	if tuple(one, a).HashKey() == one.HashKey() {
+		t.Errorf("tuple and integer have same hash keys")
+	}
+
+	if _, ok := AsHashable(tuple(one, tuple(a))); !ok {
+		t.Errorf("tuple of hashable elements is not hashable")
+	}
+	if _, ok := AsHashable(tuple(one, tuple(&Array{}))); ok {
+		t.Errorf("tuple containing an array is hashable")
+	}
+	if _, ok := AsHashable(&Array{}); ok {
+		t.Errorf("array is hashable")
+	}
+}
+
+func TestEquals(t *testing.T) {
+	array := func(elements ...Object) *Array { return &Array{Elements: elements} }
+	hash := func(pairs ...Object) *Hash {
+		h := &Hash{Pairs: map[HashKey]HashPair{}}
+		for i := 0; i < len(pairs); i += 2 {
+			h.Pairs[pairs[i].(Hashable).HashKey()] = HashPair{Key: pairs[i], Value: pairs[i+1]}
+		}
+		return h
+	}
+	one := &Integer{Value: 1}
+	a := &String{Value: "a"}
+	fn := &Builtin{}
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{one, &Integer{Value: 1}, true},
+		{one, &Float{Value: 1}, true},
+		{one, &String{Value: "1"}, false},
+		{a, &String{Value: "a"}, true},
+		{array(one, array(a)), array(&Integer{Value: 1}, array(&String{Value: "a"})), true},
+		{array(one, array(a)), array(one, array(one)), false},
+		{array(one), array(one, one), false},
+		{hash(a, one, one, array(a)), hash(one, array(a), a, one), true},
+		{hash(a, one), hash(a, &Integer{Value: 2}), false},
+		{hash(a, one), array(a, one), false},
+		{array(fn), array(fn), true},
+		{array(fn), array(&Builtin{}), false},
+	}
+
+	for _, tt := range tests {
+		if got := Equals(tt.a, tt.b); got != tt.expected {
+			t.Errorf("Equals(%s, %s) wrong. want=%t, got=%t", tt.a.Inspect(), tt.b.Inspect(), tt.expected, got)
+		}
+		if got := Equals(tt.b, tt.a); got != tt.expected {
+			t.Errorf("Equals(%s, %s) wrong. want=%t, got=%t", tt.b.Inspect(), tt.a.Inspect(), tt.expected, got)
+		}
+	}
+}
+
+// 組み込み関数の名前・添字・実体が相互に引けることをテスト
+func TestBuiltinLookupRoundTrip(t *testing.T) {
+	for i, def := range Builtins {
+		if got := GetBuiltinIndex(def.Name); got != i {
+			t.Errorf("GetBuiltinIndex(%q) wrong. want=%d, got=%d", def.Name, i, got)
+		}
+		if got := GetBuiltinByIndex(i); got != def.Builtin {
+			t.Errorf("GetBuiltinByIndex(%d) is not %q", i, def.Name)
+		}
+		if got := GetBuiltinByName(def.Name); got != def.Builtin {
+			t.Errorf("GetBuiltinByName(%q) is not Builtins[%d]", def.Name, i)
+		}
+	}
+
+	if got := GetBuiltinIndex("no_such_builtin"); got != -1 {
+		t.Errorf("GetBuiltinIndex for unknown name wrong. want=-1, got=%d", got)
+	}
+	if GetBuiltinByName("no_such_builtin") != nil {
+		t.Errorf("GetBuiltinByName for unknown name is not nil")
+	}
+	for _, i := range []int{-1, len(Builtins)} {
+		if GetBuiltinByIndex(i) != nil {
+			t.Errorf("GetBuiltinByIndex(%d) is not nil", i)
+		}
+	}
+}
+
+// Assignは名前を定義した環境の束縛を書き換え、未定義の名前には失敗することをテスト
+func TestEnvironmentAssign(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("n", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+
+	if !inner.Assign("n", &Integer{Value: 2}) {
+		t.Fatalf("Assign to n in the outer environment failed")
+	}
+	if _, ok := inner.store["n"]; ok {
+		t.Errorf("Assign created a binding in the inner environment")
+	}
+	if n, _ := outer.Get("n"); n.(*Integer).Value != 2 {
+		t.Errorf("outer n not updated. got=%s", n.Inspect())
+	}
+
+	// 内側で束縛し直した名前は内側の束縛が書き換わる
+	inner.Set("n", &Integer{Value: 10})
+	inner.Assign("n", &Integer{Value: 20})
+	if n, _ := outer.Get("n"); n.(*Integer).Value != 2 {
+		t.Errorf("outer n updated through a shadowing binding. got=%s", n.Inspect())
+	}
+	if n, _ := inner.Get("n"); n.(*Integer).Value != 20 {
+		t.Errorf("inner n not updated. got=%s", n.Inspect())
+	}
+
+	if inner.Assign("undefined", &Integer{Value: 1}) {
+		t.Errorf("Assign to an undefined name succeeded")
+	}
+	if _, ok := inner.Get("undefined"); ok {
+		t.Errorf("failed Assign created a binding")
+	}
+}
+
+// Keysは現在の環境の名前だけを返し、Allは外側の環境の名前も内側を優先して返すことをテスト
+func TestEnvironmentKeysAndAll(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("b", &Integer{Value: 1})
+	outer.Set("x", &Integer{Value: 2})
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("x", &Integer{Value: 10})
+	inner.SetConst("a", &Integer{Value: 20})
+
+	if keys := inner.Keys(); !reflect.DeepEqual(keys, []string{"a", "x"}) {
+		t.Errorf("inner.Keys() wrong. got=%v", keys)
+	}
+	if keys := outer.Keys(); !reflect.DeepEqual(keys, []string{"b", "x"}) {
+		t.Errorf("outer.Keys() wrong. got=%v", keys)
+	}
+	if keys := NewEnvironment().Keys(); len(keys) != 0 {
+		t.Errorf("Keys() of an empty environment not empty. got=%v", keys)
+	}
+
+	all := inner.All()
+	expected := map[string]int64{"a": 20, "b": 1, "x": 10}
+	if len(all) != len(expected) {
+		t.Fatalf("inner.All() has wrong number of names. want=%d, got=%d", len(expected), len(all))
+	}
+	for name, value := range expected {
+		obj, ok := all[name]
+		if !ok {
+			t.Errorf("inner.All() lacks %q", name)
+			continue
+		}
+		if obj.(*Integer).Value != value {
+			t.Errorf("inner.All()[%q] wrong. want=%d, got=%s", name, value, obj.Inspect())
+		}
+	}
+	if all := outer.All(); len(all) != 2 {
+		t.Errorf("outer.All() sees names of the inner environment. got=%v", all)
+	}
+}
+
+// 位置の分かるエラーは位置を付けて表示し、メッセージの行番号と重ならないことをテスト
+func TestErrorInspect(t *testing.T) {
+	tests := []struct {
+		err      *Error
+		expected string
+	}{
+		{&Error{Message: "type mismatch"}, "ERROR: type mismatch"},
+		{&Error{Message: "line 5: identifier not found: x", Line: 5, Column: 12}, "ERROR at line 5, col 12: identifier not found: x"},
+		{&Error{Message: "oops", Line: 2, Column: 3, File: "main.mk"}, "ERROR at main.mk, line 2, col 3: oops"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.err.Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
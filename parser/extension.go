@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/token"
+)
+
+// 組み込み先のプログラムがMonkeyを拡張して独自の構文を追加するためのAPI
+// token.RegisterKeywordで追加したキーワードなどのトークンに対して解析する関数を登録し、
+// 解析する関数の中では以下のメソッドを使ってトークンを読み進めたり式をパースしたりする
+
+// トークンが前置で出現した場合にそれを解析する関数を登録する
+// 既に登録されている場合は置き換える
+func (p *Parser) RegisterPrefix(tokenType token.TokenType, fn func() ast.Expression) {
+	p.registerPrefix(tokenType, fn)
+}
+
+// トークンが中置で出現した場合にそれを解析する関数を、その演算子の優先順位とともに登録する
+// fnには演算子の左にある式が渡される
+func (p *Parser) RegisterInfix(tokenType token.TokenType, precedence int, fn func(ast.Expression) ast.Expression) {
+	if p.extraPrecedences == nil {
+		p.extraPrecedences = make(map[token.TokenType]int)
+	}
+	p.extraPrecedences[tokenType] = precedence
+	p.registerInfix(tokenType, fn)
+}
+
+// 今見ているトークンを返す
+func (p *Parser) CurToken() token.Token {
+	return p.curToken
+}
+
+// 次に見るべきトークンを返す
+func (p *Parser) PeekToken() token.Token {
+	return p.peekToken
+}
+
+// 見るトークンを一つ進める
+func (p *Parser) NextToken() {
+	p.nextToken()
+}
+
+// 次のトークンがtであれば読み進めてtrueを返す
+// そうでなければエラーを記録してfalseを返す
+func (p *Parser) ExpectPeek(t token.TokenType) bool {
+	return p.expectPeek(t)
+}
+
+// 今見ているトークンから始まる式を、precedenceより強く結合する演算子までパースする
+// precedenceにはLOWESTやPREFIXなどの優先順位を渡す
+func (p *Parser) ParseExpression(precedence int) ast.Expression {
+	return p.parseExpression(precedence)
+}
+
+// 今見ている「{」から対応する「}」までをブロック文としてパースする
+func (p *Parser) ParseBlockStatement() *ast.BlockStatement {
+	return p.parseBlockStatement()
+}
+
+// 今見ているトークンの位置でパースエラーを記録する
+func (p *Parser) Errorf(format string, a ...interface{}) {
+	p.errorAt(p.curToken.Pos, format, a...)
+}
@@ -0,0 +1,139 @@
+package parser_test
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"testing"
+)
+
+const (
+	UNLESS token.TokenType = "UNLESS"
+	MOD    token.TokenType = "MOD"
+)
+
+// 独自のキーワードunlessとmodを登録し、テストが終わったら取り除く
+// キーワードはすべてのレキサに影響するので、他のテストの字句解析を変えないように必要なテストの中だけで登録する
+func registerKeywords(t *testing.T) {
+	t.Helper()
+	token.RegisterKeyword("unless", UNLESS)
+	token.RegisterKeyword("mod", MOD)
+	t.Cleanup(func() {
+		token.UnregisterKeyword("unless")
+		token.UnregisterKeyword("mod")
+	})
+}
+
+// unless (<condition>) { <consequence> } else { <alternative> } を
+// if (!<condition>) { <consequence> } else { <alternative> } としてパースする関数を登録したパーサを返す
+func newExtendedParser(input string) *parser.Parser {
+	p := parser.New(lexer.New(input))
+
+	p.RegisterPrefix(UNLESS, func() ast.Expression {
+		tok := p.CurToken()
+		if p.PeekToken().Type != token.LPAREN {
+			p.Errorf("expected ( after unless, got %s", p.PeekToken().Type)
+			return nil
+		}
+		p.NextToken()
+		p.NextToken()
+		condition := p.ParseExpression(parser.LOWEST)
+		if !p.ExpectPeek(token.RPAREN) || !p.ExpectPeek(token.LBRACE) {
+			return nil
+		}
+		expression := &ast.IfExpression{
+			Token:       tok,
+			Condition:   &ast.PrefixExpression{Token: tok, Operator: "!", Right: condition},
+			Consequence: p.ParseBlockStatement(),
+		}
+		if p.PeekToken().Type == token.ELSE {
+			p.NextToken()
+			if !p.ExpectPeek(token.LBRACE) {
+				return nil
+			}
+			expression.Alternative = p.ParseBlockStatement()
+		}
+		return expression
+	})
+
+	p.RegisterInfix(MOD, parser.PRODUCT, func(left ast.Expression) ast.Expression {
+		expression := &ast.InfixExpression{Token: p.CurToken(), Operator: "mod", Left: left}
+		p.NextToken()
+		expression.Right = p.ParseExpression(parser.PRODUCT)
+		return expression
+	})
+	return p
+}
+
+// 独自のキーワードを登録して、それを使ったプログラムをパースできることをテスト
+func TestRegisterKeyword(t *testing.T) {
+	registerKeywords(t)
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"unless (x > 1) { 10 } else { 20 }", "if(!(x > 1)) \n\t10\nelse \n\t20\n"},
+		{"let y = unless (x) { x };", "let y = if(!x) \n\tx\n;"},
+		{"1 + 10 mod 3 * 2", "(1 + ((10 mod 3) * 2))"},
+		{"unless (a mod 2 == 0) { a }", "if(!((a mod 2) == 0)) \n\ta\n"},
+	}
+
+	for _, tt := range tests {
+		p := newExtendedParser(tt.input)
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser has errors for %q: %v", tt.input, p.Errors())
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	if _, ok := newExtendedParserStatement(t, "unless (x) { 1 }").(*ast.IfExpression); !ok {
+		t.Errorf("unless is not parsed as ast.IfExpression")
+	}
+}
+
+// 独自の構文を解析する関数が報告したエラーが記録されることをテスト
+func TestRegisterKeywordErrors(t *testing.T) {
+	registerKeywords(t)
+	p := newExtendedParser("unless x { 1 }")
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) == 0 || errors[0].Error() != "[line 1, col 1] expected ( after unless, got IDENT" {
+		t.Fatalf("wrong errors. got=%v", errors)
+	}
+
+	// 登録していないパーサでは前置の解析関数がないというエラーになる
+	plain := parser.New(lexer.New("unless (x) { 1 }"))
+	plain.ParseProgram()
+	if len(plain.Errors()) == 0 || plain.Errors()[0].Error() != "[line 1, col 1] no prefix parse function for UNLESS found" {
+		t.Fatalf("wrong errors. got=%v", plain.Errors())
+	}
+}
+
+func newExtendedParserStatement(t *testing.T, input string) ast.Expression {
+	t.Helper()
+	p := newExtendedParser(input)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors for %q: %v", input, p.Errors())
+	}
+	return program.Statements[0].(*ast.ExpressionStatement).Expression
+}
+
+// 登録したキーワードがテストの終わりに取り除かれ、識別子に戻ることをテスト
+func TestUnregisterKeyword(t *testing.T) {
+	t.Run("registered", func(t *testing.T) {
+		registerKeywords(t)
+		if got := token.LookupIdent("unless"); got != UNLESS {
+			t.Errorf("unless is not a keyword. got=%s", got)
+		}
+	})
+	for _, word := range []string{"unless", "mod"} {
+		if got := token.LookupIdent(word); got != token.IDENT {
+			t.Errorf("%s is still a keyword. got=%s", word, got)
+		}
+	}
+}
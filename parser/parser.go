@@ -12,6 +12,9 @@ const (
 	// 優先順位の定義
 	_ int = iota
 	LOWEST
+	ASSIGN     // x = y
+	OR         // ||
+	AND        // &&
 	EQUALS     // ==
 	LESSGRATER // > or <
 	SUM        // +
@@ -23,35 +26,62 @@ const (
 
 // 優先順位テーブル
 var precedences = map[token.TokenType]int{
+	token.ASSIGN:   ASSIGN,
+	token.OR:       OR,
+	token.AND:      AND,
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGRATER,
 	token.GT:       LESSGRATER,
+	token.LT_EQ:    LESSGRATER,
+	token.GT_EQ:    LESSGRATER,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
+	token.PERCENT:  PRODUCT,
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
+	token.QUESTION: INDEX,
 }
 
 // パーサの定義
 type Parser struct {
 	l         *lexer.Lexer // 字句解析器を内部に含む
-	errors    []string     // エラー
+	errors    []ParseError // エラー
 	curToken  token.Token  // 今見ているトークン
 	peekToken token.Token  // 次見るべきトークン
 
 	// Pratt構文解析器のアイディアの核心
 	prefixParseFns map[token.TokenType]prefixParseFn // 特定の前置演算子トークンとそれを解析する関数のマップ
 	infixParseFns  map[token.TokenType]infixParseFn  // 特定の中置演算子トークンとそれを解析する関数のマップ
+
+	extraPrecedences map[token.TokenType]int // RegisterInfixで追加された中置演算子の優先順位
+
+	comments     []token.Token // まだどの文にも付けていないコメント
+	peekComments []token.Token // peekTokenの直前にあるコメント
+}
+
+// パーサーの設定を変更するオプション
+type Option func(*Parser)
+
+// コメントを読み飛ばさずにASTに保持するオプション
+// コメントはその直後の文のCommentsに、ブロックやプログラムの末尾にあるものはTrailingCommentsに付けられる
+func WithComments() Option {
+	return func(p *Parser) {
+		p.l.EmitComments()
+	}
 }
 
 // パーサーを生成する
-func New(l *lexer.Lexer) *Parser {
+func New(l *lexer.Lexer, opts ...Option) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []ParseError{},
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
 	p.nextToken()
 	p.nextToken()
@@ -59,78 +89,174 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.NULL, p.parseNullLiteral)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.SWITCH, p.parseSwitchExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.SET_LBRACE, p.parseSetLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.IMPORT, p.parseImportExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseDotExpression)
+	p.registerInfix(token.QUESTION, p.parsePropagateErrorExpression)
 	return p
 }
 
+// パース中に見つかったエラー
+// Line・Columnはエラーの原因になったトークンの位置
+type ParseError struct {
+	Message string
+	Line    int
+	Column  int
+}
+
+// 「[line N, col M] メッセージ」の形でエラーを返す
+func (e ParseError) Error() string {
+	return fmt.Sprintf("[line %d, col %d] %s", e.Line, e.Column, e.Message)
+}
+
 // エラーを返す
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []ParseError {
 	return p.errors
 }
 
+// 位置posで見つかったエラーを記録する
+func (p *Parser) errorAt(pos token.Pos, format string, a ...interface{}) {
+	p.errors = append(p.errors, ParseError{Message: fmt.Sprintf(format, a...), Line: pos.Line, Column: pos.Column})
+}
+
 // 次に来るべきトークンが来ていないならばエラーメッセージを追加
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
-		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.peekToken.Pos, "expected next token to be %s, got %s instead", t, p.peekToken.Type)
 }
 
 // 見るトークンを一つ進める
+// COMMENTトークンは読み飛ばし、次の文に付けるために取っておく
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
+	p.comments = append(p.comments, p.peekComments...)
+	p.peekComments = nil
 	p.peekToken = p.l.NextToken()
+	for p.peekToken.Type == token.COMMENT {
+		p.peekComments = append(p.peekComments, p.peekToken)
+		p.peekToken = p.l.NextToken()
+	}
+}
+
+// まだどの文にも付けていないコメントを取り出す
+func (p *Parser) takeComments() []token.Token {
+	comments := p.comments
+	p.comments = nil
+	return comments
 }
 
 // プログラムをパースしてProgram型のASTノードを返す
 func (p *Parser) ParseProgram() *ast.Program {
-	program := &ast.Program{}
+	program := &ast.Program{NodePos: p.curToken.Pos}
 	program.Statements = []ast.Statement{}
 
 	for p.curToken.Type != token.EOF { // EOF型のトークンに遭遇するまで
 
 		// 現在見ている文をパースした結果得られるStatement型のASTノードstmtを
 		// ノードprogramのStatementsフィールドに追加する
+		numErrors := len(p.errors)
 		stmt := p.parseStatement()
 
+		// エラーが起きた文は捨て、次の文の先頭からパースを続ける
+		if len(p.errors) > numErrors {
+			p.synchronize()
+			continue
+		}
+
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 		p.nextToken() // 調べるトークンを一つ進める
 	}
+	program.TrailingComments = p.takeComments()
 	return program // パースして得られたProgram型のASTノードを返す
 }
 
+// エラーが起きた文の残りを読み飛ばし、次の文の先頭までトークンを進める
+// 「;」の次か、文の始まりになるlet・return・if・fnのトークンを文の区切りとみなす
+// 一つのエラーから次々にエラーが起きるのを防ぎ、離れた箇所のエラーをまとめて報告できるようにする
+func (p *Parser) synchronize() {
+	for !p.curTokenIs(token.EOF) {
+		if p.curTokenIs(token.SEMICOLON) {
+			p.nextToken()
+			return
+		}
+		p.nextToken()
+		switch p.curToken.Type {
+		case token.LET, token.RETURN, token.IF, token.FUNCTION:
+			return
+		}
+	}
+}
+
 // 文をパースしてStatement型のASTノードを返す
+// 文の前にあるコメントはその文に付ける
 func (p *Parser) parseStatement() ast.Statement {
+	comments := p.takeComments()
+
+	var stmt ast.Statement
 	switch p.curToken.Type { // 現在見ているトークンのタイプによって処理が分かれる
 	case token.LET: // LET文: let <identifier> = <expression>;
-		return p.parseLetStatement()
+		if p.peekTokenIs(token.LBRACKET) { // let [<identifier>, ...] = <expression>;
+			stmt = p.parseDestructuringLetStatement()
+		} else {
+			stmt = p.parseLetStatement()
+		}
+	case token.CONST: // CONST文: const <identifier> = <expression>;
+		stmt = p.parseConstStatement()
 	case token.RETURN: // RETURN文: return <expression>;
-		return p.parseReturnStatement()
+		stmt = p.parseReturnStatement()
+	case token.FOR: // FOR文: for (<init>; <condition>; <post>) { <body> }
+		stmt = p.parseForStatement()
+	case token.WHILE: // WHILE文: while (<condition>) { <body> }
+		stmt = p.parseWhileStatement()
+	case token.BREAK: // BREAK文: break;
+		stmt = p.parseBreakStatement()
+	case token.CONTINUE: // CONTINUE文: continue;
+		stmt = p.parseContinueStatement()
+	case token.TRY: // TRY文: try { <try> } catch (<errName>) { <catch> }
+		stmt = p.parseTryCatchStatement()
+	case token.DEFER: // DEFER文: defer <call expression>;
+		stmt = p.parseDeferStatement()
 	default: // その他は式文
-		return p.parseExpressionStatement()
+		stmt = p.parseExpressionStatement()
 	}
+
+	if comments != nil {
+		ast.SetComments(stmt, comments)
+	}
+	return stmt
 }
 
 // LET文をパースしてLetStatement型のASTノードを返す
@@ -139,13 +265,13 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	// let x = 5;
 
 	// LetStatement型のASTノードを生成
-	stmt := &ast.LetStatement{Token: p.curToken}
+	stmt := &ast.LetStatement{Token: p.curToken, NodePos: p.curToken.Pos}
 
 	// 後続するトークンにアサーションを設けつつパースを進めていく
 	if !p.expectPeek(token.IDENT) { // let = 5;みたいなやつはだめ
 		return nil
 	}
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	stmt.Name = &ast.Identifier{Token: p.curToken, NodePos: p.curToken.Pos, Value: p.curToken.Literal}
 	if !p.expectPeek(token.ASSIGN) { // let x 5;みたいなやつはだめ
 		return nil
 	}
@@ -162,6 +288,74 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+// 配列を分割して束縛するLET文をパースしてDestructuringLetStatement型のASTノードを返す
+func (p *Parser) parseDestructuringLetStatement() *ast.DestructuringLetStatement {
+	// let [<identifier>, <identifier>, ...] = <expression>;
+	// let [x, y] = [1, 2];
+
+	// DestructuringLetStatement型のASTノードを生成
+	stmt := &ast.DestructuringLetStatement{Token: p.curToken, NodePos: p.curToken.Pos}
+	stmt.Names = []*ast.Identifier{}
+
+	// 「[」に進める
+	p.nextToken()
+
+	// コンマ区切りの識別子を「]」まで読む
+	if !p.peekTokenIs(token.RBRACKET) {
+		for {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			stmt.Names = append(stmt.Names, &ast.Identifier{Token: p.curToken, NodePos: p.curToken.Pos, Value: p.curToken.Literal})
+			if !p.peekTokenIs(token.COMMA) {
+				break
+			}
+			p.nextToken()
+		}
+	}
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// CONST文をパースしてConstStatement型のASTノードを返す
+func (p *Parser) parseConstStatement() *ast.ConstStatement {
+	// const <identifier> = <expression>;
+	// const x = 5;
+
+	// ConstStatement型のASTノードを生成
+	stmt := &ast.ConstStatement{Token: p.curToken, NodePos: p.curToken.Pos}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, NodePos: p.curToken.Pos, Value: p.curToken.Literal}
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 // 今見ているトークンのタイプをチェックするヘルパー関数
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
@@ -189,14 +383,14 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	// return 5;
 
 	// ReturnStatement型のASTノードを生成
-	stmt := &ast.ReturnStatement{Token: p.curToken}
+	stmt := &ast.ReturnStatement{Token: p.curToken, NodePos: p.curToken.Pos}
 
 	p.nextToken()
 
 	// returnに続くトークンをパースした結果得られるExpression型のASTノードをstmtのReturnValueとして追加
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	for !p.curTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
@@ -225,7 +419,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	// defer untrace(trace("parseExpressionStatement"))
 
 	// ExpressionStatement型のASTノードを生成
-	stmt := &ast.ExpressionStatement{Token: p.curToken}
+	stmt := &ast.ExpressionStatement{Token: p.curToken, NodePos: p.curToken.Pos}
 
 	stmt.Expression = p.parseExpression(LOWEST)
 
@@ -267,7 +461,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 // 識別子をパースしてExpression型のASTノードを返す
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return &ast.Identifier{Token: p.curToken, NodePos: p.curToken.Pos, Value: p.curToken.Literal}
 }
 
 // 整数リテラルをパースしてExpression型のASTノードを返す
@@ -275,16 +469,14 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	// defer untrace(trace("parseIntegerLiteral"))
 
 	// IntegerLiteral型のASTノードを生成
-	lit := &ast.IntegerLiteral{Token: p.curToken}
+	lit := &ast.IntegerLiteral{Token: p.curToken, NodePos: p.curToken.Pos}
 
 	// 今見ているトークンのリテラルが整数リテラルであることを確認する
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 
 	// 整数リテラルでなければエラーメッセージをパーサ内に記録したのちnilのExpression型ASTノードを返す
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer",
-			p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.curToken.Pos, "could not parse %q as integer", p.curToken.Literal)
 		return nil
 	}
 
@@ -293,10 +485,23 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// 浮動小数点数リテラルのトークンをパースしてExpression型のASTノードを返す
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken, NodePos: p.curToken.Pos}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.errorAt(p.curToken.Pos, "could not parse %q as float", p.curToken.Literal)
+		return nil
+	}
+
+	lit.Value = value
+	return lit
+}
+
 // 該当する前置演算子トークンに対してそれをパースする関数が紐づけられていなかった時にエラーメッセージを出力するヘルパー関数
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.curToken.Pos, "no prefix parse function for %s found", t)
 }
 
 // 前置演算子トークンをパースしてExpression型のASTノードを返す
@@ -306,6 +511,7 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	// PrefixExpression型のASTノードを生成
 	expression := &ast.PrefixExpression{
 		Token:    p.curToken,
+		NodePos:  p.curToken.Pos,
 		Operator: p.curToken.Literal,
 	}
 
@@ -320,15 +526,21 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 
 // 次に見るべきトークンの優先順位を返すヘルパー関数
 func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
-		return p
-	}
-	return LOWEST
+	return p.precedenceOf(p.peekToken.Type)
 }
 
 // 現在見ているトークンの優先順位を返すヘルパー関数
 func (p *Parser) currPrecedence() int {
-	if p, ok := precedences[p.curToken.Type]; ok {
+	return p.precedenceOf(p.curToken.Type)
+}
+
+// トークンタイプの優先順位を返すヘルパー関数
+// RegisterInfixで追加された中置演算子の優先順位を優先する
+func (p *Parser) precedenceOf(t token.TokenType) int {
+	if p, ok := p.extraPrecedences[t]; ok {
+		return p
+	}
+	if p, ok := precedences[t]; ok {
 		return p
 	}
 	return LOWEST
@@ -342,6 +554,7 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	// InfixExpression型のASTノードを生成する
 	expression := &ast.InfixExpression{
 		Token:    p.curToken,
+		NodePos:  p.curToken.Pos,
 		Operator: p.curToken.Literal,
 		Left:     left,
 	}
@@ -360,19 +573,64 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// 代入式をパースしてExpression型のASTノードを返す
+// 代入できるのは識別子だけ
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	// <identifier> = <expression>
+	// x = y = 5 は x = (y = 5) とパースする
+
+	name, ok := left.(*ast.Identifier)
+	if !ok {
+		p.errorAt(left.Position(), "cannot assign to %s", left.String())
+		return nil
+	}
+	expression := &ast.AssignExpression{Token: p.curToken, NodePos: p.curToken.Pos, Name: name}
+
+	p.nextToken()
+
+	// 右結合にするために、右辺は代入より一つ低い優先順位でパースする
+	expression.Value = p.parseExpression(ASSIGN - 1)
+
+	return expression
+}
+
 // Boolean型のトークンをパースしてExpression型のASTノードを返す
 func (p *Parser) parseBoolean() ast.Expression {
-	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+	return &ast.Boolean{Token: p.curToken, NodePos: p.curToken.Pos, Value: p.curTokenIs(token.TRUE)}
+}
+
+// NULL型のトークンをパースしてExpression型のASTノードを返す
+func (p *Parser) parseNullLiteral() ast.Expression {
+	return &ast.NullLiteral{Token: p.curToken, NodePos: p.curToken.Pos}
 }
 
 // 丸括弧でまとめられたトークンをパースしてExpression型のASTノードを返す
+// 括弧の中にコンマがあればタプルリテラルとしてパースする
+// (1,)のように末尾のコンマは省略できないので、要素が一つのタプルも書ける
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	tok := p.curToken
 	p.nextToken()
 	exp := p.parseExpression(LOWEST)
+	if !p.peekTokenIs(token.COMMA) {
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+		return exp
+	}
+
+	tuple := &ast.TupleLiteral{Token: tok, NodePos: tok.Pos, Elements: []ast.Expression{exp}}
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if p.peekTokenIs(token.RPAREN) {
+			break
+		}
+		p.nextToken()
+		tuple.Elements = append(tuple.Elements, p.parseExpression(LOWEST))
+	}
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
-	return exp
+	return tuple
 }
 
 // IF式をパースしてExpression型のASTノードを返す
@@ -382,7 +640,7 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	// let foobar = if (x > y) { x; } else { y; }
 
 	// IfExpression型のASTノードを生成
-	expression := &ast.IfExpression{Token: p.curToken}
+	expression := &ast.IfExpression{Token: p.curToken, NodePos: p.curToken.Pos}
 
 	// 「(」が来るはず
 	if !p.expectPeek(token.LPAREN) {
@@ -428,7 +686,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	// { statement1; statement2; ... }
 
 	// BlockStatement型のASTノードを生成
-	block := &ast.BlockStatement{Token: p.curToken}
+	block := &ast.BlockStatement{Token: p.curToken, NodePos: p.curToken.Pos}
 	block.Statements = []ast.Statement{}
 
 	p.nextToken()
@@ -441,16 +699,253 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	block.TrailingComments = p.takeComments()
 	return block
 }
 
+// SWITCH式をパースしてExpression型のASTノードを返す
+func (p *Parser) parseSwitchExpression() ast.Expression {
+	// switch <subject> { case <value>: <body> ... default: <body> }
+	// switch x { case 1: "one"; case 2: "two"; default: "many" }
+
+	// SwitchExpression型のASTノードを生成
+	expression := &ast.SwitchExpression{Token: p.curToken, NodePos: p.curToken.Pos}
+
+	p.nextToken()
+	expression.Subject = p.parseExpression(LOWEST)
+
+	// 「{」が来るはず
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	p.nextToken()
+
+	// 「}」に到達するまでcase節とdefault節をパースする
+	for !p.curTokenIs(token.RBRACE) {
+		switch p.curToken.Type {
+		case token.CASE:
+			clause := &ast.CaseClause{Token: p.curToken, NodePos: p.curToken.Pos}
+			p.nextToken()
+			clause.Value = p.parseExpression(LOWEST)
+			if !p.expectPeek(token.COLON) {
+				return nil
+			}
+			clause.Body = p.parseCaseBody()
+			expression.Cases = append(expression.Cases, clause)
+		case token.DEFAULT:
+			if expression.Default != nil {
+				p.errorAt(p.curToken.Pos, "multiple defaults in switch")
+				return nil
+			}
+			if !p.expectPeek(token.COLON) {
+				return nil
+			}
+			expression.Default = p.parseCaseBody()
+		default:
+			p.errorAt(p.curToken.Pos, "expected case or default in switch, got %s instead", p.curToken.Type)
+			return nil
+		}
+	}
+	return expression
+}
+
+// case節とdefault節の本体をパースしてBlockStatement型のASTノードを返す
+// 本体は「:」の次から、次のcase・default・「}」の手前までの文
+func (p *Parser) parseCaseBody() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.curToken, NodePos: p.curToken.Pos}
+	block.Statements = []ast.Statement{}
+
+	p.nextToken()
+
+	for !p.curTokenIs(token.CASE) && !p.curTokenIs(token.DEFAULT) && !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.nextToken()
+	}
+	return block
+}
+
+// FOR文をパースしてForStatement型のASTノードを返す
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	// for (<init>; <condition>; <post>) { <body> }
+	// for (let i = 0; i < 10; i = i + 1) { puts(i); }
+
+	// ForStatement型のASTノードを生成
+	stmt := &ast.ForStatement{Token: p.curToken, NodePos: p.curToken.Pos}
+
+	// 「(」が来るはず
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+
+	// Init部はLET文のみ。省略されていれば「;」が来る
+	if p.curTokenIs(token.LET) {
+		init := p.parseLetStatement()
+		if init == nil {
+			return nil
+		}
+		stmt.Init = init
+		// LET文の末尾の「;」は省略できない
+		if !p.curTokenIs(token.SEMICOLON) {
+			p.peekError(token.SEMICOLON)
+			return nil
+		}
+	} else if !p.curTokenIs(token.SEMICOLON) {
+		p.errorAt(p.curToken.Pos, "expected let statement or ; in for statement, got %s instead", p.curToken.Type)
+		return nil
+	}
+
+	// Condition部は省略できる
+	if !p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		stmt.Condition = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	// Post部は省略できる
+	if !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		stmt.Post = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	// 「{」が来るはず
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// WHILE文をパースしてWhileStatement型のASTノードを返す
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	// while (<condition>) { <body> }
+	// while (i < 10) { i = i + 1; }
+
+	// WhileStatement型のASTノードを生成
+	stmt := &ast.WhileStatement{Token: p.curToken, NodePos: p.curToken.Pos}
+
+	// 「(」が来るはず
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	// 「)」が来るはず
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	// 「{」が来るはず
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// TRY文をパースしてTryCatchStatement型のASTノードを返す
+func (p *Parser) parseTryCatchStatement() *ast.TryCatchStatement {
+	// try { <try> } catch (<errName>) { <catch> }
+	// try { 10 / x } catch (e) { puts(e); 0 }
+
+	// TryCatchStatement型のASTノードを生成
+	stmt := &ast.TryCatchStatement{Token: p.curToken, NodePos: p.curToken.Pos}
+
+	// 「{」が来るはず
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Try = p.parseBlockStatement()
+
+	// 「catch (<errName>)」が来るはず
+	if !p.expectPeek(token.CATCH) || !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.ErrName = &ast.Identifier{Token: p.curToken, NodePos: p.curToken.Pos, Value: p.curToken.Literal}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	// 「{」が来るはず
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Catch = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// DEFER文をパースしてDeferStatement型のASTノードを返す
+// 遅らせられるのは関数呼び出しだけなので、それ以外の式はエラーとする
+func (p *Parser) parseDeferStatement() *ast.DeferStatement {
+	// defer <call expression>;
+	// defer puts("done");
+
+	// DeferStatement型のASTノードを生成
+	stmt := &ast.DeferStatement{Token: p.curToken, NodePos: p.curToken.Pos}
+
+	p.nextToken()
+	pos := p.curToken.Pos
+	stmt.Call = p.parseExpression(LOWEST)
+	if stmt.Call == nil {
+		return nil
+	}
+	if _, ok := stmt.Call.(*ast.CallExpression); !ok {
+		p.errorAt(pos, "expression in defer must be function call, got %s", stmt.Call.String())
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// BREAK文をパースしてBreakStatement型のASTノードを返す
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken, NodePos: p.curToken.Pos}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// CONTINUE文をパースしてContinueStatement型のASTノードを返す
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken, NodePos: p.curToken.Pos}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
 // 関数リテラルをパースしてExpression型のASTノードを返す
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	// fn (<parameter1>, <parameter2>, ...) <block statement>;
 	// fn () <blocks tatement>;
 
 	// FunctionLiteral型のASTノードを生成
-	lit := &ast.FunctionLiteral{Token: p.curToken}
+	lit := &ast.FunctionLiteral{Token: p.curToken, NodePos: p.curToken.Pos}
 
 	// 「(」が来るはず
 	if !p.expectPeek(token.LPAREN) {
@@ -459,6 +954,9 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 
 	// 関数の引数リストをパースして得られるASTをFunctionLiteral型のASTノードlitのParametersフィールドに登録
 	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return nil
+	}
 
 	// 「{」が来るはず
 	if !p.expectPeek(token.LBRACE) {
@@ -471,6 +969,27 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
+// マクロリテラルをパースしてExpression型のASTノードを返す
+// 仮引数リストと本体の書き方は関数リテラルと同じ
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	// macro (<parameter1>, <parameter2>, ...) <block statement>;
+	lit := &ast.MacroLiteral{Token: p.curToken, NodePos: p.curToken.Pos}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
 // 関数リテラルの引数リストを解析してIdentifier型のASTノードのスライスを返すヘルパー関数
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 
@@ -486,7 +1005,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	p.nextToken()
 
 	// 一つ目の識別子に遭遇
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	ident := &ast.Identifier{Token: p.curToken, NodePos: p.curToken.Pos, Value: p.curToken.Literal}
 
 	// Identifier型のASTノードを生成したので追加
 	identifiers = append(identifiers, ident)
@@ -495,7 +1014,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		ident := &ast.Identifier{Token: p.curToken, NodePos: p.curToken.Pos, Value: p.curToken.Literal}
 		identifiers = append(identifiers, ident)
 	}
 
@@ -511,7 +1030,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 
 	// CallExpression型のASTノードを生成
-	exp := &ast.CallExpression{Token: p.curToken, Function: function}
+	exp := &ast.CallExpression{Token: p.curToken, NodePos: p.curToken.Pos, Function: function}
 
 	// expのArgumentsフィールドに実引数を格納する
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
@@ -553,19 +1072,45 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 
 // StringLiteral型のトークンを返す関数
 func (p *Parser) parseStringLiteral() ast.Expression {
-	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	return &ast.StringLiteral{Token: p.curToken, NodePos: p.curToken.Pos, Value: p.curToken.Literal}
 }
 
 // ArrayLiteral型のトークンを返す関数
 func (p *Parser) parseArrayLiteral() ast.Expression {
-	array := &ast.ArrayLiteral{Token: p.curToken}
-	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array := &ast.ArrayLiteral{Token: p.curToken, NodePos: p.curToken.Pos}
+	array.Elements = p.parseList(token.RBRACKET, p.parseArrayElement)
 	return array
 }
 
+// SetLiteral型のトークンを返す関数
+func (p *Parser) parseSetLiteral() ast.Expression {
+	set := &ast.SetLiteral{Token: p.curToken, NodePos: p.curToken.Pos}
+	set.Elements = p.parseList(token.RBRACE, func() ast.Expression {
+		return p.parseExpression(LOWEST)
+	})
+	return set
+}
+
+// 配列リテラルの要素をパースする
+// 要素には「...」で始まるスプレッド要素も書ける
+func (p *Parser) parseArrayElement() ast.Expression {
+	if !p.curTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
+	}
+	spread := &ast.SpreadElement{Token: p.curToken, NodePos: p.curToken.Pos}
+	p.nextToken()
+	spread.Expression = p.parseExpression(LOWEST)
+	return spread
+}
+
 // カンマ区切りのリストをパースして[]ast.Expressionを返すヘルパー関数
 // parseCallArgumentsメソッドの一般化
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	return p.parseList(end, func() ast.Expression { return p.parseExpression(LOWEST) })
+}
+
+// カンマ区切りのリストを、各要素をparseElementでパースしながらendまで読む
+func (p *Parser) parseList(end token.TokenType, parseElement func() ast.Expression) []ast.Expression {
 
 	// 返すべき実引数リストを表現するExpression型のASTノードのスライスを用意
 	list := []ast.Expression{}
@@ -577,13 +1122,13 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 		return list
 	}
 	p.nextToken()
-	list = append(list, p.parseExpression(LOWEST))
+	list = append(list, parseElement())
 
 	// コンマに遭遇するごとに同じことを繰り返す
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		list = append(list, p.parseExpression(LOWEST))
+		list = append(list, parseElement())
 	}
 
 	// 閉じるはず
@@ -593,11 +1138,76 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return list
 }
 
+// プロパティアクセスhash.keyをパースしてExpression型のASTノードを返す関数
+// hash["key"]の糖衣構文なので、文字列を添字とするIndexExpressionを返す
+// a.b.cは(a.b).cと左結合にパースされる
+func (p *Parser) parseDotExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	key := &ast.StringLiteral{
+		Token:   token.Token{Type: token.STRING, Literal: p.curToken.Literal, Pos: p.curToken.Pos},
+		NodePos: p.curToken.Pos,
+		Value:   p.curToken.Literal,
+	}
+	return &ast.IndexExpression{Token: tok, NodePos: tok.Pos, Left: left, Index: key}
+}
+
+// IMPORT式をパースしてExpression型のASTノードを返す関数
+// import "io"の値は読み込んだモジュールなので、let io = import "io";のように束縛できる
+func (p *Parser) parseImportExpression() ast.Expression {
+	expression := &ast.ImportExpression{Token: p.curToken, NodePos: p.curToken.Pos}
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	expression.Path = &ast.StringLiteral{Token: p.curToken, NodePos: p.curToken.Pos, Value: p.curToken.Literal}
+	return expression
+}
+
+// 後置演算子?をパースしてExpression型のASTノードを返す関数
+// 添字演算子と同じ優先順位で左の式に結び付くので、f(x)? + 1は(f(x)?) + 1とパースされる
+func (p *Parser) parsePropagateErrorExpression(left ast.Expression) ast.Expression {
+	return &ast.PropagateErrorExpression{Token: p.curToken, NodePos: p.curToken.Pos, Inner: left}
+}
+
 // 添字演算子[をパースしてExpression型のASTノードを返す関数
+// [の内側に:が現れた場合はスライス式としてパースする
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	tok := p.curToken
+
+	// arr[:high] や arr[:] の時
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(tok, left, nil)
+	}
+
+	exp := &ast.IndexExpression{Token: tok, NodePos: tok.Pos, Left: left}
 	p.nextToken()
 	exp.Index = p.parseExpression(LOWEST)
+
+	// arr[low:high] や arr[low:] の時
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(tok, left, exp.Index)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return exp
+}
+
+// 今見ているトークンが:であるときに、スライス式の残りをパースしてExpression型のASTノードを返す関数
+func (p *Parser) parseSliceExpression(tok token.Token, left, low ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, NodePos: tok.Pos, Left: left, Low: low}
+
+	// 上限が省略されていなければパースする
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.High = p.parseExpression(LOWEST)
+	}
+
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
@@ -606,7 +1216,7 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 
 // ハッシュリテラルをパースしてExpression型のASTノードを返す関数
 func (p *Parser) parseHashLiteral() ast.Expression {
-	hash := &ast.HashLiteral{Token: p.curToken}
+	hash := &ast.HashLiteral{Token: p.curToken, NodePos: p.curToken.Pos}
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
@@ -617,6 +1227,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
 		}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"monkey/token"
 	"testing"
 )
 
@@ -102,8 +103,8 @@ func checkParserErrors(t *testing.T, p *Parser) {
 
 	// 各情報を出力
 	t.Errorf("parser has %d errors", len(errors))
-	for _, msg := range errors {
-		t.Errorf("parser error: %q", msg)
+	for _, err := range errors {
+		t.Errorf("parser error: %q", err.Error())
 	}
 	t.FailNow()
 }
@@ -157,7 +158,607 @@ return 993322;
 	}
 }
 
+// セミコロンのないRETURN文の後続の文が読み飛ばされないことをテスト
+func TestReturnStatementWithoutSemicolon(t *testing.T) {
+	input := `if (x) { return 1 } y`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+	if len(exp.Consequence.Statements) != 1 {
+		t.Fatalf("consequence is not 1 statements. got=%d", len(exp.Consequence.Statements))
+	}
+	if _, ok := exp.Consequence.Statements[0].(*ast.ReturnStatement); !ok {
+		t.Fatalf("consequence.Statements[0] is not ast.ReturnStatement. got=%T", exp.Consequence.Statements[0])
+	}
+	stmt, ok = program.Statements[1].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[1] is not ast.ExpressionStatement. got=%T", program.Statements[1])
+	}
+	testIdentifier(t, stmt.Expression, "y")
+}
+
+// SWITCH式のパースをテスト
+func TestSwitchExpression(t *testing.T) {
+	input := `switch x { case 1: a; b case y + 1: default: let z = 2; z }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.SwitchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.SwitchExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, exp.Subject, "x") {
+		return
+	}
+	if len(exp.Cases) != 2 {
+		t.Fatalf("switch does not have 2 cases. got=%d", len(exp.Cases))
+	}
+
+	if !testLiteralExpression(t, exp.Cases[0].Value, 1) {
+		return
+	}
+	if len(exp.Cases[0].Body.Statements) != 2 {
+		t.Fatalf("cases[0] is not 2 statements. got=%d", len(exp.Cases[0].Body.Statements))
+	}
+	testIdentifier(t, exp.Cases[0].Body.Statements[1].(*ast.ExpressionStatement).Expression, "b")
+
+	if !testInfixExpression(t, exp.Cases[1].Value, "y", "+", 1) {
+		return
+	}
+	if len(exp.Cases[1].Body.Statements) != 0 {
+		t.Fatalf("cases[1] is not empty. got=%d statements", len(exp.Cases[1].Body.Statements))
+	}
+
+	if exp.Default == nil || len(exp.Default.Statements) != 2 {
+		t.Fatalf("default is not 2 statements. got=%+v", exp.Default)
+	}
+	testLetStatement(t, exp.Default.Statements[0], "z")
+
+	// default節は省略でき、switch式は他の式の中にも書ける
+	l = lexer.New(`let a = switch (x) { case 1: 2 };`)
+	p = New(l)
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+	let := program.Statements[0].(*ast.LetStatement)
+	exp, ok = let.Value.(*ast.SwitchExpression)
+	if !ok {
+		t.Fatalf("let.Value is not ast.SwitchExpression. got=%T", let.Value)
+	}
+	if len(exp.Cases) != 1 || exp.Default != nil {
+		t.Fatalf("wrong switch. got=%s", exp.String())
+	}
+}
+
+// 不正なSWITCH式に対してエラーが報告されることをテスト
+func TestSwitchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"switch x case 1: 2", "[line 1, col 10] expected next token to be {, got CASE instead"},
+		{"switch x { 1 }", "[line 1, col 12] expected case or default in switch, got INT instead"},
+		{"switch x { case 1 2 }", "[line 1, col 19] expected next token to be :, got INT instead"},
+		{"switch x { default 1 }", "[line 1, col 20] expected next token to be :, got INT instead"},
+		{"switch x { default: 1 default: 2 }", "[line 1, col 23] multiple defaults in switch"},
+		{"switch x { case 1: 2", "[line 1, col 21] expected case or default in switch, got EOF instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("%q: expected parser errors, got none", tt.input)
+			continue
+		}
+		if errors[0].Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+// FOR文のパースをテスト
+func TestForStatement(t *testing.T) {
+	input := `for (let i = 0; i < 10; puts(i)) { let i = i + 1; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T", program.Statements[0])
+	}
+	if !testLetStatement(t, stmt.Init, "i") {
+		return
+	}
+	if !testInfixExpression(t, stmt.Condition, "i", "<", 10) {
+		return
+	}
+	post, ok := stmt.Post.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Post is not ast.CallExpression. got=%T", stmt.Post)
+	}
+	if !testIdentifier(t, post.Function, "puts") {
+		return
+	}
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("body is not 1 statement. got=%d", len(stmt.Body.Statements))
+	}
+	testLetStatement(t, stmt.Body.Statements[0], "i")
+}
+
+// 省略可能な部分を省略したFOR文のパースをテスト
+func TestForStatementOmittingClauses(t *testing.T) {
+	tests := []struct {
+		input         string
+		hasInit       bool
+		hasCondition  bool
+		hasPost       bool
+		numStatements int
+	}{
+		{"for (;;) {}", false, false, false, 0},
+		{"for (let i = 0;;) { i }", true, false, false, 1},
+		{"for (; x;) { x; y }", false, true, false, 2},
+		{"for (;; x) {};", false, false, true, 0},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: program.Statements does not contain 1 statement. got=%d", tt.input, len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("%q: program.Statements[0] is not ast.ForStatement. got=%T", tt.input, program.Statements[0])
+		}
+		if (stmt.Init != nil) != tt.hasInit || (stmt.Condition != nil) != tt.hasCondition || (stmt.Post != nil) != tt.hasPost {
+			t.Errorf("%q: wrong clauses. init=%v, condition=%v, post=%v", tt.input, stmt.Init, stmt.Condition, stmt.Post)
+		}
+		if len(stmt.Body.Statements) != tt.numStatements {
+			t.Errorf("%q: body is not %d statements. got=%d", tt.input, tt.numStatements, len(stmt.Body.Statements))
+		}
+	}
+}
+
+// 不正なFOR文に対してエラーが報告されることをテスト
+func TestForStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for let i = 0; i; i) {}", "[line 1, col 5] expected next token to be (, got LET instead"},
+		{"for (i; i; i) {}", "[line 1, col 6] expected let statement or ; in for statement, got IDENT instead"},
+		{"for (let i = 0 i; i) {}", "[line 1, col 16] expected next token to be ;, got IDENT instead"},
+		{"for (;; i {}", "[line 1, col 11] expected next token to be ), got { instead"},
+		{"for (;;) i", "[line 1, col 10] expected next token to be {, got IDENT instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("%q: expected parser errors, got none", tt.input)
+			continue
+		}
+		if errors[0].Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+// ハッシュリテラルの文字列表現がソース上のキーの順序で毎回同じになることをテスト
+// WHILE文とbreak文・continue文のパースをテスト
+func TestTryCatchStatement(t *testing.T) {
+	input := `try { x / y } catch (err) { err; 0 }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.TryCatchStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.TryCatchStatement. got=%T", program.Statements[0])
+	}
+	if len(stmt.Try.Statements) != 1 {
+		t.Fatalf("try block is not 1 statement. got=%d", len(stmt.Try.Statements))
+	}
+	if !testInfixExpression(t, stmt.Try.Statements[0].(*ast.ExpressionStatement).Expression, "x", "/", "y") {
+		return
+	}
+	if stmt.ErrName.Value != "err" {
+		t.Errorf("stmt.ErrName.Value not %q. got=%q", "err", stmt.ErrName.Value)
+	}
+	if len(stmt.Catch.Statements) != 2 {
+		t.Fatalf("catch block is not 2 statements. got=%d", len(stmt.Catch.Statements))
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"try x catch (e) { }", "[line 1, col 5] expected next token to be {, got IDENT instead"},
+		{"try { } (e) { }", "[line 1, col 9] expected next token to be CATCH, got ( instead"},
+		{"try { } catch e { }", "[line 1, col 15] expected next token to be (, got IDENT instead"},
+		{"try { } catch (1) { }", "[line 1, col 16] expected next token to be IDENT, got INT instead"},
+		{"try { } catch (e) e", "[line 1, col 19] expected next token to be {, got IDENT instead"},
+	}
+
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("%q: expected parser errors, got none", tt.input)
+			continue
+		}
+		if errors[0].Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+// IMPORT式のパースをテスト
+func TestImportExpression(t *testing.T) {
+	p := New(lexer.New(`let io = import "io";`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+	}
+	imp, ok := stmt.Value.(*ast.ImportExpression)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.ImportExpression. got=%T", stmt.Value)
+	}
+	if imp.Path.Value != "io" {
+		t.Errorf("imp.Path.Value is not %q. got=%q", "io", imp.Path.Value)
+	}
+	if got := stmt.String(); got != `let io = import "io";` {
+		t.Errorf("wrong String(). got=%q", got)
+	}
+
+	// importの結果にもプロパティアクセスや呼び出しを続けられる
+	p = New(lexer.New(`import "io".puts(1)`))
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+	if got := program.String(); got != `(import "io"[puts])(1)` {
+		t.Errorf("wrong String(). got=%q", got)
+	}
+
+	p = New(lexer.New("import io"))
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+	if expected := "[line 1, col 8] expected next token to be STRING, got IDENT instead"; errors[0].Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, errors[0])
+	}
+}
+
+// DEFER文のパースをテスト
+func TestDeferStatement(t *testing.T) {
+	p := New(lexer.New(`defer puts("done");`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.DeferStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.DeferStatement. got=%T", program.Statements[0])
+	}
+	call, ok := stmt.Call.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Call is not ast.CallExpression. got=%T", stmt.Call)
+	}
+	if !testIdentifier(t, call.Function, "puts") {
+		return
+	}
+	if got := stmt.String(); got != "defer puts(done);" {
+		t.Errorf("wrong String(). got=%q", got)
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"defer x + 1", "[line 1, col 7] expression in defer must be function call, got (x + 1)"},
+		{"defer;", "[line 1, col 6] no prefix parse function for ; found"},
+	}
+
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("%q: expected parser errors, got none", tt.input)
+			continue
+		}
+		if errors[0].Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { if (x == 5) { break; } continue }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T", program.Statements[0])
+	}
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("body is not 2 statements. got=%d", len(stmt.Body.Statements))
+	}
+	ifExp := stmt.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if _, ok := ifExp.Consequence.Statements[0].(*ast.BreakStatement); !ok {
+		t.Errorf("consequence is not ast.BreakStatement. got=%T", ifExp.Consequence.Statements[0])
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Errorf("body.Statements[1] is not ast.ContinueStatement. got=%T", stmt.Body.Statements[1])
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"while x { }", "[line 1, col 7] expected next token to be (, got IDENT instead"},
+		{"while (x { }", "[line 1, col 10] expected next token to be ), got { instead"},
+		{"while (x) x", "[line 1, col 11] expected next token to be {, got IDENT instead"},
+	}
+
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("%q: expected parser errors, got none", tt.input)
+			continue
+		}
+		if errors[0].Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestHashLiteralStringIsDeterministic(t *testing.T) {
+	input := `{"e": 5, "b": 2, 3: "three", true: false, "a": 1 + 1}`
+	expected := "{e: 5, b: 2, 3: three, true: false, a: (1 + 1)}"
+
+	for i := 0; i < 20; i++ {
+		l := lexer.New(input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if got := program.String(); got != expected {
+			t.Fatalf("String() wrong at run %d. want=%q, got=%q", i, expected, got)
+		}
+	}
+}
+
 // 式文としての識別子のパースをテスト
+// 配列を分割して束縛するLet文のパースをテスト
+func TestDestructuringLetStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedNames []string
+		expected      string
+	}{
+		{"let [x, y] = [1, 2];", []string{"x", "y"}, "let [x, y] = [1, 2];"},
+		{"let [a] = f(1)", []string{"a"}, "let [a] = f(1);"},
+		{"let [] = arr", []string{}, "let [] = arr;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.DestructuringLetStatement)
+		if !ok {
+			t.Fatalf("stmt is not *ast.DestructuringLetStatement. got=%T", program.Statements[0])
+		}
+		if len(stmt.Names) != len(tt.expectedNames) {
+			t.Fatalf("wrong number of names. want=%d, got=%d", len(tt.expectedNames), len(stmt.Names))
+		}
+		for i, name := range tt.expectedNames {
+			testIdentifier(t, stmt.Names[i], name)
+		}
+		if got := stmt.String(); got != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, got)
+		}
+	}
+
+	errors := map[string]string{
+		"let [x, 1] = y": "[line 1, col 9] expected next token to be IDENT, got INT instead",
+		"let [x, y = z":  "[line 1, col 11] expected next token to be ], got = instead",
+		"let [x] y":      "[line 1, col 9] expected next token to be =, got IDENT instead",
+	}
+	for input, expected := range errors {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0].Error() != expected {
+			t.Errorf("wrong parser errors for %q. want=%q, got=%v", input, expected, p.Errors())
+		}
+	}
+}
+
+// Const文のパースをテスト
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      interface{}
+	}{
+		{"const x = 5;", "x", 5},
+		{"const y = true", "y", true},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ConstStatement)
+		if !ok {
+			t.Fatalf("stmt is not *ast.ConstStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Name.Value != tt.expectedIdentifier {
+			t.Errorf("stmt.Name.Value not %q. got=%q", tt.expectedIdentifier, stmt.Name.Value)
+		}
+		testLiteralExpression(t, stmt.Value, tt.expectedValue)
+	}
+}
+
+// 代入式のパースをテスト
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5", "(x = 5)"},
+		{"x = y = 5", "(x = (y = 5))"},
+		{"x = a + b * c", "(x = (a + (b * c)))"},
+		{"let x = y = f(1)", "let x = (y = f(1));"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if got := program.String(); got != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, got)
+		}
+	}
+
+	p := New(lexer.New("1 = 2"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 || p.Errors()[0].Error() != "[line 1, col 1] cannot assign to 1" {
+		t.Errorf("wrong parser errors for assignment to a literal. got=%v", p.Errors())
+	}
+}
+
+// WithComments()を指定したときにコメントが直後の文に付くことをテスト
+func TestComments(t *testing.T) {
+	input := `// header
+let x = 1; // after x
+if (x) {
+	// inside
+	x
+	// end of block
+}
+// end of file`
+
+	l := lexer.New(input)
+	p := New(l, WithComments())
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	ifExp := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	tests := []struct {
+		comments []token.Token
+		expected []string
+	}{
+		{ast.Comments(program.Statements[0]), []string{"// header"}},
+		{ast.Comments(program.Statements[1]), []string{"// after x"}},
+		{ast.Comments(ifExp.Consequence.Statements[0]), []string{"// inside"}},
+		{ifExp.Consequence.TrailingComments, []string{"// end of block"}},
+		{program.TrailingComments, []string{"// end of file"}},
+	}
+
+	for i, tt := range tests {
+		if len(tt.comments) != len(tt.expected) {
+			t.Errorf("tests[%d] - wrong number of comments. want=%v, got=%v", i, tt.expected, tt.comments)
+			continue
+		}
+		for j, c := range tt.comments {
+			if c.Type != token.COMMENT || c.Literal != tt.expected[j] {
+				t.Errorf("tests[%d] - wrong comment. want=%q, got=%q %q", i, tt.expected[j], c.Type, c.Literal)
+			}
+		}
+	}
+
+	// 指定しなければコメントは読み飛ばされる
+	program = New(lexer.New(input)).ParseProgram()
+	if len(program.Statements) != 2 || ast.Comments(program.Statements[0]) != nil || program.TrailingComments != nil {
+		t.Errorf("comments must be skipped without WithComments. got=%+v", program)
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
 
@@ -256,6 +857,29 @@ func TestIntegerLiteralExpression(t *testing.T) {
 }
 
 // 前置演算子式のASTノードのパースをテスト
+// 浮動小数点数リテラルのパースをテスト
+func TestFloatLiteralExpression(t *testing.T) {
+	l := lexer.New("3.25;")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != 3.25 {
+		t.Errorf("literal.Value not %v. got=%v", 3.25, literal.Value)
+	}
+	if literal.TokenLiteral() != "3.25" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "3.25", literal.TokenLiteral())
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 
 	// テストセットを定義
@@ -376,6 +1000,7 @@ func TestParsingInfixExpression(t *testing.T) {
 		{"5 - 5", 5, "-", 5},
 		{"5 * 5", 5, "*", 5},
 		{"5 / 5", 5, "/", 5},
+		{"5 % 5", 5, "%", 5},
 		{"5 > 5", 5, ">", 5},
 		{"5 < 5", 5, "<", 5},
 		{"5 == 5", 5, "==", 5},
@@ -453,6 +1078,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a + b / c",
 			"(a + (b / c))",
 		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
 		{
 			"a + b * c + d / e - f",
 			"(((a + (b * c)) + (d / e)) - f)",
@@ -533,6 +1162,22 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a || b && c || d",
+			"((a || (b && c)) || d)",
+		},
+		{
+			"a < b && !c == d || e",
+			"(((a < b) && ((!c) == d)) || e)",
+		},
+		{
+			"x = a || b",
+			"(x = (a || b))",
+		},
+		{
+			"a + b <= c * d == e >= f",
+			"(((a + b) <= (c * d)) == (e >= f))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -887,6 +1532,48 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+// マクロリテラルを正しくパースできているかをテスト
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statement. got=%d\n",
+			1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statement. got=%d\n",
+			len(macro.Body.Statements))
+	}
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
 // 関数の引数リストを正しくパースできているかをテスト
 func TestFunctionParameterParsing(t *testing.T) {
 
@@ -1068,6 +1755,97 @@ func TestStringLiteralExpression(t *testing.T) {
 }
 
 // 配列リテラルを正しくパースできるかをテスト
+// スプレッド要素を含む配列リテラルのパースをテスト
+func TestParsingSpreadElements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, ...rest, 4]", "[1, ...rest, 4]"},
+		{"[...a, ...f(b + c)]", "[...a, ...f((b + c))]"},
+		{"[...[1, 2]]", "[...[1, 2]]"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if got := program.String(); got != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, got)
+		}
+	}
+
+	// スプレッド要素は配列リテラルの中にしか書けない
+	for _, input := range []string{"f(...a)", "...a"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0].Message != "no prefix parse function for ... found" {
+			t.Errorf("wrong parser errors for %q. got=%v", input, p.Errors())
+		}
+	}
+}
+
+// 括弧の中にコンマがある場合だけタプルリテラルになることをテスト
+func TestParsingTupleLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		isTuple  bool
+	}{
+		{"(1, 2 * 2, a)", "(1, (2 * 2), a)", true},
+		{"(1,)", "(1,)", true},
+		{"(1, 2,)", "(1, 2)", true},
+		{"((1, 2), (3,))", "((1, 2), (3,))", true},
+		{"(1)", "1", false},
+		{"(1 + 2) * 3", "((1 + 2) * 3)", false},
+		{"f((1, 2), 3)", "f((1, 2), 3)", false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if _, ok := stmt.Expression.(*ast.TupleLiteral); ok != tt.isTuple {
+			t.Errorf("wrong node for %q. got=%T", tt.input, stmt.Expression)
+		}
+		if stmt.Expression.String() != tt.expected {
+			t.Errorf("wrong String() for %q. expected=%q, got=%q", tt.input, tt.expected, stmt.Expression.String())
+		}
+	}
+}
+
+func TestParsingSetLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"#{1, 2 * 2, 3 + 3}", "#{1, (2 * 2), (3 + 3)}"},
+		{"#{}", "#{}"},
+		{"#{a, #{b}}", "#{a, #{b}}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		set, ok := stmt.Expression.(*ast.SetLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.SetLiteral. got=%T", stmt.Expression)
+		}
+		if set.String() != tt.expected {
+			t.Errorf("set.String() wrong. expected=%q, got=%q", tt.expected, set.String())
+		}
+	}
+}
+
 func TestParsingArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -1127,6 +1905,136 @@ func TestParsingIndexExpression(t *testing.T) {
 	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
 		return
 	}
+
+	// hash.keyはhash["key"]としてパースされる
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"myHash.name", `myHash["name"]`},
+		{"a.b.c", `a["b"]["c"]`},
+		{"a.b[0].c(1)", `a["b"][0]["c"](1)`},
+		{"-a.b * c.d", `-a["b"] * c["d"]`},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if got := ast.Format(program.Statements[0]); got != tt.expected+";" {
+			t.Errorf("wrong AST for %q. want=%q, got=%q", tt.input, tt.expected+";", got)
+		}
+	}
+
+	chained := New(lexer.New("a.b.c")).ParseProgram().Statements[0].(*ast.ExpressionStatement).Expression
+	outer, ok := chained.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not ast.IndexExpression. got=%T", chained)
+	}
+	if _, ok := outer.Left.(*ast.IndexExpression); !ok {
+		t.Errorf("a.b.c is not parsed as (a.b).c. got=%s", outer.String())
+	}
+	if key, ok := outer.Index.(*ast.StringLiteral); !ok || key.Value != "c" {
+		t.Errorf("wrong index of a.b.c. got=%s", outer.Index.String())
+	}
+
+	p = New(lexer.New("a.1"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 || p.Errors()[0].Error() != "[line 1, col 3] expected next token to be IDENT, got INT instead" {
+		t.Errorf("wrong parser errors for a.1. got=%v", p.Errors())
+	}
+}
+
+// 後置演算子?を正しくパースできるかをテスト
+func TestParsingPropagateErrorExpression(t *testing.T) {
+	p := New(lexer.New("parse(x)?"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.PropagateErrorExpression)
+	if !ok {
+		t.Fatalf("exp not ast.PropagateErrorExpression. got=%T", stmt.Expression)
+	}
+	if _, ok := exp.Inner.(*ast.CallExpression); !ok {
+		t.Errorf("exp.Inner not ast.CallExpression. got=%T", exp.Inner)
+	}
+	if pos := exp.Position(); pos.Line != 1 || pos.Column != 9 {
+		t.Errorf("wrong position. got=%+v", exp.Position())
+	}
+
+	// ?は添字演算子と同じ優先順位で左の式に結び付く
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"f(x)? + 1", "((f(x)?) + 1)"},
+		{"-a?", "(-(a?))"},
+		{"a[0]?.b", "(((a[0])?)[b])"},
+		{"f()??", "((f()?)?)"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("wrong AST for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// SliceExpressionを正しくパースできるかをテスト
+func TestParsingSliceExpression(t *testing.T) {
+
+	// テストケース
+	// 上限・下限はそれぞれ省略可能で、省略された場合はnilになる
+	tests := []struct {
+		input    string
+		low      interface{}
+		high     interface{}
+		expected string
+	}{
+		{"myArray[1:3]", 1, 3, "(myArray[1:3])"},
+		{"myArray[:2]", nil, 2, "(myArray[:2])"},
+		{"myArray[2:]", 2, nil, "(myArray[2:])"},
+		{"myArray[:]", nil, nil, "(myArray[:])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		// 正しい型のASTノードが得られたかを確認
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+		sliceExp, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("exp not ast.SliceExpression. got=%T", stmt.Expression)
+		}
+		if !testIdentifier(t, sliceExp.Left, "myArray") {
+			return
+		}
+		if tt.low == nil {
+			if sliceExp.Low != nil {
+				t.Errorf("sliceExp.Low is not nil. got=%s", sliceExp.Low)
+			}
+		} else if !testLiteralExpression(t, sliceExp.Low, tt.low) {
+			return
+		}
+		if tt.high == nil {
+			if sliceExp.High != nil {
+				t.Errorf("sliceExp.High is not nil. got=%s", sliceExp.High)
+			}
+		} else if !testLiteralExpression(t, sliceExp.High, tt.high) {
+			return
+		}
+		if sliceExp.String() != tt.expected {
+			t.Errorf("sliceExp.String() wrong. expected=%q, got=%q", tt.expected, sliceExp.String())
+		}
+	}
 }
 
 // 文字列キーのハッシュリテラルを正しくパースできるかのテスト
@@ -1253,3 +2161,92 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+// ASTノードにトークンの位置が付くことをテスト
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+add(1, 2)[0]`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	fn := let.Value.(*ast.FunctionLiteral)
+	infix := fn.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	index := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IndexExpression)
+	call := index.Left.(*ast.CallExpression)
+
+	tests := []struct {
+		node     ast.Node
+		expected ast.Pos
+	}{
+		{program, ast.Pos{Line: 1, Column: 1, Offset: 0}},
+		{let, ast.Pos{Line: 1, Column: 1, Offset: 0}},
+		{let.Name, ast.Pos{Line: 1, Column: 5, Offset: 4}},
+		{fn, ast.Pos{Line: 1, Column: 11, Offset: 10}},
+		{fn.Parameters[1], ast.Pos{Line: 1, Column: 17, Offset: 16}},
+		{fn.Body, ast.Pos{Line: 1, Column: 20, Offset: 19}},
+		{infix, ast.Pos{Line: 2, Column: 5, Offset: 25}},
+		{infix.Left, ast.Pos{Line: 2, Column: 3, Offset: 23}},
+		{call, ast.Pos{Line: 4, Column: 4, Offset: 35}},
+		{call.Function, ast.Pos{Line: 4, Column: 1, Offset: 32}},
+		{call.Arguments[1], ast.Pos{Line: 4, Column: 8, Offset: 39}},
+		{index, ast.Pos{Line: 4, Column: 10, Offset: 41}},
+	}
+
+	for i, tt := range tests {
+		if got := tt.node.Position(); got != tt.expected {
+			t.Errorf("tests[%d] - position of %q wrong. expected=%#v, got=%#v", i, tt.node.String(), tt.expected, got)
+		}
+	}
+}
+
+// 離れた箇所にある複数のエラーがまとめて報告され、正しい文はパースされることをテスト
+func TestMultipleParseErrors(t *testing.T) {
+	input := `
+let = 5;
+let x 10;
+let y = 3;
+return );
+let z = fn(a b) { a };
+puts(y);
+`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	expected := []string{
+		"[line 2, col 5] expected next token to be IDENT, got = instead",
+		"[line 3, col 7] expected next token to be =, got INT instead",
+		"[line 5, col 8] no prefix parse function for ) found",
+		"[line 6, col 14] expected next token to be ), got IDENT instead",
+	}
+	errors := p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. want=%d, got=%d: %q", len(expected), len(errors), errors)
+	}
+	for i, want := range expected {
+		if errors[i].Error() != want {
+			t.Errorf("errors[%d] wrong. want=%q, got=%q", i, want, errors[i])
+		}
+	}
+	if errors[2].Message != "no prefix parse function for ) found" || errors[2].Line != 5 || errors[2].Column != 8 {
+		t.Errorf("errors[2] has wrong fields. got=%+v", errors[2])
+	}
+
+	// エラーの起きた文は捨てられ、それ以外の文は残る
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	if !testLetStatement(t, program.Statements[0], "y") {
+		return
+	}
+	if got := program.Statements[1].String(); got != "puts(y)" {
+		t.Errorf("program.Statements[1] wrong. got=%q", got)
+	}
+}
@@ -0,0 +1,191 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"unicode"
+)
+
+// 行エディタが解釈するキー入力
+const (
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlH     = 8
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// 入力済みの行の履歴
+// 上下の矢印キーで履歴を辿る際の現在位置も保持する
+type history struct {
+	lines []string
+	pos   int    // 表示中の履歴の位置。len(lines)なら履歴を辿っていない
+	draft string // 履歴を辿り始める前に入力していた行
+}
+
+// 行を履歴に追加し、辿っている位置を最新に戻す
+// 空行と直前と同じ行は追加しない
+func (h *history) add(line string) {
+	if line != "" && (len(h.lines) == 0 || h.lines[len(h.lines)-1] != line) {
+		h.lines = append(h.lines, line)
+	}
+	h.pos = len(h.lines)
+	h.draft = ""
+}
+
+// 一つ前の履歴を返す
+// 履歴を辿り始めるときは、入力中の行currentを後で戻れるように覚えておく
+func (h *history) prev(current string) (string, bool) {
+	if h.pos == 0 {
+		return "", false
+	}
+	if h.pos == len(h.lines) {
+		h.draft = current
+	}
+	h.pos--
+	return h.lines[h.pos], true
+}
+
+// 一つ後の履歴を返す
+// 最新の履歴より後は、履歴を辿り始める前に入力していた行を返す
+func (h *history) next() (string, bool) {
+	if h.pos >= len(h.lines) {
+		return "", false
+	}
+	h.pos++
+	if h.pos == len(h.lines) {
+		return h.draft, true
+	}
+	return h.lines[h.pos], true
+}
+
+// 編集中の行とカーソル位置
+type lineBuffer struct {
+	runes  []rune
+	cursor int
+}
+
+// カーソル位置に文字を挿入する
+func (b *lineBuffer) insert(r rune) {
+	b.runes = append(b.runes, 0)
+	copy(b.runes[b.cursor+1:], b.runes[b.cursor:])
+	b.runes[b.cursor] = r
+	b.cursor++
+}
+
+// カーソルの直前の文字を削除する
+func (b *lineBuffer) backspace() {
+	if b.cursor == 0 {
+		return
+	}
+	b.runes = append(b.runes[:b.cursor-1], b.runes[b.cursor:]...)
+	b.cursor--
+}
+
+func (b *lineBuffer) left() {
+	if b.cursor > 0 {
+		b.cursor--
+	}
+}
+
+func (b *lineBuffer) right() {
+	if b.cursor < len(b.runes) {
+		b.cursor++
+	}
+}
+
+// 行の内容を置き換え、カーソルを行末に置く
+func (b *lineBuffer) set(line string) {
+	b.runes = []rune(line)
+	b.cursor = len(b.runes)
+}
+
+func (b *lineBuffer) String() string { return string(b.runes) }
+
+// 端末を生の(raw)モードにした状態で使う最小限の行エディタ
+// 左右の矢印キーによるカーソル移動、バックスペース、上下の矢印キーによる履歴の呼び出しができる
+// 画面の制御にはカーソルを動かす程度のANSIエスケープシーケンスしか使わない
+type lineEditor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history history
+}
+
+func newLineEditor(in io.Reader, out io.Writer) *lineEditor {
+	return &lineEditor{in: bufio.NewReader(in), out: out}
+}
+
+// プロンプトを表示して一行読み込む
+// Enterで確定した行は履歴に追加する
+// 空行でCtrl-Dが押されるか入力が終わるとio.EOFを返す
+// Ctrl-Cは入力中の行を捨てて新しい行の入力を始める
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	var buf lineBuffer
+	io.WriteString(e.out, prompt)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			io.WriteString(e.out, "\r\n")
+			line := buf.String()
+			e.history.add(line)
+			return line, nil
+		case keyCtrlC:
+			io.WriteString(e.out, "^C\r\n")
+			buf.set("")
+			e.history.add("")
+		case keyCtrlD:
+			if len(buf.runes) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+		case keyBackspace, keyCtrlH:
+			buf.backspace()
+		case keyEscape:
+			e.readEscapeSequence(&buf)
+		default:
+			if unicode.IsPrint(r) {
+				buf.insert(r)
+			}
+		}
+		e.refresh(prompt, &buf)
+	}
+}
+
+// 矢印キーのエスケープシーケンス(ESC [ A〜D)を読んで処理する
+// それ以外のシーケンスは無視する
+func (e *lineEditor) readEscapeSequence(buf *lineBuffer) {
+	if r, _, err := e.in.ReadRune(); err != nil || r != '[' {
+		return
+	}
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return
+	}
+	switch r {
+	case 'A':
+		if line, ok := e.history.prev(buf.String()); ok {
+			buf.set(line)
+		}
+	case 'B':
+		if line, ok := e.history.next(); ok {
+			buf.set(line)
+		}
+	case 'C':
+		buf.right()
+	case 'D':
+		buf.left()
+	}
+}
+
+// 行を再描画してカーソルを編集位置に移動する
+func (e *lineEditor) refresh(prompt string, buf *lineBuffer) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, buf.String())
+	if n := len(buf.runes) - buf.cursor; n > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", n)
+	}
+}
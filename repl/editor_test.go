@@ -0,0 +1,137 @@
+package repl
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// 上下の矢印キーで辿る履歴の位置の移動をテスト
+func TestHistoryNavigation(t *testing.T) {
+	var h history
+	if _, ok := h.prev("typing"); ok {
+		t.Fatalf("prev succeeded on empty history")
+	}
+
+	h.add("let a = 1")
+	h.add("")
+	h.add("a + 1")
+	h.add("a + 1")
+	if len(h.lines) != 2 {
+		t.Fatalf("empty or repeated lines added to history. got=%q", h.lines)
+	}
+
+	steps := []struct {
+		up       bool
+		expected string
+		ok       bool
+	}{
+		{true, "a + 1", true},
+		{true, "let a = 1", true},
+		{true, "", false}, // 最も古い履歴より前には戻らない
+		{false, "a + 1", true},
+		{false, "typing", true}, // 履歴を辿り始める前に入力していた行に戻る
+		{false, "", false},
+		{true, "a + 1", true},
+	}
+	for i, step := range steps {
+		var line string
+		var ok bool
+		if step.up {
+			line, ok = h.prev("typing")
+		} else {
+			line, ok = h.next()
+		}
+		if ok != step.ok || (ok && line != step.expected) {
+			t.Errorf("step %d: want=(%q, %t), got=(%q, %t)", i, step.expected, step.ok, line, ok)
+		}
+	}
+
+	// 行を追加すると辿っている位置は最新に戻る
+	h.add("b")
+	if line, _ := h.prev(""); line != "b" {
+		t.Errorf("history position not reset after add. got=%q", line)
+	}
+}
+
+// 編集中の行に対するカーソル移動と文字の挿入・削除をテスト
+func TestLineBuffer(t *testing.T) {
+	var b lineBuffer
+	for _, r := range "let x" {
+		b.insert(r)
+	}
+	b.left()
+	b.left()
+	b.insert('!')
+	if b.String() != "let! x" || b.cursor != 4 {
+		t.Errorf("insert in the middle wrong. got=%q, cursor=%d", b.String(), b.cursor)
+	}
+	b.backspace()
+	b.backspace()
+	if b.String() != "le x" || b.cursor != 2 {
+		t.Errorf("backspace wrong. got=%q, cursor=%d", b.String(), b.cursor)
+	}
+	for i := 0; i < 10; i++ {
+		b.left()
+	}
+	b.backspace()
+	if b.cursor != 0 || b.String() != "le x" {
+		t.Errorf("cursor moved past the start. got=%q, cursor=%d", b.String(), b.cursor)
+	}
+	for i := 0; i < 10; i++ {
+		b.right()
+	}
+	if b.cursor != 4 {
+		t.Errorf("cursor moved past the end. cursor=%d", b.cursor)
+	}
+	b.set("日本語")
+	if b.cursor != 3 {
+		t.Errorf("cursor not at the end of the line after set. cursor=%d", b.cursor)
+	}
+}
+
+// キー入力のバイト列から行エディタが読み込む行をテスト
+func TestLineEditorReadLine(t *testing.T) {
+	const (
+		up    = "\x1b[A"
+		down  = "\x1b[B"
+		right = "\x1b[C"
+		left  = "\x1b[D"
+	)
+	input := "let a = 1\r" +
+		"a + 2\r" +
+		up + up + "\r" + // 二つ前の行を呼び出す
+		"x" + up + down + "y\r" + // 履歴を辿っても入力中の行に戻れる
+		"ac" + left + "b" + right + "d\r" + // カーソル位置に挿入する
+		"abc\x7f\x7fz\r" + // バックスペース
+		"junk\x03ok\r" + // Ctrl-Cで入力中の行を捨てる
+		"\x04"
+
+	editor := newLineEditor(strings.NewReader(input), io.Discard)
+	expected := []string{"let a = 1", "a + 2", "let a = 1", "xy", "abcd", "az", "ok"}
+	for i, want := range expected {
+		line, err := editor.readLine(PROMPT)
+		if err != nil {
+			t.Fatalf("line %d: unexpected error %v", i, err)
+		}
+		if line != want {
+			t.Errorf("line %d: want=%q, got=%q", i, want, line)
+		}
+	}
+	if _, err := editor.readLine(PROMPT); err != io.EOF {
+		t.Errorf("Ctrl-D on an empty line did not return io.EOF. got=%v", err)
+	}
+}
+
+// 行エディタは入出力が端末でなければ使われず、これまで通り一行ずつ読み込むことをテスト
+func TestLineEditorFallsBackWhenNotTerminal(t *testing.T) {
+	in := strings.NewReader("1 + 2\n")
+	var out bytes.Buffer
+	StartWithOptions(in, &out, Options{Quiet: true, LineEditor: true})
+
+	expected := PROMPT + "3\n" + PROMPT
+	if got := out.String(); got != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, got)
+	}
+}
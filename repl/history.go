@@ -0,0 +1,78 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// REPLに入力して実行できた入力の履歴
+// .historyで一覧を表示し、!Nで N 番目(1始まり)の入力をもう一度実行する
+type inputHistory struct {
+	entries []string
+	path    string // 空でなければ履歴をこのファイルに保存する
+}
+
+// pathに保存された履歴を読み込む
+// pathが空ならファイルを使わない。ファイルがなかったり読めない行があったりしても、読めた分だけで始める
+func loadInputHistory(path string) *inputHistory {
+	h := &inputHistory{path: path}
+	if path == "" {
+		return h
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+	defer f.Close()
+
+	// 複数行の入力も一行に収まるように、各行はGoの文字列リテラルとして保存してある
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if entry, err := strconv.Unquote(scanner.Text()); err == nil {
+			h.entries = append(h.entries, entry)
+		}
+	}
+	return h
+}
+
+// 入力を履歴に追加し、ファイルにも追記する
+// ファイルに書き込めなくてもREPLは続けられるので、エラーは無視する
+func (h *inputHistory) add(input string) {
+	h.entries = append(h.entries, input)
+	if h.path == "" {
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, strconv.Quote(input))
+}
+
+// 履歴を番号付きで出力する
+func (h *inputHistory) print(out io.Writer) {
+	for i, entry := range h.entries {
+		fmt.Fprintf(out, "%d: %s\n", i+1, entry)
+	}
+}
+
+// 「!N」の形の入力を、履歴のN番目の入力に置き換える
+// それ以外の入力はそのまま返す
+func (h *inputHistory) expand(input string) (string, error) {
+	if !strings.HasPrefix(input, "!") {
+		return input, nil
+	}
+	n, err := strconv.Atoi(input[1:])
+	if err != nil {
+		return "", fmt.Errorf("invalid history reference: %s", input)
+	}
+	if n < 1 || len(h.entries) < n {
+		return "", fmt.Errorf("no history entry: %s", input)
+	}
+	return h.entries[n-1], nil
+}
@@ -4,17 +4,28 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"monkey/ast"
 	"monkey/compiler"
+	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	// "monkey/object"
 	"monkey/parser"
+	"monkey/token"
 	"monkey/vm"
 )
 
 const PROMPT = ">> "
 
+// 括弧が閉じていない入力の続きを読むときのプロンプト
+const CONTINUATION_PROMPT = ".. "
+
 const MONKEY = `    ___
 　 彡_＿ ＼_　 n
 　 (・・) ○) ((
@@ -28,92 +39,517 @@ const MONKEY = `    ___
 
 `
 
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	// env := object.NewEnvironment()
-	constants := []object.Object{}
-	globals := make([]object.Object, vm.GlobalsSize)
-	symbolTable := compiler.NewSymbolTable()
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
+// REPLの挙動を切り替えるオプション
+type Options struct {
+	Quiet bool // trueならエラー時のMONKEYバナーを出力しない
+	Color bool // trueならエラーメッセージをANSIカラーで出力する（出力先がTTYでなければ無効）
+
+	// trueなら矢印キーでカーソル移動や履歴の呼び出しができる行エディタで入力を読む
+	// 入出力がTTYでない場合や端末を生の(raw)モードにできない場合は無効
+	LineEditor bool
+
+	// 空でなければ、実行できた入力をこのファイルに保存し、次に起動したときに読み込む
+	HistoryFile string
+
+	// importや.loadのファイルが現在のディレクトリに見つからなかったときに、順に探すディレクトリ
+	ModulePath []string
+}
+
+// エラーメッセージの色付けに使うANSIエスケープシーケンス
+const (
+	colorRed   = "\x1b[31m"
+	colorReset = "\x1b[0m"
+)
+
+// デフォルトのオプションでREPLを開始する
+func Start(in io.Reader, out io.Writer) int {
+	return StartWithOptions(in, out, Options{})
+}
+
+// オプションを指定してREPLを開始する
+// 入力が終わるか「exit」が入力されると0を、組み込み関数exitが呼ばれるとその終了コードを返す
+func StartWithOptions(in io.Reader, out io.Writer, opts Options) int {
+	if opts.Color && !isTerminal(out) {
+		opts.Color = false
+	}
+	history := loadInputHistory(opts.HistoryFile)
+	readLine := scanLines(in, out)
+	if opts.LineEditor {
+		if edit, ok := editLines(in, out, history.entries); ok {
+			readLine = edit
+		}
 	}
+	s := newSession(out, opts)
 
 	for {
 
-		// プロンプト「>>」の出力
-		fmt.Printf(PROMPT)
+		// プロンプト「>>」を出力して一行入力
+		line, ok := readLine(PROMPT)
+		if !ok {
+			return 0
+		}
+		if line == "exit" {
+			return 0
+		}
 
-		// 入力
-		scanned := scanner.Scan()
-		if !scanned {
-			return
+		// 括弧が閉じるまで「..」を出力して続きの行を読む
+		// 続きの行で空行が入力されたら、それまでの入力を捨てる
+		line, ok = readContinuation(line, readLine)
+		if !ok {
+			continue
 		}
 
-		line := scanner.Text()
-		if line == "exit" {
-			return
+		// .historyで履歴を一覧し、!Nで履歴のN番目の入力を表示してから実行する
+		if line == ".history" {
+			history.print(out)
+			continue
+		}
+		recalled, err := history.expand(line)
+		if err != nil {
+			printError(out, fmt.Sprintf("Woops! %s\n", err), opts)
+			continue
+		}
+		if recalled != line {
+			line = recalled
+			io.WriteString(out, line+"\n")
 		}
 
-		// inputで初期化されたレキサを生成
-		l := lexer.New(line)
+		// .env [prefix]でグローバル変数の一覧を表示する
+		if line == ".env" || strings.HasPrefix(line, ".env ") {
+			s.printEnv(strings.TrimSpace(strings.TrimPrefix(line, ".env")))
+			continue
+		}
 
-		// for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-		// 	fmt.Printf("%+v\n", tok)
-		// }
+		// .mode tree|vmで実行方式を切り替える
+		if line == ".mode" || strings.HasPrefix(line, ".mode ") {
+			s.setMode(strings.TrimSpace(strings.TrimPrefix(line, ".mode")))
+			continue
+		}
 
-		// レキサをセットしたパーサを生成
-		p := parser.New(l)
+		// .time on|offで実行時間の表示を切り替える
+		if line == ".time" || strings.HasPrefix(line, ".time ") {
+			s.setTiming(strings.TrimSpace(strings.TrimPrefix(line, ".time")))
+			continue
+		}
 
-		// プログラムをパース
-		program := p.ParseProgram()
+		// .load <file>でファイルのプログラムを実行する
+		if line == ".load" || strings.HasPrefix(line, ".load ") {
+			if s.load(strings.TrimSpace(strings.TrimPrefix(line, ".load"))) {
+				history.add(line)
+			}
+			if s.exit != nil {
+				return s.exit.Code
+			}
+			continue
+		}
 
-		// パース中のエラーを出力
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		result, ok := s.execute(line)
+		if s.exit != nil {
+			history.add(line)
+			return s.exit.Code
+		}
+		if !ok {
 			continue
 		}
+		history.add(line)
 
-		// io.WriteString(out, program.String())
-		// io.WriteString(out, "\n")
+		// マクロの定義だけの入力のように、値を残す文がなければ何も出力しない
+		if result != nil {
+			io.WriteString(out, result.Inspect())
+			io.WriteString(out, "\n")
+		}
+		if s.timing {
+			fmt.Fprintf(out, "Execution time: %s\n", s.elapsed)
+		}
+	}
+}
 
-		// // パースした結果得られたASTを評価器に通してObjectを得る
-		// evaluated := evaluator.Eval(program, env)
-		//
-		// if evaluated != nil {
-		// 	io.WriteString(out, evaluated.Inspect())
-		// 	io.WriteString(out, "\n")
-		// }
+// REPLの実行方式
+const (
+	modeVM   = "vm"   // コンパイルしてVMで実行する
+	modeTree = "tree" // ASTを評価器で直接評価する
+)
 
-		comp := compiler.NewWithState(symbolTable, constants)
-		err := comp.Compile(program)
-		if err != nil {
-			io.WriteString(out, MONKEY)
-			fmt.Fprintf(out, "Woops! Complation failed:\n\t%s\n", err)
-			continue
+// 入力をまたいで引き継ぐREPLの状態
+// 前の入力で定義したマクロやグローバル変数は以降の入力でも使える
+type session struct {
+	out      io.Writer
+	opts     Options
+	mode     string
+	macroEnv *object.Environment
+
+	// VMで実行するときの状態
+	constants   []object.Object
+	globals     []object.Object
+	symbolTable *compiler.SymbolTable
+
+	// 評価器で評価するときの状態
+	evaluator *evaluator.Evaluator
+	env       *object.Environment
+
+	timing  bool          // trueなら入力を実行するたびに実行時間を出力する
+	elapsed time.Duration // 最後に実行した入力のコンパイルと実行にかかった時間
+
+	exit *object.Exit // 組み込み関数exitが呼ばれたときの終了コード。nilでなければREPLを終える
+}
+
+func newSession(out io.Writer, opts Options) *session {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	// putsの出力もプロンプトと同じ出力先に順序通り書き込む
+	e := evaluator.New()
+	e.SetOutput(out)
+	e.SetSearchPath(opts.ModulePath)
+	return &session{
+		out:         out,
+		opts:        opts,
+		mode:        modeVM,
+		macroEnv:    object.NewEnvironment(),
+		constants:   []object.Object{},
+		globals:     make([]object.Object, vm.GlobalsSize),
+		symbolTable: symbolTable,
+		evaluator:   e,
+		env:         object.NewEnvironment(),
+	}
+}
+
+// inputをパースし、マクロを展開してから現在の実行方式で実行する
+// 最後に評価した式の値を返す。値を残す文がなければnilを返す
+// エラーが起きた場合はoutに出力してfalseを返す
+func (s *session) execute(input string) (object.Object, bool) {
+
+	// inputで初期化されたレキサを生成
+	l := lexer.New(input)
+
+	// for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	// 	fmt.Printf("%+v\n", tok)
+	// }
+
+	// レキサをセットしたパーサを生成
+	p := parser.New(l)
+
+	// プログラムをパース
+	program := p.ParseProgram()
+
+	// パース中のエラーを出力
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, p.Errors(), s.opts)
+		return nil, false
+	}
+
+	// マクロを展開してから評価する
+	// 定義したマクロは以降の入力でも使える
+	evaluator.DefineMacros(program, s.macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, s.macroEnv)
+	if err != nil {
+		printError(s.out, fmt.Sprintf("Woops! Macro expansion failed:\n\t%s\n", err), s.opts)
+		return nil, false
+	}
+
+	// 実行時間にはコンパイルと実行(評価)だけを含める
+	start := time.Now()
+	defer func() { s.elapsed = time.Since(start) }()
+
+	if s.mode == modeTree {
+		return s.evaluate(expanded)
+	}
+	return s.run(expanded.(*ast.Program))
+}
+
+// programをパースした結果得られたASTを評価器に通してObjectを得る
+func (s *session) evaluate(program ast.Node) (object.Object, bool) {
+	evaluated := s.evaluator.Eval(program, s.env)
+	if exit, ok := evaluated.(*object.Exit); ok {
+		s.exit = exit
+		return nil, false
+	}
+	if errObj, ok := evaluated.(*object.Error); ok {
+		printError(s.out, fmt.Sprintf("Woops! Evaluation failed:\n\t%s\n", errObj.Message), s.opts)
+		return nil, false
+	}
+	return evaluated, true
+}
+
+// programをコンパイルしてVMで実行する
+func (s *session) run(program *ast.Program) (object.Object, bool) {
+	// 実行されることのない分岐を取り除いてからコンパイルする
+	comp := compiler.NewWithState(s.symbolTable, s.constants)
+	err := comp.Compile(compiler.EliminateDeadCode(program))
+	if err != nil {
+		printError(s.out, fmt.Sprintf("Woops! Complation failed:\n\t%s\n", err), s.opts)
+		return nil, false
+	}
+
+	code := comp.Bytecode()
+	s.constants = code.Constants
+
+	machine := vm.NewWithGlobalsStore(code, s.globals)
+	machine.SetOutput(s.out) // putsの出力もプロンプトと同じ出力先に順序通り書き込む
+	err = machine.Run()
+	if exit, ok := err.(*object.Exit); ok {
+		s.exit = exit
+		return nil, false
+	}
+	if err != nil {
+		printError(s.out, fmt.Sprintf("Woops! Executing bytecode failed:\n\t%s\n", err), s.opts)
+		return nil, false
+	}
+	return machine.LastPoppedStackElem(), true
+}
+
+// .timeの引数に従って実行時間の表示を切り替える
+// 引数がなければ現在の設定を出力する
+func (s *session) setTiming(arg string) {
+	switch arg {
+	case "on":
+		s.timing = true
+	case "off":
+		s.timing = false
+	case "":
+		if s.timing {
+			io.WriteString(s.out, "timing is on\n")
+		} else {
+			io.WriteString(s.out, "timing is off\n")
 		}
+	default:
+		printError(s.out, "Woops! usage: .time on|off\n", s.opts)
+	}
+}
 
-		code := comp.Bytecode()
-		constants = code.Constants
+// .modeの引数に従って実行方式を切り替える
+// 引数がなければ現在の実行方式を出力する
+// それまでに定義したグローバル変数は、定数であるかどうかも含めて切り替えた後の実行方式に引き継ぐ
+// ただし関数は実行方式ごとに表現が異なり切り替えた後では呼び出せないので、引き継がずに名前を警告として出力する
+func (s *session) setMode(arg string) {
+	var skipped []string
+	switch arg {
+	case "":
+		fmt.Fprintf(s.out, "mode is %s\n", s.mode)
+	case s.mode:
+	case modeTree:
+		for _, symbol := range s.symbolTable.Symbols() {
+			val := s.globals[symbol.Index]
+			if symbol.Scope != compiler.GlobalScope || val == nil {
+				continue
+			}
+			if _, ok := val.(*object.Closure); ok {
+				skipped = append(skipped, symbol.Name)
+				continue
+			}
+			if symbol.Annotation == compiler.ConstScope {
+				s.env.SetConst(symbol.Name, val)
+			} else {
+				s.env.Set(symbol.Name, val)
+			}
+		}
+		s.mode = modeTree
+	case modeVM:
+		for name, val := range s.env.All() {
+			if _, ok := val.(*object.Function); ok {
+				skipped = append(skipped, name)
+				continue
+			}
+			symbol, ok := s.symbolTable.Lookup(name)
+			isConst := s.env.IsConst(name)
+			if !ok || symbol.Scope != compiler.GlobalScope || (symbol.Annotation == compiler.ConstScope) != isConst {
+				if isConst {
+					symbol = s.symbolTable.DefineConst(name)
+				} else {
+					symbol = s.symbolTable.Define(name)
+				}
+			}
+			s.globals[symbol.Index] = val
+		}
+		s.mode = modeVM
+	default:
+		printError(s.out, "Woops! usage: .mode tree|vm\n", s.opts)
+	}
 
-		machine := vm.NewWithGlobalsStore(code, globals)
-		err = machine.Run()
-		if err != nil {
-			io.WriteString(out, MONKEY)
-			fmt.Fprintf(out, "Woops! Executing bytecode failed:\n\t%s\n", err)
-			continue
+	if len(skipped) > 0 {
+		sort.Strings(skipped)
+		fmt.Fprintf(s.out, "warning: functions are not carried over to %s mode: %s\n", s.mode, strings.Join(skipped, ", "))
+	}
+}
+
+// 現在の実行方式で定義されているグローバル変数とその値を返す
+func (s *session) bindings() map[string]object.Object {
+	if s.mode == modeTree {
+		return s.env.All()
+	}
+	bindings := map[string]object.Object{}
+	for _, symbol := range s.symbolTable.Symbols() {
+		// 定義した入力の実行に失敗した変数には値がない
+		if symbol.Scope == compiler.GlobalScope && s.globals[symbol.Index] != nil {
+			bindings[symbol.Name] = s.globals[symbol.Index]
+		}
+	}
+	return bindings
+}
+
+// .envで表示する値の最大の文字数
+const maxEnvValueLength = 80
+
+// グローバル変数のうち名前がprefixで始まるものを「name = value」の形で名前順に出力する
+// 長い値は先頭のmaxEnvValueLength文字だけを表示する
+func (s *session) printEnv(prefix string) {
+	bindings := s.bindings()
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(s.out, "%s = %s\n", name, truncate(bindings[name].Inspect(), maxEnvValueLength))
+	}
+}
+
+// sが最大でn文字になるように切り詰める。切り詰めた場合は末尾に「...」を付ける
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "..."
+}
+
+// pathのファイルを読み込んで実行する
+// ファイルはimportと同じく、現在のディレクトリ、ModulePathの各ディレクトリの順に探す
+// ファイルで定義した関数や変数は以降の入力でも使える。最後の値は出力しない
+func (s *session) load(path string) bool {
+	if path == "" {
+		printError(s.out, "Woops! usage: .load <file>\n", s.opts)
+		return false
+	}
+	resolved, err := s.evaluator.ResolveModule(path)
+	if err != nil {
+		printError(s.out, fmt.Sprintf("Woops! Loading file failed:\n\t%s\n", err), s.opts)
+		return false
+	}
+	src, err := os.ReadFile(resolved)
+	if err != nil {
+		printError(s.out, fmt.Sprintf("Woops! Loading file failed:\n\t%s\n", err), s.opts)
+		return false
+	}
+
+	// ファイルの中のimportは、そのファイルがあるディレクトリから探す
+	dir := s.evaluator.Directory()
+	s.evaluator.SetDirectory(filepath.Dir(resolved))
+	defer s.evaluator.SetDirectory(dir)
+	_, ok := s.execute(string(src))
+	return ok
+}
+
+// promptを出力して一行読み込む関数
+// 入力が終わるとfalseを返す
+type lineReader func(prompt string) (string, bool)
+
+// inputの括弧が閉じるまで続きの行を読み、改行でつないだ入力全体を返す
+// 続きの行で空行が入力されるか入力が終わった場合はfalseを返す
+func readContinuation(input string, readLine lineReader) (string, bool) {
+	for unclosedBrackets(input) {
+		line, ok := readLine(CONTINUATION_PROMPT)
+		if !ok || line == "" {
+			return "", false
+		}
+		input += "\n" + line
+	}
+	return input, true
+}
+
+// inputに閉じていない括弧「{」「(」「[」があるかを確認する
+// 文字列やコメントの中の括弧を数えないように、レキサでトークンに分けてから数える
+func unclosedBrackets(input string) bool {
+	depth := 0
+	l := lexer.New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LBRACE, token.SET_LBRACE, token.LPAREN, token.LBRACKET:
+			depth++
+		case token.RBRACE, token.RPAREN, token.RBRACKET:
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+// bufio.Scannerで一行ずつ読み込むlineReaderを返す
+func scanLines(in io.Reader, out io.Writer) lineReader {
+	scanner := bufio.NewScanner(in)
+	return func(prompt string) (string, bool) {
+		fmt.Fprint(out, prompt)
+		if !scanner.Scan() {
+			return "", false
 		}
-		stackTop := machine.LastPoppedStackElem()
-		io.WriteString(out, stackTop.Inspect())
-		io.WriteString(out, "\n")
+		return scanner.Text(), true
 	}
 }
 
+// 行エディタで一行ずつ読み込むlineReaderを返す
+// 上下の矢印キーで前回までに保存した一行の入力recalledも呼び出せる
+// 入出力が端末でないか、端末を生の(raw)モードにできなければfalseを返す
+// 評価中の出力やinputによる入力に影響しないように、生のモードにするのは一行読み込む間だけにする
+func editLines(in io.Reader, out io.Writer, recalled []string) (lineReader, bool) {
+	f, ok := in.(*os.File)
+	if !ok || !isTerminal(f) || !isTerminal(out) {
+		return nil, false
+	}
+	restore, err := makeRaw(int(f.Fd()))
+	if err != nil {
+		return nil, false
+	}
+	restore()
+
+	editor := newLineEditor(f, out)
+	for _, line := range recalled {
+		if !strings.Contains(line, "\n") {
+			editor.history.add(line)
+		}
+	}
+	return func(prompt string) (string, bool) {
+		restore, err := makeRaw(int(f.Fd()))
+		if err != nil {
+			return "", false
+		}
+		defer restore()
+		line, err := editor.readLine(prompt)
+		return line, err == nil
+	}, true
+}
+
 // パース中のエラーを出力するヘルパー関数
-func printParserErrors(out io.Writer, errors []string) {
-	io.WriteString(out, MONKEY)
-	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
-	io.WriteString(out, " parser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+func printParserErrors(out io.Writer, errors []parser.ParseError, opts Options) {
+	msg := "Woops! We ran into some monkey business here!\n"
+	msg += " parser errors:\n"
+	for _, e := range errors {
+		msg += "\t" + e.Error() + "\n"
+	}
+	printError(out, msg, opts)
+}
+
+// オプションに従ってバナーと色付けを施しつつエラーメッセージを出力するヘルパー関数
+func printError(out io.Writer, msg string, opts Options) {
+	if !opts.Quiet {
+		io.WriteString(out, MONKEY)
+	}
+	if opts.Color {
+		msg = colorRed + msg + colorReset
+	}
+	io.WriteString(out, msg)
+}
+
+// 出力先が端末であるかを確認するヘルパー関数
+func isTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
 	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
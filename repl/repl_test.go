@@ -0,0 +1,427 @@
+package repl
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Quietオプションを指定するとエラー時にバナーが出力されないことを確認するテスト
+func TestQuietSuppressesBanner(t *testing.T) {
+	tests := []struct {
+		input string
+		quiet bool
+	}{
+		{"let = 5;", true},
+		{"let = 5;", false},
+		{"foobar", true},
+		{"foobar", false},
+	}
+
+	for _, tt := range tests {
+		in := strings.NewReader(tt.input + "\n")
+		var out bytes.Buffer
+		StartWithOptions(in, &out, Options{Quiet: tt.quiet})
+
+		got := out.String()
+		if !strings.Contains(got, "Woops!") {
+			t.Fatalf("error message not found in output. got=%q", got)
+		}
+		if tt.quiet && strings.Contains(got, MONKEY) {
+			t.Errorf("banner printed despite Quiet. got=%q", got)
+		}
+		if !tt.quiet && !strings.Contains(got, MONKEY) {
+			t.Errorf("banner not printed. got=%q", got)
+		}
+	}
+}
+
+// 出力先がTTYでなければColorオプションが無効になることを確認するテスト
+func TestColorDisabledWhenNotTerminal(t *testing.T) {
+	in := strings.NewReader("foobar\n")
+	var out bytes.Buffer
+	StartWithOptions(in, &out, Options{Quiet: true, Color: true})
+
+	if strings.Contains(out.String(), colorRed) {
+		t.Errorf("output colored despite non-terminal writer. got=%q", out.String())
+	}
+}
+
+// コンパイルして実行したputsの出力がREPLの出力先に書き込まれることを確認するテスト
+func TestPutsWritesToOutput(t *testing.T) {
+	in := strings.NewReader("puts(\"hi\")\nputs(1, 2)\n")
+	var out bytes.Buffer
+	StartWithOptions(in, &out, Options{Quiet: true})
+
+	expected := PROMPT + "hi\nNull\n" + PROMPT + "1\n2\nNull\n" + PROMPT
+	if got := out.String(); got != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, got)
+	}
+}
+
+// 前の行で定義したマクロが次の行で展開されることを確認するテスト
+func TestMacrosPersistAcrossLines(t *testing.T) {
+	in := strings.NewReader("let plusOne = macro(x) { quote(unquote(x) + 1) };\nplusOne(2)\n")
+	var out bytes.Buffer
+	StartWithOptions(in, &out, Options{Quiet: true})
+
+	expected := PROMPT + PROMPT + "3\n" + PROMPT
+	if got := out.String(); got != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, got)
+	}
+}
+
+// 括弧が閉じるまで続きの行を読んでから評価することを確認するテスト
+func TestREPLMultiLine(t *testing.T) {
+	r, w := io.Pipe()
+	go func() {
+		lines := []string{
+			"let add = fn(a, b) {",
+			"  a + b",
+			"};",
+			"add(1,",
+			"2)",
+			`puts("(", [`,
+			"",
+			"add(3, 4)",
+		}
+		for _, line := range lines {
+			io.WriteString(w, line+"\n")
+		}
+		w.Close()
+	}()
+
+	var out bytes.Buffer
+	StartWithOptions(r, &out, Options{Quiet: true})
+
+	// 空行で中断した入力は評価しない
+	got := out.String()
+	if !strings.HasPrefix(got, PROMPT+CONTINUATION_PROMPT+CONTINUATION_PROMPT+"Closure[") {
+		t.Fatalf("function definition not read across lines. got=%q", got)
+	}
+	got = got[strings.Index(got, "\n")+1:]
+	expected := PROMPT + CONTINUATION_PROMPT + "3\n" +
+		PROMPT + CONTINUATION_PROMPT +
+		PROMPT + "7\n" + PROMPT
+	if got != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", expected, got)
+	}
+}
+
+// 文字列やコメントの中の括弧は数えないことを確認するテスト
+func TestUnclosedBrackets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 + 2", false},
+		{"fn(x) {", true},
+		{"fn(x) { x }", false},
+		{"[1, (2, #{3", true},
+		{"[1, (2, #{3})]", false},
+		{`"{"`, false},
+		{"1 // {", false},
+		{"}", false},
+	}
+
+	for _, tt := range tests {
+		if got := unclosedBrackets(tt.input); got != tt.expected {
+			t.Errorf("unclosedBrackets(%q) wrong. want=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// !Nで履歴のN番目の入力をもう一度実行し、.historyで履歴を一覧できることを確認するテスト
+func TestREPLHistory(t *testing.T) {
+	input := strings.Join([]string{
+		"puts(1)",
+		"foobar",
+		"2 * 3",
+		"!1",
+		"!9",
+		"!x",
+		".history",
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader(input), &out, Options{Quiet: true})
+
+	// エラーになった入力は履歴に追加しない。!Nで実行した入力は展開した内容で追加する
+	expected := PROMPT + "1\nNull\n" +
+		PROMPT + "Woops! Complation failed:\n\tundefined variable foobar\n" +
+		PROMPT + "6\n" +
+		PROMPT + "puts(1)\n1\nNull\n" +
+		PROMPT + "Woops! no history entry: !9\n" +
+		PROMPT + "Woops! invalid history reference: !x\n" +
+		PROMPT + "1: puts(1)\n2: 2 * 3\n3: puts(1)\n" +
+		PROMPT
+	if got := out.String(); got != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", expected, got)
+	}
+}
+
+// HistoryFileを指定すると履歴が保存され、次に起動したときに使えることを確認するテスト
+func TestREPLHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	opts := Options{Quiet: true, HistoryFile: path}
+
+	StartWithOptions(strings.NewReader("len([\n  1, 2\n])\n3 + 4\n"), io.Discard, opts)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("history file not written: %s", err)
+	}
+
+	// 複数行の入力も一つの履歴として読み込まれる
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader("!1\n!2\n"), &out, opts)
+	expected := PROMPT + "len([\n  1, 2\n])\n2\n" +
+		PROMPT + "3 + 4\n7\n" + PROMPT
+	if got := out.String(); got != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", expected, got)
+	}
+}
+
+// .loadで読み込んだファイルで定義した関数が以降の入力で呼び出せることを確認するテスト
+func TestREPLLoad(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.mk")
+	if err := os.WriteFile(lib, []byte("let double = fn(x) {\n  x * 2\n};\nlet ten = 10;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(dir, "broken.mk")
+	if err := os.WriteFile(broken, []byte("let f = fn() { undefinedName };\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	input := strings.Join([]string{
+		".load " + lib,
+		"double(ten)",
+		".load lib.mk", // 相対パス
+		"double(4)",
+		".load lib", // 拡張子の省略
+		"double(5)",
+		".load missing.mk",
+		".load broken.mk",
+		".load",
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader(input), &out, Options{Quiet: true})
+
+	expected := PROMPT +
+		PROMPT + "20\n" +
+		PROMPT +
+		PROMPT + "8\n" +
+		PROMPT +
+		PROMPT + "10\n" +
+		PROMPT + "Woops! Loading file failed:\n\tmodule \"missing.mk\" not found\n" +
+		PROMPT + "Woops! Complation failed:\n\tundefined variable undefinedName\n" +
+		PROMPT + "Woops! usage: .load <file>\n" +
+		PROMPT
+	if got := out.String(); got != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", expected, got)
+	}
+}
+
+// .envでグローバル変数の一覧が表示されることを確認するテスト
+func TestREPLEnvCommand(t *testing.T) {
+	input := strings.Join([]string{
+		"let x = 1",
+		`let name = "monkey"`,
+		"let nums = [1, 2, 3]",
+		"let long = \"" + strings.Repeat("a", 100) + "\"",
+		"let f = fn(a) { let inner = a; inner }",
+		"let foobar = undefinedName",
+		".env",
+		".env n",
+		".env zzz",
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader(input), &out, Options{Quiet: true})
+
+	prompts := strings.Split(out.String(), PROMPT)
+	if len(prompts) != 11 {
+		t.Fatalf("wrong number of prompts. got=%q", out.String())
+	}
+
+	// 関数の中の変数や、実行に失敗した入力で定義した変数は表示しない
+	env := prompts[7]
+	for _, want := range []string{"x = 1\n", "name = monkey\n", "nums = [1, 2, 3]\n", "f = Closure["} {
+		if !strings.Contains(env, want) {
+			t.Errorf(".env output lacks %q. got=%q", want, env)
+		}
+	}
+	for _, unwanted := range []string{"inner", "foobar", "len"} {
+		if strings.Contains(env, unwanted) {
+			t.Errorf(".env output contains %q. got=%q", unwanted, env)
+		}
+	}
+	if want := "long = " + strings.Repeat("a", 80) + "...\n"; !strings.Contains(env, want) {
+		t.Errorf("long value not truncated. got=%q", env)
+	}
+	if strings.Index(env, "f = ") > strings.Index(env, "x = ") {
+		t.Errorf(".env output not sorted by name. got=%q", env)
+	}
+
+	if want := "name = monkey\nnums = [1, 2, 3]\n"; prompts[8] != want {
+		t.Errorf("wrong output of .env with prefix. want=%q, got=%q", want, prompts[8])
+	}
+	if prompts[9] != "" {
+		t.Errorf("output of .env with unmatched prefix not empty. got=%q", prompts[9])
+	}
+}
+
+// .time onで実行時間が出力され、.time offで出力されなくなることを確認するテスト
+func TestREPLTiming(t *testing.T) {
+	input := strings.Join([]string{
+		"1 + 1",
+		".time on",
+		".time",
+		"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)",
+		"foobar",
+		".time off",
+		"2 + 2",
+		".time maybe",
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader(input), &out, Options{Quiet: true})
+
+	prompts := strings.Split(out.String(), PROMPT)
+	if len(prompts) != 10 {
+		t.Fatalf("wrong number of prompts. got=%q", out.String())
+	}
+	if prompts[1] != "2\n" || prompts[7] != "4\n" {
+		t.Errorf("execution time printed while timing is off. got=%q", out.String())
+	}
+	if prompts[3] != "timing is on\n" {
+		t.Errorf("wrong output of .time. got=%q", prompts[3])
+	}
+	if !strings.HasPrefix(prompts[4], "55\nExecution time: ") {
+		t.Errorf("execution time not printed after the result. got=%q", prompts[4])
+	}
+	// 失敗した入力には実行時間を出力しない
+	if strings.Contains(prompts[5], "Execution time:") {
+		t.Errorf("execution time printed for a failed input. got=%q", prompts[5])
+	}
+	if prompts[8] != "Woops! usage: .time on|off\n" {
+		t.Errorf("wrong output of .time with a wrong argument. got=%q", prompts[8])
+	}
+}
+
+// .modeで実行方式を切り替えても、定義したグローバル変数が定数かどうかも含めて引き継がれることを確認するテスト
+// 関数は引き継がれず、その名前が警告として出力される
+func TestREPLModeSwitch(t *testing.T) {
+	input := strings.Join([]string{
+		".mode",
+		".mode tree",
+		".mode",
+		"let x = 40",
+		`const greeting = "hi"`,
+		"let double = fn(n) { n * 2 }",
+		"double(x)",
+		"sort([3, 1, 2])", // 評価器だけの組み込み関数
+		".env",
+		".mode vm",
+		"x + 2",
+		"greeting",
+		`greeting = "bye"`,
+		"let y = x + 1",
+		"let triple = fn(n) { n * 3 }; triple(1)",
+		".mode tree",
+		"y",
+		"triple",
+		"x = 1; x",
+		".mode vm",
+		"x",
+		".mode stack",
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader(input), &out, Options{Quiet: true})
+
+	expected := []string{
+		"",
+		"mode is vm\n",
+		"",
+		"mode is tree\n",
+		"",
+		"",
+		"",
+		"80\n",
+		"[1, 2, 3]\n",
+		"double = fn(n) {\n\n\t(n * 2)\n\n}\ngreeting = hi\nx = 40\n",
+		"warning: functions are not carried over to vm mode: double\n",
+		"42\n",
+		"hi\n",
+		"Woops! Complation failed:\n\tcannot assign to constant greeting\n",
+		"41\n",
+		"3\n",
+		"warning: functions are not carried over to tree mode: triple\n",
+		"41\n",
+		"Woops! Evaluation failed:\n\tline 1: identifier not found: triple\n",
+		"1\n",
+		"warning: functions are not carried over to vm mode: double\n",
+		"1\n",
+		"Woops! usage: .mode tree|vm\n",
+		"",
+	}
+	if got := strings.Split(out.String(), PROMPT); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", expected, got)
+	}
+}
+
+// 評価器・VM・組み込み関数が同じNullを使い、実行方式を切り替えてもnullどうしが等しいことを確認するテスト
+func TestREPLModeSwitchNull(t *testing.T) {
+	input := strings.Join([]string{
+		"let a = null",
+		"let b = first([])",
+		".mode tree",
+		"[a == null, b == null, a == first([]), if (b) { 1 } else { 2 }]",
+		"let c = last([])",
+		".mode vm",
+		"[c == null, c == first([]), a == b]",
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader(input), &out, Options{Quiet: true})
+
+	expected := []string{
+		"",
+		"Null\n",
+		"Null\n",
+		"",
+		"[true, true, true, 2]\n",
+		"",
+		"",
+		"[true, true, true]\n",
+		"",
+	}
+	if got := strings.Split(out.String(), PROMPT); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", expected, got)
+	}
+}
+
+// 組み込み関数exitが呼ばれるとREPLを終え、その終了コードを返すことをテスト
+func TestREPLExit(t *testing.T) {
+	tests := []struct {
+		input    string
+		code     int
+		expected string
+	}{
+		{"puts(1)\nexit(3)\nputs(2)\n", 3, PROMPT + "1\nNull\n" + PROMPT},
+		{".mode tree\nlet f = fn() { exit(4) }\nf()\nputs(2)\n", 4, PROMPT + PROMPT + PROMPT},
+		{"1\nexit\nexit(5)\n", 0, PROMPT + "1\n" + PROMPT},
+		{"1\n", 0, PROMPT + "1\n" + PROMPT},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		code := StartWithOptions(strings.NewReader(tt.input), &out, Options{Quiet: true})
+		if code != tt.code {
+			t.Errorf("wrong exit code for %q. want=%d, got=%d", tt.input, tt.code, code)
+		}
+		if got := out.String(); got != tt.expected {
+			t.Errorf("wrong output for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
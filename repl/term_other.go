@@ -0,0 +1,10 @@
+//go:build !linux
+
+package repl
+
+import "errors"
+
+// Linux以外では生の(raw)モードに対応していないので、常に行単位の入力にフォールバックさせる
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
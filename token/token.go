@@ -1,18 +1,34 @@
 package token
 
+import "fmt"
+
 type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Pos // トークンの先頭の文字の位置
+}
+
+// ソースコード上の位置
+type Pos struct {
+	Line   int // 1から始まる行番号
+	Column int // 1から始まる列番号(バイト単位)
+	Offset int // 入力の先頭から数えたバイト単位のオフセット
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT" // 「//」から行末までのコメント
 
 	// 識別子 + リテラル
 	IDENT  = "IDENT" // add, result, x, y, etc.
 	INT    = "INT"   // 12, 34, ...
+	FLOAT  = "FLOAT" // 1.5, 0.25, ...
 	STRING = "STRING"
 
 	// 演算子
@@ -22,17 +38,26 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
 
-	LT = "<" // Less Than
-	GT = ">" // Greater Than
+	LT    = "<"  // Less Than
+	GT    = ">"  // Greater Than
+	LT_EQ = "<=" // Less Than or Equal
+	GT_EQ = ">=" // Greater Than or Equal
 
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	AND = "&&"
+	OR  = "||"
+
 	// デリミタ
 	COMMA     = ","
 	COLON     = ":"
 	SEMICOLON = ";"
+	ELLIPSIS  = "..."
+	DOT       = "."
+	QUESTION  = "?"
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -41,25 +66,68 @@ const (
 	LBRACKET = "["
 	RBRACKET = "]"
 
+	SET_LBRACE = "#{" // 集合リテラルの開き括弧
+
 	// キーワード
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
+	NULL     = "NULL"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	FOR      = "FOR"
+	WHILE    = "WHILE"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	SWITCH   = "SWITCH"
+	CASE     = "CASE"
+	DEFAULT  = "DEFAULT"
+	MACRO    = "MACRO"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	DEFER    = "DEFER"
+	IMPORT   = "IMPORT"
 )
 
 // ユーザー定義の識別子と言語のキーワードを区別する機能
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"const":    CONST,
+	"true":     TRUE,
+	"false":    FALSE,
+	"null":     NULL,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"for":      FOR,
+	"while":    WHILE,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"switch":   SWITCH,
+	"case":     CASE,
+	"macro":    MACRO,
+	"default":  DEFAULT,
+	"try":      TRY,
+	"catch":    CATCH,
+	"defer":    DEFER,
+	"import":   IMPORT,
+}
+
+// 組み込み先のプログラムが独自のキーワードを追加するための関数
+// 登録したwordはLookupIdentでttとして識別されるようになる
+// パーサにそのトークンを解析する関数を登録するにはparser.Parser.RegisterPrefixなどを使う
+func RegisterKeyword(word string, tt TokenType) {
+	keywords[word] = tt
+}
+
+// RegisterKeywordで追加したキーワードを取り除く
+// 取り除いたwordはLookupIdentで再び識別子として識別される
+func UnregisterKeyword(word string) {
+	delete(keywords, word)
 }
 
 // 渡された識別子とされるものがキーワードではないかを確認する
@@ -1,12 +1,18 @@
 package vm
 
 import (
+	"fmt"
 	"monkey/code"
 	"monkey/object"
+	"strings"
 )
 
 const MaxFrame = 1024
 
+// MaxCallDepth is how deeply function calls may nest. Going deeper is reported as "call stack overflow"
+// instead of running out of frames.
+const MaxCallDepth = 512
+
 // Frame is a data structure that holds execution-relevant information, like the instructions and the instruction pointer.
 // In compiler or interpreter literature, this data structure is also called activation record.
 type Frame struct {
@@ -23,3 +29,47 @@ func NewFrame(cl *object.Closure, basePointer int) *Frame {
 func (f *Frame) Instructions() code.Instructions {
 	return f.cl.Fn.Instructions
 }
+
+// StackTrace returns the frames that were active when Run last returned an error, one per line with the most recent call last.
+// Each frame shows the name of its function and the offset of the instruction it was executing.
+// The bytecode doesn't keep source positions, so they aren't shown. It returns "" if the last run succeeded.
+func (vm *VM) StackTrace() string {
+	if len(vm.lastFrames) == 0 {
+		return ""
+	}
+	var out strings.Builder
+	out.WriteString("stack trace (most recent call last):")
+	for i, f := range vm.lastFrames {
+		name := f.cl.Fn.Name
+		switch {
+		case i == 0:
+			name = "<main>"
+		case name == "":
+			name = "<anonymous>"
+		}
+		start, def := f.currentInstruction()
+		fmt.Fprintf(&out, "\n  %s at %04d %s", name, start, def)
+	}
+	return out.String()
+}
+
+// currentInstruction returns the offset and the name of the instruction that ip is in.
+// ip points either at the opcode or at the last operand byte read so far.
+func (f *Frame) currentInstruction() (int, string) {
+	ins := f.Instructions()
+	for start := 0; start < len(ins); {
+		def, err := code.Lookup(ins[start])
+		if err != nil {
+			break
+		}
+		width := 1
+		for _, w := range def.OperandWidth {
+			width += w
+		}
+		if f.ip < start+width {
+			return start, def.Name
+		}
+		start += width
+	}
+	return f.ip, "?"
+}
@@ -2,6 +2,8 @@ package vm
 
 import (
 	"fmt"
+	"io"
+	"math"
 	"monkey/code"
 	"monkey/compiler"
 	"monkey/object"
@@ -19,11 +21,14 @@ type VM struct {
 	globals    []object.Object // stores global variables
 	frames     []*Frame
 	frameIndex int
+	out        io.Writer // is where builtins like puts write their output. nil means os.Stdout.
+	lastFrames []Frame   // is a snapshot of the active frames, outermost first, taken when Run last failed.
+	callDepth  int       // is the number of function calls that haven't returned yet.
 }
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
-var Null = &object.Null{}
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
 
 // New returns a pointer to the VM which is initialized with compiler.Bytecode.
 func New(bytecode *compiler.Bytecode) *VM {
@@ -49,6 +54,34 @@ func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
 	return vm
 }
 
+// SetOutput makes builtins like puts write their output to w instead of os.Stdout.
+func (vm *VM) SetOutput(w io.Writer) {
+	vm.out = w
+}
+
+// ResetForReuse prepares the VM to run another compiled program, reusing its stack, globals and frames
+// instead of allocating new ones. The stack and the globals are cleared, so nothing is carried over from the previous run.
+func (vm *VM) ResetForReuse(bytecode *compiler.Bytecode) {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainClosure := &object.Closure{Fn: mainFn}
+	vm.frames[0] = NewFrame(mainClosure, 0)
+	for i := 1; i < len(vm.frames); i++ {
+		vm.frames[i] = nil
+	}
+	vm.frameIndex = 1
+	vm.lastFrames = nil
+	vm.callDepth = 0
+
+	vm.constants = bytecode.Constants
+	for i := range vm.stack {
+		vm.stack[i] = nil
+	}
+	vm.sp = 0
+	for i := range vm.globals {
+		vm.globals[i] = nil
+	}
+}
+
 // func (vm *VM) StackTop() object.Object {
 // 	if vm.sp == 0 {
 // 		return nil
@@ -60,12 +93,37 @@ func (vm *VM) LastPoppedStackElem() object.Object {
 	return vm.stack[vm.sp]
 }
 
+// Run executes the bytecode. When it fails, the frames active at that moment are kept for StackTrace.
+// When the program calls exit(), it stops there and Run returns the *object.Exit holding the exit code.
 func (vm *VM) Run() error {
+	return vm.RunWithLimit(math.MaxInt)
+}
+
+// RunWithLimit is like Run, but gives up with an error once it has executed maxSteps instructions,
+// so that untrusted code can't run forever.
+func (vm *VM) RunWithLimit(maxSteps int) error {
+	vm.lastFrames = nil
+	err := vm.run(maxSteps)
+	if err != nil {
+		vm.lastFrames = make([]Frame, vm.frameIndex)
+		for i := range vm.lastFrames {
+			vm.lastFrames[i] = *vm.frames[i]
+		}
+	}
+	return err
+}
+
+func (vm *VM) run(maxSteps int) error {
 	var ip int // ip stands for instruction pointer
 	var ins code.Instructions
 	var op code.Opcode
+	steps := 0
 	// fetch-decode-execute cycle.
 	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		if steps >= maxSteps {
+			return fmt.Errorf("execution limit exceeded after %d steps", maxSteps)
+		}
+		steps++
 		vm.currentFrame().ip++
 		ip = vm.currentFrame().ip
 		ins = vm.currentFrame().Instructions()
@@ -78,8 +136,8 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
-			err := vm.executeBinaryOperation(op) // delegate executeBinaryOperation to execute +, -, *, /.
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod:
+			err := vm.executeBinaryOperation(op) // delegate executeBinaryOperation to execute +, -, *, /, %.
 			if err != nil {
 				return err
 			}
@@ -95,8 +153,8 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
-			err := vm.executeComparison(op) // delegate executeComparison to execute ==, !=, >.
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual, code.OpLessThan, code.OpLessThanOrEqual:
+			err := vm.executeComparison(op) // delegate executeComparison to execute ==, !=, >, >=, <, <=.
 			if err != nil {
 				return err
 			}
@@ -128,8 +186,11 @@ func (vm *VM) Run() error {
 		case code.OpGetBuiltin:
 			builtinIndex := code.ReadUint8(ins[ip+1:]) // decode index of builtin function object
 			vm.currentFrame().ip += 1
-			definition := object.Builtins[builtinIndex] // search builtin function object
-			err := vm.push(definition.Builtin)          // load builtin function object onto the stack
+			builtin := object.GetBuiltinByIndex(int(builtinIndex)) // search builtin function object
+			if builtin == nil {
+				return fmt.Errorf("undefined builtin function: %d", builtinIndex)
+			}
+			err := vm.push(builtin) // load builtin function object onto the stack
 			if err != nil {
 				return err
 			}
@@ -186,6 +247,28 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpSet:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			set, unusable := object.NewSet(vm.stack[vm.sp-numElements : vm.sp])
+			if unusable != nil {
+				return fmt.Errorf("unusable as set element: %s", unusable.Type())
+			}
+			vm.sp = vm.sp - numElements
+			err := vm.push(set)
+			if err != nil {
+				return err
+			}
+		case code.OpTuple:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp = vm.sp - numElements
+			err := vm.push(&object.Tuple{Elements: elements})
+			if err != nil {
+				return err
+			}
 		case code.OpIndex:
 			index := vm.pop()
 			left := vm.pop()
@@ -193,6 +276,26 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpSlice:
+			flags := code.ReadUint8(ins[ip+1:]) // decode which bounds were given
+			vm.currentFrame().ip += 1
+			high := vm.pop()
+			low := vm.pop()
+			left := vm.pop()
+			err := vm.executeSliceExpression(left, low, high, int(flags))
+			if err != nil {
+				return err
+			}
+		case code.OpSpread:
+			operand := vm.pop()
+			array, ok := operand.(*object.Array)
+			if !ok {
+				return fmt.Errorf("spread operator requires ARRAY, got %s", operand.Type())
+			}
+			err := vm.push(&spread{array: array})
+			if err != nil {
+				return err
+			}
 		case code.OpCall:
 			numArgs := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
@@ -201,15 +304,26 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpReturnValue:
-			returnValue := vm.pop()
-			frame := vm.popFrame()
-			vm.sp = frame.basePointer - 1
-			err := vm.push(returnValue)
+			err := vm.returnValue(vm.pop())
+			if err != nil {
+				return err
+			}
+		case code.OpPropagateError:
+			errObj, ok := vm.stack[vm.sp-1].(*object.Error)
+			if !ok {
+				break
+			}
+			// there is no function to return from at the top level, so the error stops the program.
+			if vm.frameIndex == 1 {
+				return fmt.Errorf("%s", errObj.Message)
+			}
+			err := vm.returnValue(vm.pop())
 			if err != nil {
 				return err
 			}
 		case code.OpReturn:
 			frame := vm.popFrame()
+			vm.callDepth--
 			vm.sp = frame.basePointer - 1
 			err := vm.push(Null)
 			if err != nil {
@@ -236,6 +350,8 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	switch {
 	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
 		return vm.executeBinaryIntegerOperation(op, left, right)
+	case isNumber(left) && isNumber(right): // an integer operand is promoted to float.
+		return vm.executeBinaryFloatOperation(op, toFloat(left), toFloat(right))
 	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
 		return vm.executeBinaryStringOperation(op, left, right)
 	default:
@@ -255,13 +371,53 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 	case code.OpMul:
 		result = leftValue * rightValue
 	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
 		result = leftValue / rightValue
+	case code.OpMod:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		result = leftValue % rightValue
 	default:
 		return fmt.Errorf("unknown operator: %d", op)
 	}
 	return vm.push(&object.Integer{Value: result})
 }
 
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, leftValue, rightValue float64) error {
+	var result float64
+	switch op {
+	case code.OpAdd:
+		result = leftValue + rightValue
+	case code.OpSub:
+		result = leftValue - rightValue
+	case code.OpMul:
+		result = leftValue * rightValue
+	case code.OpDiv:
+		result = leftValue / rightValue
+	case code.OpMod:
+		result = math.Mod(leftValue, rightValue) // like float division, a zero divisor doesn't fail but gives NaN.
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+	return vm.push(&object.Float{Value: result})
+}
+
+func isNumber(obj object.Object) bool {
+	t := obj.Type()
+	return t == object.INTEGER_OBJ || t == object.FLOAT_OBJ
+}
+
+// toFloat converts an integer or a float to float64.
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
 func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
 	if op != code.OpAdd {
 		return fmt.Errorf("unknown string operator: %d", op)
@@ -290,6 +446,14 @@ func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.frameIndex-1]
 }
 
+// returnValue returns from the current function, replacing the called closure on the stack with value.
+func (vm *VM) returnValue(value object.Object) error {
+	frame := vm.popFrame()
+	vm.callDepth--
+	vm.sp = frame.basePointer - 1
+	return vm.push(value)
+}
+
 func (vm *VM) pushFrame(f *Frame) {
 	vm.frames[vm.frameIndex] = f
 	vm.frameIndex++
@@ -303,14 +467,21 @@ func (vm *VM) popFrame() *Frame {
 func (vm *VM) executeComparison(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
-	if left.Type() == object.INTEGER_OBJ || right.Type() == object.INTEGER_OBJ {
+	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
 		return vm.executeIntegerComparison(op, left, right)
 	}
+	if isNumber(left) && isNumber(right) {
+		return vm.executeFloatComparison(op, toFloat(left), toFloat(right))
+	}
+	if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
+		return vm.executeStringComparison(op, left, right)
+	}
+	// arrays and hashes are compared structurally.
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(right == left))
+		return vm.push(nativeBoolToBooleanObject(object.Equals(left, right)))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(right != left))
+		return vm.push(nativeBoolToBooleanObject(!object.Equals(left, right)))
 	default:
 		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
 	}
@@ -326,6 +497,54 @@ func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object
 		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
 	case code.OpGreaterThan:
 		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+func (vm *VM) executeFloatComparison(op code.Opcode, leftValue, rightValue float64) error {
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+// executeStringComparison compares strings by value in lexicographic order.
+// Strings with the same value are usually distinct objects, so they must not be compared by pointer.
+func (vm *VM) executeStringComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
 	default:
 		return fmt.Errorf("unknown operator: %d", op)
 	}
@@ -354,28 +573,45 @@ func (vm *VM) executeBangOperator() error {
 
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
-	if operand.Type() != object.INTEGER_OBJ {
+	switch operand := operand.(type) {
+	case *object.Integer:
+		return vm.push(&object.Integer{Value: -operand.Value})
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
 		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
 	}
-	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
 }
 
+// buildArray builds an array out of the elements on the stack, flattening the spread ones.
 func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
-	elements := make([]object.Object, endIndex-startIndex)
+	elements := make([]object.Object, 0, endIndex-startIndex)
 	for i := startIndex; i < endIndex; i++ {
-		elements[i-startIndex] = vm.stack[i]
+		if s, ok := vm.stack[i].(*spread); ok {
+			elements = append(elements, s.array.Elements...)
+			continue
+		}
+		elements = append(elements, vm.stack[i])
 	}
 	return &object.Array{Elements: elements}
 }
 
+// spread wraps an array pushed by OpSpread, so that OpArray spreads its elements.
+// It only lives on the stack between the two instructions.
+type spread struct {
+	array *object.Array
+}
+
+func (s *spread) Type() object.ObjectType { return "SPREAD" }
+func (s *spread) Inspect() string         { return "..." + s.array.Inspect() }
+
 func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
 	hashedPairs := make(map[object.HashKey]object.HashPair)
 	for i := startIndex; i < endIndex; i += 2 {
 		key := vm.stack[i]
 		value := vm.stack[i+1]
 		pair := object.HashPair{Key: key, Value: value}
-		hashKey, ok := key.(object.Hashable)
+		hashKey, ok := object.AsHashable(key)
 		if !ok {
 			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
 		}
@@ -388,6 +624,10 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.TUPLE_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeElementIndex(left.(*object.Tuple).Elements, index.(*object.Integer).Value)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return vm.executeHashIndex(left, index)
 	default:
@@ -398,16 +638,98 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 func (vm *VM) executeArrayIndex(array, index object.Object) error {
 	arrayObject := array.(*object.Array)
 	i := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
+	return vm.executeElementIndex(arrayObject.Elements, i)
+}
+
+// executeElementIndex pushes the element of an array or a tuple at i, or Null if it's out of range.
+func (vm *VM) executeElementIndex(elements []object.Object, i int64) error {
+	max := int64(len(elements) - 1)
+	if i < 0 { // negative indices count from the end.
+		i = int64(len(elements)) + i
+	}
 	if i < 0 || i > max {
 		return vm.push(Null)
 	}
-	return vm.push(arrayObject.Elements[i])
+	return vm.push(elements[i])
+}
+
+// executeStringIndex pushes the character of a string at i as a one-character string, or Null if it's out of range.
+// Like slicing, strings are indexed by code point and negative indices count from the end.
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	runes := []rune(str.(*object.String).Value)
+	i := index.(*object.Integer).Value
+	if i < 0 {
+		i = int64(len(runes)) + i
+	}
+	if i < 0 || i >= int64(len(runes)) {
+		return vm.push(Null)
+	}
+	return vm.push(&object.String{Value: string(runes[i])})
+}
+
+func (vm *VM) executeSliceExpression(left, low, high object.Object, flags int) error {
+	// strings are sliced by code point, the same way len counts them.
+	var length int64
+	var runes []rune
+	switch left := left.(type) {
+	case *object.Array:
+		length = int64(len(left.Elements))
+	case *object.String:
+		runes = []rune(left.Value)
+		length = int64(len(runes))
+	default:
+		return fmt.Errorf("slice operator not supported: %s", left.Type())
+	}
+
+	lo, err := sliceBound(low, flags&code.SliceLow != 0, 0)
+	if err != nil {
+		return err
+	}
+	hi, err := sliceBound(high, flags&code.SliceHigh != 0, length)
+	if err != nil {
+		return err
+	}
+	if lo > hi {
+		return fmt.Errorf("slice bounds out of range: low=%d > high=%d", lo, hi)
+	}
+	lo, hi = clampIndex(lo, length), clampIndex(hi, length)
+
+	switch left := left.(type) {
+	case *object.Array:
+		elements := make([]object.Object, hi-lo)
+		copy(elements, left.Elements[lo:hi])
+		return vm.push(&object.Array{Elements: elements})
+	default:
+		return vm.push(&object.String{Value: string(runes[lo:hi])})
+	}
+}
+
+// sliceBound returns the integer value of a slice bound, or defaultValue if the bound was omitted.
+func sliceBound(bound object.Object, given bool, defaultValue int64) (int64, error) {
+	if !given {
+		return defaultValue, nil
+	}
+	integer, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, fmt.Errorf("slice bound must be INTEGER, got %s", bound.Type())
+	}
+	return integer.Value, nil
+}
+
+// clampIndex clamps idx into the range [0, length].
+func clampIndex(idx, length int64) int64 {
+	if idx < 0 {
+		return 0
+	}
+	if idx > length {
+		return length
+	}
+	return idx
 }
 
 func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	hashObject := hash.(*object.Hash)
-	key, ok := index.(object.Hashable) // check whether the given index can be used as an object.HashKey.
+	key, ok := object.AsHashable(index) // check whether the given index can be used as an object.HashKey.
 	if !ok {
 		return fmt.Errorf("unusable as hash key: %s", index.Type())
 	}
@@ -434,6 +756,10 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 	if numArgs != cl.Fn.NumParameters {
 		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
 	}
+	vm.callDepth++
+	if vm.callDepth > MaxCallDepth {
+		return fmt.Errorf("call stack overflow")
+	}
 	frame := NewFrame(cl, vm.sp-numArgs)
 	vm.pushFrame(frame)                         // load function on to the stack frame.
 	vm.sp = frame.basePointer + cl.Fn.NumLocals // make "hole" to store local bindings.
@@ -441,9 +767,15 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 }
 
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
-	args := vm.stack[vm.sp-numArgs : vm.sp] // take the arguments from the stack without removing them yet
-	result := builtin.Fn(args...)           // and pass them to the builtin function being called now
-	vm.sp = vm.sp - numArgs - 1             // decrease stack pointer in order to take the arguments and the executed function itself off the stack.
+	args := vm.stack[vm.sp-numArgs : vm.sp]           // take the arguments from the stack without removing them yet
+	result := builtin.CallWithOutput(vm.out, args...) // and pass them to the builtin function being called now
+	vm.sp = vm.sp - numArgs - 1                       // decrease stack pointer in order to take the arguments and the executed function itself off the stack.
+	if exit, ok := result.(*object.Exit); ok {
+		return exit // exit() stops the program. Run returns the *object.Exit so that the caller can pick up the exit code.
+	}
+	if err, ok := result.(*object.Error); ok && err.Halt {
+		return fmt.Errorf("%s", err.Message) // a failed assert stops the program instead of being pushed as a value.
+	}
 	if result != nil {
 		vm.push(result)
 	} else {
@@ -1,12 +1,16 @@
 package vm
 
 import (
+	"bytes"
 	"fmt"
 	"monkey/ast"
+	"monkey/code"
 	"monkey/compiler"
+	"monkey/enginetest"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
 	"testing"
 )
 
@@ -38,6 +42,23 @@ func TestIntegerArithmetic(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5", 1.5},
+		{"1.5 + 2.25", 3.75},
+		{"1 / 2.0", 0.5},
+		{"7 / 2", 3},
+		{"2 * 1.5 - 1", 2.0},
+		{"-2.5", -2.5},
+		{"-(1 - 1.5)", 0.5},
+		{"1.5 > 1", true},
+		{"1 < 1.5", true},
+		{"1 == 1.0", true},
+		{"0.5 != 0.5", false},
+	}
+	runVmTests(t, tests)
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{"true", true},
@@ -59,6 +80,12 @@ func TestBooleanExpressions(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"2.5 >= 2", true},
 		{"!true", false},
 		{"!false", true},
 		{"!5", false},
@@ -70,6 +97,15 @@ func TestBooleanExpressions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+// && and || result in whichever operand decides the result, and skip the right one when the left decides.
+func TestLogicalExpressions(t *testing.T) {
+	runEngineTests(t, enginetest.LogicalExpressions)
+}
+
+func TestDeepEquality(t *testing.T) {
+	runEngineTests(t, enginetest.DeepEquality)
+}
+
 func TestConditionals(t *testing.T) {
 	tests := []vmTestCase{
 		{"if (true) { 10; }", 10},
@@ -86,6 +122,24 @@ func TestConditionals(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+// let inside an if block binds in the enclosing scope (there is no block scope),
+// and a block without a value (empty or ending with a let) evaluates to Null.
+func TestLetInsideIfBlock(t *testing.T) {
+	runEngineTests(t, enginetest.LetInsideIfBlock)
+}
+
+func TestNullLiteral(t *testing.T) {
+	tests := []vmTestCase{
+		{"null", Null},
+		{"null == null", true},
+		{"null != null", false},
+		{"null == 0", false},
+		{"if (false) { 1 } == null", true},
+		{"fn() {}() == null", true},
+	}
+	runVmTests(t, tests)
+}
+
 func TestGlobalLetStatements(t *testing.T) {
 	tests := []vmTestCase{
 		{"let one = 1; one;", 1},
@@ -95,11 +149,81 @@ func TestGlobalLetStatements(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestLetRebinding(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; let x = x + 1; x", 2},
+		{"let f = fn() { let x = 1; let x = x * 10; x }; f()", 10},
+		{"let x = 5; let f = fn() { let x = x + 1; x }; f() + x", 11},
+	}
+	runVmTests(t, tests)
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let [x, y] = [1, 2]; x + y", 3},
+		{"let [x, y] = [1, 2, 3]; y", 2},
+		{"let [x, y, z] = [1, 2]; z", Null},
+		{"let f = fn(a) { let [h, t] = [a, a * 2]; h + t }; f(3)", 9},
+		{"let x = 1; let [x] = [x + 1]; x", 2},
+	}
+	runVmTests(t, tests)
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"const one = 1; one;", 1},
+		{"const one = 1; let f = fn() { const two = 2; one + two }; f()", 3},
+	}
+	runVmTests(t, tests)
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = 1; a = 2; a", 2},
+		{"let a = 1; a = a + 10", 11},
+		{"let a = 1; let b = 2; a = b = 3; a + b", 6},
+		{"let n = 0; let inc = fn() { n = n + 1 }; inc(); inc(); n", 2},
+		{"let f = fn(x) { x = x * 2; x }; f(4)", 8},
+		{"let f = fn() { let a = 1; a = a + 1; a }; f()", 2},
+	}
+	runVmTests(t, tests)
+}
+
+func TestSwitchExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"switch 1 { case 1: 10; case 2: 20; default: 30 }", 10},
+		{"switch 2 { case 1: 10; case 2: 20; default: 30 }", 20},
+		{"switch 3 { case 1: 10; case 2: 20; default: 30 }", 30},
+		{"switch 3 { case 1: 10; case 2: 20 }", Null},
+		{"switch 1 { }", Null},
+		{"switch 1 { case 1: }", Null},
+		{"switch 1 { case 1: let x = 5 }", Null},
+		{"switch 2 { case 1 + 1: 3; case 2: 4 }", 3},
+		{"switch true { case 1 > 2: 1; case 2 > 1: 2 }", 2},
+		{"let f = fn(x) { switch x { case 0: return 100; default: x } 200 }; f(0) + f(1)", 300},
+		{"let f = fn(x, y) { switch x { case 1: switch y { case 1: 11; default: 10 } default: 0 } }; [f(1, 1), f(1, 2), f(2, 1)]", []int{11, 10, 0}},
+		{"let n = 0; let next = fn() { let n = n + 1; n }; switch next() { case 2: 20; case 1: 10 }", 10},
+		{"switch 1 { case 1: let y = 7 }; y", 7},
+	}
+	runVmTests(t, tests)
+}
+
+func TestForStatements(t *testing.T) {
+	runEngineTests(t, enginetest.ForStatements)
+}
+
 func TestStringExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{`"monkey"`, "monkey"},
 		{`"mon" + "key"`, "monkey"},
 		{`"mon" + "key" + " banana"`, "monkey banana"},
+		{`"abc" < "abd"`, true},
+		{`"abc" > "ab"`, true},
+		{`"abc" <= "abc"`, true},
+		{`"ab" >= "abc"`, false},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`let s = "mon"; s + "key" == "monkey"`, true},
 	}
 	runVmTests(t, tests)
 }
@@ -113,6 +237,92 @@ func TestArrayLiterals(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestSpreadElements(t *testing.T) {
+	tests := []vmTestCase{
+		{"[...[1, 2], 3, ...[4, 5]]", []int{1, 2, 3, 4, 5}},
+		{"let rest = [2, 3]; [1, ...rest, 4]", []int{1, 2, 3, 4}},
+		{"[...[]]", []int{}},
+		{"let f = fn(a) { [0, ...a] }; f([1, 2])", []int{0, 1, 2}},
+	}
+	runVmTests(t, tests)
+
+	vm := New(compileBytecode(t, "[...1]"))
+	if err := vm.Run(); err == nil || err.Error() != "spread operator requires ARRAY, got INTEGER" {
+		t.Errorf("wrong VM error. got=%v", err)
+	}
+}
+
+func TestSetLiterals(t *testing.T) {
+	runEngineTests(t, enginetest.Sets)
+}
+
+func TestTuples(t *testing.T) {
+	runEngineTests(t, enginetest.Tuples)
+}
+
+func TestKeysValuesBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.KeysValuesBuiltins)
+}
+
+func TestHasKeyContainsBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.HasKeyContainsBuiltins)
+}
+
+func TestDeleteRemoveBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.DeleteRemoveBuiltins)
+}
+
+func TestTypeBuiltin(t *testing.T) {
+	runEngineTests(t, enginetest.TypeBuiltin)
+
+	// builtins return errors as values in the VM
+	runVmTests(t, []vmTestCase{
+		{`let e = error("boom"); type(e)`, "ERROR"},
+	})
+}
+
+func TestIsErrorBuiltin(t *testing.T) {
+	runEngineTests(t, enginetest.IsErrorBuiltin)
+
+	// an error bound with let is an ordinary value in the VM
+	runVmTests(t, []vmTestCase{
+		{`let e = error("oops"); is_error(e)`, true},
+	})
+}
+
+func TestMathBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.MathBuiltins)
+}
+
+// Errors returned by builtins are values in the VM, so ? is what stops a function at them.
+func TestPropagateErrorExpression(t *testing.T) {
+	runEngineTests(t, enginetest.PropagateErrorExpression)
+
+	runVmTests(t, []vmTestCase{
+		{`let g = fn() { error("oops")?; 1 }; let f = fn() { type(g()) }; f()`, "ERROR"},
+	})
+}
+
+func TestRangeBuiltin(t *testing.T) {
+	runEngineTests(t, enginetest.RangeBuiltin)
+}
+
+func TestTimeAndRandomBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.TimeAndRandomBuiltins)
+}
+
+func TestSequenceBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.SequenceBuiltins)
+}
+
+func TestStrIntBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.StrIntBuiltins)
+}
+
+func TestStringBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.StringBuiltins)
+}
+
 func TestHashLiterals(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -144,7 +354,16 @@ func TestIndexExpressions(t *testing.T) {
 		{"[[1, 1, 1]][0][0]", 1},
 		{"[][0]", Null},
 		{"[1, 2, 3][99]", Null},
-		{"[1][-1]", Null},
+		{"[1][-1]", 1},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][-4]", Null},
+		{`"abc"[0]`, "a"},
+		{`"abc"[-1]`, "c"},
+		{`"abc"[-3]`, "a"},
+		{`"abc"[-4]`, Null},
+		{`"abc"[3]`, Null},
+		{`"日本語"[-2]`, "本"},
 		{"{1: 1, 2: 2}[1]", 1},
 		{"{1: 1, 2: 2}[2]", 2},
 		{"{1: 1}[0]", Null},
@@ -153,6 +372,51 @@ func TestIndexExpressions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestSliceExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3][1:]", []int{2, 3}},
+		{"[1, 2, 3][:2]", []int{1, 2}},
+		{"[1, 2, 3][:]", []int{1, 2, 3}},
+		{"[1, 2, 3][-5:99]", []int{1, 2, 3}},
+		{"[1, 2, 3][3:]", []int{}},
+		{"let a = [1, 2, 3]; let b = a[:]; a == b", true}, // arrays are compared structurally.
+		{`"monkey"[1:4]`, "onk"},
+		{`"monkey"[3:]`, "key"},
+		{`"日本語"[1:]`, "本語"},
+	}
+	runVmTests(t, tests)
+}
+
+func TestSliceExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3][2:1]", "slice bounds out of range: low=2 > high=1"},
+		{`[1, 2, 3]["a":]`, "slice bound must be INTEGER, got STRING"},
+		{"[1, 2][null:]", "slice bound must be INTEGER, got NULL"},
+		{"[1, 2][:null]", "slice bound must be INTEGER, got NULL"},
+		{"5[1:2]", "slice operator not supported: INTEGER"},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
 func TestCallingFunctionsWithoutArguments(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -382,6 +646,18 @@ func TestBuiltinFunctions(t *testing.T) {
 			input:    `len("hello world")`,
 			expected: 11,
 		},
+		{
+			input:    `len("a")`,
+			expected: 1,
+		},
+		{
+			input:    `len("café")`,
+			expected: 4,
+		},
+		{
+			input:    `len("日本語")`,
+			expected: 3,
+		},
 		{
 			input: `len(1)`,
 			expected: &object.Error{
@@ -452,10 +728,95 @@ func TestBuiltinFunctions(t *testing.T) {
 				Message: "argument to `push` must be ARRAY, got INTEGER",
 			},
 		},
+		{
+			input:    `assert(1 + 1 == 2, "addition broken")`,
+			expected: Null,
+		},
+		{
+			input:    `clamp(5, 0, 3)`,
+			expected: 3,
+		},
+		{
+			input:    `clamp(-1, 0, 3)`,
+			expected: 0,
+		},
+		{
+			input:    `between(2, 1, 3)`,
+			expected: true,
+		},
+		{
+			input:    `if (between(4, 1, 3)) { 1 } else { 2 }`,
+			expected: 2,
+		},
+		{
+			input: `error("oops")`,
+			expected: &object.Error{
+				Message: "oops",
+			},
+		},
+		{
+			input: `merge({1: 1, 2: 2}, {2: 3})`,
+			expected: map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey(): 1,
+				(&object.Integer{Value: 2}).HashKey(): 3,
+			},
+		},
+		{
+			input: `merge({1: 1}, 1)`,
+			expected: &object.Error{
+				Message: "argument to `merge` must be HASH, got INTEGER",
+			},
+		},
+		{
+			input:    `transpose([[1, 2, 3], [4, 5, 6]])[1]`,
+			expected: []int{2, 5},
+		},
+		{
+			input: `transpose([[1, 2, 3], [4, 5]])`,
+			expected: &object.Error{
+				Message: "rows of `transpose` must have the same length. row 0 has 3, row 1 has 2",
+			},
+		},
+		{
+			input:    `sum([1, 2, 3]) + avg([1, 2, 4]) + min([3, -1, 2]) + max([3, -1, 2])`,
+			expected: 6 + 2 + -1 + 3,
+		},
+		{
+			input:    `sum([])`,
+			expected: 0,
+		},
+		{
+			input: `avg([])`,
+			expected: &object.Error{
+				Message: "`avg` of empty array",
+			},
+		},
 	}
 	runVmTests(t, tests)
 }
 
+// len is loaded with OpGetBuiltin and called through the VM.
+func TestVMBuiltinLen(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse("len([1, 2, 3])")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	getLen := string(code.Make(code.OpGetBuiltin, object.GetBuiltinIndex("len")))
+	if !strings.Contains(string(bytecode.Instructions), getLen) {
+		t.Fatalf("len is not loaded with OpGetBuiltin. got=\n%s", bytecode.Instructions)
+	}
+
+	vm := New(bytecode)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if err := testIntegerObject(3, vm.LastPoppedStackElem()); err != nil {
+		t.Errorf("testIntegerObject failed: %s", err)
+	}
+}
+
 func TestClosures(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -566,6 +927,9 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 		if err != nil {
 			t.Fatalf("compiler error: %s", err)
 		}
+		if err := comp.Bytecode().Verify(); err != nil {
+			t.Fatalf("invalid bytecode: %s", err)
+		}
 		vm := New(comp.Bytecode())
 		err = vm.Run()
 		if err != nil {
@@ -577,74 +941,143 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 	}
 }
 
-func testExpectedObject(t *testing.T, expected interface{}, actual object.Object) {
+// runEngineTests runs the cases shared with the evaluator.
+// An expected enginetest.Error matches both an error the VM pushed as a value and an error that stopped it.
+func runEngineTests(t *testing.T, tests []enginetest.Case) {
+	t.Helper()
+	for _, tt := range tests {
+		vm := New(compileBytecode(t, tt.Input))
+		if err := vm.Run(); err != nil {
+			if expected, ok := tt.Expected.(enginetest.Error); !ok || err.Error() != string(expected) {
+				t.Errorf("%q: unexpected vm error. want=%v, got=%q", tt.Input, tt.Expected, err)
+			}
+			continue
+		}
+		if !testExpectedObject(t, tt.Expected, vm.LastPoppedStackElem()) {
+			t.Errorf("wrong result for %q", tt.Input)
+		}
+	}
+}
+
+func testExpectedObject(t *testing.T, expected interface{}, actual object.Object) bool {
 	t.Helper()
 	switch expected := expected.(type) {
 	case int:
 		err := testIntegerObject(int64(expected), actual)
 		if err != nil {
 			t.Errorf("testIntegerObject failed: %s", err)
+			return false
+		}
+	case float64:
+		result, ok := actual.(*object.Float)
+		if !ok {
+			t.Errorf("object is not Float. got=%T (%+v)", actual, actual)
+			return false
+		}
+		if result.Value != expected {
+			t.Errorf("object has wrong value. got=%v, want=%v", result.Value, expected)
+			return false
 		}
 	case bool:
 		err := testBooleanObject(bool(expected), actual)
 		if err != nil {
 			t.Errorf("testBooleanObject failed: %s", err)
+			return false
 		}
 	case string:
 		err := testStringObject(expected, actual)
 		if err != nil {
 			t.Errorf("testStringObject failed: %s", err)
+			return false
 		}
 	case []int:
 		array, ok := actual.(*object.Array)
 		if !ok {
 			t.Errorf("object not Array: %T (%+v)", actual, actual)
-			return
+			return false
 		}
 		if len(array.Elements) != len(expected) {
 			t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
-			return
+			return false
 		}
 		for i, expectedElem := range expected {
 			err := testIntegerObject(int64(expectedElem), array.Elements[i])
 			if err != nil {
 				t.Errorf("testIntegerObject failed: %s", err)
+				return false
+			}
+		}
+	case []string:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return false
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+			return false
+		}
+		for i, expectedElem := range expected {
+			err := testStringObject(expectedElem, array.Elements[i])
+			if err != nil {
+				t.Errorf("testStringObject failed: %s", err)
+				return false
 			}
 		}
 	case map[object.HashKey]int64:
 		hash, ok := actual.(*object.Hash)
 		if !ok {
 			t.Errorf("object is not Hash. got=%T (%+v)", actual, actual)
-			return
+			return false
 		}
 		if len(hash.Pairs) != len(expected) {
 			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d", len(expected), len(hash.Pairs))
-			return
+			return false
 		}
 		for expectedKey, expectedValue := range expected {
 			pair, ok := hash.Pairs[expectedKey]
 			if !ok {
 				t.Errorf("no pair for given key in Pairs")
+				return false
 			}
 			err := testIntegerObject(expectedValue, pair.Value)
 			if err != nil {
 				t.Errorf("testIntgerObject failed: %s", err)
+				return false
 			}
 		}
-	case *object.Null:
+	case nil, *object.Null:
 		if actual != Null {
 			t.Errorf("object is not Null: %T (%+v)", actual, actual)
+			return false
+		}
+	case enginetest.Inspect:
+		if actual.Inspect() != string(expected) {
+			t.Errorf("object has wrong Inspect. want=%s, got=%s", expected, actual.Inspect())
+			return false
+		}
+	case enginetest.Error:
+		errObj, ok := actual.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error: %T (%+v)", actual, actual)
+			return false
+		}
+		if errObj.Message != string(expected) {
+			t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			return false
 		}
 	case *object.Error:
 		errObj, ok := actual.(*object.Error)
 		if !ok {
 			t.Errorf("object is not Error: %T (%+v)", actual, actual)
-			return
+			return false
 		}
 		if errObj.Message != expected.Message {
 			t.Errorf("wrong error message. expected=%q, got=%q", expected.Message, errObj.Message)
+			return false
 		}
 	}
+	return true
 }
 
 func parse(input string) *ast.Program {
@@ -685,3 +1118,308 @@ func testStringObject(expected string, actual object.Object) error {
 	}
 	return nil
 }
+
+func TestResetForReuse(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = 1; let b = 2; a + b", 3},
+		{"let c = fn(x) { x * 10 }; c(5)", 50},
+		{`let d = [1, 2, 3]; len(d[1:])`, 2},
+	}
+
+	var vm *VM
+	for i, tt := range tests {
+		bytecode := compileBytecode(t, tt.input)
+		if vm == nil {
+			vm = New(bytecode)
+		} else {
+			stack, globals := &vm.stack[0], &vm.globals[0]
+			vm.ResetForReuse(bytecode)
+			if &vm.stack[0] != stack || &vm.globals[0] != globals {
+				t.Fatalf("test[%d] - ResetForReuse reallocated the stack or the globals", i)
+			}
+		}
+		if err := vm.Run(); err != nil {
+			t.Fatalf("test[%d] - vm error: %s", i, err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+
+		// the globals of the previous program must not leak into the next one.
+		vm.ResetForReuse(bytecode)
+		for j, g := range vm.globals[:3] {
+			if g != nil {
+				t.Errorf("test[%d] - global %d not cleared: %s", i, j, g.Inspect())
+			}
+		}
+		if err := vm.Run(); err != nil {
+			t.Fatalf("test[%d] - vm error on rerun: %s", i, err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func BenchmarkRunSnippets(b *testing.B) {
+	inputs := []string{
+		"let a = 1; let b = 2; a + b",
+		"let c = fn(x) { x * 10 }; c(5)",
+		`let d = [1, 2, 3]; len(d[1:])`,
+	}
+	bytecodes := []*compiler.Bytecode{}
+	for _, input := range inputs {
+		comp := compiler.New()
+		if err := comp.Compile(parse(input)); err != nil {
+			b.Fatalf("compiler error: %s", err)
+		}
+		bytecodes = append(bytecodes, comp.Bytecode())
+	}
+
+	b.Run("New", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, bytecode := range bytecodes {
+				vm := New(bytecode)
+				if err := vm.Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		}
+	})
+	b.Run("ResetForReuse", func(b *testing.B) {
+		b.ReportAllocs()
+		vm := New(bytecodes[0])
+		for i := 0; i < b.N; i++ {
+			for _, bytecode := range bytecodes {
+				vm.ResetForReuse(bytecode)
+				if err := vm.Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		}
+	})
+}
+
+func compileBytecode(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	if err := comp.Bytecode().Verify(); err != nil {
+		t.Fatalf("invalid bytecode: %s", err)
+	}
+	return comp.Bytecode()
+}
+
+func TestSetOutput(t *testing.T) {
+	var out bytes.Buffer
+	vm := New(compileBytecode(t, `puts("hello", 1); let x = len("abc"); puts(x)`))
+	vm.SetOutput(&out)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if got := out.String(); got != "hello\n1\n3\n" {
+		t.Errorf("wrong output. got=%q", got)
+	}
+}
+
+func TestExitBuiltin(t *testing.T) {
+	for _, tt := range enginetest.ExitBuiltin {
+		var out bytes.Buffer
+		vm := New(compileBytecode(t, tt.Input+`; puts("unreachable")`))
+		vm.SetOutput(&out)
+		exit, ok := vm.Run().(*object.Exit)
+		if !ok {
+			t.Errorf("%q: Run didn't return *object.Exit", tt.Input)
+			continue
+		}
+		if exit.Code != tt.Code {
+			t.Errorf("%q: wrong exit code. want=%d, got=%d", tt.Input, tt.Code, exit.Code)
+		}
+		if out.Len() != 0 {
+			t.Errorf("%q: instructions after exit were executed. output=%q", tt.Input, out.String())
+		}
+	}
+}
+
+// A failed assert stops the program like exit does, instead of being pushed as a value.
+func TestFailedAssertHaltsProgram(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`assert(1 == 2)`, "assertion failed"},
+		{`assert(1 + 1 == 3, "addition broken")`, "assertion failed: addition broken"},
+		{`let f = fn(x) { assert(x > 0, "not positive"); x }; f(-1)`, "assertion failed: not positive"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		vm := New(compileBytecode(t, tt.input+`; puts("after assert")`))
+		vm.SetOutput(&out)
+		err := vm.Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("%q: instructions after the failed assert were executed. output=%q", tt.input, out.String())
+		}
+	}
+}
+
+func TestFormatBuiltins(t *testing.T) {
+	runEngineTests(t, enginetest.FormatBuiltins)
+
+	var out bytes.Buffer
+	vm := New(compileBytecode(t, `let x = 3; printf("x = {}", x); printf(", done")`))
+	vm.SetOutput(&out)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if got := out.String(); got != "x = 3, done" {
+		t.Errorf("wrong output. got=%q", got)
+	}
+}
+
+// The operands of a comparison are evaluated from left to right, like in the evaluator.
+func TestComparisonOperandOrder(t *testing.T) {
+	for _, op := range []string{"<", "<=", ">", ">="} {
+		var out bytes.Buffer
+		vm := New(compileBytecode(t, `let f = fn(x) { puts(x); x }; f(1) `+op+` f(2)`))
+		vm.SetOutput(&out)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		if got := out.String(); got != "1\n2\n" {
+			t.Errorf("%s: operands evaluated in the wrong order. output=%q", op, got)
+		}
+	}
+}
+
+func TestModuloVM(t *testing.T) {
+	tests := []vmTestCase{
+		{"10 % 3", 1},
+		{"9 % 3", 0},
+		{"-7 % 3", -1},
+		{"2 + 10 % 4 * 3", 8},
+		{"7.5 % 2", 1.5},
+		{"-7.5 % 2", -1.5},
+		{"7 % 2.5", 2.0},
+	}
+	runVmTests(t, tests)
+
+	for _, input := range []string{"5 % (2 - 2)", "5 / 0", "let x = 0; 10 / x", "let f = fn(x) { 10 / x }; f(0)"} {
+		vm := New(compileBytecode(t, input))
+		if err := vm.Run(); err == nil || err.Error() != "division by zero" {
+			t.Errorf("%q: wrong VM error. got=%v", input, err)
+		}
+	}
+}
+
+// Running deserialized bytecode gives the same result as running the bytecode it was serialized from.
+func TestRunDeserializedBytecode(t *testing.T) {
+	input := `
+let fibonacci = fn(x) {
+	if (x < 2) { return x; }
+	fibonacci(x - 1) + fibonacci(x - 2)
+};
+let greet = fn(name) { "hello " + name };
+[fibonacci(15), greet("monkey"), 1.5 * 2.0, len([1, 2, 3])]
+`
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	original := comp.Bytecode()
+
+	var buf bytes.Buffer
+	if err := original.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize failed: %s", err)
+	}
+	restored, err := compiler.Deserialize(&buf)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %s", err)
+	}
+
+	var results []string
+	for _, bytecode := range []*compiler.Bytecode{original, restored} {
+		vm := New(bytecode)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		results = append(results, vm.LastPoppedStackElem().Inspect())
+	}
+	if results[0] != results[1] {
+		t.Errorf("results differ. original=%s, deserialized=%s", results[0], results[1])
+	}
+	if expected := "[610, hello monkey, 3.0, 3]"; results[1] != expected {
+		t.Errorf("wrong result. want=%s, got=%s", expected, results[1])
+	}
+}
+
+func TestVMStackTrace(t *testing.T) {
+	input := `
+let inner = fn(x) { x + true };
+let middle = fn(x) { inner(x) + 1 };
+let outer = fn() { fn() { middle(1) }() };
+outer();
+`
+	vm := New(compileBytecode(t, input))
+	err := vm.Run()
+	if err == nil || err.Error() != "unsupported types for binary operation: INTEGER BOOLEAN" {
+		t.Fatalf("expected type error, got=%v", err)
+	}
+
+	expected := []string{
+		"stack trace (most recent call last):",
+		"  <main> at 0024 OpCall",
+		"  outer at 0004 OpCall",
+		"  <anonymous> at 0006 OpCall",
+		"  middle at 0005 OpCall",
+		"  inner at 0003 OpAdd",
+	}
+	if got := vm.StackTrace(); got != strings.Join(expected, "\n") {
+		t.Errorf("wrong stack trace.\nwant=%q\ngot=%q", strings.Join(expected, "\n"), got)
+	}
+
+	// a successful run leaves no stack trace behind.
+	vm.ResetForReuse(compileBytecode(t, "1 + 1"))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if got := vm.StackTrace(); got != "" {
+		t.Errorf("stack trace after a successful run. got=%q", got)
+	}
+}
+
+func TestVMCallStackOverflow(t *testing.T) {
+	vm := New(compileBytecode(t, "let f = fn(n) { f(n + 1) }; f(0)"))
+	err := vm.Run()
+	if err == nil || err.Error() != "call stack overflow" {
+		t.Fatalf("expected call stack overflow, got=%v", err)
+	}
+
+	// calls that have returned don't count toward the limit.
+	runVmTests(t, []vmTestCase{
+		{"let depth = fn(n) { if (n == 0) { 0 } else { depth(n - 1) + 1 } }; depth(500)", 500},
+		{"let f = fn() { 1 }; let sum = fn(n) { if (n == 0) { 0 } else { f() + sum(n - 1) } }; sum(300) + sum(300)", 600},
+	})
+}
+
+func TestVMStepLimit(t *testing.T) {
+	vm := New(compileBytecode(t, "for (let i = 0; true; i = i + 1) {}"))
+	err := vm.RunWithLimit(100)
+	if err == nil || err.Error() != "execution limit exceeded after 100 steps" {
+		t.Fatalf("expected step limit error, got=%v", err)
+	}
+
+	// a program that finishes within the limit runs as usual.
+	vm = New(compileBytecode(t, "1 + 2"))
+	if err := vm.RunWithLimit(4); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 3, vm.LastPoppedStackElem())
+
+	vm = New(compileBytecode(t, "1 + 2"))
+	if err := vm.RunWithLimit(3); err == nil {
+		t.Errorf("expected step limit error for 4 instructions within 3 steps")
+	}
+}